@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"example.com/lab-08/config"
+	"example.com/lab-08/store"
+)
+
+// formatFromPath guesses the catalog format from a file extension
+func formatFromPath(path string) string {
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		return "csv"
+	}
+	return "json"
+}
+
+// runImport handles: import [-dry-run] [-format csv|json] <file>
+func runImport(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	loader := config.Register(fs)
+	dryRun := fs.Bool("dry-run", false, "validate the file and report changes without applying them")
+	format := fs.String("format", "", "input format, csv or json (default: from the file extension)")
+	cfg, err := loadConfig(fs, loader, args)
+	if err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("usage: import [-dry-run] [-format csv|json] <file>")
+	}
+
+	path := fs.Arg(0)
+	if *format == "" {
+		*format = formatFromPath(path)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("error opening import file: %v", err)
+	}
+	defer file.Close()
+
+	rows, err := store.ParseCatalog(file, *format)
+	if err != nil {
+		return err
+	}
+
+	s, err := store.Open(cfg)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	report, err := s.ImportCatalog(context.Background(), rows, *dryRun)
+	if err != nil {
+		return fmt.Errorf("error saving the import, nothing was changed: %v", err)
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(report)
+	fmt.Printf("Created: %d, Updated: %d, Rejected: %d\n", report.Created, report.Updated, report.Rejected)
+
+	// Rejected rows only fail the command when nothing else was applied
+	if report.Rejected > 0 && report.Created+report.Updated == 0 {
+		return fmt.Errorf("all %d rows were rejected", report.Rejected)
+	}
+	return nil
+}
+
+// runExport handles: export [-format csv|json] [-o file]
+func runExport(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	loader := config.Register(fs)
+	format := fs.String("format", "", "output format, csv or json (default: from -o, otherwise json)")
+	output := fs.String("o", "", "file to write to (default: standard output)")
+	cfg, err := loadConfig(fs, loader, args)
+	if err != nil {
+		return err
+	}
+	if *format == "" {
+		*format = formatFromPath(*output)
+	}
+
+	s, err := store.Open(cfg)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			return fmt.Errorf("error creating export file: %v", err)
+		}
+		defer file.Close()
+		w = file
+	}
+
+	switch *format {
+	case "csv":
+		return s.ExportCatalogCSV(w)
+	case "json":
+		return s.ExportCatalogJSON(w)
+	default:
+		return fmt.Errorf("unsupported catalog format %q", *format)
+	}
+}
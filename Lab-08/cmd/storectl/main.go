@@ -0,0 +1,139 @@
+// Command storectl runs the store. Every subcommand opens the same catalog
+// and order storage, so orders placed in the shop show up in the server and
+// in reports.
+//
+//	storectl serve   start the HTTP API and web interface
+//	storectl shop    place orders interactively from the terminal
+//	storectl import  bulk load products from CSV or JSON
+//	storectl export  write the catalog with live stock as CSV or JSON
+//	storectl report  print the sales report for a date range
+//	storectl user    manage staff users and their API keys
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"example.com/lab-08/config"
+	"example.com/lab-08/store"
+)
+
+const usage = `Usage: storectl <command> [flags]
+
+Commands:
+  serve   start the HTTP API and web interface
+  shop    place orders interactively from the terminal
+  import  bulk load products from CSV or JSON
+  export  write the catalog with live stock as CSV or JSON
+  report  print the sales report for a date range
+  user    manage staff users and their API keys
+
+Every command accepts -config <file> (JSON or YAML), the STORECTL_* environment
+variables and -print-config. Run "storectl <command> -h" for the flags of a command.
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	var err error
+	switch command, args := os.Args[1], os.Args[2:]; command {
+	case "serve":
+		err = runServe(args)
+	case "shop":
+		err = runShop(args)
+	case "import":
+		err = runImport(args)
+	case "export":
+		err = runExport(args)
+	case "report":
+		err = runReport(args)
+	case "user":
+		err = runUser(args)
+	case "help", "-h", "--help":
+		fmt.Print(usage)
+		return
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n\n%s", command, usage)
+		os.Exit(2)
+	}
+
+	if errors.Is(err, flag.ErrHelp) || errors.Is(err, errConfigPrinted) {
+		return
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+}
+
+// errConfigPrinted ends a command after -print-config has printed the configuration
+var errConfigPrinted = errors.New("configuration printed")
+
+// loadConfig parses the command's flags and builds the configuration from
+// defaults, the config file, the environment and the flags
+func loadConfig(fs *flag.FlagSet, loader *config.Loader, args []string) (*config.Config, error) {
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	cfg, err := loader.Load()
+	if err != nil {
+		return nil, err
+	}
+	if loader.PrintRequested() {
+		if err := cfg.Print(os.Stdout); err != nil {
+			return nil, err
+		}
+		return nil, errConfigPrinted
+	}
+	return cfg, nil
+}
+
+// runServe handles: serve
+func runServe(args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	cfg, err := loadConfig(fs, config.Register(fs), args)
+	if err != nil {
+		return err
+	}
+
+	s, err := store.Open(cfg)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	logger := store.NewLogger(os.Stderr, cfg.Log)
+	server := &http.Server{
+		Addr:     cfg.Server.Addr,
+		Handler:  s.Routes(cfg.Server.StaticDir),
+		ErrorLog: slog.NewLogLogger(logger.Handler(), slog.LevelError),
+	}
+
+	// Stop cleanly on Ctrl+C so queued orders are finished and saved
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.Server.ShutdownTimeout))
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	logger.Info("server starting", "addr", cfg.Server.Addr, "url", "http://localhost"+cfg.Server.Addr)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	logger.Info("server stopped, finishing queued orders")
+	return nil
+}
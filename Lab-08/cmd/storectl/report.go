@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"example.com/lab-08/config"
+	"example.com/lab-08/store"
+)
+
+// runReport handles: report [-from YYYY-MM-DD] [-to YYYY-MM-DD] [-top 5] [-format json|csv]
+func runReport(args []string) error {
+	fs := flag.NewFlagSet("report", flag.ContinueOnError)
+	loader := config.Register(fs)
+	today := time.Now().Format(store.DateLayout)
+	from := fs.String("from", time.Now().AddDate(0, 0, -29).Format(store.DateLayout), "first day of the report")
+	to := fs.String("to", today, "last day of the report")
+	top := fs.Int("top", 5, "number of top products to list")
+	format := fs.String("format", "json", "output format, json or csv")
+	cfg, err := loadConfig(fs, loader, args)
+	if err != nil {
+		return err
+	}
+
+	fromDate, err := time.ParseInLocation(store.DateLayout, *from, time.Local)
+	if err != nil {
+		return fmt.Errorf("invalid -from date %q, expected YYYY-MM-DD", *from)
+	}
+	toDate, err := time.ParseInLocation(store.DateLayout, *to, time.Local)
+	if err != nil {
+		return fmt.Errorf("invalid -to date %q, expected YYYY-MM-DD", *to)
+	}
+
+	s, err := store.Open(cfg)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	report, err := s.SalesReport(fromDate, toDate, *top)
+	if err != nil {
+		return err
+	}
+
+	switch *format {
+	case "json":
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	case "csv":
+		return report.WriteCSV(csv.NewWriter(os.Stdout))
+	default:
+		return fmt.Errorf("unsupported report format %q", *format)
+	}
+}
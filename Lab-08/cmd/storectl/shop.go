@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"example.com/lab-08/config"
+	"example.com/lab-08/store"
+)
+
+// runShop handles: shop. It runs the interactive ordering flow in the terminal.
+func runShop(args []string) error {
+	fs := flag.NewFlagSet("shop", flag.ContinueOnError)
+	loader := config.Register(fs)
+	cfg, err := loadConfig(fs, loader, args)
+	if err != nil {
+		return err
+	}
+
+	s, err := store.Open(cfg)
+	if err != nil {
+		return err
+	}
+	// Close waits for the workers, so every order is processed before exiting
+	defer s.Close()
+
+	reader := bufio.NewReader(os.Stdin)
+	var orders []*store.Order
+	for {
+		// Display available products
+		s.DisplayProducts()
+
+		productID, err := getValidProductID(reader, s)
+		if err != nil {
+			return err
+		}
+		quantity, err := getValidQuantity(reader)
+		if err != nil {
+			return err
+		}
+
+		product, err := s.GetProduct(productID)
+		if err != nil {
+			return err
+		}
+		order, err := s.CreateOrder(context.Background(), product, quantity)
+		if err != nil {
+			fmt.Println("Error creating order:", err)
+			continue
+		}
+		orders = append(orders, order)
+
+		// Display the order and pay for it, which queues it for processing
+		s.DisplayOrderDetails(order)
+		if err := s.PayOrder(context.Background(), order); err != nil {
+			fmt.Println("Payment failed, the order is pending:", err)
+		}
+
+		fmt.Print("\nDo you want to continue shopping? (y/n): ")
+		response, _ := reader.ReadString('\n')
+		if !strings.EqualFold(strings.TrimSpace(response), "y") {
+			fmt.Println("\nThank you for shopping with us!")
+			s.DisplayAllOrders(orders)
+			return nil
+		}
+	}
+}
+
+// getValidProductID prompts for and validates a product ID (Call by Reference)
+func getValidProductID(reader *bufio.Reader, s *store.Store) (int, error) {
+	for {
+		var productID int
+		fmt.Print("\nEnter Product ID: ")
+
+		input, err := reader.ReadString('\n')
+		if err != nil {
+			return 0, errors.New("input error")
+		}
+		input = strings.TrimSpace(input)
+
+		_, err = fmt.Sscanf(input, "%d", &productID)
+		if err != nil {
+			fmt.Println("Invalid input: please enter a valid number")
+			continue
+		}
+
+		_, err = s.GetProduct(productID)
+		if err != nil {
+			fmt.Println("Invalid product ID: product not found")
+			continue
+		}
+
+		return productID, nil
+	}
+}
+
+// getValidQuantity prompts for and validates quantity input (Call by Value)
+func getValidQuantity(reader *bufio.Reader) (int, error) {
+	for {
+		var quantity int
+		fmt.Print("Enter Quantity: ")
+
+		input, err := reader.ReadString('\n')
+		if err != nil {
+			return 0, errors.New("input error")
+		}
+		input = strings.TrimSpace(input)
+
+		_, err = fmt.Sscanf(input, "%d", &quantity)
+		if err != nil {
+			fmt.Println("Invalid input: please enter a valid number")
+			continue
+		}
+
+		if err := store.ValidateQuantity(quantity); err != nil {
+			fmt.Println(err.Error())
+			continue
+		}
+
+		return quantity, nil
+	}
+}
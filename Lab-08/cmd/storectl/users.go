@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"example.com/lab-08/config"
+	"example.com/lab-08/store"
+)
+
+const userUsage = `usage:
+  user add [-role viewer|inventory_manager|admin] [-password-stdin] <username>
+  user list
+  user key [-name <label>] <username>
+  user revoke <username> <key id>`
+
+// runUser handles: user add|list|key|revoke. Staff accounts are managed
+// here so the first admin can be created before anyone can sign in.
+func runUser(args []string) error {
+	if len(args) == 0 {
+		return errors.New(userUsage)
+	}
+	fs := flag.NewFlagSet("user "+args[0], flag.ContinueOnError)
+	loader := config.Register(fs)
+	var role, name *string
+	var passwordStdin *bool
+	switch args[0] {
+	case "add":
+		role = fs.String("role", string(store.RoleViewer), "role: viewer, inventory_manager or admin")
+		passwordStdin = fs.Bool("password-stdin", false, "read a password for signing in from standard input")
+	case "key":
+		name = fs.String("name", "", "label to tell the key apart from the user's others")
+	case "list", "revoke":
+	default:
+		return errors.New(userUsage)
+	}
+	cfg, err := loadConfig(fs, loader, args[1:])
+	if err != nil {
+		return err
+	}
+
+	s, err := store.Open(cfg)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	switch args[0] {
+	case "add":
+		if fs.NArg() != 1 {
+			return errors.New(userUsage)
+		}
+		var password string
+		if *passwordStdin {
+			line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+			if err != nil && line == "" {
+				return fmt.Errorf("error reading password: %v", err)
+			}
+			password = strings.TrimRight(line, "\r\n")
+		}
+		user, err := s.CreateUser(fs.Arg(0), store.Role(*role), password)
+		if err != nil {
+			return err
+		}
+		key, _, err := s.CreateAPIKey(user.ID, "created with the user")
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Created %s user %q (ID %d)\n", user.Role, user.Username, user.ID)
+		fmt.Printf("API key (shown only once): %s\n", key)
+	case "list":
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tUSERNAME\tROLE\tKEYS")
+		for _, user := range s.Users() {
+			ids := make([]string, len(user.APIKeys))
+			for i, key := range user.APIKeys {
+				ids[i] = key.ID
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", user.ID, user.Username, user.Role, strings.Join(ids, ", "))
+		}
+		return w.Flush()
+	case "key":
+		if fs.NArg() != 1 {
+			return errors.New(userUsage)
+		}
+		user, err := findUser(s, fs.Arg(0))
+		if err != nil {
+			return err
+		}
+		key, apiKey, err := s.CreateAPIKey(user.ID, *name)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("API key %s for %q (shown only once): %s\n", apiKey.ID, user.Username, key)
+	case "revoke":
+		if fs.NArg() != 2 {
+			return errors.New(userUsage)
+		}
+		user, err := findUser(s, fs.Arg(0))
+		if err != nil {
+			return err
+		}
+		if err := s.RevokeAPIKey(user.ID, fs.Arg(1)); err != nil {
+			return err
+		}
+		fmt.Printf("Revoked API key %s of %q\n", fs.Arg(1), user.Username)
+	}
+	return nil
+}
+
+// findUser looks a user up by username
+func findUser(s *store.Store, username string) (*store.User, error) {
+	for _, user := range s.Users() {
+		if strings.EqualFold(user.Username, username) {
+			return user, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %q", store.ErrUserNotFound, username)
+}
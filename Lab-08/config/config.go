@@ -0,0 +1,625 @@
+// Package config loads storectl settings. Each setting starts from a default
+// and can be overridden, in increasing order of precedence, by a JSON or YAML
+// config file, an environment variable and a command-line flag.
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EnvPrefix starts the name of every environment variable read by Load
+const EnvPrefix = "STORECTL_"
+
+// Duration is a time.Duration written as a string such as "30s" in config files
+type Duration time.Duration
+
+// MarshalJSON writes the duration as a string like "30s"
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// UnmarshalJSON accepts a duration string like "30s" or a number of seconds
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var seconds float64
+	if err := json.Unmarshal(data, &seconds); err == nil {
+		*d = Duration(seconds * float64(time.Second))
+		return nil
+	}
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return errors.New("duration must be a string such as \"30s\"")
+	}
+	parsed, err := parseDuration(value)
+	if err != nil {
+		return err
+	}
+	*d = parsed
+	return nil
+}
+
+// parseDuration reads a duration string like "30s" or a plain number of
+// seconds. Config files, environment variables and flags all use it.
+func parseDuration(value string) (Duration, error) {
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+		return Duration(seconds * float64(time.Second)), nil
+	}
+	d, err := time.ParseDuration(value)
+	return Duration(d), err
+}
+
+// ServerConfig holds the HTTP server settings
+type ServerConfig struct {
+	Addr            string   `json:"addr"`
+	StaticDir       string   `json:"staticDir"`
+	ShutdownTimeout Duration `json:"shutdownTimeout"`
+	// CORSOrigins is a comma separated list of origins browsers may call
+	// the API from; "*" allows any origin
+	CORSOrigins  string `json:"corsOrigins"`
+	MaxBodyBytes int    `json:"maxBodyBytes"` // largest request body accepted
+	// ValidateResponses checks responses against the OpenAPI document and
+	// logs a warning for any that do not match
+	ValidateResponses bool `json:"validateResponses"`
+}
+
+// StoreConfig says where the store keeps its catalog, data and media
+type StoreConfig struct {
+	CatalogFile string `json:"catalogFile"`
+	DataDir     string `json:"dataDir"` // empty keeps orders and invoices in memory only
+	MediaDir    string `json:"mediaDir"`
+}
+
+// WorkerConfig sizes the order processing worker pool
+type WorkerConfig struct {
+	Count       int      `json:"count"`       // maximum number of workers
+	QueueSize   int      `json:"queueSize"`   // orders that can wait for a worker
+	IdleTimeout Duration `json:"idleTimeout"` // idle workers above one stop after this; 0 keeps them
+	// ReadyQueuePercent is how full the queue can get before /readyz reports
+	// the store as not ready, so a load balancer sends traffic elsewhere
+	ReadyQueuePercent int `json:"readyQueuePercent"`
+}
+
+// SellerConfig is the seller printed on invoices
+type SellerConfig struct {
+	Name    string `json:"name"`
+	Address string `json:"address"`
+	GSTIN   string `json:"gstin"`
+}
+
+// LogConfig controls the structured log written to stderr
+type LogConfig struct {
+	Level  string `json:"level"`  // debug, info, warn or error
+	Format string `json:"format"` // json or text
+}
+
+// SlogLevel returns the configured level as a slog.Level
+func (c LogConfig) SlogLevel() (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.Level)); err != nil {
+		return level, fmt.Errorf("log.level must be debug, info, warn or error, got %q", c.Level)
+	}
+	return level, nil
+}
+
+// RateLimitConfig limits how fast each client may call the routes listed in
+// Routes. A client is the signed in staff user or customer, or its IP
+// address when it is not signed in.
+type RateLimitConfig struct {
+	Enabled bool `json:"enabled"`
+	// Routes is a comma separated list of "METHOD /pattern requests/unit [burst]"
+	// entries such as "POST /api/orders 30/m 10". The unit is s, m or h and
+	// the burst defaults to the number of requests.
+	Routes string `json:"routes"`
+	// Allowlist is a comma separated list of IP addresses, CIDR ranges and
+	// API keys that are never limited, for internal tools
+	Allowlist  string `json:"allowlist"`
+	TrustProxy bool   `json:"trustProxy"` // take the client IP from X-Forwarded-For
+	// TrustedProxies is a comma separated list of the IP addresses and CIDR
+	// ranges of any further proxies between the clients and the one the
+	// store sees, whose X-Forwarded-For entries are skipped
+	TrustedProxies  string   `json:"trustedProxies"`
+	CleanupInterval Duration `json:"cleanupInterval"` // how often idle clients are forgotten
+}
+
+// Proxies parses TrustedProxies into address ranges, a single address being
+// a range of one
+func (c RateLimitConfig) Proxies() ([]netip.Prefix, error) {
+	var proxies []netip.Prefix
+	for _, entry := range strings.Split(c.TrustedProxies, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if prefix, err := netip.ParsePrefix(entry); err == nil {
+			proxies = append(proxies, prefix.Masked())
+		} else if addr, err := netip.ParseAddr(entry); err == nil {
+			proxies = append(proxies, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+		} else {
+			return nil, fmt.Errorf("rateLimit.trustedProxies: %q is not an IP address or CIDR range", entry)
+		}
+	}
+	return proxies, nil
+}
+
+// RateRule is one parsed entry of RateLimitConfig.Routes
+type RateRule struct {
+	Method   string
+	Pattern  string
+	Rate     string // as written, e.g. "30/m"
+	Requests int
+	Per      time.Duration
+	Burst    int
+}
+
+// rateUnits are the units a rate may be given in
+var rateUnits = map[string]time.Duration{"s": time.Second, "m": time.Minute, "h": time.Hour}
+
+// Rules parses the per-route limits
+func (c RateLimitConfig) Rules() ([]RateRule, error) {
+	var rules []RateRule
+	for _, entry := range strings.Split(c.Routes, ",") {
+		fields := strings.Fields(entry)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) < 3 || len(fields) > 4 || !strings.HasPrefix(fields[1], "/") {
+			return nil, fmt.Errorf("rateLimit.routes: %q should look like \"POST /api/orders 30/m 10\"", strings.TrimSpace(entry))
+		}
+		rule := RateRule{Method: strings.ToUpper(fields[0]), Pattern: fields[1], Rate: fields[2]}
+		count, unit, _ := strings.Cut(fields[2], "/")
+		n, err := strconv.Atoi(count)
+		per, ok := rateUnits[unit]
+		if err != nil || n < 1 || !ok {
+			return nil, fmt.Errorf("rateLimit.routes: invalid rate %q for %s %s, expected requests/s, /m or /h", fields[2], rule.Method, rule.Pattern)
+		}
+		rule.Requests, rule.Per, rule.Burst = n, per, n
+		if len(fields) == 4 {
+			if rule.Burst, err = strconv.Atoi(fields[3]); err != nil || rule.Burst < 1 {
+				return nil, fmt.Errorf("rateLimit.routes: invalid burst %q for %s %s", fields[3], rule.Method, rule.Pattern)
+			}
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// AuthConfig controls access to the admin endpoints. Customers browse and
+// order without logging in; staff use an API key or a login session.
+type AuthConfig struct {
+	// Enabled requires staff credentials on stock, product, catalog, report
+	// and admin endpoints. Only turn it off for local development.
+	Enabled         bool     `json:"enabled"`
+	SessionLifetime Duration `json:"sessionLifetime"` // how long a login session lasts
+}
+
+// PaymentsConfig chooses the payment provider that authorizes orders.
+// Only the local mock provider is available so far.
+type PaymentsConfig struct {
+	Provider string `json:"provider"`
+	// MockMode makes the mock provider's authorizations succeed, decline
+	// or time out
+	MockMode string   `json:"mockMode"`
+	Timeout  Duration `json:"timeout"` // how long to wait for the provider
+	// PendingTimeout is how long an unpaid order holds its stock before it
+	// is cancelled
+	PendingTimeout Duration `json:"pendingTimeout"`
+	// WebhookSecret signs the provider's webhooks. Without one the store
+	// generates a secret at startup, which nobody else knows.
+	WebhookSecret string `json:"webhookSecret"`
+}
+
+// PaymentProviders are the providers PaymentsConfig.Provider may name
+var PaymentProviders = []string{"mock"}
+
+// MockModes are the modes PaymentsConfig.MockMode may name
+var MockModes = []string{"succeed", "decline", "timeout"}
+
+// WebhooksConfig controls how store events are delivered to webhook
+// subscriptions
+type WebhooksConfig struct {
+	MaxAttempts int `json:"maxAttempts"` // attempts before a delivery is given up
+	// RetryBackoff is the wait before the first retry; each retry after
+	// that waits twice as long as the one before
+	RetryBackoff      Duration `json:"retryBackoff"`
+	Timeout           Duration `json:"timeout"`           // how long a receiver has to answer
+	LowStockThreshold int      `json:"lowStockThreshold"` // the reorder point of products without their own
+}
+
+// InventoryConfig tunes the reorder report's suggestions
+type InventoryConfig struct {
+	VelocityDays int `json:"velocityDays"` // days of sales the sales velocity is measured over
+	LeadTimeDays int `json:"leadTimeDays"` // supplier lead time for products without their own
+	CoverDays    int `json:"coverDays"`    // days of sales a reorder should last once it arrives
+}
+
+// Config holds every storectl setting
+type Config struct {
+	Server    ServerConfig    `json:"server"`
+	Store     StoreConfig     `json:"store"`
+	Workers   WorkerConfig    `json:"workers"`
+	Seller    SellerConfig    `json:"seller"`
+	Log       LogConfig       `json:"log"`
+	RateLimit RateLimitConfig `json:"rateLimit"`
+	Auth      AuthConfig      `json:"auth"`
+	Payments  PaymentsConfig  `json:"payments"`
+	Webhooks  WebhooksConfig  `json:"webhooks"`
+	Inventory InventoryConfig `json:"inventory"`
+}
+
+// Default returns the settings used when nothing else is configured
+func Default() *Config {
+	return &Config{
+		Server: ServerConfig{
+			Addr:            ":8080",
+			StaticDir:       "static",
+			ShutdownTimeout: Duration(10 * time.Second),
+			CORSOrigins:     "*",
+			MaxBodyBytes:    10 << 20,
+		},
+		Store: StoreConfig{
+			CatalogFile: "products.json",
+			DataDir:     "data",
+			MediaDir:    "media",
+		},
+		Workers: WorkerConfig{
+			Count:       3,
+			QueueSize:   100,
+			IdleTimeout: Duration(30 * time.Second),
+			// Leave a fifth of the queue as headroom for requests in flight
+			ReadyQueuePercent: 80,
+		},
+		Seller: SellerConfig{
+			Name:    "Quick Commerce Store",
+			Address: "12 MG Road, Bengaluru, Karnataka 560001",
+			GSTIN:   "29ABCDE1234F1Z5",
+		},
+		Log: LogConfig{
+			Level:  "info",
+			Format: "json",
+		},
+		RateLimit: RateLimitConfig{
+			Enabled: true,
+			// Enough for a shopper, too slow to empty the stock of a product
+			Routes:          "POST /api/orders 30/m 10, POST /api/checkout 10/m 5, POST /api/auth/login 10/m 5, POST /api/customers/login 10/m 5, POST /api/customers/register 10/m 5",
+			CleanupInterval: Duration(time.Minute),
+		},
+		Auth: AuthConfig{
+			Enabled:         true,
+			SessionLifetime: Duration(12 * time.Hour),
+		},
+		Payments: PaymentsConfig{
+			Provider:       "mock",
+			MockMode:       "succeed",
+			Timeout:        Duration(10 * time.Second),
+			PendingTimeout: Duration(30 * time.Minute),
+		},
+		Webhooks: WebhooksConfig{
+			MaxAttempts:       5,
+			RetryBackoff:      Duration(30 * time.Second),
+			Timeout:           Duration(10 * time.Second),
+			LowStockThreshold: 5,
+		},
+		Inventory: InventoryConfig{
+			VelocityDays: 30,
+			LeadTimeDays: 7,
+			CoverDays:    14,
+		},
+	}
+}
+
+// setting describes one configurable value and the names it goes by
+type setting struct {
+	key   string // path in the config file, e.g. "workers.count"
+	flag  string
+	usage string
+	field func(c *Config) any // pointer to the value: *string, *int, *bool or *Duration
+}
+
+// Env returns the environment variable for the setting, e.g. STORECTL_WORKERS_COUNT
+func (s setting) Env() string {
+	name := strings.NewReplacer(".", "_").Replace(s.key)
+	var b strings.Builder
+	for i, r := range name {
+		// Split camelCase keys such as staticDir into STATIC_DIR
+		if r >= 'A' && r <= 'Z' && i > 0 && name[i-1] != '_' {
+			b.WriteByte('_')
+		}
+		b.WriteRune(r)
+	}
+	return EnvPrefix + strings.ToUpper(b.String())
+}
+
+// settings lists every value that can be set from the environment or a flag
+var settings = []setting{
+	{"server.addr", "addr", "address to listen on", func(c *Config) any { return &c.Server.Addr }},
+	{"server.staticDir", "static", "directory holding the web interface", func(c *Config) any { return &c.Server.StaticDir }},
+	{"server.shutdownTimeout", "shutdown-timeout", "how long to wait for requests to finish on shutdown", func(c *Config) any { return &c.Server.ShutdownTimeout }},
+	{"server.corsOrigins", "cors-origins", "comma separated origins allowed to call the API, or * for any", func(c *Config) any { return &c.Server.CORSOrigins }},
+	{"server.maxBodyBytes", "max-body-bytes", "largest request body accepted, in bytes", func(c *Config) any { return &c.Server.MaxBodyBytes }},
+	{"server.validateResponses", "validate-responses", "log responses that do not match the OpenAPI document", func(c *Config) any { return &c.Server.ValidateResponses }},
+	{"store.catalogFile", "catalog", "seed product catalog file", func(c *Config) any { return &c.Store.CatalogFile }},
+	{"store.dataDir", "data", "directory for orders and invoices", func(c *Config) any { return &c.Store.DataDir }},
+	{"store.mediaDir", "media", "directory for uploaded product images", func(c *Config) any { return &c.Store.MediaDir }},
+	{"workers.count", "workers", "maximum number of order processing workers", func(c *Config) any { return &c.Workers.Count }},
+	{"workers.queueSize", "queue-size", "orders that can wait for a worker", func(c *Config) any { return &c.Workers.QueueSize }},
+	{"workers.idleTimeout", "worker-idle-timeout", "stop extra workers after this long without orders (0 keeps them)", func(c *Config) any { return &c.Workers.IdleTimeout }},
+	{"workers.readyQueuePercent", "ready-queue-percent", "how full the queue can get, in percent, before /readyz reports not ready", func(c *Config) any { return &c.Workers.ReadyQueuePercent }},
+	{"seller.name", "seller-name", "seller name printed on invoices", func(c *Config) any { return &c.Seller.Name }},
+	{"seller.address", "seller-address", "seller address printed on invoices", func(c *Config) any { return &c.Seller.Address }},
+	{"seller.gstin", "seller-gstin", "seller GSTIN printed on invoices", func(c *Config) any { return &c.Seller.GSTIN }},
+	{"log.level", "log-level", "minimum log level: debug, info, warn or error", func(c *Config) any { return &c.Log.Level }},
+	{"log.format", "log-format", "log format: json or text", func(c *Config) any { return &c.Log.Format }},
+	{"rateLimit.enabled", "rate-limit", "limit how fast each client may call the rate limited routes", func(c *Config) any { return &c.RateLimit.Enabled }},
+	{"rateLimit.routes", "rate-limit-routes", "comma separated \"METHOD /pattern requests/unit [burst]\" limits", func(c *Config) any { return &c.RateLimit.Routes }},
+	{"rateLimit.allowlist", "rate-limit-allowlist", "comma separated IPs, CIDR ranges and API keys that are never limited", func(c *Config) any { return &c.RateLimit.Allowlist }},
+	{"rateLimit.trustProxy", "rate-limit-trust-proxy", "take the client IP from X-Forwarded-For", func(c *Config) any { return &c.RateLimit.TrustProxy }},
+	{"rateLimit.trustedProxies", "rate-limit-trusted-proxies", "comma separated IPs and CIDR ranges of further proxies whose X-Forwarded-For entries are skipped", func(c *Config) any { return &c.RateLimit.TrustedProxies }},
+	{"rateLimit.cleanupInterval", "rate-limit-cleanup-interval", "how often idle rate limit clients are forgotten", func(c *Config) any { return &c.RateLimit.CleanupInterval }},
+	{"auth.enabled", "auth", "require staff credentials on admin endpoints", func(c *Config) any { return &c.Auth.Enabled }},
+	{"auth.sessionLifetime", "session-lifetime", "how long a login session lasts", func(c *Config) any { return &c.Auth.SessionLifetime }},
+	{"payments.provider", "payment-provider", "payment provider: mock", func(c *Config) any { return &c.Payments.Provider }},
+	{"payments.mockMode", "payment-mock-mode", "what the mock payment provider does: succeed, decline or timeout", func(c *Config) any { return &c.Payments.MockMode }},
+	{"payments.timeout", "payment-timeout", "how long to wait for the payment provider", func(c *Config) any { return &c.Payments.Timeout }},
+	{"payments.pendingTimeout", "payment-pending-timeout", "how long an unpaid order holds its stock before it is cancelled", func(c *Config) any { return &c.Payments.PendingTimeout }},
+	{"payments.webhookSecret", "payment-webhook-secret", "secret that signs the payment provider's webhooks", func(c *Config) any { return &c.Payments.WebhookSecret }},
+	{"webhooks.maxAttempts", "webhook-max-attempts", "attempts before a webhook delivery is given up", func(c *Config) any { return &c.Webhooks.MaxAttempts }},
+	{"webhooks.retryBackoff", "webhook-retry-backoff", "wait before the first webhook retry, doubling for each retry after it", func(c *Config) any { return &c.Webhooks.RetryBackoff }},
+	{"webhooks.timeout", "webhook-timeout", "how long a webhook receiver has to answer", func(c *Config) any { return &c.Webhooks.Timeout }},
+	{"webhooks.lowStockThreshold", "low-stock-threshold", "reorder point, and stock.low threshold, for products without their own", func(c *Config) any { return &c.Webhooks.LowStockThreshold }},
+	{"inventory.velocityDays", "velocity-days", "days of sales the reorder report measures sales velocity over", func(c *Config) any { return &c.Inventory.VelocityDays }},
+	{"inventory.leadTimeDays", "lead-time-days", "supplier lead time in days for products without their own", func(c *Config) any { return &c.Inventory.LeadTimeDays }},
+	{"inventory.coverDays", "cover-days", "days of sales a suggested reorder should last", func(c *Config) any { return &c.Inventory.CoverDays }},
+}
+
+// set parses value into the setting's field
+func (s setting) set(c *Config, value string) error {
+	switch field := s.field(c).(type) {
+	case *string:
+		*field = value
+	case *int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%s: invalid number %q", s.key, value)
+		}
+		*field = n
+	case *bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%s: invalid boolean %q", s.key, value)
+		}
+		*field = b
+	case *Duration:
+		d, err := parseDuration(value)
+		if err != nil {
+			return fmt.Errorf("%s: invalid duration %q", s.key, value)
+		}
+		*field = d
+	}
+	return nil
+}
+
+// get formats the setting's current value
+func (s setting) get(c *Config) string {
+	switch field := s.field(c).(type) {
+	case *string:
+		return *field
+	case *int:
+		return strconv.Itoa(*field)
+	case *bool:
+		return strconv.FormatBool(*field)
+	case *Duration:
+		return time.Duration(*field).String()
+	}
+	return ""
+}
+
+// Loader registers the configuration flags on a flag set and builds the
+// final configuration once the flags have been parsed
+type Loader struct {
+	fs          *flag.FlagSet
+	flagValues  map[string]*string
+	file        *string
+	printConfig *bool
+}
+
+// Register adds a flag for every setting, plus -config and -print-config, to fs
+func Register(fs *flag.FlagSet) *Loader {
+	defaults := Default()
+	l := &Loader{fs: fs, flagValues: make(map[string]*string)}
+	for _, s := range settings {
+		l.flagValues[s.flag] = fs.String(s.flag, s.get(defaults), fmt.Sprintf("%s (env %s)", s.usage, s.Env()))
+	}
+	l.file = fs.String("config", "", "JSON or YAML config file (env "+EnvPrefix+"CONFIG)")
+	l.printConfig = fs.Bool("print-config", false, "print the effective configuration and exit")
+	return l
+}
+
+// PrintRequested reports whether -print-config was given
+func (l *Loader) PrintRequested() bool {
+	return *l.printConfig
+}
+
+// Load merges defaults, the config file, environment variables and the flags
+// that were set explicitly, then validates the result. It must be called
+// after the flag set has been parsed.
+func (l *Loader) Load() (*Config, error) {
+	cfg := Default()
+
+	path := *l.file
+	if path == "" {
+		path = os.Getenv(EnvPrefix + "CONFIG")
+	}
+	if path != "" {
+		if err := cfg.loadFile(path); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, s := range settings {
+		if value, ok := os.LookupEnv(s.Env()); ok {
+			if err := s.set(cfg, value); err != nil {
+				return nil, fmt.Errorf("%s: %v", s.Env(), err)
+			}
+		}
+	}
+
+	var flagErr error
+	l.fs.Visit(func(f *flag.Flag) {
+		for _, s := range settings {
+			if s.flag == f.Name && flagErr == nil {
+				flagErr = s.set(cfg, *l.flagValues[f.Name])
+			}
+		}
+	})
+	if flagErr != nil {
+		return nil, flagErr
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// loadFile overlays the settings in a JSON or YAML file onto the config.
+// Settings missing from the file keep their current values.
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("error reading config file: %v", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		values, err := parseYAML(string(data))
+		if err != nil {
+			return fmt.Errorf("error parsing config file %s: %v", path, err)
+		}
+		// Round trip through JSON so both formats share the same field names
+		if data, err = json.Marshal(values); err != nil {
+			return fmt.Errorf("error parsing config file %s: %v", path, err)
+		}
+	}
+
+	decoder := json.NewDecoder(strings.NewReader(string(data)))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(c); err != nil {
+		return fmt.Errorf("error parsing config file %s: %v", path, err)
+	}
+	return nil
+}
+
+// Validate checks that the settings make sense together
+func (c *Config) Validate() error {
+	var problems []error
+	if c.Server.Addr == "" {
+		problems = append(problems, errors.New("server.addr is required"))
+	}
+	if c.Server.ShutdownTimeout < 0 {
+		problems = append(problems, errors.New("server.shutdownTimeout cannot be negative"))
+	}
+	if c.Server.MaxBodyBytes < 1 {
+		problems = append(problems, errors.New("server.maxBodyBytes must be at least 1"))
+	}
+	if c.Store.CatalogFile == "" {
+		problems = append(problems, errors.New("store.catalogFile is required"))
+	}
+	if c.Store.MediaDir == "" {
+		problems = append(problems, errors.New("store.mediaDir is required"))
+	}
+	if c.Workers.Count < 1 {
+		problems = append(problems, errors.New("workers.count must be at least 1"))
+	}
+	if c.Workers.QueueSize < 0 {
+		problems = append(problems, errors.New("workers.queueSize cannot be negative"))
+	}
+	if c.Workers.ReadyQueuePercent < 1 || c.Workers.ReadyQueuePercent > 100 {
+		problems = append(problems, errors.New("workers.readyQueuePercent must be between 1 and 100"))
+	}
+	if c.Workers.IdleTimeout < 0 {
+		problems = append(problems, errors.New("workers.idleTimeout cannot be negative"))
+	}
+	if c.Seller.Name == "" {
+		problems = append(problems, errors.New("seller.name is required"))
+	}
+	if _, err := c.Log.SlogLevel(); err != nil {
+		problems = append(problems, err)
+	}
+	if c.Log.Format != "json" && c.Log.Format != "text" {
+		problems = append(problems, fmt.Errorf("log.format must be json or text, got %q", c.Log.Format))
+	}
+	if _, err := c.RateLimit.Rules(); err != nil {
+		problems = append(problems, err)
+	}
+	if _, err := c.RateLimit.Proxies(); err != nil {
+		problems = append(problems, err)
+	}
+	if c.RateLimit.CleanupInterval <= 0 {
+		problems = append(problems, errors.New("rateLimit.cleanupInterval must be positive"))
+	}
+	if c.Auth.SessionLifetime <= 0 {
+		problems = append(problems, errors.New("auth.sessionLifetime must be positive"))
+	}
+	if !slices.Contains(PaymentProviders, c.Payments.Provider) {
+		problems = append(problems, fmt.Errorf("payments.provider must be one of %s, got %q", strings.Join(PaymentProviders, ", "), c.Payments.Provider))
+	}
+	if !slices.Contains(MockModes, c.Payments.MockMode) {
+		problems = append(problems, fmt.Errorf("payments.mockMode must be succeed, decline or timeout, got %q", c.Payments.MockMode))
+	}
+	if c.Payments.Timeout <= 0 {
+		problems = append(problems, errors.New("payments.timeout must be positive"))
+	}
+	if c.Payments.PendingTimeout <= 0 {
+		problems = append(problems, errors.New("payments.pendingTimeout must be positive"))
+	}
+	if c.Webhooks.MaxAttempts < 1 {
+		problems = append(problems, errors.New("webhooks.maxAttempts must be at least 1"))
+	}
+	if c.Webhooks.RetryBackoff <= 0 {
+		problems = append(problems, errors.New("webhooks.retryBackoff must be positive"))
+	}
+	if c.Webhooks.Timeout <= 0 {
+		problems = append(problems, errors.New("webhooks.timeout must be positive"))
+	}
+	if c.Webhooks.LowStockThreshold < 0 {
+		problems = append(problems, errors.New("webhooks.lowStockThreshold cannot be negative"))
+	}
+	if c.Inventory.VelocityDays < 1 {
+		problems = append(problems, errors.New("inventory.velocityDays must be at least 1"))
+	}
+	if c.Inventory.LeadTimeDays < 0 {
+		problems = append(problems, errors.New("inventory.leadTimeDays cannot be negative"))
+	}
+	if c.Inventory.CoverDays < 0 {
+		problems = append(problems, errors.New("inventory.coverDays cannot be negative"))
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid configuration: %w", errors.Join(problems...))
+	}
+	return nil
+}
+
+// Print writes the configuration as indented JSON
+func (c *Config) Print(w io.Writer) error {
+	redacted := *c
+	if redacted.Payments.WebhookSecret != "" {
+		redacted.Payments.WebhookSecret = redactedSecret
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(redacted)
+}
+
+// redactedSecret stands in for secrets in the printed configuration
+const redactedSecret = "[redacted]"
@@ -0,0 +1,227 @@
+package config
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// load registers the flags, parses args and loads the configuration
+func load(t *testing.T, args ...string) (*Config, error) {
+	t.Helper()
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	loader := Register(fs)
+	if err := fs.Parse(args); err != nil {
+		t.Fatalf("Failed to parse flags: %v", err)
+	}
+	return loader.Load()
+}
+
+func TestDefaults(t *testing.T) {
+	cfg, err := load(t)
+	if err != nil {
+		t.Fatalf("Expected defaults to be valid, got %v", err)
+	}
+	if cfg.Server.Addr != ":8080" || cfg.Workers.Count != 3 || cfg.Workers.QueueSize != 100 {
+		t.Errorf("Unexpected defaults: %+v", cfg)
+	}
+	if time.Duration(cfg.Workers.IdleTimeout) != 30*time.Second {
+		t.Errorf("Expected 30s idle timeout, got %v", time.Duration(cfg.Workers.IdleTimeout))
+	}
+}
+
+func TestPrecedence(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "storectl.yaml")
+	os.WriteFile(path, []byte(`
+# Settings shared by every environment
+server:
+  addr: ":9000"
+  staticDir: "web"   # served at /static/
+workers:
+  count: 5
+  queueSize: 10
+  idleTimeout: 1m
+seller:
+  name: 'Kirana & Co'
+`), 0o644)
+
+	t.Setenv("STORECTL_CONFIG", path)
+	t.Setenv("STORECTL_WORKERS_COUNT", "7")
+	t.Setenv("STORECTL_SERVER_STATIC_DIR", "public")
+	t.Setenv("STORECTL_LOG_LEVEL", "debug")
+	t.Setenv("STORECTL_SERVER_VALIDATE_RESPONSES", "true")
+
+	cfg, err := load(t, "-workers", "8")
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		got      any
+		expected any
+	}{
+		{"file overrides default", cfg.Server.Addr, ":9000"},
+		{"env overrides file", cfg.Server.StaticDir, "public"},
+		{"flag overrides env", cfg.Workers.Count, 8},
+		{"file value kept", cfg.Workers.QueueSize, 10},
+		{"file duration", time.Duration(cfg.Workers.IdleTimeout), time.Minute},
+		{"quoted string", cfg.Seller.Name, "Kirana & Co"},
+		{"default kept", cfg.Store.CatalogFile, "products.json"},
+		{"env log level", cfg.Log.Level, "debug"},
+		{"env boolean", cfg.Server.ValidateResponses, true},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.expected {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.expected, tt.got)
+		}
+	}
+}
+
+func TestJSONConfigFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "storectl.json")
+	os.WriteFile(path, []byte(`{"store": {"dataDir": "/var/lib/store"}, "workers": {"idleTimeout": "45s"}}`), 0o644)
+
+	cfg, err := load(t, "-config", path)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if cfg.Store.DataDir != "/var/lib/store" || time.Duration(cfg.Workers.IdleTimeout) != 45*time.Second {
+		t.Errorf("Unexpected config: %+v", cfg)
+	}
+
+	os.WriteFile(path, []byte(`{"workers": {"threads": 4}}`), 0o644)
+	if _, err := load(t, "-config", path); err == nil {
+		t.Errorf("Expected error for unknown setting, got nil")
+	}
+}
+
+func TestDurationSeconds(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "storectl.json")
+	os.WriteFile(path, []byte(`{"workers": {"idleTimeout": "90"}, "payments": {"timeout": 5}}`), 0o644)
+	t.Setenv("STORECTL_SERVER_SHUTDOWN_TIMEOUT", "30")
+
+	cfg, err := load(t, "-config", path, "-session-lifetime", "1.5")
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	tests := []struct {
+		name     string
+		got      Duration
+		expected time.Duration
+	}{
+		{"file string", cfg.Workers.IdleTimeout, 90 * time.Second},
+		{"file number", cfg.Payments.Timeout, 5 * time.Second},
+		{"env", cfg.Server.ShutdownTimeout, 30 * time.Second},
+		{"flag", cfg.Auth.SessionLifetime, 1500 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		if time.Duration(tt.got) != tt.expected {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.expected, time.Duration(tt.got))
+		}
+	}
+
+	t.Setenv("STORECTL_SERVER_SHUTDOWN_TIMEOUT", "soon")
+	if _, err := load(t); err == nil || !strings.Contains(err.Error(), "server.shutdownTimeout") {
+		t.Errorf("Expected an invalid duration error, got %v", err)
+	}
+}
+
+func TestValidation(t *testing.T) {
+	t.Setenv("STORECTL_WORKERS_QUEUE_SIZE", "-1")
+	_, err := load(t, "-workers", "0")
+	if err == nil {
+		t.Fatal("Expected validation error, got nil")
+	}
+	for _, expected := range []string{"workers.count", "workers.queueSize"} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("Expected error to mention %s, got %v", expected, err)
+		}
+	}
+
+	t.Setenv("STORECTL_WORKERS_QUEUE_SIZE", "10")
+	if _, err := load(t, "-log-level", "verbose"); err == nil {
+		t.Errorf("Expected error for unknown log level, got nil")
+	}
+	if _, err := load(t, "-worker-idle-timeout", "soon"); err == nil {
+		t.Errorf("Expected error for invalid duration, got nil")
+	}
+	if _, err := load(t, "-session-lifetime", "0s"); err == nil || !strings.Contains(err.Error(), "auth.sessionLifetime") {
+		t.Errorf("Expected error for a zero session lifetime, got %v", err)
+	}
+	if _, err := load(t, "-payment-mock-mode", "flaky"); err == nil || !strings.Contains(err.Error(), "payments.mockMode") {
+		t.Errorf("Expected error for an unknown mock payment mode, got %v", err)
+	}
+	if _, err := load(t, "-webhook-max-attempts", "0"); err == nil || !strings.Contains(err.Error(), "webhooks.maxAttempts") {
+		t.Errorf("Expected error for zero webhook attempts, got %v", err)
+	}
+}
+
+func TestRateLimitRules(t *testing.T) {
+	rules, err := RateLimitConfig{Routes: "post /api/orders 30/m 10, GET /api/products 5/s,"}.Rules()
+	if err != nil {
+		t.Fatalf("Failed to parse rules: %v", err)
+	}
+	expected := []RateRule{
+		{Method: "POST", Pattern: "/api/orders", Rate: "30/m", Requests: 30, Per: time.Minute, Burst: 10},
+		{Method: "GET", Pattern: "/api/products", Rate: "5/s", Requests: 5, Per: time.Second, Burst: 5},
+	}
+	if len(rules) != len(expected) {
+		t.Fatalf("Expected %d rules, got %+v", len(expected), rules)
+	}
+	for i := range expected {
+		if rules[i] != expected[i] {
+			t.Errorf("Rule %d: expected %+v, got %+v", i, expected[i], rules[i])
+		}
+	}
+
+	for _, routes := range []string{"POST /api/orders", "POST /api/orders 30/d", "POST /api/orders 0/m", "POST /api/orders 3/m -1", "/api/orders POST 3/m"} {
+		if _, err := load(t, "-rate-limit-routes", routes); err == nil {
+			t.Errorf("Expected error for %q, got nil", routes)
+		}
+	}
+	if _, err := load(t, "-rate-limit-trusted-proxies", "10.0.0.0/8, proxy.internal"); err == nil || !strings.Contains(err.Error(), "rateLimit.trustedProxies") {
+		t.Errorf("Expected a proxy that is not an address to be refused, got %v", err)
+	}
+}
+
+func TestPrint(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Default().Print(&buf); err != nil {
+		t.Fatalf("Failed to print config: %v", err)
+	}
+	if !strings.Contains(buf.String(), `"idleTimeout": "30s"`) {
+		t.Errorf("Expected readable durations, got:\n%s", buf.String())
+	}
+
+	// Secrets are never printed
+	cfg := Default()
+	cfg.Payments.WebhookSecret = "hunter2"
+	buf.Reset()
+	cfg.Print(&buf)
+	if strings.Contains(buf.String(), "hunter2") || !strings.Contains(buf.String(), `"webhookSecret": "[redacted]"`) {
+		t.Errorf("Expected the webhook secret to be redacted, got:\n%s", buf.String())
+	}
+}
+
+func TestParseYAMLErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+	}{
+		{"list", "workers:\n  - 1\n"},
+		{"bad indent", "server:\n    addr: x\n  static: y\n"},
+		{"duplicate", "server:\n  addr: a\n  addr: b\n"},
+		{"tabs", "server:\n\taddr: a\n"},
+	}
+	for _, tt := range tests {
+		if _, err := parseYAML(tt.text); err == nil {
+			t.Errorf("%s: expected error, got nil", tt.name)
+		}
+	}
+}
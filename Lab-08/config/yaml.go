@@ -0,0 +1,115 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// parseYAML parses the small subset of YAML used by config files: nested
+// mappings of scalars, with # comments. Lists, anchors and multi-line
+// strings are not supported.
+func parseYAML(text string) (map[string]any, error) {
+	type level struct {
+		indent int
+		values map[string]any
+	}
+	root := map[string]any{}
+	stack := []level{{indent: 0, values: root}}
+	// pending is a key with no value yet; the next deeper line starts its mapping
+	var pending map[string]any
+
+	for n, raw := range strings.Split(text, "\n") {
+		line := stripComment(raw)
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if strings.Contains(line, "\t") {
+			return nil, fmt.Errorf("line %d: tabs are not allowed for indentation", n+1)
+		}
+		indent := len(line) - len(strings.TrimLeft(line, " "))
+		line = strings.TrimSpace(line)
+
+		if pending != nil {
+			if indent <= stack[len(stack)-1].indent {
+				return nil, fmt.Errorf("line %d: expected an indented block", n+1)
+			}
+			stack = append(stack, level{indent: indent, values: pending})
+			pending = nil
+		}
+		for indent < stack[len(stack)-1].indent {
+			stack = stack[:len(stack)-1]
+		}
+		current := stack[len(stack)-1]
+		if indent != current.indent {
+			return nil, fmt.Errorf("line %d: unexpected indentation", n+1)
+		}
+
+		key, value, found := strings.Cut(line, ":")
+		if !found || strings.HasPrefix(line, "- ") {
+			return nil, fmt.Errorf("line %d: expected \"key: value\"", n+1)
+		}
+		key = strings.TrimSpace(key)
+		value = strings.TrimSpace(value)
+		if _, exists := current.values[key]; exists {
+			return nil, fmt.Errorf("line %d: duplicate key %q", n+1, key)
+		}
+
+		if value == "" {
+			pending = map[string]any{}
+			current.values[key] = pending
+			continue
+		}
+		scalar, err := parseScalar(value)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", n+1, err)
+		}
+		current.values[key] = scalar
+	}
+	return root, nil
+}
+
+// stripComment removes a trailing # comment that is not inside quotes
+func stripComment(line string) string {
+	var quote rune
+	for i, r := range line {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '#' && (i == 0 || line[i-1] == ' '):
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// parseScalar converts a YAML scalar to a string, number or bool
+func parseScalar(value string) (any, error) {
+	if strings.HasPrefix(value, "\"") {
+		unquoted, err := strconv.Unquote(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid quoted string %s", value)
+		}
+		return unquoted, nil
+	}
+	if strings.HasPrefix(value, "'") {
+		if len(value) < 2 || !strings.HasSuffix(value, "'") {
+			return nil, fmt.Errorf("invalid quoted string %s", value)
+		}
+		return strings.ReplaceAll(value[1:len(value)-1], "''", "'"), nil
+	}
+	switch value {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	}
+	if n, err := strconv.ParseFloat(value, 64); err == nil {
+		return n, nil
+	}
+	return value, nil
+}
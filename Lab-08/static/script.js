@@ -28,6 +28,9 @@ function displayProducts() {
     productGrid.innerHTML = products.map(product => `
         <div class="col">
             <div class="card product-card position-relative">
+                ${product.thumbnail || product.image ? `
+                <img src="${product.thumbnail || product.image}" alt="${product.name}" class="card-img-top product-img" loading="lazy">
+                ` : ''}
                 <span class="badge bg-primary category-badge">${product.category}</span>
                 <span class="badge ${product.stock > 0 ? 'bg-success' : 'bg-danger'} stock-badge">
                     ${product.stock > 0 ? 'In Stock' : 'Out of Stock'}
@@ -35,6 +38,9 @@ function displayProducts() {
                 <div class="card-body d-flex flex-column">
                     <h5 class="card-title">${product.name}</h5>
                     <p class="card-text">₹${product.price.toFixed(2)}</p>
+                    ${product.rating && product.rating.count > 0 ? `
+                    <p class="card-text text-warning">★ ${product.rating.average.toFixed(1)} <small class="text-muted">(${product.rating.count})</small></p>
+                    ` : ''}
                     <p class="card-text">Stock: ${product.stock}</p>
                     <div class="quantity-control mb-3">
                         <button class="btn btn-sm btn-outline-secondary" onclick="event.stopPropagation(); updateCardQuantity(${product.id}, 'decrease')">-</button>
@@ -218,7 +224,7 @@ async function checkout() {
                 }
             }
         } else {
-            const error = await response.text();
+            const error = await errorMessage(response);
             console.error('Checkout error:', error); // Debug log
             alert(`Checkout failed: ${error}`);
         }
@@ -228,6 +234,18 @@ async function checkout() {
     }
 }
 
+// errorMessage reads the message from a JSON error response:
+// {"error": {"code": "...", "message": "...", "details": {...}, "requestId": "..."}}
+async function errorMessage(response) {
+    const text = await response.text();
+    try {
+        const { error } = JSON.parse(text);
+        return error.message;
+    } catch {
+        return text;
+    }
+}
+
 // Initialize the page
 document.addEventListener('DOMContentLoaded', () => {
     fetchProducts();
@@ -328,6 +346,12 @@ async function testGetProduct() {
     </div>`;
 }
 
+// staffHeaders sends the API key entered for the staff-only tests
+function staffHeaders() {
+    const key = document.getElementById('adminApiKey').value.trim();
+    return key ? { 'X-API-Key': key } : {};
+}
+
 async function testUpdateStock() {
     const testOutput = document.getElementById('testOutput');
     const productId = document.getElementById('productId').value;
@@ -345,13 +369,14 @@ async function testUpdateStock() {
         method: 'PUT',
         headers: { 
             'Content-Type': 'application/json',
-            'Accept': 'application/json'
+            'Accept': 'application/json',
+            ...staffHeaders()
         },
         body: JSON.stringify({ stock: parseInt(newStock) })
     });
     
     if (!updateResponse.ok) {
-        const errorText = await updateResponse.text();
+        const errorText = await errorMessage(updateResponse);
         throw new Error(`Failed to update stock: ${updateResponse.status} - ${errorText}`);
     }
     
@@ -435,7 +460,7 @@ async function testNegativeStock() {
     
     const response = await fetch(`/api/products/${productId}/stock`, {
         method: 'PUT',
-        headers: { 'Content-Type': 'application/json' },
+        headers: { 'Content-Type': 'application/json', ...staffHeaders() },
         body: JSON.stringify({ stock: parseInt(stockValue) })
     });
     if (response.ok) throw new Error('Expected error for negative stock');
@@ -461,6 +486,8 @@ async function testExceedStock() {
         body: JSON.stringify({ productId: parseInt(productId), quantity: parseInt(quantity) })
     });
     if (orderResponse.ok) throw new Error('Expected error for exceeding stock');
+    const { error } = await orderResponse.json();
+    if (error.code !== 'insufficient_stock') throw new Error(`Expected insufficient_stock, got ${error.code}`);
     testOutput.innerHTML += `<div class="alert alert-success mt-2">
         <i class="bi bi-check-circle-fill"></i> Exceed stock test passed
     </div>`;
@@ -0,0 +1,562 @@
+package store
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Role is what a member of staff may do. Each role can do everything the
+// roles before it can.
+type Role string
+
+const (
+	RoleViewer           Role = "viewer"            // reports, catalog export and the worker pool
+	RoleInventoryManager Role = "inventory_manager" // stock, products, images and catalog import
+	RoleAdmin            Role = "admin"             // users and API keys
+
+	// RoleCustomer marks routes for signed in customers. It is not a staff
+	// role, so no user can have it.
+	RoleCustomer Role = "customer"
+
+	// public marks routes anyone may call, such as browsing and ordering
+	public Role = ""
+)
+
+// roleRank orders the roles from least to most privileged
+var roleRank = map[Role]int{RoleViewer: 1, RoleInventoryManager: 2, RoleAdmin: 3}
+
+// Valid reports whether r is a known role
+func (r Role) Valid() bool {
+	return roleRank[r] > 0
+}
+
+// Allows reports whether r may do everything the required role may
+func (r Role) Allows(required Role) bool {
+	return r.Valid() && roleRank[r] >= roleRank[required]
+}
+
+// sessionCookie holds the session token of a logged in user
+const sessionCookie = "store_session"
+
+// passwordIterations is the PBKDF2 work factor for stored passwords
+const passwordIterations = 100_000
+
+// APIKey is a key a user calls the API with. Only a hash of the key is
+// kept; the key itself is shown once, when it is created.
+type APIKey struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name,omitempty"`
+	Hash      string    `json:"hash,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// User is a member of staff who can log in or call the API with a key
+type User struct {
+	ID           int       `json:"id"`
+	Username     string    `json:"username"`
+	Role         Role      `json:"role"`
+	PasswordHash string    `json:"passwordHash,omitempty"`
+	APIKeys      []APIKey  `json:"apiKeys"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+// public returns a copy of the user without its password and key hashes,
+// for API responses
+func (u *User) public() *User {
+	copied := *u
+	copied.PasswordHash = ""
+	copied.APIKeys = make([]APIKey, len(u.APIKeys))
+	for i, key := range u.APIKeys {
+		key.Hash = ""
+		copied.APIKeys[i] = key
+	}
+	return &copied
+}
+
+// session is a logged in staff user or customer
+type session struct {
+	userID     int // zero for a customer session
+	customerID int // zero for a staff session
+	expires    time.Time
+}
+
+// userKey is the context key for the authenticated user
+type userKey struct{}
+
+// withUser returns a copy of ctx carrying the authenticated user
+func withUser(ctx context.Context, user *User) context.Context {
+	return context.WithValue(ctx, userKey{}, user)
+}
+
+// UserFromContext returns the authenticated user carried by ctx, or nil
+func UserFromContext(ctx context.Context) *User {
+	user, _ := ctx.Value(userKey{}).(*User)
+	return user
+}
+
+// randomHex returns n random bytes as hex
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// hashPassword derives a salted PBKDF2-SHA256 hash of the password
+func hashPassword(password string) string {
+	salt := make([]byte, 16)
+	rand.Read(salt)
+	key := pbkdf2Key([]byte(password), salt, passwordIterations)
+	return fmt.Sprintf("pbkdf2-sha256$%d$%x$%x", passwordIterations, salt, key)
+}
+
+// checkPassword reports whether password matches a hash from hashPassword
+func checkPassword(hash, password string) bool {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 4 || parts[0] != "pbkdf2-sha256" {
+		return false
+	}
+	iterations, err := strconv.Atoi(parts[1])
+	if err != nil || iterations < 1 {
+		return false
+	}
+	salt, err := hex.DecodeString(parts[2])
+	if err != nil {
+		return false
+	}
+	expected, err := hex.DecodeString(parts[3])
+	if err != nil {
+		return false
+	}
+	return subtle.ConstantTimeCompare(pbkdf2Key([]byte(password), salt, iterations), expected) == 1
+}
+
+// pbkdf2Key derives a 32 byte key with PBKDF2 and HMAC-SHA256 (RFC 8018),
+// which needs a single block at this length
+func pbkdf2Key(password, salt []byte, iterations int) []byte {
+	mac := hmac.New(sha256.New, password)
+	mac.Write(salt)
+	mac.Write([]byte{0, 0, 0, 1})
+	u := mac.Sum(nil)
+	key := append([]byte(nil), u...)
+	for i := 1; i < iterations; i++ {
+		mac.Reset()
+		mac.Write(u)
+		u = mac.Sum(u[:0])
+		for j := range key {
+			key[j] ^= u[j]
+		}
+	}
+	return key
+}
+
+// dummyPasswordHash is checked when a login names no user with a password
+var dummyPasswordHash = hashPassword(randomHex(16))
+
+// hashAPIKey hashes an API key for storage. Keys are long and random, so a
+// plain SHA-256 is enough.
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateUser adds a member of staff. The password may be empty for users
+// who only call the API with keys.
+func (s *Store) CreateUser(username string, role Role, password string) (*User, error) {
+	username = strings.TrimSpace(username)
+	if username == "" {
+		return nil, ErrInvalidUsername
+	}
+	if !role.Valid() {
+		return nil, ErrInvalidRole
+	}
+	user := &User{Username: username, Role: role, APIKeys: []APIKey{}, CreatedAt: time.Now()}
+	if password != "" {
+		user.PasswordHash = hashPassword(password)
+	}
+
+	s.authMu.Lock()
+	defer s.authMu.Unlock()
+	for _, existing := range s.users {
+		if strings.EqualFold(existing.Username, username) {
+			return nil, ErrUserExists
+		}
+		user.ID = max(user.ID, existing.ID)
+	}
+	user.ID++
+	s.users[user.ID] = user
+	if err := s.saveUsers(); err != nil {
+		delete(s.users, user.ID)
+		return nil, err
+	}
+	s.logger.Info("user created", "userId", user.ID, "username", username, "role", role)
+	return user.public(), nil
+}
+
+// Users returns every member of staff in ID order, without secrets
+func (s *Store) Users() []*User {
+	s.authMu.Lock()
+	defer s.authMu.Unlock()
+	users := make([]*User, 0, len(s.users))
+	for _, user := range s.users {
+		users = append(users, user.public())
+	}
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].ID < users[j].ID
+	})
+	return users
+}
+
+// CreateAPIKey issues a new API key for a user. The key is returned only
+// here; the store keeps just its hash.
+func (s *Store) CreateAPIKey(userID int, name string) (string, APIKey, error) {
+	s.authMu.Lock()
+	defer s.authMu.Unlock()
+	user, ok := s.users[userID]
+	if !ok {
+		return "", APIKey{}, ErrUserNotFound
+	}
+	// The ID before the dot finds the key without comparing every hash
+	id := randomHex(4)
+	key := id + "." + randomHex(24)
+	apiKey := APIKey{ID: id, Name: name, Hash: hashAPIKey(key), CreatedAt: time.Now()}
+	user.APIKeys = append(user.APIKeys, apiKey)
+	if err := s.saveUsers(); err != nil {
+		user.APIKeys = user.APIKeys[:len(user.APIKeys)-1]
+		return "", APIKey{}, err
+	}
+	s.logger.Info("api key created", "userId", userID, "keyId", id)
+	apiKey.Hash = ""
+	return key, apiKey, nil
+}
+
+// RevokeAPIKey deletes one of a user's API keys
+func (s *Store) RevokeAPIKey(userID int, keyID string) error {
+	s.authMu.Lock()
+	defer s.authMu.Unlock()
+	user, ok := s.users[userID]
+	if !ok {
+		return ErrUserNotFound
+	}
+	for i, key := range user.APIKeys {
+		if key.ID == keyID {
+			keys := user.APIKeys
+			user.APIKeys = append(keys[:i:i], keys[i+1:]...)
+			if err := s.saveUsers(); err != nil {
+				user.APIKeys = keys
+				return err
+			}
+			s.logger.Info("api key revoked", "userId", userID, "keyId", keyID)
+			return nil
+		}
+	}
+	return ErrAPIKeyNotFound
+}
+
+// Login checks a user's password and starts a session, returning its
+// token and when it expires
+func (s *Store) Login(username, password string) (string, time.Time, *User, error) {
+	s.authMu.Lock()
+	var user *User
+	for _, candidate := range s.users {
+		if strings.EqualFold(candidate.Username, username) {
+			user = candidate
+		}
+	}
+	s.authMu.Unlock()
+
+	hash := dummyPasswordHash
+	if user != nil && user.PasswordHash != "" {
+		hash = user.PasswordHash
+	}
+	// Checking a dummy hash for unknown users takes as long as a real check,
+	// so response times do not reveal which usernames exist
+	if !checkPassword(hash, password) || hash == dummyPasswordHash {
+		s.logger.Warn("login failed", "username", username)
+		return "", time.Time{}, nil, ErrInvalidCredentials
+	}
+
+	s.authMu.Lock()
+	defer s.authMu.Unlock()
+	token, expires := s.startSession(&session{userID: user.ID})
+	s.logger.Info("user logged in", "userId", user.ID)
+	return token, expires, user.public(), nil
+}
+
+// startSession stores a new session and returns its token and expiry. The
+// caller must hold s.authMu.
+func (s *Store) startSession(sess *session) (string, time.Time) {
+	// Drop expired sessions while we are here, so the map does not grow forever
+	for t, existing := range s.sessions {
+		if time.Now().After(existing.expires) {
+			delete(s.sessions, t)
+		}
+	}
+	token := randomHex(32)
+	sess.expires = time.Now().Add(s.sessionLifetime)
+	s.sessions[token] = sess
+	return token, sess.expires
+}
+
+// lookupSession returns the unexpired session for a token, forgetting it
+// once it has expired. The caller must hold s.authMu.
+func (s *Store) lookupSession(token string) (*session, bool) {
+	sess, ok := s.sessions[token]
+	if ok && time.Now().After(sess.expires) {
+		delete(s.sessions, token)
+		return nil, false
+	}
+	return sess, ok
+}
+
+// Logout ends a session
+func (s *Store) Logout(token string) {
+	s.authMu.Lock()
+	defer s.authMu.Unlock()
+	delete(s.sessions, token)
+}
+
+// sessionToken returns the session token from an Authorization: Bearer
+// header or the named session cookie
+func sessionToken(r *http.Request, cookieName string) string {
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return strings.TrimSpace(token)
+	}
+	if cookie, err := r.Cookie(cookieName); err == nil {
+		return cookie.Value
+	}
+	return ""
+}
+
+// authenticate returns the user a request's API key or session belongs to.
+// It returns nil and no error for a request without credentials, and
+// ErrInvalidCredentials for an unknown key or an expired session.
+func (s *Store) authenticate(r *http.Request) (*User, error) {
+	s.authMu.Lock()
+	defer s.authMu.Unlock()
+
+	if key := r.Header.Get(APIKeyHeader); key != "" {
+		id, _, _ := strings.Cut(key, ".")
+		hash := hashAPIKey(key)
+		for _, user := range s.users {
+			for _, apiKey := range user.APIKeys {
+				if apiKey.ID == id && subtle.ConstantTimeCompare([]byte(apiKey.Hash), []byte(hash)) == 1 {
+					return user.public(), nil
+				}
+			}
+		}
+		return nil, ErrInvalidCredentials
+	}
+
+	token := sessionToken(r, sessionCookie)
+	if token == "" {
+		return nil, nil
+	}
+	sess, ok := s.lookupSession(token)
+	if !ok {
+		return nil, ErrInvalidCredentials
+	}
+	if sess.userID == 0 {
+		// A customer's bearer token says nothing about staff access
+		return nil, nil
+	}
+	user, ok := s.users[sess.userID]
+	if !ok {
+		return nil, ErrInvalidCredentials
+	}
+	return user.public(), nil
+}
+
+// withAuth identifies the staff user or customer behind a request and
+// checks that the route allows them. Public routes are open to everyone, and
+// credentials that are not valid only matter on routes that need them.
+func (s *Store) withAuth(mux *http.ServeMux, access map[string]Role) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, err := s.authenticate(r)
+			if user != nil {
+				r = r.WithContext(withUser(r.Context(), user))
+			}
+			customer, customerErr := s.authenticateCustomer(r)
+			if customer != nil {
+				r = r.WithContext(withCustomer(r.Context(), customer))
+			}
+			_, pattern := mux.Handler(r)
+			required := access[pattern]
+
+			// Customer routes need a customer even without staff auth, since
+			// they act on the customer's own account
+			if required == RoleCustomer {
+				switch {
+				case customer != nil:
+					next.ServeHTTP(w, r)
+				case customerErr != nil:
+					s.writeError(w, r, customerErr)
+				default:
+					s.writeError(w, r, &APIError{Status: http.StatusUnauthorized, Code: CodeUnauthorized,
+						Message: "sign in to your customer account"})
+				}
+				return
+			}
+			if required == public || !s.authEnabled {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			switch {
+			case err != nil:
+				s.writeError(w, r, err)
+			case user == nil:
+				s.writeError(w, r, &APIError{Status: http.StatusUnauthorized, Code: CodeUnauthorized,
+					Message: "sign in or send an API key in the " + APIKeyHeader + " header"})
+			case !user.Role.Allows(required):
+				s.log(r.Context()).Warn("request forbidden", "method", r.Method, "path", r.URL.Path,
+					"userId", user.ID, "role", user.Role, "required", required)
+				s.writeError(w, r, &APIError{Status: http.StatusForbidden, Code: CodeForbidden,
+					Message: fmt.Sprintf("the %s role cannot do this, %s is required", user.Role, required),
+					Details: map[string]any{"role": user.Role, "required": required}})
+			default:
+				next.ServeHTTP(w, r)
+			}
+		})
+	}
+}
+
+// handleLogin serves POST /api/auth/login, starting a session in a cookie
+// and returning its token for clients that send it as a bearer token
+func (s *Store) handleLogin(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+	if err := decodeJSON(r, &request); err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	token, expires, user, err := s.Login(request.Username, request.Password)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+
+	setSessionCookie(w, r, sessionCookie, token, expires)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(map[string]any{"token": token, "expiresAt": expires, "user": user})
+}
+
+// setSessionCookie sets a session cookie scripts cannot read, or clears it
+// when token is empty
+func setSessionCookie(w http.ResponseWriter, r *http.Request, name, token string, expires time.Time) {
+	cookie := &http.Cookie{
+		Name:     name,
+		Value:    token,
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteStrictMode,
+	}
+	if token == "" {
+		cookie.Expires = time.Time{}
+		cookie.MaxAge = -1
+	}
+	http.SetCookie(w, cookie)
+}
+
+// handleLogout serves POST /api/auth/logout
+func (s *Store) handleLogout(w http.ResponseWriter, r *http.Request) {
+	if token := sessionToken(r, sessionCookie); token != "" {
+		s.Logout(token)
+	}
+	setSessionCookie(w, r, sessionCookie, "", time.Time{})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleMe serves GET /api/auth/me with the signed in user
+func (s *Store) handleMe(w http.ResponseWriter, r *http.Request) {
+	user := UserFromContext(r.Context())
+	if user == nil {
+		s.writeError(w, r, &APIError{Status: http.StatusUnauthorized, Code: CodeUnauthorized, Message: "not signed in"})
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(user)
+}
+
+// handleListUsers serves GET /api/admin/users
+func (s *Store) handleListUsers(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.Users())
+}
+
+// handleCreateUser serves POST /api/admin/users
+func (s *Store) handleCreateUser(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Username string `json:"username"`
+		Role     Role   `json:"role"`
+		Password string `json:"password"`
+	}
+	if err := decodeJSON(r, &request); err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	user, err := s.CreateUser(request.Username, request.Role, request.Password)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(user)
+}
+
+// handleCreateAPIKey serves POST /api/admin/users/{id}/keys. The response
+// is the only time the key is shown.
+func (s *Store) handleCreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		s.writeError(w, r, invalidRequest("invalid user ID"))
+		return
+	}
+	var request struct {
+		Name string `json:"name"`
+	}
+	if err := decodeJSON(r, &request); err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	key, apiKey, err := s.CreateAPIKey(userID, request.Name)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]any{"key": key, "apiKey": apiKey})
+}
+
+// handleRevokeAPIKey serves DELETE /api/admin/users/{id}/keys/{keyId}
+func (s *Store) handleRevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		s.writeError(w, r, invalidRequest("invalid user ID"))
+		return
+	}
+	if err := s.RevokeAPIKey(userID, r.PathValue("keyId")); err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,304 @@
+package store
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// staffKey creates a user with the given role and returns an API key for them
+func staffKey(t *testing.T, store *Store, role Role) string {
+	t.Helper()
+	user, err := store.CreateUser(string(role)+"-"+randomHex(4), role, "")
+	if err != nil {
+		t.Fatalf("Failed to create %s user: %v", role, err)
+	}
+	key, _, err := store.CreateAPIKey(user.ID, "test")
+	if err != nil {
+		t.Fatalf("Failed to create API key: %v", err)
+	}
+	return key
+}
+
+// staffRequest serves a request sent with an API key, if one is given
+func staffRequest(handler http.Handler, method, path, body, key string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if key != "" {
+		req.Header.Set(APIKeyHeader, key)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestRoleAllows(t *testing.T) {
+	tests := []struct {
+		role     Role
+		required Role
+		want     bool
+	}{
+		{RoleViewer, RoleViewer, true},
+		{RoleViewer, RoleInventoryManager, false},
+		{RoleInventoryManager, RoleViewer, true},
+		{RoleInventoryManager, RoleAdmin, false},
+		{RoleAdmin, RoleInventoryManager, true},
+		{Role("owner"), RoleViewer, false},
+	}
+	for _, tt := range tests {
+		if got := tt.role.Allows(tt.required); got != tt.want {
+			t.Errorf("%s.Allows(%s) = %v, want %v", tt.role, tt.required, got, tt.want)
+		}
+	}
+}
+
+func TestPasswordHash(t *testing.T) {
+	hash := hashPassword("correct horse")
+	if !checkPassword(hash, "correct horse") {
+		t.Error("Expected the password to match its hash")
+	}
+	if checkPassword(hash, "wrong horse") || checkPassword("", "correct horse") {
+		t.Error("Expected a wrong password or empty hash not to match")
+	}
+	if hashPassword("correct horse") == hash {
+		t.Error("Expected every hash to be salted differently")
+	}
+}
+
+func TestRouteAccess(t *testing.T) {
+	store := newTestStore()
+	store.InitializeCatalog()
+	handler := store.Routes("../static")
+	defer store.Close()
+	viewer := staffKey(t, store, RoleViewer)
+	manager := staffKey(t, store, RoleInventoryManager)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		key    string
+		status int
+		code   string
+	}{
+		{"anyone browses", http.MethodGet, "/api/products", "", "", http.StatusOK, ""},
+		{"anyone orders", http.MethodPost, "/api/orders", `{"productId": 1, "quantity": 1}`, "", http.StatusCreated, ""},
+		{"unknown key on a public route", http.MethodGet, "/api/products/1", "", "nope.nope", http.StatusOK, ""},
+		{"stock needs a key", http.MethodPut, "/api/products/1/stock", `{"stock": 5}`, "", http.StatusUnauthorized, CodeUnauthorized},
+		{"unknown key", http.MethodPut, "/api/products/1/stock", `{"stock": 5}`, "nope.nope", http.StatusUnauthorized, CodeUnauthorized},
+		{"viewer cannot set stock", http.MethodPut, "/api/products/1/stock", `{"stock": 5}`, viewer, http.StatusForbidden, CodeForbidden},
+		{"manager sets stock", http.MethodPut, "/api/products/1/stock", `{"stock": 5}`, manager, http.StatusOK, ""},
+		{"viewer reads reports", http.MethodGet, "/api/reports/sales", "", viewer, http.StatusOK, ""},
+		{"reports need a key", http.MethodGet, "/api/reports/sales", "", "", http.StatusUnauthorized, CodeUnauthorized},
+		{"manager cannot add users", http.MethodPost, "/api/admin/users", `{"username": "eve", "role": "admin"}`, manager, http.StatusForbidden, CodeForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := staffRequest(handler, tt.method, tt.path, tt.body, tt.key)
+			if rec.Code != tt.status {
+				t.Fatalf("Expected status %d, got %d: %s", tt.status, rec.Code, rec.Body.String())
+			}
+			if tt.code == "" {
+				return
+			}
+			if apiErr := errorResponse(t, rec); apiErr.Code != tt.code {
+				t.Errorf("Expected code %s, got %+v", tt.code, apiErr)
+			}
+		})
+	}
+
+	rec := staffRequest(handler, http.MethodPut, "/api/products/1/stock", `{"stock": 5}`, viewer)
+	if apiErr := errorResponse(t, rec); apiErr.Details["role"] != "viewer" || apiErr.Details["required"] != "inventory_manager" {
+		t.Errorf("Expected the roles in the details, got %+v", apiErr.Details)
+	}
+
+	// With authentication turned off every route is open
+	store.authEnabled = false
+	if rec := staffRequest(handler, http.MethodGet, "/api/reports/sales", "", ""); rec.Code != http.StatusOK {
+		t.Errorf("Expected reports to be open without auth, got %d", rec.Code)
+	}
+}
+
+func TestLoginSession(t *testing.T) {
+	store := newTestStore()
+	store.InitializeCatalog()
+	handler := store.Routes("../static")
+	defer store.Close()
+	if _, err := store.CreateUser("asha", RoleViewer, "s3cret"); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	rec := staffRequest(handler, http.MethodPost, "/api/auth/login", `{"username": "asha", "password": "nope"}`, "")
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected a wrong password to be refused, got %d", rec.Code)
+	}
+
+	rec = staffRequest(handler, http.MethodPost, "/api/auth/login", `{"username": "asha", "password": "s3cret"}`, "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected to log in, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var session struct {
+		Token string `json:"token"`
+		User  User   `json:"user"`
+	}
+	json.NewDecoder(rec.Body).Decode(&session)
+	cookies := rec.Result().Cookies()
+	if session.Token == "" || session.User.Role != RoleViewer || len(cookies) != 1 || cookies[0].Value != session.Token {
+		t.Fatalf("Expected a session token in the body and cookie, got %+v, %v", session, cookies)
+	}
+
+	// The cookie and the bearer token both sign the user in
+	req := httptest.NewRequest(http.MethodGet, "/api/auth/me", nil)
+	req.AddCookie(cookies[0])
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	var me User
+	json.NewDecoder(rec.Body).Decode(&me)
+	if rec.Code != http.StatusOK || me.Username != "asha" || me.PasswordHash != "" {
+		t.Errorf("Expected the signed in user without secrets, got %d %+v", rec.Code, me)
+	}
+	req = httptest.NewRequest(http.MethodGet, "/api/reports/sales", nil)
+	req.Header.Set("Authorization", "Bearer "+session.Token)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected the bearer token to sign in, got %d", rec.Code)
+	}
+
+	// Logging out ends the session
+	req = httptest.NewRequest(http.MethodPost, "/api/auth/logout", nil)
+	req.AddCookie(cookies[0])
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	req = httptest.NewRequest(http.MethodGet, "/api/auth/me", nil)
+	req.AddCookie(cookies[0])
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected the session to be over, got %d", rec.Code)
+	}
+
+	// So does its lifetime running out
+	token, _, _, _ := store.Login("asha", "s3cret")
+	store.sessions[token].expires = time.Now().Add(-time.Second)
+	req = httptest.NewRequest(http.MethodGet, "/api/auth/me", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected an expired session to be refused, got %d", rec.Code)
+	}
+}
+
+func TestManageUsersAndKeys(t *testing.T) {
+	store := newTestStore()
+	store.dataDir = t.TempDir()
+	handler := store.Routes("../static")
+	defer store.Close()
+	admin := staffKey(t, store, RoleAdmin)
+
+	rec := staffRequest(handler, http.MethodPost, "/api/admin/users", `{"username": "ravi", "role": "inventory_manager"}`, admin)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected the user to be created, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var user User
+	json.NewDecoder(rec.Body).Decode(&user)
+	if rec := staffRequest(handler, http.MethodPost, "/api/admin/users", `{"username": "RAVI", "role": "viewer"}`, admin); rec.Code != http.StatusConflict {
+		t.Errorf("Expected a taken username to be refused, got %d", rec.Code)
+	}
+
+	rec = staffRequest(handler, http.MethodPost, "/api/admin/users/"+strconv.Itoa(user.ID)+"/keys", `{"name": "scanner"}`, admin)
+	var created struct {
+		Key    string `json:"key"`
+		APIKey APIKey `json:"apiKey"`
+	}
+	json.NewDecoder(rec.Body).Decode(&created)
+	if rec.Code != http.StatusCreated || created.Key == "" || created.APIKey.Hash != "" {
+		t.Fatalf("Expected a new key without its hash, got %d %+v", rec.Code, created)
+	}
+	if rec := staffRequest(handler, http.MethodGet, "/api/auth/me", "", created.Key); rec.Code != http.StatusOK {
+		t.Errorf("Expected the new key to sign in, got %d", rec.Code)
+	}
+
+	// Keys are stored hashed and survive a restart
+	data, _ := os.ReadFile(filepath.Join(store.dataDir, usersFile))
+	if strings.Contains(string(data), created.Key) || !strings.Contains(string(data), hashAPIKey(created.Key)) {
+		t.Error("Expected users.json to hold the key's hash, not the key")
+	}
+	reloaded := newTestStore()
+	defer reloaded.Close()
+	reloaded.dataDir = store.dataDir
+	reloaded.InitializeCatalog()
+	if err := reloaded.LoadState(); err != nil || len(reloaded.Users()) != 2 {
+		t.Fatalf("Expected users to be reloaded, got %v, %v", reloaded.Users(), err)
+	}
+
+	// A revoke that cannot be saved leaves the key working
+	blocker := filepath.Join(store.dataDir, usersFile+".tmp")
+	os.MkdirAll(blocker, 0o755)
+	if err := store.RevokeAPIKey(user.ID, created.APIKey.ID); err == nil {
+		t.Fatal("Expected the revoke to fail when users.json cannot be saved")
+	}
+	if rec := staffRequest(handler, http.MethodGet, "/api/auth/me", "", created.Key); rec.Code != http.StatusOK {
+		t.Errorf("Expected the key to keep working after a failed revoke, got %d", rec.Code)
+	}
+	os.Remove(blocker)
+
+	rec = staffRequest(handler, http.MethodDelete, "/api/admin/users/"+strconv.Itoa(user.ID)+"/keys/"+created.APIKey.ID, "", admin)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("Expected the key to be revoked, got %d", rec.Code)
+	}
+	if rec := staffRequest(handler, http.MethodGet, "/api/auth/me", "", created.Key); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected the revoked key to be refused, got %d", rec.Code)
+	}
+}
+
+func TestProductCRUD(t *testing.T) {
+	store := newTestStore()
+	store.catalogFile = filepath.Join(t.TempDir(), "products.json")
+	data, _ := os.ReadFile(testCatalog)
+	os.WriteFile(store.catalogFile, data, 0o644)
+	store.InitializeCatalog()
+	handler := store.Routes("../static")
+	defer store.Close()
+	key := staffKey(t, store, RoleInventoryManager)
+
+	rec := staffRequest(handler, http.MethodPost, "/api/products", `{"name": "Pear", "category": "Grocery", "sku": "PEAR-1", "price": 30, "stock": 5}`, key)
+	if rec.Code != http.StatusCreated || rec.Header().Get("Location") != "/api/products/4" {
+		t.Fatalf("Expected product 4 to be created, got %d %q: %s", rec.Code, rec.Header().Get("Location"), rec.Body.String())
+	}
+
+	rec = staffRequest(handler, http.MethodPost, "/api/products", `{"name": "Pear again", "category": "Grocery", "sku": "PEAR-1", "price": 30, "stock": 5}`, key)
+	if apiErr := errorResponse(t, rec); rec.Code != http.StatusBadRequest || apiErr.Code != CodeInvalidProduct {
+		t.Errorf("Expected a duplicate SKU to be refused, got %d %+v", rec.Code, apiErr)
+	}
+
+	rec = staffRequest(handler, http.MethodPut, "/api/products/1", `{"name": "Green Apple", "category": "Grocery", "price": 45, "stock": 80}`, key)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected product 1 to be updated, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if product, _ := store.GetProduct(1); product.Name != "Green Apple" || product.Price != 45 || product.Image == "" {
+		t.Errorf("Expected the new details with the old image, got %+v", product)
+	}
+
+	if rec := staffRequest(handler, http.MethodDelete, "/api/products/2", "", key); rec.Code != http.StatusNoContent {
+		t.Fatalf("Expected product 2 to be deleted, got %d", rec.Code)
+	}
+	if _, err := store.GetProduct(2); err != ErrProductNotFound {
+		t.Errorf("Expected product 2 to be gone, got %v", err)
+	}
+
+	// Changes are saved to the catalog file
+	reloaded := newTestStore()
+	defer reloaded.Close()
+	reloaded.catalogFile = store.catalogFile
+	reloaded.InitializeCatalog()
+	if len(reloaded.Products()) != 3 {
+		t.Errorf("Expected 3 products after reloading, got %d", len(reloaded.Products()))
+	}
+}
@@ -0,0 +1,279 @@
+package store
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// NotificationBackorderFilled tells a customer their backordered order has
+// stock and is on its way
+const NotificationBackorderFilled = "backorder_filled"
+
+// BackorderPolicy lets a product take orders for more than it has in stock.
+// A pre-order is a backorder for a product that is not out yet: it has no
+// stock, and ExpectedAt is its release date.
+type BackorderPolicy struct {
+	ProductID int `json:"productId"`
+	// Limit is how many units may wait on backorder at once; zero takes no
+	// backorders
+	Limit      int        `json:"limit"`
+	ExpectedAt *time.Time `json:"expectedAt,omitempty"` // when stock is expected
+}
+
+// BackorderAvailability tells customers a product can be ordered beyond
+// its stock
+type BackorderAvailability struct {
+	Remaining  int        `json:"remaining"` // units that can still be backordered
+	ExpectedAt *time.Time `json:"expectedAt,omitempty"`
+}
+
+// saveBackorderPolicies persists the backorder policies. The caller must
+// hold s.mu.
+func (s *Store) saveBackorderPolicies() error {
+	policies := make([]*BackorderPolicy, 0, len(s.backorders))
+	for _, policy := range s.backorders {
+		policies = append(policies, policy)
+	}
+	slices.SortFunc(policies, func(a, b *BackorderPolicy) int { return cmp.Compare(a.ProductID, b.ProductID) })
+	return s.writeJSONFile(backordersFile, policies)
+}
+
+// SetBackorderPolicy sets how many units of a product may be backordered
+// and when stock is expected. A limit of zero removes the policy; orders
+// already backordered still wait for stock.
+func (s *Store) SetBackorderPolicy(productID int, policy BackorderPolicy) (*BackorderPolicy, error) {
+	if policy.Limit < 0 {
+		return nil, invalidRequest("limit cannot be negative")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.catalog[productID]; !ok {
+		return nil, ErrProductNotFound
+	}
+	previous, had := s.backorders[productID]
+	policy.ProductID = productID
+	if policy.Limit == 0 {
+		delete(s.backorders, productID)
+	} else {
+		s.backorders[productID] = &policy
+	}
+	if err := s.saveBackorderPolicies(); err != nil {
+		if had {
+			s.backorders[productID] = previous
+		} else {
+			delete(s.backorders, productID)
+		}
+		return nil, err
+	}
+	s.logger.Info("backorder policy set", "productId", productID, "limit", policy.Limit, "expectedAt", policy.ExpectedAt)
+	return &policy, nil
+}
+
+// backordered returns how many units of a product are waiting on
+// backorder. The caller must hold s.mu.
+func (s *Store) backordered(productID int) int {
+	units := 0
+	for _, order := range s.orders {
+		if order.Status == OrderBackordered && order.Product.ID == productID {
+			units += order.Quantity
+		}
+	}
+	return units
+}
+
+// backorderAvailability returns how much more of each product with a
+// backorder policy can be backordered. The caller must hold s.mu.
+func (s *Store) backorderAvailability() map[int]*BackorderAvailability {
+	availability := make(map[int]*BackorderAvailability, len(s.backorders))
+	for productID, policy := range s.backorders {
+		availability[productID] = &BackorderAvailability{
+			Remaining:  max(policy.Limit-s.backordered(productID), 0),
+			ExpectedAt: policy.ExpectedAt,
+		}
+	}
+	return availability
+}
+
+// Backorders returns the orders waiting on backorder in the order they will
+// be filled, optionally only for one product
+func (s *Store) Backorders(productID int) []*Order {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	orders := []*Order{}
+	for _, order := range s.orders {
+		if order.Status == OrderBackordered && (productID == 0 || order.Product.ID == productID) {
+			orders = append(orders, order)
+		}
+	}
+	return orders
+}
+
+// takeStock allocates an order to the locations nearest its delivery
+// address and takes the stock, recording a sale for each location. The
+// caller must hold s.mu and have checked that there is enough stock.
+func (s *Store) takeStock(order *Order, note, by string) {
+	pincode := ""
+	if order.DeliveryAddress != nil {
+		pincode = order.DeliveryAddress.Pincode
+	}
+	product := s.catalog[order.Product.ID]
+	order.Allocations = s.allocate(product.ID, order.Quantity, pincode)
+	for _, allocation := range order.Allocations {
+		location := s.location(allocation.LocationID)
+		s.setLocationStock(location, product.ID, location.Stock[product.ID]-allocation.Quantity)
+		product.Stock -= allocation.Quantity
+		movement := s.recordMovement(product, -allocation.Quantity, MovementSale, note, by, order.ID)
+		movement.LocationID = allocation.LocationID
+	}
+}
+
+// orderBuyer names who placed an order in the ledger
+func orderBuyer(order *Order) string {
+	if order.CustomerID != 0 {
+		return "customer:" + strconv.Itoa(order.CustomerID)
+	}
+	return "guest"
+}
+
+// fillBackorders gives a product's stock to the orders waiting on it,
+// oldest first. Filling stops at the first order there is not enough
+// stock for, so later, smaller orders never jump the queue. A filled order
+// goes on to be paid for, or is queued for processing if it already is.
+// If the orders or the stock cannot be saved, the orders go back to waiting
+// and the stock is left as it was. The caller must hold s.mu, and pass the
+// filled orders to backordersFilled once it has let go.
+func (s *Store) fillBackorders(productID int) ([]*Order, error) {
+	product, ok := s.catalog[productID]
+	if !ok {
+		return nil, nil
+	}
+	previousStock := product.Stock
+	snapshot := s.snapshotStock(productID)
+	var filled []*Order
+	for _, order := range s.orders {
+		if order.Status != OrderBackordered || order.Product.ID != productID {
+			continue
+		}
+		if order.Quantity > product.Stock {
+			break
+		}
+		s.takeStock(order, "backorder filled", orderBuyer(order))
+		now := time.Now()
+		order.Status, order.PendingSince = OrderPending, &now
+		if order.Payment != nil && order.Payment.Status == PaymentAuthorized {
+			order.Status = OrderPaid
+		}
+		filled = append(filled, order)
+	}
+	if len(filled) == 0 {
+		return nil, nil
+	}
+	err := s.saveOrders()
+	saved := err == nil
+	if saved {
+		err = s.saveInventory(snapshot)
+	}
+	if err != nil {
+		s.restoreStock(snapshot)
+		for _, order := range filled {
+			order.Status, order.PendingSince, order.Allocations = OrderBackordered, nil, nil
+		}
+		if saved {
+			if saveErr := s.saveOrders(); saveErr != nil {
+				s.logger.Error("error putting back unsaved backorders", "productId", productID, "error", saveErr)
+			}
+		}
+		return nil, err
+	}
+	for _, order := range filled {
+		s.orderStatusChanged(order, OrderBackordered)
+	}
+	s.stockChanged(product, previousStock)
+	return filled, nil
+}
+
+// backordersFilled tells the customers whose backorders were filled, and
+// queues the paid ones for processing. The caller must not hold s.mu.
+func (s *Store) backordersFilled(ctx context.Context, orders []*Order) {
+	if len(orders) == 0 {
+		return
+	}
+	// s.mu is never held with s.authMu, so read what the messages need first
+	paid := make([]bool, len(orders))
+	messages := make([]string, len(orders))
+	s.mu.RLock()
+	for i, order := range orders {
+		paid[i] = order.Status == OrderPaid
+		messages[i] = fmt.Sprintf("Your order #%d for %s is in stock; pay for it to have it sent", order.ID, order.Product.Name)
+		if paid[i] {
+			messages[i] = fmt.Sprintf("Your order #%d for %s is in stock and on its way", order.ID, order.Product.Name)
+		}
+	}
+	s.mu.RUnlock()
+
+	s.authMu.Lock()
+	notified := 0
+	for i, order := range orders {
+		s.orderLog(order).Info("backorder filled", "quantity", order.Quantity, "paid", paid[i])
+		if customer, ok := s.customers[order.CustomerID]; ok {
+			s.notify(customer, Notification{Kind: NotificationBackorderFilled, Message: messages[i], ProductID: order.Product.ID})
+			notified++
+		}
+	}
+	if notified > 0 {
+		if err := s.saveCustomers(); err != nil {
+			s.log(ctx).Error("error saving notifications", "error", err)
+		}
+	}
+	s.authMu.Unlock()
+
+	for i, order := range orders {
+		if paid[i] {
+			s.ProcessOrder(order)
+		}
+	}
+}
+
+// handleSetBackorderPolicy serves PUT /api/products/{id}/backorder
+func (s *Store) handleSetBackorderPolicy(w http.ResponseWriter, r *http.Request) {
+	productID, err := pathID(r, "id", "product")
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	var policy BackorderPolicy
+	if err := decodeJSON(r, &policy); err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	saved, err := s.SetBackorderPolicy(productID, policy)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, saved)
+}
+
+// handleListBackorders serves GET /api/inventory/backorders?productId=
+func (s *Store) handleListBackorders(w http.ResponseWriter, r *http.Request) {
+	productID := 0
+	if value := r.URL.Query().Get("productId"); value != "" {
+		id, err := strconv.Atoi(value)
+		if err != nil || id < 1 {
+			s.writeError(w, r, invalidRequest("invalid productId"))
+			return
+		}
+		productID = id
+	}
+	orders := s.Backorders(productID)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	writeJSON(w, http.StatusOK, orders)
+}
@@ -0,0 +1,168 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBackorders(t *testing.T) {
+	store := newTestStore()
+	store.InitializeCatalog()
+	defer store.Close()
+	customer, _, _, err := store.RegisterCustomer("asha@example.com", "Asha", "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := WithOrderOwner(context.Background(), OrderOwner{CustomerID: customer.ID})
+	laptop, _ := store.GetProduct(2)
+
+	if _, err := store.CreateOrder(ctx, laptop, 11); !errors.Is(err, ErrInsufficientStock) {
+		t.Fatalf("Expected no backorders without a policy, got %v", err)
+	}
+	expected := time.Date(2026, 12, 1, 0, 0, 0, 0, time.UTC)
+	if _, err := store.SetBackorderPolicy(2, BackorderPolicy{Limit: 8, ExpectedAt: &expected}); err != nil {
+		t.Fatal(err)
+	}
+
+	// 6 of the 10 laptops sell from stock; the next orders wait for more
+	if order, _ := store.CreateOrder(ctx, laptop, 6); order.Status != OrderPending {
+		t.Errorf("Expected an order in stock to be pending, got %s", order.Status)
+	}
+	first, _ := store.CreateOrder(ctx, laptop, 5)
+	if first.Status != OrderBackordered || !first.ExpectedAt.Equal(expected) || laptop.Stock != 4 || len(first.Allocations) != 0 {
+		t.Errorf("Expected the order to be backordered without taking stock, got %+v with %d left", first, laptop.Stock)
+	}
+	// The 4 left are promised to the first backorder, so even 2 wait
+	second, _ := store.CreateOrder(ctx, laptop, 2)
+	if second.Status != OrderBackordered {
+		t.Errorf("Expected the second order to queue behind the first, got %s", second.Status)
+	}
+	var stockErr *InsufficientStockError
+	if _, err := store.CreateOrder(ctx, laptop, 2); !errors.As(err, &stockErr) || stockErr.Available != 0 {
+		t.Errorf("Expected the backorder limit of 8 to refuse 9 units, got %v", err)
+	}
+	if product, _ := store.RatedProduct(2); product.Backorder == nil || product.Backorder.Remaining != 1 {
+		t.Errorf("Expected 1 more laptop to be available on backorder, got %+v", product.Backorder)
+	}
+
+	// The first backorder is paid for while it waits
+	if err := store.PayOrder(ctx, first); err != nil {
+		t.Fatal(err)
+	}
+	if backorders := store.Backorders(2); len(backorders) != 2 || backorders[0] != first {
+		t.Fatalf("Expected both orders to still be waiting, got %d", len(backorders))
+	}
+
+	// A restock of 1 fills the first; the second waits for more
+	if _, err := store.AdjustStock(context.Background(), 2, 0, 1, MovementRestock, "", 0); err != nil {
+		t.Fatal(err)
+	}
+	if backorders := store.Backorders(2); len(backorders) != 1 || backorders[0] != second {
+		t.Fatalf("Expected only the second order to be waiting, got %d", len(backorders))
+	}
+	if sales := store.Ledger(2, MovementSale, 1); sales[0].OrderID != first.ID || sales[0].Delta != -5 || sales[0].Note != "backorder filled" {
+		t.Errorf("Expected the filled backorder to be recorded as a sale, got %+v", sales[0])
+	}
+	if err := store.SetStock(context.Background(), 2, 2, ""); err != nil {
+		t.Fatal(err)
+	}
+	store.mu.RLock()
+	status := second.Status
+	store.mu.RUnlock()
+	if status != OrderPending || laptop.Stock != 0 {
+		t.Errorf("Expected the unpaid backorder to be filled and wait for payment, got %s with %d left", status, laptop.Stock)
+	}
+
+	notifications, _ := store.Notifications(customer.ID)
+	if len(notifications) != 2 || notifications[0].Kind != NotificationBackorderFilled ||
+		!strings.Contains(notifications[0].Message, "pay for it") || !strings.Contains(notifications[1].Message, "on its way") {
+		t.Errorf("Expected a notification for each filled backorder, got %+v", notifications)
+	}
+
+	// Cancelling a backorder gives back no stock, since it never had any
+	third, _ := store.CreateOrder(ctx, laptop, 3)
+	if _, err := store.CancelOrder(context.Background(), third.ID, 0); err != nil {
+		t.Fatal(err)
+	}
+	if laptop.Stock != 0 || len(store.Ledger(2, MovementReturn, 10)) != 0 {
+		t.Errorf("Expected no stock back from a cancelled backorder, got %d", laptop.Stock)
+	}
+}
+
+func TestFillBackordersUndoneWhenSaveFails(t *testing.T) {
+	store := openDataStore(t)
+	ctx := context.Background()
+	laptop, _ := store.GetProduct(2)
+	store.SetBackorderPolicy(2, BackorderPolicy{Limit: 15})
+	backorder, _ := store.CreateOrder(ctx, laptop, 12)
+	if backorder.Status != OrderBackordered {
+		t.Fatalf("Expected the order to be backordered, got %s", backorder.Status)
+	}
+
+	// A directory in the way of the orders' temporary file fails the fill
+	blocker := filepath.Join(store.dataDir, ordersFile+".tmp")
+	os.MkdirAll(blocker, 0o755)
+	if _, err := store.AdjustStock(ctx, 2, 0, 2, MovementRestock, "", 0); err == nil {
+		t.Fatal("Expected filling the backorder to fail when the orders cannot be saved")
+	}
+	if orderStatus(store, backorder) != OrderBackordered || len(backorder.Allocations) != 0 || backorder.PendingSince != nil {
+		t.Errorf("Expected the backorder to keep waiting, got %+v", backorder)
+	}
+	if laptop.Stock != 12 || len(store.Ledger(2, MovementSale, 10)) != 0 {
+		t.Errorf("Expected the restocked laptops to stay on hand, got %d", laptop.Stock)
+	}
+
+	// The next restock fills it
+	os.Remove(blocker)
+	if _, err := store.AdjustStock(ctx, 2, 0, 1, MovementRestock, "", 0); err != nil {
+		t.Fatal(err)
+	}
+	if status := orderStatus(store, backorder); status != OrderPending || laptop.Stock != 1 {
+		t.Errorf("Expected the backorder to be filled, got %s with %d left", status, laptop.Stock)
+	}
+}
+
+func TestStockRisesFillBackorders(t *testing.T) {
+	store := openDataStore(t)
+	ctx := context.Background()
+	laptop, _ := store.GetProduct(2)
+	store.SetBackorderPolicy(2, BackorderPolicy{Limit: 30})
+
+	// Updating the product with more stock fills the waiting order
+	updated, _ := store.CreateOrder(ctx, laptop, 12)
+	details := *laptop
+	details.Stock = 12
+	if _, err := store.UpdateProduct(ctx, 2, details); err != nil {
+		t.Fatal(err)
+	}
+	if status := orderStatus(store, updated); status != OrderPending || laptop.Stock != 0 {
+		t.Errorf("Expected an update to fill the backorder, got %s with %d left", status, laptop.Stock)
+	}
+
+	// So does importing it with more stock
+	imported, _ := store.CreateOrder(ctx, laptop, 5)
+	details.Stock = 5
+	if _, err := store.ImportCatalog(ctx, []ImportRow{{Line: 2, Product: details}}, false); err != nil {
+		t.Fatal(err)
+	}
+	if status := orderStatus(store, imported); status != OrderPending || laptop.Stock != 0 {
+		t.Errorf("Expected an import to fill the backorder, got %s with %d left", status, laptop.Stock)
+	}
+
+	// And rebuilding it from a ledger that holds more
+	reconciled, _ := store.CreateOrder(ctx, laptop, 3)
+	store.mu.Lock()
+	store.recordMovement(laptop, 3, MovementRestock, "", "test", 0)
+	store.mu.Unlock()
+	if _, err := store.ReconcileStock(ctx, true); err != nil {
+		t.Fatal(err)
+	}
+	if status := orderStatus(store, reconciled); status != OrderPending || laptop.Stock != 0 {
+		t.Errorf("Expected reconciling to fill the backorder, got %s with %d left", status, laptop.Stock)
+	}
+}
@@ -0,0 +1,472 @@
+package store
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// knownCategories lists the categories the order workflow knows how to handle
+var knownCategories = map[string]bool{
+	"Grocery":     true,
+	"Electronics": true,
+	"Fashion":     true,
+}
+
+// catalogColumns is the column order used for CSV import and export
+var catalogColumns = []string{"id", "sku", "name", "category", "price", "stock", "image"}
+
+// ImportRow is one product row read from an import file, along with any
+// problems found while parsing it
+type ImportRow struct {
+	Line    int
+	Product Product
+	Errors  []string
+}
+
+// ImportResult reports what happened to a single import row
+type ImportResult struct {
+	Line   int      `json:"line"`
+	ID     int      `json:"id,omitempty"`
+	SKU    string   `json:"sku,omitempty"`
+	Action string   `json:"action"` // created, updated or rejected
+	Errors []string `json:"errors,omitempty"`
+}
+
+// ImportReport summarises a catalog import
+type ImportReport struct {
+	DryRun   bool           `json:"dryRun"`
+	Created  int            `json:"created"`
+	Updated  int            `json:"updated"`
+	Rejected int            `json:"rejected"`
+	Rows     []ImportResult `json:"rows"`
+}
+
+// ParseCatalogCSV reads products from CSV. The header row names the columns,
+// so they may appear in any order; id and sku are optional but at least one
+// of them is needed to update an existing product.
+func ParseCatalogCSV(r io.Reader) ([]ImportRow, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("error reading CSV header: %v", err)
+	}
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, required := range []string{"name", "category", "price", "stock"} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("CSV header is missing the %q column", required)
+		}
+	}
+
+	var rows []ImportRow
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading CSV: %v", err)
+		}
+		line, _ := reader.FieldPos(0)
+		row := ImportRow{Line: line}
+
+		field := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		row.Product.SKU = field("sku")
+		row.Product.Name = field("name")
+		row.Product.Category = field("category")
+		row.Product.Image = field("image")
+		if value := field("id"); value != "" {
+			if row.Product.ID, err = strconv.Atoi(value); err != nil {
+				row.Errors = append(row.Errors, fmt.Sprintf("invalid id %q", value))
+			}
+		}
+		if row.Product.Price, err = strconv.ParseFloat(field("price"), 64); err != nil {
+			row.Errors = append(row.Errors, fmt.Sprintf("invalid price %q", field("price")))
+		}
+		if row.Product.Stock, err = strconv.Atoi(field("stock")); err != nil {
+			row.Errors = append(row.Errors, fmt.Sprintf("invalid stock %q", field("stock")))
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// ParseCatalogJSON reads products in the same {"products": [...]} format as products.json
+func ParseCatalogJSON(r io.Reader) ([]ImportRow, error) {
+	var productData ProductData
+	if err := json.NewDecoder(r).Decode(&productData); err != nil {
+		return nil, fmt.Errorf("error parsing products data: %v", err)
+	}
+	rows := make([]ImportRow, len(productData.Products))
+	for i, product := range productData.Products {
+		// JSON has no line numbers, so rows are numbered by position
+		rows[i] = ImportRow{Line: i + 1, Product: product}
+	}
+	return rows, nil
+}
+
+// validateProduct returns the problems with a product's fields
+func validateProduct(p Product) []string {
+	var problems []string
+	if p.ID < 0 {
+		problems = append(problems, "id cannot be negative")
+	}
+	if p.Name == "" {
+		problems = append(problems, "name is required")
+	}
+	if !knownCategories[p.Category] {
+		problems = append(problems, fmt.Sprintf("unknown category %q", p.Category))
+	}
+	if p.Price <= 0 {
+		problems = append(problems, "price must be greater than zero")
+	}
+	if p.Stock < 0 {
+		problems = append(problems, "stock cannot be negative")
+	}
+	return problems
+}
+
+// ImportCatalog upserts products into the catalog. Rows are matched to
+// existing products by ID, then by SKU; unmatched rows create new products.
+// Rejected rows are skipped and reported, the rest are applied unless dryRun
+// is set, in which case the report shows what would have happened. The
+// catalog, locations and ledger are saved together; if any of them fails to
+// save the whole import is undone and the error returned. Products whose
+// stock rises fill the orders waiting on them.
+func (s *Store) ImportCatalog(ctx context.Context, rows []ImportRow, dryRun bool) (*ImportReport, error) {
+	s.mu.Lock()
+	report, filled, err := s.importCatalog(ctx, rows, dryRun)
+	s.mu.Unlock()
+	s.backordersFilled(ctx, filled)
+	return report, err
+}
+
+// importCatalog does the work of ImportCatalog and returns the backorders it
+// filled. The caller must hold s.mu.
+func (s *Store) importCatalog(ctx context.Context, rows []ImportRow, dryRun bool) (*ImportReport, []*Order, error) {
+	report := &ImportReport{DryRun: dryRun, Rows: make([]ImportResult, 0, len(rows))}
+	previous := make(map[int]Product, len(s.catalog))
+	for id, product := range s.catalog {
+		previous[id] = *product
+	}
+	snapshot := s.snapshotStock(slices.Collect(maps.Keys(s.catalog))...)
+	type change struct {
+		product       *Product
+		previousStock int
+	}
+	var changed []change
+
+	skuIndex := make(map[string]int)
+	nextID := 1
+	for id, product := range s.catalog {
+		if product.SKU != "" {
+			skuIndex[product.SKU] = id
+		}
+		if id >= nextID {
+			nextID = id + 1
+		}
+	}
+
+	seenIDs := make(map[int]int)
+	seenSKUs := make(map[string]int)
+	for _, row := range rows {
+		p := row.Product
+		result := ImportResult{Line: row.Line, ID: p.ID, SKU: p.SKU}
+		problems := append([]string(nil), row.Errors...)
+		if len(row.Errors) == 0 {
+			problems = append(problems, validateProduct(p)...)
+		}
+
+		// Resolve the product this row refers to
+		targetID := p.ID
+		if skuID, ok := skuIndex[p.SKU]; ok && p.SKU != "" {
+			if targetID == 0 {
+				targetID = skuID
+			} else if targetID != skuID {
+				problems = append(problems, fmt.Sprintf("sku %q belongs to product %d", p.SKU, skuID))
+			}
+		}
+		if targetID != 0 {
+			if line, dup := seenIDs[targetID]; dup {
+				problems = append(problems, fmt.Sprintf("duplicate id %d, first seen on line %d", targetID, line))
+			}
+		}
+		if p.SKU != "" {
+			if line, dup := seenSKUs[p.SKU]; dup {
+				problems = append(problems, fmt.Sprintf("duplicate sku %q, first seen on line %d", p.SKU, line))
+			}
+		}
+
+		if len(problems) > 0 {
+			result.Action = "rejected"
+			result.Errors = problems
+			report.Rejected++
+			report.Rows = append(report.Rows, result)
+			continue
+		}
+
+		if targetID == 0 {
+			targetID = nextID
+		}
+		if targetID >= nextID {
+			nextID = targetID + 1
+		}
+		seenIDs[targetID] = row.Line
+		if existing, ok := s.catalog[targetID]; ok && existing.SKU != "" && existing.SKU != p.SKU {
+			delete(skuIndex, existing.SKU)
+		}
+		if p.SKU != "" {
+			seenSKUs[p.SKU] = row.Line
+			skuIndex[p.SKU] = targetID
+		}
+		result.ID = targetID
+
+		existing, exists := s.catalog[targetID]
+		if exists {
+			result.Action = "updated"
+			report.Updated++
+		} else {
+			result.Action = "created"
+			report.Created++
+		}
+		report.Rows = append(report.Rows, result)
+
+		if dryRun {
+			continue
+		}
+		p.ID = targetID
+		if exists {
+			// Keep the uploaded thumbnail unless the import points somewhere else
+			if p.Image == "" || p.Image == existing.Image {
+				p.Image, p.Thumbnail = existing.Image, existing.Thumbnail
+			}
+			// Update in place so orders holding this product see the change
+			previousStock := existing.Stock
+			*existing = p
+			s.recordMovement(existing, p.Stock-previousStock, MovementAdjustment, "catalog import", actor(ctx), 0)
+			changed = append(changed, change{existing, previousStock})
+		} else {
+			newProduct := p
+			s.catalog[targetID] = &newProduct
+			s.recordMovement(&newProduct, p.Stock, MovementOpening, "catalog import", actor(ctx), 0)
+		}
+	}
+	if dryRun || report.Created+report.Updated == 0 {
+		return report, nil, nil
+	}
+
+	s.syncLocations()
+	saves := []func() error{s.saveStock, s.saveLocations, s.saveLedger}
+	for i, save := range saves {
+		err := save()
+		if err == nil {
+			continue
+		}
+		// Put the catalog back in place so orders holding its products
+		// see the old values again
+		for id, product := range s.catalog {
+			if old, ok := previous[id]; ok {
+				*product = old
+			} else {
+				delete(s.catalog, id)
+			}
+		}
+		s.restoreStock(snapshot)
+		s.syncLocations()
+		for _, undo := range saves[:i] {
+			if undoErr := undo(); undoErr != nil {
+				s.logger.Error("error undoing a catalog import", "error", undoErr)
+			}
+		}
+		return nil, nil, err
+	}
+	var filled []*Order
+	for _, c := range changed {
+		s.productChanged(c.product, c.previousStock)
+		if c.product.Stock > c.previousStock {
+			orders, err := s.fillBackorders(c.product.ID)
+			if err != nil {
+				s.log(ctx).Error("error filling backorders", "productId", c.product.ID, "error", err)
+			}
+			filled = append(filled, orders...)
+		}
+	}
+	return report, filled, nil
+}
+
+// Products returns a copy of every catalog product, ordered by ID
+func (s *Store) Products() []Product {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.productsLocked()
+}
+
+// productsLocked is Products for callers that already hold s.mu
+func (s *Store) productsLocked() []Product {
+	products := make([]Product, 0, len(s.catalog))
+	for _, product := range s.catalog {
+		products = append(products, *product)
+	}
+	sort.Slice(products, func(i, j int) bool { return products[i].ID < products[j].ID })
+	return products
+}
+
+// ExportCatalogCSV writes the catalog with its live stock as CSV
+func (s *Store) ExportCatalogCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(catalogColumns); err != nil {
+		return fmt.Errorf("error writing catalog CSV: %v", err)
+	}
+	for _, p := range s.Products() {
+		record := []string{
+			strconv.Itoa(p.ID),
+			p.SKU,
+			p.Name,
+			p.Category,
+			strconv.FormatFloat(p.Price, 'f', -1, 64),
+			strconv.Itoa(p.Stock),
+			p.Image,
+		}
+		if err := cw.Write(record); err != nil {
+			return fmt.Errorf("error writing catalog CSV: %v", err)
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// ExportCatalogJSON writes the catalog with its live stock in the products.json format
+func (s *Store) ExportCatalogJSON(w io.Writer) error {
+	return writeCatalogJSON(w, s.Products())
+}
+
+// writeCatalogJSON writes products in the products.json format
+func writeCatalogJSON(w io.Writer, products []Product) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(ProductData{Products: products}); err != nil {
+		return fmt.Errorf("error writing catalog JSON: %v", err)
+	}
+	return nil
+}
+
+// SaveCatalog writes the catalog to the live catalog in the data directory,
+// or without one back to the file it was loaded from
+func (s *Store) SaveCatalog() error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.saveCatalog()
+}
+
+// saveCatalog writes the catalog through a temporary file so readers never
+// see it half written. The caller must hold s.mu.
+func (s *Store) saveCatalog() error {
+	if s.dataDir != "" {
+		return s.writeJSONFile(productsFile, ProductData{Products: s.productsLocked()})
+	}
+	tmp := s.catalogFile + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("error writing products file: %v", err)
+	}
+	if err := writeCatalogJSON(file, s.productsLocked()); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("error writing products file: %v", err)
+	}
+	if err := os.Rename(tmp, s.catalogFile); err != nil {
+		return fmt.Errorf("error writing products file: %v", err)
+	}
+	return nil
+}
+
+// ParseCatalog reads import rows in the given format, "csv" or "json"
+func ParseCatalog(r io.Reader, format string) ([]ImportRow, error) {
+	switch format {
+	case "csv":
+		return ParseCatalogCSV(r)
+	case "json":
+		return ParseCatalogJSON(r)
+	default:
+		return nil, fmt.Errorf("unsupported catalog format %q", format)
+	}
+}
+
+// requestCatalogFormat works out the catalog format from ?format= or the Content-Type header
+func requestCatalogFormat(r *http.Request) string {
+	if format := r.URL.Query().Get("format"); format != "" {
+		return format
+	}
+	if strings.Contains(r.Header.Get("Content-Type"), "csv") {
+		return "csv"
+	}
+	return "json"
+}
+
+// handleImportCatalog serves POST /api/catalog/import?format=csv|json&dryRun=true
+func (s *Store) handleImportCatalog(w http.ResponseWriter, r *http.Request) {
+	dryRun, _ := strconv.ParseBool(r.URL.Query().Get("dryRun"))
+	rows, err := ParseCatalog(r.Body, requestCatalogFormat(r))
+	if err != nil {
+		s.writeError(w, r, badRequestBody(err))
+		return
+	}
+
+	report, err := s.ImportCatalog(r.Context(), rows, dryRun)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+
+	// Rejected rows only fail the request when nothing else was applied
+	status := http.StatusOK
+	if report.Rejected > 0 && report.Created+report.Updated == 0 {
+		status = http.StatusUnprocessableEntity
+	}
+	writeJSON(w, status, report)
+}
+
+// handleExportCatalog serves GET /api/catalog/export?format=csv|json
+func (s *Store) handleExportCatalog(w http.ResponseWriter, r *http.Request) {
+	var err error
+	switch format := r.URL.Query().Get("format"); format {
+	case "", "json":
+		w.Header().Set("Content-Type", "application/json")
+		err = s.ExportCatalogJSON(w)
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", "attachment; filename=\"catalog.csv\"")
+		err = s.ExportCatalogCSV(w)
+	default:
+		s.writeError(w, r, invalidRequest("unsupported catalog format %q, expected json or csv", format))
+		return
+	}
+	if err != nil {
+		// The response has started, so the error can only be logged
+		s.log(r.Context()).Error("error exporting catalog", "error", err)
+	}
+}
@@ -0,0 +1,214 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"example.com/lab-08/config"
+)
+
+const importCSV = `id,sku,name,category,price,stock
+1,APL-1,Apple,Grocery,45,80
+,TSH-RED,Red T-Shirt,Fashion,999,20
+4,,Phone,Gadgets,15000,5
+5,,Mango,Grocery,abc,10
+1,,Apple Again,Grocery,50,10
+`
+
+func TestParseCatalogCSV(t *testing.T) {
+	rows, err := ParseCatalogCSV(strings.NewReader(importCSV))
+	if err != nil {
+		t.Fatalf("Failed to parse CSV: %v", err)
+	}
+	if len(rows) != 5 {
+		t.Fatalf("Expected 5 rows, got %d", len(rows))
+	}
+	if rows[0].Line != 2 || rows[0].Product.SKU != "APL-1" || rows[0].Product.Price != 45 {
+		t.Errorf("Unexpected first row: %+v", rows[0])
+	}
+	if len(rows[3].Errors) != 1 {
+		t.Errorf("Expected a price error on line 5, got %v", rows[3].Errors)
+	}
+
+	if _, err := ParseCatalogCSV(strings.NewReader("id,name\n1,Apple\n")); err == nil {
+		t.Errorf("Expected error for missing columns, got nil")
+	}
+}
+
+func TestImportCatalog(t *testing.T) {
+	store := newTestStore()
+	store.InitializeCatalog()
+	rows, _ := ParseCatalogCSV(strings.NewReader(importCSV))
+
+	report, err := store.ImportCatalog(context.Background(), rows, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Created != 1 || report.Updated != 1 || report.Rejected != 3 {
+		t.Fatalf("Expected 1 created, 1 updated, 3 rejected, got %+v", report)
+	}
+
+	expected := []string{"updated", "created", "rejected", "rejected", "rejected"}
+	for i, action := range expected {
+		if report.Rows[i].Action != action {
+			t.Errorf("Line %d: expected %s, got %s (%v)", report.Rows[i].Line, action, report.Rows[i].Action, report.Rows[i].Errors)
+		}
+	}
+
+	apple, _ := store.GetProduct(1)
+	if apple.Price != 45 || apple.Stock != 80 || apple.SKU != "APL-1" {
+		t.Errorf("Expected Apple to be updated, got %+v", apple)
+	}
+	shirt, err := store.GetProduct(4)
+	if err != nil || shirt.Name != "Red T-Shirt" {
+		t.Errorf("Expected new product with ID 4, got %+v, %v", shirt, err)
+	}
+
+	// Upsert by SKU alone updates the same product
+	rows, _ = ParseCatalogCSV(strings.NewReader("sku,name,category,price,stock\nTSH-RED,Red T-Shirt,Fashion,899,15\n"))
+	report, _ = store.ImportCatalog(context.Background(), rows, false)
+	if report.Updated != 1 || report.Rows[0].ID != 4 {
+		t.Errorf("Expected SKU match to update product 4, got %+v", report.Rows)
+	}
+}
+
+func TestImportCatalogDryRun(t *testing.T) {
+	store := newTestStore()
+	store.InitializeCatalog()
+	rows, _ := ParseCatalogCSV(strings.NewReader(importCSV))
+
+	report, _ := store.ImportCatalog(context.Background(), rows, true)
+	if !report.DryRun || report.Updated != 1 || report.Created != 1 {
+		t.Errorf("Expected dry run report with 1 update and 1 create, got %+v", report)
+	}
+	if apple, _ := store.GetProduct(1); apple.Price != 40 {
+		t.Errorf("Dry run changed the catalog: %+v", apple)
+	}
+	if _, err := store.GetProduct(4); err == nil {
+		t.Errorf("Dry run created a product")
+	}
+}
+
+func TestExportCatalogRoundTrip(t *testing.T) {
+	store := newTestStore()
+	store.InitializeCatalog()
+	product, _ := store.GetProduct(2)
+	store.CreateOrder(context.Background(), product, 3)
+
+	var buf bytes.Buffer
+	if err := store.ExportCatalogCSV(&buf); err != nil {
+		t.Fatalf("Failed to export: %v", err)
+	}
+	if !strings.Contains(buf.String(), "2,,Laptop,Electronics,82000,7") {
+		t.Errorf("Expected export to contain live Laptop stock, got:\n%s", buf.String())
+	}
+
+	rows, err := ParseCatalogCSV(&buf)
+	if err != nil {
+		t.Fatalf("Failed to parse exported CSV: %v", err)
+	}
+	report, _ := newTestStore().ImportCatalog(context.Background(), rows, true)
+	if report.Rejected != 0 || report.Created != 3 {
+		t.Errorf("Expected exported catalog to import cleanly, got %+v", report)
+	}
+}
+
+func TestHandleImportCatalog(t *testing.T) {
+	dir := t.TempDir()
+	data, _ := os.ReadFile(testCatalog)
+	cfg := config.Default()
+	cfg.Store.CatalogFile = filepath.Join(dir, "products.json")
+	cfg.Store.DataDir = filepath.Join(dir, "data")
+	os.WriteFile(cfg.Store.CatalogFile, data, 0o644)
+	store, err := Open(cfg)
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/catalog/import", strings.NewReader(
+		"id,name,category,price,stock\n3,T-Shirt,Fashion,1200,40\n"))
+	req.Header.Set("Content-Type", "text/csv")
+	rec := httptest.NewRecorder()
+	store.handleImportCatalog(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	// Valid rows are applied even when others are rejected
+	req = httptest.NewRequest(http.MethodPost, "/api/catalog/import?format=csv", strings.NewReader(
+		"id,name,category,price,stock\n1,Apple,Grocery,50,100\n3,T-Shirt,Toys,1200,40\n"))
+	rec = httptest.NewRecorder()
+	store.handleImportCatalog(rec, req)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"rejected":1`) {
+		t.Errorf("Expected status 200 with the rejected row reported, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/api/catalog/import?format=csv", strings.NewReader(
+		"id,name,category,price,stock\n3,T-Shirt,Toys,1200,40\n"))
+	rec = httptest.NewRecorder()
+	store.handleImportCatalog(rec, req)
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422 when every row was rejected, got %d", rec.Code)
+	}
+	store.Close()
+
+	// The import is saved with the store
+	reloaded, err := Open(cfg)
+	if err != nil {
+		t.Fatalf("Failed to reopen store: %v", err)
+	}
+	defer reloaded.Close()
+	shirt, _ := reloaded.GetProduct(3)
+	apple, _ := reloaded.GetProduct(1)
+	if shirt.Price != 1200 || shirt.Stock != 40 || apple.Price != 50 {
+		t.Errorf("Expected the imported prices to be saved, got %+v and %+v", shirt, apple)
+	}
+	if drift, _ := reloaded.ReconcileStock(context.Background(), false); drift.Drifted != 0 {
+		t.Errorf("Expected the saved ledger to match the saved stock, got %+v", drift)
+	}
+}
+
+func TestImportCatalogUndoneWhenSaveFails(t *testing.T) {
+	dir := t.TempDir()
+	data, _ := os.ReadFile(testCatalog)
+	cfg := config.Default()
+	cfg.Store.CatalogFile = filepath.Join(dir, "products.json")
+	cfg.Store.DataDir = filepath.Join(dir, "data")
+	os.WriteFile(cfg.Store.CatalogFile, data, 0o644)
+	store, err := Open(cfg)
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	defer store.Close()
+
+	// A directory in the way of the ledger's temporary file fails its save
+	blocker := filepath.Join(cfg.Store.DataDir, ledgerFile+".tmp")
+	os.MkdirAll(blocker, 0o755)
+	rows, _ := ParseCatalogCSV(strings.NewReader(importCSV))
+	if _, err := store.ImportCatalog(context.Background(), rows, false); err == nil {
+		t.Fatal("Expected the import to fail when the ledger cannot be saved")
+	}
+	if apple, _ := store.GetProduct(1); apple.Price != 40 || apple.Stock != 100 || apple.SKU != "" {
+		t.Errorf("Expected Apple to be left as it was, got %+v", apple)
+	}
+	if _, err := store.GetProduct(4); err == nil {
+		t.Error("Expected the new product to be dropped")
+	}
+	if availability, _ := store.Availability(1, ""); len(availability) != 1 || availability[0].Stock != 100 {
+		t.Errorf("Expected the default location to hold 100 apples, got %+v", availability)
+	}
+
+	var saved ProductData
+	live, _ := os.ReadFile(filepath.Join(cfg.Store.DataDir, productsFile))
+	json.Unmarshal(live, &saved)
+	if len(saved.Products) != 3 || saved.Products[0].Stock != 100 {
+		t.Errorf("Expected the saved catalog to be written back, got %+v", saved.Products)
+	}
+}
@@ -0,0 +1,606 @@
+package store
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// customerCookie holds the session token of a signed in customer. It is
+// separate from the staff cookie so one browser can hold both.
+const customerCookie = "store_customer_session"
+
+// minPasswordLength is the shortest password a customer may choose
+const minPasswordLength = 8
+
+// pincodePattern matches a six digit Indian postal code
+var pincodePattern = regexp.MustCompile(`^[1-9][0-9]{5}$`)
+
+// Address is a delivery address in a customer's profile
+type Address struct {
+	ID      int    `json:"id"`
+	Label   string `json:"label,omitempty"` // e.g. "Home" or "Office"
+	Name    string `json:"name"`
+	Line1   string `json:"line1"`
+	Line2   string `json:"line2,omitempty"`
+	City    string `json:"city"`
+	State   string `json:"state,omitempty"`
+	Pincode string `json:"pincode"`
+	Phone   string `json:"phone,omitempty"`
+	Default bool   `json:"default"`
+}
+
+// String formats the address on one line, as printed on an invoice
+func (a *Address) String() string {
+	parts := []string{a.Line1, a.Line2, a.City, a.State}
+	parts = slices.DeleteFunc(parts, func(part string) bool { return part == "" })
+	return strings.Join(parts, ", ") + " " + a.Pincode
+}
+
+// validate returns the problems with an address's fields
+func (a *Address) validate() []string {
+	var problems []string
+	if strings.TrimSpace(a.Name) == "" {
+		problems = append(problems, "name is required")
+	}
+	if strings.TrimSpace(a.Line1) == "" {
+		problems = append(problems, "line1 is required")
+	}
+	if strings.TrimSpace(a.City) == "" {
+		problems = append(problems, "city is required")
+	}
+	if !pincodePattern.MatchString(a.Pincode) {
+		problems = append(problems, fmt.Sprintf("pincode %q must be six digits", a.Pincode))
+	}
+	return problems
+}
+
+// Customer is a shopper with an account. Customers can still check out
+// without one.
+type Customer struct {
+	ID           int       `json:"id"`
+	Email        string    `json:"email"`
+	Name         string    `json:"name"`
+	PasswordHash string    `json:"passwordHash,omitempty"`
+	Addresses    []Address `json:"addresses"`
+	CreatedAt    time.Time `json:"createdAt"`
+	// Kept with the account but served by their own endpoints, so left out
+	// of the profile
+	Wishlist      []WishlistItem `json:"wishlist,omitempty"`
+	SavedCarts    []SavedCart    `json:"savedCarts,omitempty"`
+	Notifications []Notification `json:"notifications,omitempty"`
+}
+
+// public returns a copy of the customer's profile without the password hash
+func (c *Customer) public() *Customer {
+	copied := *c
+	copied.PasswordHash = ""
+	copied.Addresses = slices.Clone(c.Addresses)
+	copied.Wishlist, copied.SavedCarts, copied.Notifications = nil, nil, nil
+	return &copied
+}
+
+// address returns the customer's address with the given ID, or the default
+// address when id is 0. It returns nil when the customer has no addresses.
+func (c *Customer) address(id int) (*Address, error) {
+	for i := range c.Addresses {
+		if c.Addresses[i].ID == id || id == 0 && c.Addresses[i].Default {
+			address := c.Addresses[i]
+			return &address, nil
+		}
+	}
+	if id == 0 {
+		return nil, nil
+	}
+	return nil, ErrAddressNotFound
+}
+
+// customerKey is the context key for the signed in customer
+type customerKey struct{}
+
+// withCustomer returns a copy of ctx carrying the signed in customer
+func withCustomer(ctx context.Context, customer *Customer) context.Context {
+	return context.WithValue(ctx, customerKey{}, customer)
+}
+
+// CustomerFromContext returns the signed in customer carried by ctx, or nil
+func CustomerFromContext(ctx context.Context) *Customer {
+	customer, _ := ctx.Value(customerKey{}).(*Customer)
+	return customer
+}
+
+// OrderOwner says who an order belongs to: a customer and the address to
+// deliver to, or for an anonymous order the claim code that links it to an
+// account later. Orders placed together share one owner.
+type OrderOwner struct {
+	CustomerID int
+	Address    *Address
+	ClaimCode  string
+}
+
+// orderOwnerKey is the context key for the owner of the orders a request places
+type orderOwnerKey struct{}
+
+// WithOrderOwner returns a copy of ctx whose orders are placed for owner
+func WithOrderOwner(ctx context.Context, owner OrderOwner) context.Context {
+	return context.WithValue(ctx, orderOwnerKey{}, owner)
+}
+
+// orderOwner returns the owner carried by ctx. Without one the order is
+// anonymous and gets a claim code of its own.
+func orderOwner(ctx context.Context) OrderOwner {
+	owner, _ := ctx.Value(orderOwnerKey{}).(OrderOwner)
+	if owner.CustomerID == 0 && owner.ClaimCode == "" {
+		owner.ClaimCode = newClaimCode()
+	}
+	return owner
+}
+
+// claimAlphabet leaves out letters and digits that are easily confused
+const claimAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+// newClaimCode returns a code like "K7QM-2XDA" for linking anonymous orders
+// to an account
+func newClaimCode() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	code := make([]byte, 0, 9)
+	for i, c := range b {
+		if i == 4 {
+			code = append(code, '-')
+		}
+		code = append(code, claimAlphabet[int(c)%len(claimAlphabet)])
+	}
+	return string(code)
+}
+
+// RegisterCustomer creates a customer account and signs the customer in,
+// returning the session token and when it expires
+func (s *Store) RegisterCustomer(email, name, password string) (*Customer, string, time.Time, error) {
+	address, err := mail.ParseAddress(email)
+	if err != nil || address.Address != strings.TrimSpace(email) {
+		return nil, "", time.Time{}, ErrInvalidEmail
+	}
+	if len(password) < minPasswordLength {
+		return nil, "", time.Time{}, ErrWeakPassword
+	}
+	customer := &Customer{
+		Email:        strings.ToLower(address.Address),
+		Name:         strings.TrimSpace(name),
+		PasswordHash: hashPassword(password),
+		Addresses:    []Address{},
+		CreatedAt:    time.Now(),
+	}
+
+	s.authMu.Lock()
+	defer s.authMu.Unlock()
+	for _, existing := range s.customers {
+		if existing.Email == customer.Email {
+			return nil, "", time.Time{}, ErrCustomerExists
+		}
+		customer.ID = max(customer.ID, existing.ID)
+	}
+	customer.ID++
+	s.customers[customer.ID] = customer
+	if err := s.saveCustomers(); err != nil {
+		delete(s.customers, customer.ID)
+		return nil, "", time.Time{}, err
+	}
+	token, expires := s.startSession(&session{customerID: customer.ID})
+	s.logger.Info("customer registered", "customerId", customer.ID)
+	return customer.public(), token, expires, nil
+}
+
+// LoginCustomer checks a customer's password and starts a session
+func (s *Store) LoginCustomer(email, password string) (*Customer, string, time.Time, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	s.authMu.Lock()
+	var customer *Customer
+	for _, candidate := range s.customers {
+		if candidate.Email == email {
+			customer = candidate
+		}
+	}
+	s.authMu.Unlock()
+
+	hash := dummyPasswordHash
+	if customer != nil {
+		hash = customer.PasswordHash
+	}
+	if !checkPassword(hash, password) || hash == dummyPasswordHash {
+		s.logger.Warn("customer login failed")
+		return nil, "", time.Time{}, ErrInvalidCredentials
+	}
+
+	s.authMu.Lock()
+	defer s.authMu.Unlock()
+	token, expires := s.startSession(&session{customerID: customer.ID})
+	s.logger.Info("customer logged in", "customerId", customer.ID)
+	return customer.public(), token, expires, nil
+}
+
+// Customer returns a customer's profile without the password hash
+func (s *Store) Customer(id int) (*Customer, error) {
+	s.authMu.Lock()
+	defer s.authMu.Unlock()
+	customer, ok := s.customers[id]
+	if !ok {
+		return nil, ErrCustomerNotFound
+	}
+	return customer.public(), nil
+}
+
+// UpdateCustomerName changes the name on a customer's profile
+func (s *Store) UpdateCustomerName(id int, name string) (*Customer, error) {
+	s.authMu.Lock()
+	defer s.authMu.Unlock()
+	customer, ok := s.customers[id]
+	if !ok {
+		return nil, ErrCustomerNotFound
+	}
+	previous := customer.Name
+	customer.Name = strings.TrimSpace(name)
+	if err := s.saveCustomers(); err != nil {
+		customer.Name = previous
+		return nil, err
+	}
+	return customer.public(), nil
+}
+
+// SaveAddress adds an address to a customer's profile, or replaces the one
+// with the same ID. The first address, or one marked default, becomes the
+// default for checkout.
+func (s *Store) SaveAddress(customerID int, address Address) (*Address, error) {
+	if problems := address.validate(); len(problems) > 0 {
+		return nil, &InvalidAddressError{Problems: problems}
+	}
+
+	s.authMu.Lock()
+	defer s.authMu.Unlock()
+	customer, ok := s.customers[customerID]
+	if !ok {
+		return nil, ErrCustomerNotFound
+	}
+	previous := slices.Clone(customer.Addresses)
+	index := -1
+	for i, existing := range customer.Addresses {
+		if address.ID != 0 && existing.ID == address.ID {
+			index = i
+		}
+	}
+	switch {
+	case index >= 0:
+		customer.Addresses[index] = address
+	case address.ID != 0:
+		return nil, ErrAddressNotFound
+	default:
+		for _, existing := range customer.Addresses {
+			address.ID = max(address.ID, existing.ID)
+		}
+		address.ID++
+		customer.Addresses = append(customer.Addresses, address)
+		index = len(customer.Addresses) - 1
+	}
+	if address.Default || len(customer.Addresses) == 1 {
+		for i := range customer.Addresses {
+			customer.Addresses[i].Default = i == index
+		}
+	}
+	if err := s.saveCustomers(); err != nil {
+		customer.Addresses = previous
+		return nil, err
+	}
+	saved := customer.Addresses[index]
+	return &saved, nil
+}
+
+// DeleteAddress removes an address from a customer's profile. If it was the
+// default, the first remaining address becomes the default.
+func (s *Store) DeleteAddress(customerID, addressID int) error {
+	s.authMu.Lock()
+	defer s.authMu.Unlock()
+	customer, ok := s.customers[customerID]
+	if !ok {
+		return ErrCustomerNotFound
+	}
+	index := slices.IndexFunc(customer.Addresses, func(a Address) bool { return a.ID == addressID })
+	if index < 0 {
+		return ErrAddressNotFound
+	}
+	previous := slices.Clone(customer.Addresses)
+	wasDefault := customer.Addresses[index].Default
+	customer.Addresses = slices.Delete(customer.Addresses, index, index+1)
+	if wasDefault && len(customer.Addresses) > 0 {
+		customer.Addresses[0].Default = true
+	}
+	if err := s.saveCustomers(); err != nil {
+		customer.Addresses = previous
+		return err
+	}
+	return nil
+}
+
+// CustomerOrders returns copies of a customer's orders, newest first
+func (s *Store) CustomerOrders(customerID int) []*Order {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	orders := []*Order{}
+	for i := len(s.orders) - 1; i >= 0; i-- {
+		if s.orders[i].CustomerID == customerID {
+			orders = append(orders, copyOrder(s.orders[i]))
+		}
+	}
+	return orders
+}
+
+// ClaimOrders links the anonymous orders placed with a claim code to a
+// customer and returns copies of them. The code is used up once claimed.
+func (s *Store) ClaimOrders(customerID int, claimCode string) ([]*Order, error) {
+	claimCode = strings.ToUpper(strings.TrimSpace(claimCode))
+	if claimCode == "" {
+		return nil, ErrOrderNotFound
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var claimed []*Order
+	for _, order := range s.orders {
+		if order.CustomerID == 0 && order.ClaimCode == claimCode {
+			claimed = append(claimed, order)
+		}
+	}
+	if len(claimed) == 0 {
+		return nil, ErrOrderNotFound
+	}
+	for _, order := range claimed {
+		order.CustomerID, order.ClaimCode = customerID, ""
+	}
+	if err := s.saveOrders(); err != nil {
+		for _, order := range claimed {
+			order.CustomerID, order.ClaimCode = 0, claimCode
+		}
+		return nil, err
+	}
+	s.logger.Info("orders claimed", "customerId", customerID, "orders", len(claimed))
+	for i, order := range claimed {
+		claimed[i] = copyOrder(order)
+	}
+	return claimed, nil
+}
+
+// canAccessOrder reports whether a request may see an order's details:
+// staff, the customer the order belongs to, or for an anonymous order
+// whoever sends its claim code in the claimCode query parameter
+func (s *Store) canAccessOrder(r *http.Request, order *Order) bool {
+	if user := UserFromContext(r.Context()); !s.authEnabled || user != nil && user.Role.Allows(RoleViewer) {
+		return true
+	}
+	claimCode := strings.ToUpper(strings.TrimSpace(r.URL.Query().Get("claimCode")))
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if order.CustomerID != 0 {
+		customer := CustomerFromContext(r.Context())
+		return customer != nil && customer.ID == order.CustomerID
+	}
+	return claimCode != "" && subtle.ConstantTimeCompare([]byte(claimCode), []byte(order.ClaimCode)) == 1
+}
+
+// placedOrder is an order with its claim code, which is only saved and
+// returned to the request that placed the order
+type placedOrder struct {
+	*Order
+	ClaimCode string `json:"claimCode,omitempty"`
+}
+
+// placedOrders pairs orders with their claim codes. The caller must hold s.mu.
+func placedOrders(orders []*Order) []placedOrder {
+	placed := make([]placedOrder, len(orders))
+	for i, order := range orders {
+		placed[i] = placedOrder{Order: order, ClaimCode: order.ClaimCode}
+	}
+	return placed
+}
+
+// authenticateCustomer returns the customer a request's session belongs
+// to. It returns nil and no error for a request without a customer session,
+// and ErrInvalidCredentials for an unknown or expired one.
+func (s *Store) authenticateCustomer(r *http.Request) (*Customer, error) {
+	token := sessionToken(r, customerCookie)
+	if token == "" {
+		return nil, nil
+	}
+	s.authMu.Lock()
+	defer s.authMu.Unlock()
+	sess, ok := s.lookupSession(token)
+	if !ok {
+		return nil, ErrInvalidCredentials
+	}
+	if sess.customerID == 0 {
+		return nil, nil
+	}
+	customer, ok := s.customers[sess.customerID]
+	if !ok {
+		return nil, ErrInvalidCredentials
+	}
+	return customer.public(), nil
+}
+
+// requestOrderOwner works out who the orders a request places belong to:
+// the signed in customer with the chosen or default address, or nobody
+func (s *Store) requestOrderOwner(r *http.Request, addressID int) (OrderOwner, error) {
+	customer := CustomerFromContext(r.Context())
+	if customer == nil {
+		if addressID != 0 {
+			return OrderOwner{}, invalidRequest("sign in to deliver to a saved address")
+		}
+		return OrderOwner{ClaimCode: newClaimCode()}, nil
+	}
+	address, err := customer.address(addressID)
+	if err != nil {
+		return OrderOwner{}, err
+	}
+	return OrderOwner{CustomerID: customer.ID, Address: address}, nil
+}
+
+// writeCustomerSession sends a customer and their new session, also set in
+// the customer session cookie
+func writeCustomerSession(w http.ResponseWriter, r *http.Request, status int, customer *Customer, token string, expires time.Time) {
+	setSessionCookie(w, r, customerCookie, token, expires)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]any{"token": token, "expiresAt": expires, "customer": customer})
+}
+
+// handleRegisterCustomer serves POST /api/customers/register
+func (s *Store) handleRegisterCustomer(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Email    string `json:"email"`
+		Name     string `json:"name"`
+		Password string `json:"password"`
+	}
+	if err := decodeJSON(r, &request); err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	customer, token, expires, err := s.RegisterCustomer(request.Email, request.Name, request.Password)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	writeCustomerSession(w, r, http.StatusCreated, customer, token, expires)
+}
+
+// handleCustomerLogin serves POST /api/customers/login
+func (s *Store) handleCustomerLogin(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Email    string `json:"email"`
+		Password string `json:"password"`
+	}
+	if err := decodeJSON(r, &request); err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	customer, token, expires, err := s.LoginCustomer(request.Email, request.Password)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	writeCustomerSession(w, r, http.StatusOK, customer, token, expires)
+}
+
+// handleCustomerLogout serves POST /api/customers/logout
+func (s *Store) handleCustomerLogout(w http.ResponseWriter, r *http.Request) {
+	if token := sessionToken(r, customerCookie); token != "" {
+		s.Logout(token)
+	}
+	setSessionCookie(w, r, customerCookie, "", time.Time{})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleGetProfile serves GET /api/me
+func (s *Store) handleGetProfile(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(CustomerFromContext(r.Context()))
+}
+
+// handleUpdateProfile serves PUT /api/me
+func (s *Store) handleUpdateProfile(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Name string `json:"name"`
+	}
+	if err := decodeJSON(r, &request); err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	customer, err := s.UpdateCustomerName(CustomerFromContext(r.Context()).ID, request.Name)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(customer)
+}
+
+// handleListAddresses serves GET /api/me/addresses
+func (s *Store) handleListAddresses(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(CustomerFromContext(r.Context()).Addresses)
+}
+
+// handleSaveAddress serves POST /api/me/addresses and PUT /api/me/addresses/{id}
+func (s *Store) handleSaveAddress(w http.ResponseWriter, r *http.Request) {
+	var address Address
+	if err := decodeJSON(r, &address); err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	address.ID = 0
+	status := http.StatusCreated
+	if id := r.PathValue("id"); id != "" {
+		addressID, err := strconv.Atoi(id)
+		if err != nil {
+			s.writeError(w, r, invalidRequest("invalid address ID"))
+			return
+		}
+		address.ID, status = addressID, http.StatusOK
+	}
+	saved, err := s.SaveAddress(CustomerFromContext(r.Context()).ID, address)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(saved)
+}
+
+// handleDeleteAddress serves DELETE /api/me/addresses/{id}
+func (s *Store) handleDeleteAddress(w http.ResponseWriter, r *http.Request) {
+	addressID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		s.writeError(w, r, invalidRequest("invalid address ID"))
+		return
+	}
+	if err := s.DeleteAddress(CustomerFromContext(r.Context()).ID, addressID); err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleMyOrders serves GET /api/me/orders
+func (s *Store) handleMyOrders(w http.ResponseWriter, r *http.Request) {
+	orders := s.CustomerOrders(CustomerFromContext(r.Context()).ID)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(orders)
+}
+
+// handleClaimOrders serves POST /api/me/orders/claim, linking the orders of
+// an anonymous checkout to the signed in customer
+func (s *Store) handleClaimOrders(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		ClaimCode string `json:"claimCode"`
+	}
+	if err := decodeJSON(r, &request); err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	orders, err := s.ClaimOrders(CustomerFromContext(r.Context()).ID, request.ClaimCode)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(orders)
+}
@@ -0,0 +1,231 @@
+package store
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// customerRequest serves a request sent with a customer's session token, if
+// one is given
+func customerRequest(handler http.Handler, method, path, body, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+// registerCustomer creates a customer account and returns its session token
+func registerCustomer(t *testing.T, store *Store, email string) string {
+	t.Helper()
+	_, token, _, err := store.RegisterCustomer(email, "Test Customer", "correct horse")
+	if err != nil {
+		t.Fatalf("Failed to register %s: %v", email, err)
+	}
+	return token
+}
+
+func TestRegisterAndLoginCustomer(t *testing.T) {
+	store := newTestStore()
+	handler := store.Routes("../static")
+	defer store.Close()
+
+	rec := customerRequest(handler, http.MethodPost, "/api/customers/register", `{"email": "Meera@example.com", "name": "Meera", "password": "correct horse"}`, "")
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected the account to be created, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var session struct {
+		Token    string   `json:"token"`
+		Customer Customer `json:"customer"`
+	}
+	json.NewDecoder(rec.Body).Decode(&session)
+	cookies := rec.Result().Cookies()
+	if session.Customer.Email != "meera@example.com" || session.Customer.PasswordHash != "" ||
+		len(cookies) != 1 || cookies[0].Name != customerCookie || cookies[0].Value != session.Token {
+		t.Fatalf("Expected a signed in customer without secrets, got %+v, %v", session, cookies)
+	}
+
+	for _, body := range []string{
+		`{"email": "meera@example.com", "password": "another one"}`,
+		`{"email": "not an email", "password": "correct horse"}`,
+		`{"email": "ravi@example.com", "password": "short"}`,
+	} {
+		if rec := customerRequest(handler, http.MethodPost, "/api/customers/register", body, ""); rec.Code != http.StatusConflict && rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected %s to be refused, got %d", body, rec.Code)
+		}
+	}
+	if rec := customerRequest(handler, http.MethodPost, "/api/customers/login", `{"email": "meera@example.com", "password": "wrong"}`, ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected a wrong password to be refused, got %d", rec.Code)
+	}
+	rec = customerRequest(handler, http.MethodPost, "/api/customers/login", `{"email": "MEERA@example.com", "password": "correct horse"}`, "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected to log in, got %d: %s", rec.Code, rec.Body.String())
+	}
+	json.NewDecoder(rec.Body).Decode(&session)
+
+	// The cookie and the bearer token both sign the customer in
+	req := httptest.NewRequest(http.MethodGet, "/api/me", nil)
+	req.AddCookie(cookies[0])
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected the cookie to sign in, got %d", rec.Code)
+	}
+	if rec := customerRequest(handler, http.MethodPut, "/api/me", `{"name": "Meera K"}`, session.Token); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "Meera K") {
+		t.Errorf("Expected the name to change, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	// Customer and staff sessions do not stand in for each other
+	if rec := staffRequest(handler, http.MethodGet, "/api/me", "", staffKey(t, store, RoleAdmin)); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected staff to need a customer session, got %d", rec.Code)
+	}
+	if rec := customerRequest(handler, http.MethodGet, "/api/auth/me", "", session.Token); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected a customer session to give no staff access, got %d", rec.Code)
+	}
+
+	customerRequest(handler, http.MethodPost, "/api/customers/logout", "", session.Token)
+	if rec := customerRequest(handler, http.MethodGet, "/api/me", "", session.Token); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected the session to be over, got %d", rec.Code)
+	}
+}
+
+func TestCustomerAddresses(t *testing.T) {
+	store := newTestStore()
+	handler := store.Routes("../static")
+	defer store.Close()
+	token := registerCustomer(t, store, "asha@example.com")
+
+	home := `{"label": "Home", "name": "Asha", "line1": "12 MG Road", "city": "Bengaluru", "pincode": "560001"}`
+	office := `{"label": "Office", "name": "Asha", "line1": "4 Park Street", "city": "Kolkata", "pincode": "700016", "default": true}`
+	for _, body := range []string{home, office} {
+		if rec := customerRequest(handler, http.MethodPost, "/api/me/addresses", body, token); rec.Code != http.StatusCreated {
+			t.Fatalf("Expected the address to be added, got %d: %s", rec.Code, rec.Body.String())
+		}
+	}
+	rec := customerRequest(handler, http.MethodPost, "/api/me/addresses", `{"name": "Asha", "line1": "x", "city": "y", "pincode": "12"}`, token)
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), CodeInvalidAddress) {
+		t.Errorf("Expected a bad pincode to be refused, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := customerRequest(handler, http.MethodPut, "/api/me/addresses/9", home, token); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected an unknown address to be a 404, got %d", rec.Code)
+	}
+
+	var addresses []Address
+	json.NewDecoder(customerRequest(handler, http.MethodGet, "/api/me/addresses", "", token).Body).Decode(&addresses)
+	if len(addresses) != 2 || addresses[0].Default || !addresses[1].Default {
+		t.Fatalf("Expected the office to be the default, got %+v", addresses)
+	}
+
+	// Removing the default makes the remaining address the default
+	if rec := customerRequest(handler, http.MethodDelete, "/api/me/addresses/2", "", token); rec.Code != http.StatusNoContent {
+		t.Fatalf("Expected the address to be removed, got %d", rec.Code)
+	}
+	json.NewDecoder(customerRequest(handler, http.MethodGet, "/api/me/addresses", "", token).Body).Decode(&addresses)
+	if len(addresses) != 1 || addresses[0].Label != "Home" || !addresses[0].Default {
+		t.Errorf("Expected home to be the default, got %+v", addresses)
+	}
+}
+
+func TestCustomerOrders(t *testing.T) {
+	store := newTestStore()
+	store.InitializeCatalog()
+	handler := store.Routes("../static")
+	defer store.Close()
+	token := registerCustomer(t, store, "asha@example.com")
+	store.SaveAddress(1, Address{Name: "Asha", Line1: "12 MG Road", City: "Bengaluru", Pincode: "560001"})
+
+	// A signed in checkout goes to the default address
+	rec := customerRequest(handler, http.MethodPost, "/api/checkout", `[{"product": {"id": 1}, "quantity": 1}, {"product": {"id": 2}, "quantity": 1}]`, token)
+	var checkout struct {
+		Orders []Order `json:"orders"`
+	}
+	json.NewDecoder(rec.Body).Decode(&checkout)
+	if rec.Code != http.StatusOK || len(checkout.Orders) != 2 {
+		t.Fatalf("Expected two orders, got %d: %+v", rec.Code, checkout)
+	}
+	for _, order := range checkout.Orders {
+		if order.CustomerID != 1 || order.DeliveryAddress == nil || order.ClaimCode != "" {
+			t.Errorf("Expected the order to belong to the customer, got %+v", order)
+		}
+	}
+	invoice, _ := store.GetInvoice(checkout.Orders[0].ID)
+	if invoice.Buyer.Name != "Asha" || !strings.Contains(invoice.Buyer.Address, "560001") {
+		t.Errorf("Expected the invoice to be addressed to the customer, got %+v", invoice.Buyer)
+	}
+	if rec := customerRequest(handler, http.MethodPost, "/api/orders", `{"productId": 1, "quantity": 1, "addressId": 7}`, token); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected an unknown address to be refused, got %d", rec.Code)
+	}
+
+	// An anonymous checkout shares one claim code, which links it later
+	rec = customerRequest(handler, http.MethodPost, "/api/checkout", `[{"product": {"id": 1}, "quantity": 1}, {"product": {"id": 3}, "quantity": 1}]`, "")
+	var anonymous struct {
+		Orders []struct {
+			ID         int    `json:"id"`
+			CustomerID int    `json:"customerId"`
+			ClaimCode  string `json:"claimCode"`
+		} `json:"orders"`
+	}
+	json.NewDecoder(rec.Body).Decode(&anonymous)
+	claimCode := anonymous.Orders[0].ClaimCode
+	if claimCode == "" || anonymous.Orders[1].ClaimCode != claimCode || anonymous.Orders[0].CustomerID != 0 {
+		t.Fatalf("Expected anonymous orders with one claim code, got %+v", anonymous.Orders)
+	}
+	// Only the checkout itself hands out the claim code
+	if rec := customerRequest(handler, http.MethodPost, "/api/orders/3/payment", "", ""); strings.Contains(rec.Body.String(), claimCode) {
+		t.Errorf("Expected the claim code to stay out of other responses, got %s", rec.Body.String())
+	}
+	if rec := customerRequest(handler, http.MethodPost, "/api/me/orders/claim", `{"claimCode": "`+strings.ToLower(claimCode)+`"}`, token); rec.Code != http.StatusOK {
+		t.Fatalf("Expected the orders to be claimed, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := customerRequest(handler, http.MethodPost, "/api/me/orders/claim", `{"claimCode": "`+claimCode+`"}`, token); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected a used claim code to be refused, got %d", rec.Code)
+	}
+
+	var orders []Order
+	json.NewDecoder(customerRequest(handler, http.MethodGet, "/api/me/orders", "", token).Body).Decode(&orders)
+	if len(orders) != 4 || orders[0].ID != 4 || orders[3].ID != 1 {
+		t.Errorf("Expected four orders newest first, got %+v", orders)
+	}
+	other := registerCustomer(t, store, "ravi@example.com")
+	json.NewDecoder(customerRequest(handler, http.MethodGet, "/api/me/orders", "", other).Body).Decode(&orders)
+	if len(orders) != 0 {
+		t.Errorf("Expected another customer to see none of them, got %+v", orders)
+	}
+
+	// The orders are copies, encoded without holding the store's lock
+	copies := store.CustomerOrders(1)
+	copies[0].Status, copies[0].Product.Stock = OrderCancelled, -1
+	if order, _ := store.GetOrder(copies[0].ID); order.Status == OrderCancelled || order.Product.Stock == -1 {
+		t.Errorf("Expected changing a copy to leave the order alone, got %+v", order)
+	}
+}
+
+func TestCustomersPersist(t *testing.T) {
+	store := newTestStore()
+	store.dataDir = t.TempDir()
+	defer store.Close()
+	registerCustomer(t, store, "asha@example.com")
+	if _, err := store.SaveAddress(1, Address{Name: "Asha", Line1: "12 MG Road", City: "Bengaluru", Pincode: "560001"}); err != nil {
+		t.Fatalf("Failed to save address: %v", err)
+	}
+
+	reloaded := newTestStore()
+	defer reloaded.Close()
+	reloaded.dataDir = store.dataDir
+	reloaded.InitializeCatalog()
+	if err := reloaded.LoadState(); err != nil {
+		t.Fatalf("Failed to load state: %v", err)
+	}
+	customer, err := reloaded.Customer(1)
+	if err != nil || len(customer.Addresses) != 1 || customer.PasswordHash != "" {
+		t.Fatalf("Expected the customer to be reloaded, got %+v, %v", customer, err)
+	}
+	if _, _, _, err := reloaded.LoginCustomer("asha@example.com", "correct horse"); err != nil {
+		t.Errorf("Expected the password to survive a restart, got %v", err)
+	}
+}
@@ -0,0 +1,306 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Errors returned by Store methods. Callers should compare with errors.Is,
+// since some are wrapped in a more detailed error.
+var (
+	ErrProductNotFound       = errors.New("product not found")
+	ErrOrderNotFound         = errors.New("order not found")
+	ErrInvoiceNotFound       = errors.New("invoice not found")
+	ErrInvalidQuantity       = errors.New("quantity cannot be negative")
+	ErrInsufficientStock     = errors.New("insufficient stock")
+	ErrUnsupportedImage      = errors.New("unsupported image, expected JPEG, PNG or GIF")
+	ErrImageTooLarge         = fmt.Errorf("image is larger than %d MB", maxImageUpload>>20)
+	ErrImageDimensions       = fmt.Errorf("image is larger than %d megapixels", maxImagePixels/1_000_000)
+	ErrInvalidDateRange      = errors.New("report end date is before start date")
+	ErrUserNotFound          = errors.New("user not found")
+	ErrUserExists            = errors.New("username is already taken")
+	ErrInvalidUsername       = errors.New("username is required")
+	ErrInvalidRole           = errors.New("role must be viewer, inventory_manager or admin")
+	ErrInvalidCredentials    = errors.New("invalid username, password, API key or session")
+	ErrAPIKeyNotFound        = errors.New("API key not found")
+	ErrInvalidProduct        = errors.New("invalid product")
+	ErrCustomerNotFound      = errors.New("customer not found")
+	ErrCustomerExists        = errors.New("an account with this email already exists")
+	ErrInvalidEmail          = errors.New("a valid email address is required")
+	ErrWeakPassword          = fmt.Errorf("password must be at least %d characters", minPasswordLength)
+	ErrAddressNotFound       = errors.New("address not found")
+	ErrInvalidAddress        = errors.New("invalid address")
+	ErrNotInWishlist         = errors.New("product is not on the wishlist")
+	ErrSavedCartNotFound     = errors.New("saved cart not found")
+	ErrInvalidSavedCart      = errors.New("invalid saved cart")
+	ErrReviewNotFound        = errors.New("review not found")
+	ErrInvalidReview         = errors.New("invalid review")
+	ErrInvalidReviewStatus   = errors.New("status must be pending, approved or rejected")
+	ErrPurchaseRequired      = errors.New("only customers who ordered the product can review it")
+	ErrOrderCancelled        = errors.New("order is cancelled")
+	ErrOrderDispatched       = errors.New("order has already been dispatched")
+	ErrPaymentDeclined       = errors.New("payment was declined")
+	ErrPaymentTimeout        = errors.New("payment provider did not answer in time")
+	ErrPaymentFailed         = errors.New("payment provider error")
+	ErrInvalidSignature      = errors.New("webhook signature does not match")
+	ErrSubscriptionNotFound  = errors.New("webhook subscription not found")
+	ErrDeliveryNotFound      = errors.New("webhook delivery not found")
+	ErrInvalidWebhookURL     = errors.New("webhook url must be an absolute http or https URL")
+	ErrInvalidWebhookEvent   = errors.New("events must be one or more of order.created, order.status_changed, stock.low and product.updated")
+	ErrLocationNotFound      = errors.New("location not found")
+	ErrSupplierNotFound      = errors.New("supplier not found")
+	ErrPurchaseOrderNotFound = errors.New("purchase order not found")
+	ErrPurchaseOrderClosed   = errors.New("purchase order is already received or cancelled")
+)
+
+// InsufficientStockError reports an order for more units than are in stock.
+// It matches ErrInsufficientStock.
+type InsufficientStockError struct {
+	ProductID int
+	Requested int
+	Available int
+}
+
+func (e *InsufficientStockError) Error() string {
+	return fmt.Sprintf("insufficient stock: only %d items available", e.Available)
+}
+
+func (e *InsufficientStockError) Is(target error) bool {
+	return target == ErrInsufficientStock
+}
+
+// InvalidProductError lists what is wrong with a product sent to be created
+// or updated. It matches ErrInvalidProduct.
+type InvalidProductError struct {
+	Problems []string
+}
+
+func (e *InvalidProductError) Error() string {
+	return "invalid product: " + strings.Join(e.Problems, "; ")
+}
+
+func (e *InvalidProductError) Is(target error) bool {
+	return target == ErrInvalidProduct
+}
+
+// InvalidAddressError lists what is wrong with a delivery address. It
+// matches ErrInvalidAddress.
+type InvalidAddressError struct {
+	Problems []string
+}
+
+func (e *InvalidAddressError) Error() string {
+	return "invalid address: " + strings.Join(e.Problems, "; ")
+}
+
+func (e *InvalidAddressError) Is(target error) bool {
+	return target == ErrInvalidAddress
+}
+
+// Error codes sent in the code field of error responses
+const (
+	CodeInvalidRequest        = "invalid_request"
+	CodeNotFound              = "not_found"
+	CodeMethodNotAllowed      = "method_not_allowed"
+	CodeRequestTooLarge       = "request_too_large"
+	CodeProductNotFound       = "product_not_found"
+	CodeOrderNotFound         = "order_not_found"
+	CodeInvoiceNotFound       = "invoice_not_found"
+	CodeInvalidQuantity       = "invalid_quantity"
+	CodeInsufficientStock     = "insufficient_stock"
+	CodeUnsupportedImage      = "unsupported_image"
+	CodeRateLimited           = "rate_limited"
+	CodeUnauthorized          = "unauthorized"
+	CodeForbidden             = "forbidden"
+	CodeUserNotFound          = "user_not_found"
+	CodeUserExists            = "user_exists"
+	CodeAPIKeyNotFound        = "api_key_not_found"
+	CodeInvalidProduct        = "invalid_product"
+	CodeCustomerNotFound      = "customer_not_found"
+	CodeCustomerExists        = "customer_exists"
+	CodeAddressNotFound       = "address_not_found"
+	CodeInvalidAddress        = "invalid_address"
+	CodeWishlistItemNotFound  = "wishlist_item_not_found"
+	CodeSavedCartNotFound     = "saved_cart_not_found"
+	CodeReviewNotFound        = "review_not_found"
+	CodePurchaseRequired      = "purchase_required"
+	CodeOrderCancelled        = "order_cancelled"
+	CodeOrderDispatched       = "order_dispatched"
+	CodePaymentDeclined       = "payment_declined"
+	CodePaymentTimeout        = "payment_timeout"
+	CodePaymentFailed         = "payment_failed"
+	CodeInvalidSignature      = "invalid_signature"
+	CodeWebhookNotFound       = "webhook_not_found"
+	CodeDeliveryNotFound      = "delivery_not_found"
+	CodeLocationNotFound      = "location_not_found"
+	CodeSupplierNotFound      = "supplier_not_found"
+	CodePurchaseOrderNotFound = "purchase_order_not_found"
+	CodePurchaseOrderClosed   = "purchase_order_closed"
+	CodeInternal              = "internal_error"
+)
+
+// APIError is the body of every error response, inside an "error" field:
+//
+//	{"error": {"code": "insufficient_stock", "message": "...", "details": {...}, "requestId": "..."}}
+type APIError struct {
+	Status    int            `json:"-"`
+	Code      string         `json:"code"`
+	Message   string         `json:"message"`
+	Details   map[string]any `json:"details,omitempty"`
+	RequestID string         `json:"requestId,omitempty"`
+}
+
+func (e *APIError) Error() string {
+	return e.Message
+}
+
+// invalidRequest returns a 400 error for a malformed request
+func invalidRequest(format string, args ...any) *APIError {
+	return &APIError{Status: http.StatusBadRequest, Code: CodeInvalidRequest, Message: fmt.Sprintf(format, args...)}
+}
+
+// toAPIError maps an error to its HTTP status, code and details. Errors
+// that are not recognised become a 500 without exposing their message.
+func toAPIError(err error) *APIError {
+	var apiErr *APIError
+	var stockErr *InsufficientStockError
+	var sizeErr *http.MaxBytesError
+	var productErr *InvalidProductError
+	var addressErr *InvalidAddressError
+	var paymentErr *PaymentError
+	switch {
+	case errors.As(err, &apiErr):
+		copied := *apiErr
+		return &copied
+	case errors.As(err, &stockErr):
+		return &APIError{Status: http.StatusConflict, Code: CodeInsufficientStock, Message: err.Error(),
+			Details: map[string]any{
+				"productId": stockErr.ProductID,
+				"requested": stockErr.Requested,
+				"available": stockErr.Available,
+			}}
+	case errors.As(err, &productErr):
+		return &APIError{Status: http.StatusBadRequest, Code: CodeInvalidProduct, Message: err.Error(),
+			Details: map[string]any{"problems": productErr.Problems}}
+	case errors.As(err, &addressErr):
+		return &APIError{Status: http.StatusBadRequest, Code: CodeInvalidAddress, Message: err.Error(),
+			Details: map[string]any{"problems": addressErr.Problems}}
+	case errors.As(err, &paymentErr):
+		apiErr := &APIError{Status: http.StatusBadGateway, Code: CodePaymentFailed, Message: err.Error(),
+			Details: map[string]any{"orderId": paymentErr.OrderID}}
+		if paymentErr.ClaimCode != "" {
+			apiErr.Details["claimCode"] = paymentErr.ClaimCode
+		}
+		switch {
+		case errors.Is(err, ErrPaymentDeclined):
+			apiErr.Status, apiErr.Code = http.StatusPaymentRequired, CodePaymentDeclined
+		case errors.Is(err, ErrPaymentTimeout):
+			apiErr.Status, apiErr.Code = http.StatusGatewayTimeout, CodePaymentTimeout
+		}
+		return apiErr
+	case errors.As(err, &sizeErr):
+		return &APIError{Status: http.StatusRequestEntityTooLarge, Code: CodeRequestTooLarge,
+			Message: fmt.Sprintf("request body is larger than %d bytes", sizeErr.Limit)}
+	case errors.Is(err, ErrProductNotFound):
+		return &APIError{Status: http.StatusNotFound, Code: CodeProductNotFound, Message: err.Error()}
+	case errors.Is(err, ErrOrderNotFound):
+		return &APIError{Status: http.StatusNotFound, Code: CodeOrderNotFound, Message: err.Error()}
+	case errors.Is(err, ErrInvoiceNotFound):
+		return &APIError{Status: http.StatusNotFound, Code: CodeInvoiceNotFound, Message: err.Error()}
+	case errors.Is(err, ErrInvalidQuantity):
+		return &APIError{Status: http.StatusBadRequest, Code: CodeInvalidQuantity, Message: err.Error()}
+	case errors.Is(err, ErrUnsupportedImage):
+		return &APIError{Status: http.StatusUnsupportedMediaType, Code: CodeUnsupportedImage, Message: err.Error()}
+	case errors.Is(err, ErrImageTooLarge), errors.Is(err, ErrImageDimensions):
+		return &APIError{Status: http.StatusRequestEntityTooLarge, Code: CodeRequestTooLarge, Message: err.Error()}
+	case errors.Is(err, ErrInvalidDateRange):
+		return &APIError{Status: http.StatusBadRequest, Code: CodeInvalidRequest, Message: err.Error()}
+	case errors.Is(err, ErrInvalidUsername), errors.Is(err, ErrInvalidRole):
+		return &APIError{Status: http.StatusBadRequest, Code: CodeInvalidRequest, Message: err.Error()}
+	case errors.Is(err, ErrInvalidCredentials):
+		return &APIError{Status: http.StatusUnauthorized, Code: CodeUnauthorized, Message: err.Error()}
+	case errors.Is(err, ErrUserNotFound):
+		return &APIError{Status: http.StatusNotFound, Code: CodeUserNotFound, Message: err.Error()}
+	case errors.Is(err, ErrUserExists):
+		return &APIError{Status: http.StatusConflict, Code: CodeUserExists, Message: err.Error()}
+	case errors.Is(err, ErrAPIKeyNotFound):
+		return &APIError{Status: http.StatusNotFound, Code: CodeAPIKeyNotFound, Message: err.Error()}
+	case errors.Is(err, ErrInvalidEmail), errors.Is(err, ErrWeakPassword):
+		return &APIError{Status: http.StatusBadRequest, Code: CodeInvalidRequest, Message: err.Error()}
+	case errors.Is(err, ErrCustomerNotFound):
+		return &APIError{Status: http.StatusNotFound, Code: CodeCustomerNotFound, Message: err.Error()}
+	case errors.Is(err, ErrCustomerExists):
+		return &APIError{Status: http.StatusConflict, Code: CodeCustomerExists, Message: err.Error()}
+	case errors.Is(err, ErrAddressNotFound):
+		return &APIError{Status: http.StatusNotFound, Code: CodeAddressNotFound, Message: err.Error()}
+	case errors.Is(err, ErrNotInWishlist):
+		return &APIError{Status: http.StatusNotFound, Code: CodeWishlistItemNotFound, Message: err.Error()}
+	case errors.Is(err, ErrSavedCartNotFound):
+		return &APIError{Status: http.StatusNotFound, Code: CodeSavedCartNotFound, Message: err.Error()}
+	case errors.Is(err, ErrInvalidSavedCart), errors.Is(err, ErrInvalidReview), errors.Is(err, ErrInvalidReviewStatus):
+		return &APIError{Status: http.StatusBadRequest, Code: CodeInvalidRequest, Message: err.Error()}
+	case errors.Is(err, ErrReviewNotFound):
+		return &APIError{Status: http.StatusNotFound, Code: CodeReviewNotFound, Message: err.Error()}
+	case errors.Is(err, ErrPurchaseRequired):
+		return &APIError{Status: http.StatusForbidden, Code: CodePurchaseRequired, Message: err.Error()}
+	case errors.Is(err, ErrOrderCancelled):
+		return &APIError{Status: http.StatusConflict, Code: CodeOrderCancelled, Message: err.Error()}
+	case errors.Is(err, ErrOrderDispatched):
+		return &APIError{Status: http.StatusConflict, Code: CodeOrderDispatched, Message: err.Error()}
+	case errors.Is(err, ErrInvalidSignature):
+		return &APIError{Status: http.StatusUnauthorized, Code: CodeInvalidSignature, Message: err.Error()}
+	case errors.Is(err, ErrSubscriptionNotFound):
+		return &APIError{Status: http.StatusNotFound, Code: CodeWebhookNotFound, Message: err.Error()}
+	case errors.Is(err, ErrDeliveryNotFound):
+		return &APIError{Status: http.StatusNotFound, Code: CodeDeliveryNotFound, Message: err.Error()}
+	case errors.Is(err, ErrInvalidWebhookURL), errors.Is(err, ErrInvalidWebhookEvent):
+		return &APIError{Status: http.StatusBadRequest, Code: CodeInvalidRequest, Message: err.Error()}
+	case errors.Is(err, ErrLocationNotFound):
+		return &APIError{Status: http.StatusNotFound, Code: CodeLocationNotFound, Message: err.Error()}
+	case errors.Is(err, ErrSupplierNotFound):
+		return &APIError{Status: http.StatusNotFound, Code: CodeSupplierNotFound, Message: err.Error()}
+	case errors.Is(err, ErrPurchaseOrderNotFound):
+		return &APIError{Status: http.StatusNotFound, Code: CodePurchaseOrderNotFound, Message: err.Error()}
+	case errors.Is(err, ErrPurchaseOrderClosed):
+		return &APIError{Status: http.StatusConflict, Code: CodePurchaseOrderClosed, Message: err.Error()}
+	}
+	return &APIError{Status: http.StatusInternalServerError, Code: CodeInternal, Message: "internal server error"}
+}
+
+// writeError sends err as a JSON error response tagged with the request ID.
+// Unexpected errors are logged, since their message is not sent to the client.
+func (s *Store) writeError(w http.ResponseWriter, r *http.Request, err error) {
+	apiErr := toAPIError(err)
+	if _, ok := err.(*APIError); !ok && apiErr.Status >= http.StatusInternalServerError {
+		s.log(r.Context()).Error("request failed", "method", r.Method, "path", r.URL.Path, "error", err)
+	}
+	apiErr.RequestID = RequestID(r.Context())
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(apiErr.Status)
+	json.NewEncoder(w).Encode(struct {
+		Error *APIError `json:"error"`
+	}{apiErr})
+}
+
+// badRequestBody reports an error reading the request body as an invalid
+// request, unless the body was too large
+func badRequestBody(err error) error {
+	var sizeErr *http.MaxBytesError
+	if errors.As(err, &sizeErr) {
+		return err
+	}
+	return invalidRequest("invalid request body: %v", err)
+}
+
+// decodeJSON reads the request body into v
+func decodeJSON(r *http.Request, v any) error {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		return badRequestBody(err)
+	}
+	return nil
+}
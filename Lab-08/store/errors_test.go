@@ -0,0 +1,134 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// errorResponse decodes the JSON error envelope from a response
+func errorResponse(t *testing.T, rec *httptest.ResponseRecorder) APIError {
+	t.Helper()
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Fatalf("Expected a JSON error, got %q: %s", ct, rec.Body.String())
+	}
+	var body struct {
+		Error APIError `json:"error"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatalf("Failed to decode error body: %v", err)
+	}
+	return body.Error
+}
+
+func TestDomainErrors(t *testing.T) {
+	store := newTestStore()
+	defer store.Close()
+	store.InitializeCatalog()
+	product, _ := store.GetProduct(1)
+
+	_, err := store.CreateOrder(context.Background(), product, product.Stock+1)
+	var stockErr *InsufficientStockError
+	if !errors.Is(err, ErrInsufficientStock) || !errors.As(err, &stockErr) {
+		t.Fatalf("Expected an insufficient stock error, got %v", err)
+	}
+	if stockErr.Available != product.Stock || stockErr.Requested != product.Stock+1 || stockErr.ProductID != 1 {
+		t.Errorf("Unexpected error details: %+v", stockErr)
+	}
+
+	if _, err := store.CreateOrder(context.Background(), product, -1); !errors.Is(err, ErrInvalidQuantity) {
+		t.Errorf("Expected ErrInvalidQuantity, got %v", err)
+	}
+	if _, err := store.GetProduct(99); !errors.Is(err, ErrProductNotFound) {
+		t.Errorf("Expected ErrProductNotFound, got %v", err)
+	}
+	if _, err := store.GetOrder(99); !errors.Is(err, ErrOrderNotFound) {
+		t.Errorf("Expected ErrOrderNotFound, got %v", err)
+	}
+	if err := store.UpdateStock(99, 1); !errors.Is(err, ErrProductNotFound) {
+		t.Errorf("Expected ErrProductNotFound, got %v", err)
+	}
+}
+
+func TestToAPIError(t *testing.T) {
+	tests := []struct {
+		err    error
+		status int
+		code   string
+	}{
+		{ErrProductNotFound, http.StatusNotFound, CodeProductNotFound},
+		{fmt.Errorf("loading: %w", ErrOrderNotFound), http.StatusNotFound, CodeOrderNotFound},
+		{ErrInvoiceNotFound, http.StatusNotFound, CodeInvoiceNotFound},
+		{ErrInvalidQuantity, http.StatusBadRequest, CodeInvalidQuantity},
+		{&InsufficientStockError{Available: 2}, http.StatusConflict, CodeInsufficientStock},
+		{ErrUnsupportedImage, http.StatusUnsupportedMediaType, CodeUnsupportedImage},
+		{&http.MaxBytesError{Limit: 10}, http.StatusRequestEntityTooLarge, CodeRequestTooLarge},
+		{invalidRequest("bad"), http.StatusBadRequest, CodeInvalidRequest},
+		{errors.New("disk full"), http.StatusInternalServerError, CodeInternal},
+	}
+	for _, tt := range tests {
+		apiErr := toAPIError(tt.err)
+		if apiErr.Status != tt.status || apiErr.Code != tt.code {
+			t.Errorf("%v: expected %d %s, got %d %s", tt.err, tt.status, tt.code, apiErr.Status, apiErr.Code)
+		}
+	}
+	if apiErr := toAPIError(errors.New("disk full")); strings.Contains(apiErr.Message, "disk") {
+		t.Errorf("Expected internal error message to be hidden, got %q", apiErr.Message)
+	}
+}
+
+func TestErrorEnvelope(t *testing.T) {
+	store := newTestStore()
+	store.InitializeCatalog()
+	handler := store.Routes("../static")
+	defer store.Close()
+	key := staffKey(t, store, RoleInventoryManager)
+
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		body    string
+		status  int
+		code    string
+		details map[string]any
+	}{
+		{"insufficient stock", http.MethodPost, "/api/orders", `{"productId": 2, "quantity": 1000}`,
+			http.StatusConflict, CodeInsufficientStock, map[string]any{"productId": 2.0, "requested": 1000.0, "available": 10.0}},
+		{"negative quantity", http.MethodPost, "/api/orders", `{"productId": 1, "quantity": -1}`, http.StatusBadRequest, CodeInvalidRequest,
+			map[string]any{"problems": []any{map[string]any{"in": "body", "field": "quantity", "message": "must be at least 0"}}}},
+		{"unknown product", http.MethodPost, "/api/orders", `{"productId": 99, "quantity": 1}`, http.StatusNotFound, CodeProductNotFound, nil},
+		{"malformed body", http.MethodPost, "/api/orders", `{`, http.StatusBadRequest, CodeInvalidRequest, nil},
+		{"checkout stock", http.MethodPost, "/api/checkout", `[{"product": {"id": 3}, "quantity": 1000}]`, http.StatusConflict, CodeInsufficientStock, nil},
+		{"negative stock", http.MethodPut, "/api/products/1/stock", `{"stock": -5}`, http.StatusBadRequest, CodeInvalidRequest, nil},
+		{"unknown invoice", http.MethodGet, "/api/orders/42/invoice", "", http.StatusNotFound, CodeInvoiceNotFound, nil},
+		{"unknown route", http.MethodGet, "/api/nothing", "", http.StatusNotFound, CodeNotFound, nil},
+		{"wrong method", http.MethodDelete, "/api/orders", "", http.StatusMethodNotAllowed, CodeMethodNotAllowed,
+			map[string]any{"allowed": []any{"POST", "OPTIONS"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			req.Header.Set(RequestIDHeader, "req-"+tt.code)
+			req.Header.Set(APIKeyHeader, key)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("Expected status %d, got %d: %s", tt.status, rec.Code, rec.Body.String())
+			}
+			apiErr := errorResponse(t, rec)
+			if apiErr.Code != tt.code || apiErr.Message == "" || apiErr.RequestID != "req-"+tt.code {
+				t.Errorf("Unexpected error body: %+v", apiErr)
+			}
+			if tt.details != nil && fmt.Sprint(apiErr.Details) != fmt.Sprint(tt.details) {
+				t.Errorf("Expected details %v, got %v", tt.details, apiErr.Details)
+			}
+		})
+	}
+}
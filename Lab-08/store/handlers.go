@@ -0,0 +1,304 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+)
+
+// CartItem represents an item in the shopping cart
+type CartItem struct {
+	Product  *Product `json:"product"`
+	Quantity int      `json:"quantity"`
+}
+
+// pathID reads a numeric path value, such as a product or cart ID
+func pathID(r *http.Request, name, what string) (int, error) {
+	id, err := strconv.Atoi(r.PathValue(name))
+	if err != nil {
+		return 0, invalidRequest("invalid %s ID", what)
+	}
+	return id, nil
+}
+
+// writeJSON sends v as a JSON response with the given status
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// handleGetProducts returns the product catalog with ratings as JSON,
+// sorted by the sort query parameter. Given a pincode, or for a customer
+// with a default address, each product also has its stock at the nearest
+// location.
+func (s *Store) handleGetProducts(w http.ResponseWriter, r *http.Request) {
+	// Copy the catalog into an array to avoid pointer issues
+	products, err := s.RatedProducts(r.URL.Query().Get("sort"))
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	pincode, err := requestPincode(r)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	if pincode != "" {
+		nearest := s.NearestLocation(pincode)
+		for i := range products {
+			availability := locationStock(&nearest, products[i].ID)
+			products[i].Availability = &availability
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(products); err != nil {
+		s.log(r.Context()).Error("error encoding products", "error", err)
+	}
+}
+
+// handleCheckout processes the checkout from the web interface
+func (s *Store) handleCheckout(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var cartItems []CartItem
+	if err := decodeJSON(r, &cartItems); err != nil {
+		s.metrics.checkoutFailed(failureInvalidRequest)
+		s.writeError(w, r, err)
+		return
+	}
+	addressID := 0
+	if value := r.URL.Query().Get("addressId"); value != "" {
+		var err error
+		if addressID, err = strconv.Atoi(value); err != nil {
+			s.metrics.checkoutFailed(failureInvalidRequest)
+			s.writeError(w, r, invalidRequest("invalid address ID"))
+			return
+		}
+	}
+	// Every order in the cart goes to the same customer and address, or for
+	// an anonymous checkout shares one claim code
+	owner, err := s.requestOrderOwner(r, addressID)
+	if err != nil {
+		s.metrics.checkoutFailed(failureInvalidRequest)
+		s.writeError(w, r, err)
+		return
+	}
+	ctx := s.beginCheckout(WithOrderOwner(r.Context(), owner))
+
+	// Every item is checked before any order is placed
+	products := make([]*Product, len(cartItems))
+	for i, item := range cartItems {
+		if item.Product == nil {
+			s.metrics.checkoutFailed(failureInvalidRequest)
+			s.writeError(w, r, invalidRequest("cart item is missing its product"))
+			return
+		}
+		// Get the product from the catalog
+		product, err := s.GetProduct(item.Product.ID)
+		if err != nil {
+			s.metrics.checkoutFailed(failureProductNotFound)
+			s.writeError(w, r, err)
+			return
+		}
+		products[i] = product
+	}
+
+	// Create the orders and pay for them. The cart is bought whole or not at
+	// all, so nothing is queued until every payment has gone through, and a
+	// failure cancels the orders already placed.
+	orders := []*Order{}
+	var paid []*Order
+	for i, item := range cartItems {
+		order, err := s.CreateOrder(ctx, products[i], item.Quantity)
+		if err != nil {
+			s.abandonCheckout(ctx, orders)
+			s.writeError(w, r, err)
+			return
+		}
+		orders = append(orders, order)
+		ready, err := s.authorizeOrder(ctx, order)
+		if err != nil {
+			s.abandonCheckout(ctx, orders)
+			s.writeError(w, r, err)
+			return
+		}
+		if ready {
+			paid = append(paid, order)
+		}
+	}
+	for _, order := range paid {
+		s.ProcessOrder(order)
+	}
+
+	// The workers update the orders as they process them
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]any{"message": "Order processed successfully", "orders": placedOrders(orders)})
+}
+
+// abandonCheckout cancels the orders of a checkout that could not be
+// completed, refunding their payments and putting their stock back
+func (s *Store) abandonCheckout(ctx context.Context, orders []*Order) {
+	for _, order := range orders {
+		if _, err := s.CancelOrder(ctx, order.ID, 0); err != nil && !errors.Is(err, ErrOrderCancelled) {
+			s.log(ctx).Error("error cancelling the order of a failed checkout", "orderId", order.ID, "error", err)
+		}
+	}
+	if len(orders) > 0 {
+		s.log(ctx).Info("checkout abandoned", "orders", len(orders))
+	}
+}
+
+// handleGetProduct returns a specific product with its rating as JSON
+func (s *Store) handleGetProduct(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	productID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		s.writeError(w, r, invalidRequest("invalid product ID"))
+		return
+	}
+
+	product, err := s.RatedProduct(productID)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(product)
+}
+
+// handleUpdateStock serves PUT /api/products/{id}/stock
+func (s *Store) handleUpdateStock(w http.ResponseWriter, r *http.Request) {
+	productID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		s.writeError(w, r, invalidRequest("invalid product ID"))
+		return
+	}
+
+	// Parse request body; without a location the stock is the product's total
+	var request struct {
+		Stock      int    `json:"stock"`
+		LocationID int    `json:"locationId"`
+		Note       string `json:"note"`
+	}
+	if err := decodeJSON(r, &request); err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+
+	// Update stock
+	if err := s.SetLocationStock(r.Context(), productID, request.LocationID, request.Stock, request.Note); err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+
+	// Return success response
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Stock updated successfully"})
+}
+
+// handleCreateProduct serves POST /api/products
+func (s *Store) handleCreateProduct(w http.ResponseWriter, r *http.Request) {
+	var request Product
+	if err := decodeJSON(r, &request); err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	product, err := s.CreateProduct(r.Context(), request)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/api/products/"+strconv.Itoa(product.ID))
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(product)
+}
+
+// handleUpdateProduct serves PUT /api/products/{id}
+func (s *Store) handleUpdateProduct(w http.ResponseWriter, r *http.Request) {
+	productID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		s.writeError(w, r, invalidRequest("invalid product ID"))
+		return
+	}
+	var request Product
+	if err := decodeJSON(r, &request); err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	product, err := s.UpdateProduct(r.Context(), productID, request)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(product)
+}
+
+// handleDeleteProduct serves DELETE /api/products/{id}
+func (s *Store) handleDeleteProduct(w http.ResponseWriter, r *http.Request) {
+	productID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		s.writeError(w, r, invalidRequest("invalid product ID"))
+		return
+	}
+	if err := s.DeleteProduct(r.Context(), productID); err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleCreateOrder creates a new order
+func (s *Store) handleCreateOrder(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var request struct {
+		ProductID int `json:"productId"`
+		Quantity  int `json:"quantity"`
+		AddressID int `json:"addressId"` // defaults to the customer's default address
+	}
+
+	if err := decodeJSON(r, &request); err != nil {
+		s.metrics.checkoutFailed(failureInvalidRequest)
+		s.writeError(w, r, err)
+		return
+	}
+	owner, err := s.requestOrderOwner(r, request.AddressID)
+	if err != nil {
+		s.metrics.checkoutFailed(failureInvalidRequest)
+		s.writeError(w, r, err)
+		return
+	}
+
+	product, err := s.GetProduct(request.ProductID)
+	if err != nil {
+		s.metrics.checkoutFailed(failureProductNotFound)
+		s.writeError(w, r, err)
+		return
+	}
+
+	order, err := s.CreateOrder(WithOrderOwner(r.Context(), owner), product, request.Quantity)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	if err := s.PayOrder(r.Context(), order); err != nil {
+		s.writeError(w, r, s.placingError(order, err))
+		return
+	}
+
+	// The workers update the orders as they process them
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(placedOrder{Order: order, ClaimCode: order.ClaimCode})
+}
@@ -0,0 +1,225 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// workerState is what a running worker is doing, kept for the admin endpoint
+type workerState struct {
+	startedAt time.Time
+	order     *Order    // nil while the worker is idle
+	since     time.Time // when the worker became busy or idle
+	processed int
+}
+
+// trackWorker records a newly started worker as idle
+func (s *Store) trackWorker(workerID int) {
+	s.workerStateMu.Lock()
+	defer s.workerStateMu.Unlock()
+	now := time.Now()
+	s.workerStates[workerID] = &workerState{startedAt: now, since: now}
+}
+
+// untrackWorker forgets a worker that has stopped
+func (s *Store) untrackWorker(workerID int) {
+	s.workerStateMu.Lock()
+	defer s.workerStateMu.Unlock()
+	delete(s.workerStates, workerID)
+}
+
+// setWorkerOrder records the order a worker has picked up, or nil once it
+// has finished and gone back to waiting
+func (s *Store) setWorkerOrder(workerID int, order *Order) {
+	s.workerStateMu.Lock()
+	defer s.workerStateMu.Unlock()
+	state, ok := s.workerStates[workerID]
+	if !ok {
+		return
+	}
+	if order == nil && state.order != nil {
+		state.processed++
+	}
+	state.order = order
+	state.since = time.Now()
+}
+
+// WorkerStatus describes one running worker
+type WorkerStatus struct {
+	ID        int       `json:"id"`
+	State     string    `json:"state"` // busy or idle
+	StartedAt time.Time `json:"startedAt"`
+	Since     time.Time `json:"since"`
+	// OrderID and Product are set while the worker is busy
+	OrderID int    `json:"orderId,omitempty"`
+	Product string `json:"product,omitempty"`
+	// IdleFor and StopsIn are set while the worker is idle; StopsIn is left
+	// out when the worker will not stop because it is the last one or there
+	// is no idle timeout
+	IdleFor         string `json:"idleFor,omitempty"`
+	StopsIn         string `json:"stopsIn,omitempty"`
+	OrdersProcessed int    `json:"ordersProcessed"`
+}
+
+// PoolStatus describes the order processing worker pool
+type PoolStatus struct {
+	MaxWorkers    int            `json:"maxWorkers"`
+	ActiveWorkers int            `json:"activeWorkers"`
+	BusyWorkers   int            `json:"busyWorkers"`
+	IdleWorkers   int            `json:"idleWorkers"`
+	QueueDepth    int            `json:"queueDepth"`
+	QueueCapacity int            `json:"queueCapacity"`
+	IdleTimeout   string         `json:"idleTimeout"`
+	Closed        bool           `json:"closed"`
+	Workers       []WorkerStatus `json:"workers"`
+}
+
+// WorkerPoolStatus reports what every worker in the pool is doing
+func (s *Store) WorkerPoolStatus() PoolStatus {
+	s.poolMu.RLock()
+	closed := s.closed
+	s.poolMu.RUnlock()
+
+	status := PoolStatus{
+		MaxWorkers:    s.workerCount,
+		QueueDepth:    len(s.orderChan),
+		QueueCapacity: cap(s.orderChan),
+		IdleTimeout:   s.idleTimeout.String(),
+		Closed:        closed,
+		Workers:       []WorkerStatus{},
+	}
+
+	s.workerStateMu.Lock()
+	defer s.workerStateMu.Unlock()
+
+	now := time.Now()
+	for id, state := range s.workerStates {
+		worker := WorkerStatus{
+			ID:              id,
+			StartedAt:       state.startedAt,
+			Since:           state.since,
+			OrdersProcessed: state.processed,
+		}
+		if state.order != nil {
+			worker.State = "busy"
+			worker.OrderID = state.order.ID
+			worker.Product = state.order.Product.Name
+			status.BusyWorkers++
+		} else {
+			idleFor := now.Sub(state.since)
+			worker.State = "idle"
+			worker.IdleFor = idleFor.Round(time.Millisecond).String()
+			// The last worker never stops, matching retireWorker
+			if s.idleTimeout > 0 && len(s.workerStates) > 1 {
+				worker.StopsIn = max(s.idleTimeout-idleFor, 0).Round(time.Millisecond).String()
+			}
+			status.IdleWorkers++
+		}
+		status.Workers = append(status.Workers, worker)
+	}
+	status.ActiveWorkers = len(status.Workers)
+	sort.Slice(status.Workers, func(i, j int) bool {
+		return status.Workers[i].ID < status.Workers[j].ID
+	})
+	return status
+}
+
+// Check is the result of one readiness check
+type Check struct {
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail"`
+}
+
+// Readiness reports whether the store can take orders: the catalog is
+// loaded, storage is writable, workers are running and the queue is not
+// backed up
+func (s *Store) Readiness() (bool, map[string]Check) {
+	checks := make(map[string]Check)
+
+	products := len(s.Products())
+	checks["catalog"] = Check{products > 0, fmt.Sprintf("%d products loaded", products)}
+
+	if err := s.checkStorage(); err != nil {
+		checks["storage"] = Check{false, err.Error()}
+	} else if s.dataDir == "" {
+		checks["storage"] = Check{true, "orders are kept in memory"}
+	} else {
+		checks["storage"] = Check{true, s.dataDir + " is writable"}
+	}
+
+	s.poolMu.RLock()
+	closed := s.closed
+	s.poolMu.RUnlock()
+	active := atomic.LoadInt32(&s.activeWorkers)
+	switch {
+	case closed:
+		checks["workers"] = Check{false, "shutting down"}
+	case active == 0:
+		checks["workers"] = Check{false, "no workers running"}
+	default:
+		checks["workers"] = Check{true, fmt.Sprintf("%d of %d workers running", active, s.workerCount)}
+	}
+
+	depth := len(s.orderChan)
+	detail := fmt.Sprintf("%d of %d queued, not ready at %d", depth, cap(s.orderChan), s.readyQueueDepth)
+	checks["queue"] = Check{depth < s.readyQueueDepth || s.readyQueueDepth == 0, detail}
+
+	ready := true
+	for _, check := range checks {
+		ready = ready && check.OK
+	}
+	return ready, checks
+}
+
+// checkStorage makes sure orders and invoices can be written to the data directory
+func (s *Store) checkStorage() error {
+	if s.dataDir == "" {
+		return nil
+	}
+	if err := os.MkdirAll(s.dataDir, 0o755); err != nil {
+		return fmt.Errorf("data directory is not reachable: %v", err)
+	}
+	probe, err := os.CreateTemp(s.dataDir, ".readyz-*")
+	if err != nil {
+		return fmt.Errorf("data directory is not writable: %v", err)
+	}
+	probe.Close()
+	return os.Remove(probe.Name())
+}
+
+// handleHealthz reports that the process is up and serving requests
+func (s *Store) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// handleReadyz reports whether the store should receive traffic, with 503
+// and the failing checks when it should not
+func (s *Store) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	ready, checks := s.Readiness()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	status := "ready"
+	if !ready {
+		status = "not ready"
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(struct {
+		Status string           `json:"status"`
+		Checks map[string]Check `json:"checks"`
+	}{status, checks})
+}
+
+// handleWorkerPool returns the worker pool state as JSON
+func (s *Store) handleWorkerPool(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(s.WorkerPoolStatus())
+}
@@ -0,0 +1,165 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"example.com/lab-08/config"
+)
+
+// newPoolTestStore creates a store with a single worker and a queue of two,
+// which stops being ready once one order is waiting
+func newPoolTestStore(t *testing.T) *Store {
+	t.Helper()
+	cfg := config.Default()
+	cfg.Store.CatalogFile = testCatalog
+	cfg.Store.DataDir = ""
+	cfg.Workers.Count = 1
+	cfg.Workers.QueueSize = 2
+	cfg.Workers.ReadyQueuePercent = 50
+	store := newStore(cfg)
+	store.InitializeCatalog()
+	return store
+}
+
+// waitFor polls until cond holds or fails the test after a second
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for the worker pool")
+		}
+		time.Sleep(2 * time.Millisecond)
+	}
+}
+
+func TestHealthz(t *testing.T) {
+	store := newTestStore()
+	defer store.Close()
+	rec := httptest.NewRecorder()
+	store.Routes("../static").ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected 200, got %d", rec.Code)
+	}
+}
+
+func TestReadyz(t *testing.T) {
+	store := newTestStore()
+	store.InitializeCatalog()
+	handler := store.Routes("../static")
+
+	get := func() (int, map[string]Check) {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		var body struct {
+			Checks map[string]Check `json:"checks"`
+		}
+		json.NewDecoder(rec.Body).Decode(&body)
+		return rec.Code, body.Checks
+	}
+
+	if code, checks := get(); code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %v", code, checks)
+	}
+
+	// A data directory that is really a file cannot store orders
+	file := filepath.Join(t.TempDir(), "data")
+	os.WriteFile(file, nil, 0o644)
+	store.dataDir = file
+	if code, checks := get(); code != http.StatusServiceUnavailable || checks["storage"].OK {
+		t.Errorf("Expected storage check to fail, got %d: %v", code, checks)
+	}
+	store.dataDir = ""
+
+	store.Close()
+	if code, checks := get(); code != http.StatusServiceUnavailable || checks["workers"].OK {
+		t.Errorf("Expected workers check to fail after Close, got %d: %v", code, checks)
+	}
+
+	empty := NewStore()
+	defer empty.Close()
+	if ready, checks := empty.Readiness(); ready || checks["catalog"].OK {
+		t.Errorf("Expected catalog check to fail without products, got %v", checks)
+	}
+}
+
+func TestReadyzQueueBackedUp(t *testing.T) {
+	store := newPoolTestStore(t)
+	product, _ := store.GetProduct(1)
+	first, _ := store.CreateOrder(context.Background(), product, 1)
+	second, _ := store.CreateOrder(context.Background(), product, 1)
+
+	// Hold the worker as it picks up the first order so the second one waits
+	store.workerStateMu.Lock()
+	store.ProcessOrder(first)
+	store.ProcessOrder(second)
+	waitFor(t, func() bool { return len(store.orderChan) == 1 })
+
+	ready, checks := store.Readiness()
+	store.workerStateMu.Unlock()
+	store.Close()
+
+	if ready || checks["queue"].OK {
+		t.Errorf("Expected queue check to fail with an order waiting, got %v", checks)
+	}
+}
+
+func TestWorkerPoolStatus(t *testing.T) {
+	store := newPoolTestStore(t)
+	product, _ := store.GetProduct(2)
+	order, _ := store.CreateOrder(context.Background(), product, 1)
+
+	// Hold the worker while it saves the order so it is seen busy
+	store.mu.Lock()
+	store.ProcessOrder(order)
+	waitFor(t, func() bool { return store.WorkerPoolStatus().BusyWorkers == 1 })
+	status := store.WorkerPoolStatus()
+	store.mu.Unlock()
+
+	if status.ActiveWorkers != 1 || status.MaxWorkers != 1 || len(status.Workers) != 1 {
+		t.Fatalf("Unexpected pool status: %+v", status)
+	}
+	if worker := status.Workers[0]; worker.State != "busy" || worker.OrderID != order.ID || worker.Product != product.Name {
+		t.Errorf("Expected worker busy with order %d, got %+v", order.ID, worker)
+	}
+
+	waitFor(t, func() bool { return store.WorkerPoolStatus().IdleWorkers == 1 })
+	req := httptest.NewRequest(http.MethodGet, "/api/admin/workers", nil)
+	req.Header.Set(APIKeyHeader, staffKey(t, store, RoleViewer))
+	rec := httptest.NewRecorder()
+	store.Routes("../static").ServeHTTP(rec, req)
+	store.Close()
+
+	json.NewDecoder(rec.Body).Decode(&status)
+	worker := status.Workers[0]
+	if worker.State != "idle" || worker.OrdersProcessed != 1 || worker.IdleFor == "" {
+		t.Errorf("Expected idle worker that processed one order, got %+v", worker)
+	}
+	// The only worker never stops, so it has no idle deadline
+	if worker.StopsIn != "" {
+		t.Errorf("Expected no stop time for the last worker, got %q", worker.StopsIn)
+	}
+}
+
+func TestIdleWorkerStopsIn(t *testing.T) {
+	store := newTestStore()
+	defer store.Close()
+
+	status := store.WorkerPoolStatus()
+	if status.IdleWorkers != 3 {
+		t.Fatalf("Expected 3 idle workers, got %+v", status)
+	}
+	for _, worker := range status.Workers {
+		stopsIn, err := time.ParseDuration(worker.StopsIn)
+		if err != nil || stopsIn <= 0 || stopsIn > 30*time.Second {
+			t.Errorf("Expected worker %d to stop within the idle timeout, got %q", worker.ID, worker.StopsIn)
+		}
+	}
+}
@@ -0,0 +1,253 @@
+package store
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"fmt"
+	htmltemplate "html/template"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	texttemplate "text/template"
+	"time"
+)
+
+//go:embed templates/invoice.html templates/invoice.txt
+var invoiceTemplates embed.FS
+
+// templateFuncs are shared by the HTML and plain text invoice templates
+var templateFuncs = map[string]any{
+	"money": func(amount float64) string { return fmt.Sprintf("%.2f", amount) },
+	"percent": func(rate float64) string {
+		return strconv.FormatFloat(rate*100, 'f', -1, 64) + "%"
+	},
+	"date": func(t time.Time) string { return t.Format("02 Jan 2006") },
+	"inc":  func(i int) int { return i + 1 },
+}
+
+var (
+	invoiceHTML = htmltemplate.Must(htmltemplate.New("invoice.html").
+			Funcs(templateFuncs).ParseFS(invoiceTemplates, "templates/invoice.html"))
+	invoiceText = texttemplate.Must(texttemplate.New("invoice.txt").
+			Funcs(templateFuncs).ParseFS(invoiceTemplates, "templates/invoice.txt"))
+)
+
+// Party holds the name and address details printed on an invoice
+type Party struct {
+	Name    string `json:"name"`
+	Address string `json:"address,omitempty"`
+	GSTIN   string `json:"gstin,omitempty"`
+}
+
+// walkInBuyer is used for orders that are not tied to a customer
+var walkInBuyer = Party{Name: "Walk-in Customer"}
+
+// invoiceBuyer returns the buyer printed on an order's invoice: the name and
+// address it is delivered to, or a walk-in customer
+func invoiceBuyer(order *Order) Party {
+	if order.DeliveryAddress == nil {
+		return walkInBuyer
+	}
+	return Party{Name: order.DeliveryAddress.Name, Address: order.DeliveryAddress.String()}
+}
+
+// categoryTaxRates holds the GST rate included in the price of each category
+var categoryTaxRates = map[string]float64{
+	"Grocery":     0.05,
+	"Electronics": 0.18,
+	"Fashion":     0.12,
+}
+
+// defaultTaxRate applies to categories without an explicit rate
+const defaultTaxRate = 0.18
+
+// InvoiceLine is a single product line on an invoice
+type InvoiceLine struct {
+	ProductID    int     `json:"productId"`
+	Description  string  `json:"description"`
+	Category     string  `json:"category"`
+	Quantity     int     `json:"quantity"`
+	UnitPrice    float64 `json:"unitPrice"`
+	TaxRate      float64 `json:"taxRate"`
+	TaxableValue float64 `json:"taxableValue"`
+	Tax          float64 `json:"tax"`
+	Amount       float64 `json:"amount"`
+}
+
+// Invoice is an issued invoice. Once issued it is never re-rendered, so the
+// HTML and Text fields are exactly what the customer received.
+type Invoice struct {
+	Number        string        `json:"number"`
+	FinancialYear string        `json:"financialYear"`
+	Sequence      int           `json:"sequence"`
+	OrderID       int           `json:"orderId"`
+	IssuedAt      time.Time     `json:"issuedAt"`
+	Seller        Party         `json:"seller"`
+	Buyer         Party         `json:"buyer"`
+	Lines         []InvoiceLine `json:"lines"`
+	TaxableValue  float64       `json:"taxableValue"`
+	Tax           float64       `json:"tax"`
+	Total         float64       `json:"total"`
+	HTML          string        `json:"html"`
+	Text          string        `json:"text"`
+}
+
+// financialYear returns the Indian financial year (April to March) containing t, e.g. "2026-27"
+func financialYear(t time.Time) string {
+	start := t.Year()
+	if t.Month() < time.April {
+		start--
+	}
+	return fmt.Sprintf("%d-%02d", start, (start+1)%100)
+}
+
+// roundMoney rounds an amount to paise
+func roundMoney(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
+
+// taxRateFor returns the GST rate for a product category
+func taxRateFor(category string) float64 {
+	if rate, ok := categoryTaxRates[category]; ok {
+		return rate
+	}
+	return defaultTaxRate
+}
+
+// newInvoiceLine builds the invoice line for an order. Prices are tax
+// inclusive, so the tax is backed out of the amount rather than added to it.
+func newInvoiceLine(order *Order) InvoiceLine {
+	rate := taxRateFor(order.Product.Category)
+	amount := roundMoney(float64(order.Quantity) * order.price())
+	taxable := roundMoney(amount / (1 + rate))
+	return InvoiceLine{
+		ProductID:    order.Product.ID,
+		Description:  order.Product.Name,
+		Category:     order.Product.Category,
+		Quantity:     order.Quantity,
+		UnitPrice:    order.price(),
+		TaxRate:      rate,
+		TaxableValue: taxable,
+		Tax:          roundMoney(amount - taxable),
+		Amount:       amount,
+	}
+}
+
+// render fills in the HTML and plain text versions of the invoice
+func (inv *Invoice) render() error {
+	var html, text bytes.Buffer
+	if err := invoiceHTML.Execute(&html, inv); err != nil {
+		return fmt.Errorf("error rendering HTML invoice: %v", err)
+	}
+	if err := invoiceText.Execute(&text, inv); err != nil {
+		return fmt.Errorf("error rendering text invoice: %v", err)
+	}
+	inv.HTML = html.String()
+	inv.Text = text.String()
+	return nil
+}
+
+// invoicePaidOrder issues the invoice for an order once its payment is
+// authorized, unless it already has one. Zero quantity orders sell nothing,
+// so they never get an invoice number. The caller must hold s.mu.
+func (s *Store) invoicePaidOrder(order *Order) error {
+	if _, exists := s.invoices[order.ID]; exists || order.Quantity == 0 {
+		return nil
+	}
+	_, err := s.issueInvoice(order)
+	return err
+}
+
+// issueInvoice assigns the next invoice number for the current financial year,
+// renders and stores the invoice. The caller must hold s.mu. The sequence only
+// advances once the invoice has been stored, so numbers stay gap-free.
+func (s *Store) issueInvoice(order *Order) (*Invoice, error) {
+	if _, exists := s.invoices[order.ID]; exists {
+		return nil, fmt.Errorf("order %d already has an invoice", order.ID)
+	}
+
+	issuedAt := time.Now()
+	fy := financialYear(issuedAt)
+	seq := s.invoiceSeq[fy] + 1
+	line := newInvoiceLine(order)
+	invoice := &Invoice{
+		Number:        fmt.Sprintf("INV/%s/%05d", fy, seq),
+		FinancialYear: fy,
+		Sequence:      seq,
+		OrderID:       order.ID,
+		IssuedAt:      issuedAt,
+		Seller:        s.seller,
+		Buyer:         invoiceBuyer(order),
+		Lines:         []InvoiceLine{line},
+		TaxableValue:  line.TaxableValue,
+		Tax:           line.Tax,
+		Total:         line.Amount,
+	}
+	if err := invoice.render(); err != nil {
+		return nil, err
+	}
+
+	s.invoices[order.ID] = invoice
+	if err := s.saveInvoices(); err != nil {
+		delete(s.invoices, order.ID)
+		return nil, err
+	}
+	s.invoiceSeq[fy] = seq
+	return invoice, nil
+}
+
+// GetInvoice returns the invoice issued for an order
+func (s *Store) GetInvoice(orderID int) (*Invoice, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	invoice, exists := s.invoices[orderID]
+	if !exists {
+		return nil, ErrInvoiceNotFound
+	}
+	return invoice, nil
+}
+
+// handleGetInvoice serves GET /api/orders/{id}/invoice as HTML (default),
+// plain text (?format=text or Accept: text/plain) or JSON (?format=json), to
+// staff, the customer who placed the order, or with the order's claim code
+func (s *Store) handleGetInvoice(w http.ResponseWriter, r *http.Request) {
+	orderID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		s.writeError(w, r, invalidRequest("invalid order ID"))
+		return
+	}
+
+	// Invoices carry the buyer's address, so only those who may see the
+	// order get one; to anyone else it does not exist
+	if order, err := s.GetOrder(orderID); err != nil || !s.canAccessOrder(r, order) {
+		s.writeError(w, r, ErrInvoiceNotFound)
+		return
+	}
+	invoice, err := s.GetInvoice(orderID)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" && strings.Contains(r.Header.Get("Accept"), "text/plain") {
+		format = "text"
+	}
+
+	switch format {
+	case "", "html":
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(invoice.HTML))
+	case "text":
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write([]byte(invoice.Text))
+	case "json":
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(invoice)
+	default:
+		s.writeError(w, r, invalidRequest("unsupported invoice format %q, expected html, text or json", format))
+	}
+}
@@ -0,0 +1,185 @@
+package store
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFinancialYear(t *testing.T) {
+	tests := []struct {
+		date     time.Time
+		expected string
+	}{
+		{time.Date(2026, time.March, 31, 23, 0, 0, 0, time.UTC), "2025-26"},
+		{time.Date(2026, time.April, 1, 0, 0, 0, 0, time.UTC), "2026-27"},
+		{time.Date(2099, time.December, 1, 0, 0, 0, 0, time.UTC), "2099-00"},
+	}
+
+	for _, tt := range tests {
+		if got := financialYear(tt.date); got != tt.expected {
+			t.Errorf("financialYear(%v) = %s, expected %s", tt.date, got, tt.expected)
+		}
+	}
+}
+
+func TestInvoiceNumbersAreSequential(t *testing.T) {
+	store := newTestStore()
+	if err := store.InitializeCatalog(); err != nil {
+		t.Fatalf("Failed to initialize catalog: %v", err)
+	}
+	product, _ := store.GetProduct(1)
+
+	var numbers []string
+	for _, quantity := range []int{1, 0, 2} {
+		order, err := store.CreateOrder(context.Background(), product, quantity)
+		if err != nil {
+			t.Fatalf("Failed to create order: %v", err)
+		}
+		// An unpaid order gets no invoice number
+		if _, err := store.GetInvoice(order.ID); err == nil {
+			t.Errorf("Expected no invoice before order %d is paid", order.ID)
+		}
+		if err := store.PayOrder(context.Background(), order); err != nil {
+			t.Fatalf("Failed to pay for order: %v", err)
+		}
+		invoice, err := store.GetInvoice(order.ID)
+		if quantity == 0 {
+			if err == nil {
+				t.Errorf("Expected no invoice for zero quantity order, got %s", invoice.Number)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Expected invoice for order %d, got %v", order.ID, err)
+		}
+		numbers = append(numbers, invoice.Number)
+	}
+
+	fy := financialYear(time.Now())
+	expected := []string{"INV/" + fy + "/00001", "INV/" + fy + "/00002"}
+	for i := range expected {
+		if numbers[i] != expected[i] {
+			t.Errorf("Expected invoice number %s, got %s", expected[i], numbers[i])
+		}
+	}
+}
+
+func TestInvoiceTotalsIncludeTax(t *testing.T) {
+	store := newTestStore()
+	store.InitializeCatalog()
+	product, _ := store.GetProduct(1)
+	order, _ := store.CreateOrder(context.Background(), product, 3)
+	store.PayOrder(context.Background(), order)
+
+	invoice, err := store.GetInvoice(order.ID)
+	if err != nil {
+		t.Fatalf("Expected invoice, got %v", err)
+	}
+	if invoice.Total != store.CalculateTotal(order) {
+		t.Errorf("Expected invoice total %.2f, got %.2f", store.CalculateTotal(order), invoice.Total)
+	}
+	if invoice.TaxableValue+invoice.Tax != invoice.Total {
+		t.Errorf("Taxable value %.2f and tax %.2f do not add up to %.2f",
+			invoice.TaxableValue, invoice.Tax, invoice.Total)
+	}
+	if !strings.Contains(invoice.Text, invoice.Number) || !strings.Contains(invoice.HTML, invoice.Number) {
+		t.Errorf("Expected rendered invoices to contain number %s", invoice.Number)
+	}
+}
+
+func TestInvoiceIsStoredUnchanged(t *testing.T) {
+	// Stock changes are saved to the catalog, so work on a copy
+	dir := t.TempDir()
+	data, _ := os.ReadFile(testCatalog)
+	os.WriteFile(filepath.Join(dir, "products.json"), data, 0o644)
+
+	store := newTestStore()
+	store.catalogFile = filepath.Join(dir, "products.json")
+	store.dataDir = dir
+	store.InitializeCatalog()
+	product, _ := store.GetProduct(1)
+	order, _ := store.CreateOrder(context.Background(), product, 2)
+	store.PayOrder(context.Background(), order)
+	issued, _ := store.GetInvoice(order.ID)
+
+	// Price changes after issue must not affect the stored invoice
+	product.Price = 999
+
+	reloaded := newTestStore()
+	reloaded.catalogFile = store.catalogFile
+	reloaded.dataDir = store.dataDir
+	reloaded.InitializeCatalog()
+	if err := reloaded.LoadState(); err != nil {
+		t.Fatalf("Failed to load state: %v", err)
+	}
+	invoice, err := reloaded.GetInvoice(order.ID)
+	if err != nil {
+		t.Fatalf("Expected stored invoice, got %v", err)
+	}
+	if invoice.HTML != issued.HTML || invoice.Text != issued.Text || invoice.Total != 80 {
+		t.Errorf("Stored invoice changed after reload: %+v", invoice)
+	}
+}
+
+func TestHandleGetInvoice(t *testing.T) {
+	store := newTestStore()
+	store.InitializeCatalog()
+	handler := store.Routes("../static")
+	defer store.Close()
+	viewer := staffKey(t, store, RoleViewer)
+	product, _ := store.GetProduct(2)
+	order, _ := store.CreateOrder(context.Background(), product, 1)
+	store.PayOrder(context.Background(), order)
+
+	tests := []struct {
+		name        string
+		path        string
+		key         string
+		status      int
+		contentType string
+	}{
+		{"html", "/api/orders/1/invoice", viewer, http.StatusOK, "text/html; charset=utf-8"},
+		{"text", "/api/orders/1/invoice?format=text", viewer, http.StatusOK, "text/plain; charset=utf-8"},
+		{"json", "/api/orders/1/invoice?format=json", viewer, http.StatusOK, "application/json"},
+		{"claim code", "/api/orders/1/invoice?claimCode=" + strings.ToLower(order.ClaimCode), "", http.StatusOK, "text/html; charset=utf-8"},
+		{"wrong claim code", "/api/orders/1/invoice?claimCode=NONE-SUCH", "", http.StatusNotFound, ""},
+		{"anyone", "/api/orders/1/invoice", "", http.StatusNotFound, ""},
+		{"unknown order", "/api/orders/42/invoice", viewer, http.StatusNotFound, ""},
+		{"bad path", "/api/orders/1/receipt", viewer, http.StatusNotFound, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := staffRequest(handler, http.MethodGet, tt.path, "", tt.key)
+			if rec.Code != tt.status {
+				t.Fatalf("Expected status %d, got %d", tt.status, rec.Code)
+			}
+			if tt.contentType != "" && rec.Header().Get("Content-Type") != tt.contentType {
+				t.Errorf("Expected content type %s, got %s", tt.contentType, rec.Header().Get("Content-Type"))
+			}
+		})
+	}
+}
+
+func TestCustomerInvoices(t *testing.T) {
+	store := newTestStore()
+	store.InitializeCatalog()
+	handler := store.Routes("../static")
+	defer store.Close()
+	owner := registerCustomer(t, store, "asha@example.com")
+	other := registerCustomer(t, store, "ravi@example.com")
+	store.SaveAddress(1, Address{Name: "Asha", Line1: "12 MG Road", City: "Bengaluru", Pincode: "560001"})
+
+	customerRequest(handler, http.MethodPost, "/api/orders", `{"productId": 1, "quantity": 1}`, owner)
+	if rec := customerRequest(handler, http.MethodGet, "/api/orders/1/invoice", "", owner); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "560001") {
+		t.Errorf("Expected the customer to get their invoice, got %d", rec.Code)
+	}
+	if rec := customerRequest(handler, http.MethodGet, "/api/orders/1/invoice", "", other); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected another customer to be refused the invoice, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,418 @@
+package store
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// Why a product's stock changed
+const (
+	MovementOpening    = "opening" // the stock a product had when the ledger first saw it
+	MovementSale       = "sale"
+	MovementRestock    = "restock"
+	MovementReturn     = "return"
+	MovementAdjustment = "adjustment" // a stock count or product edit set the stock
+	MovementWriteOff   = "write_off"  // damaged, expired or lost stock
+)
+
+// Limits on how many movements a ledger request gets
+const (
+	defaultLedgerLimit = 100
+	maxLedgerLimit     = 1000
+)
+
+// StockMovement is one entry in the inventory ledger. Entries are only ever
+// appended, so a product's stock is the sum of its movements' deltas.
+type StockMovement struct {
+	ID              int       `json:"id"`
+	ProductID       int       `json:"productId"`
+	Delta           int       `json:"delta"`
+	Reason          string    `json:"reason"`
+	Note            string    `json:"note,omitempty"`
+	Actor           string    `json:"actor"` // "staff:<username>", "customer:<id>", "guest" or "system"
+	OrderID         int       `json:"orderId,omitempty"`
+	LocationID      int       `json:"locationId,omitempty"`      // where the stock changed, when it was at one location
+	PurchaseOrderID int       `json:"purchaseOrderId,omitempty"` // the purchase order a restock was received against
+	StockAfter      int       `json:"stockAfter"`                // the product's total stock
+	At              time.Time `json:"at"`
+}
+
+// StockDrift compares a product's stored stock with the stock its ledger
+// adds up to
+type StockDrift struct {
+	ProductID   int    `json:"productId"`
+	Name        string `json:"name"`
+	Stock       int    `json:"stock"`
+	LedgerStock int    `json:"ledgerStock"`
+	Drift       int    `json:"drift"` // stored stock minus ledger stock
+	Movements   int    `json:"movements"`
+}
+
+// ReconcileReport is the stock of every product rebuilt from the ledger
+type ReconcileReport struct {
+	CheckedAt time.Time    `json:"checkedAt"`
+	Drifted   int          `json:"drifted"` // products whose stored stock differs from the ledger
+	Applied   bool         `json:"applied"` // the stored stock was set to the ledger stock
+	Products  []StockDrift `json:"products"`
+}
+
+// actor names who is behind a request's stock changes
+func actor(ctx context.Context) string {
+	if user := UserFromContext(ctx); user != nil {
+		return "staff:" + user.Username
+	}
+	if customer := CustomerFromContext(ctx); customer != nil {
+		return "customer:" + strconv.Itoa(customer.ID)
+	}
+	return "system"
+}
+
+// recordMovement appends a movement for a product whose stock has already
+// been changed by delta. Nothing is recorded when the stock did not change.
+// The caller must hold s.mu and save the ledger.
+func (s *Store) recordMovement(product *Product, delta int, reason, note, by string, orderID int) *StockMovement {
+	if delta == 0 {
+		return nil
+	}
+	movement := &StockMovement{
+		ID:         len(s.ledger) + 1,
+		ProductID:  product.ID,
+		Delta:      delta,
+		Reason:     reason,
+		Note:       note,
+		Actor:      by,
+		OrderID:    orderID,
+		StockAfter: product.Stock,
+		At:         time.Now(),
+	}
+	s.ledger = append(s.ledger, movement)
+	return movement
+}
+
+// saveLedger persists the inventory ledger. The caller must hold s.mu.
+func (s *Store) saveLedger() error {
+	return s.writeJSONFile(ledgerFile, s.ledger)
+}
+
+// stockSnapshot is the stock of some products, in total and at each
+// location, and how long the ledger was, taken before changing them so the
+// change can be undone
+type stockSnapshot struct {
+	stock     map[int]int
+	locations map[int]map[int]int // location ID to product ID to stock
+	ledger    int
+}
+
+// snapshotStock records the stock of the given products. The caller must
+// hold s.mu.
+func (s *Store) snapshotStock(productIDs ...int) *stockSnapshot {
+	snapshot := &stockSnapshot{
+		stock:     make(map[int]int, len(productIDs)),
+		locations: make(map[int]map[int]int, len(s.locations)),
+		ledger:    len(s.ledger),
+	}
+	for _, productID := range productIDs {
+		if product, ok := s.catalog[productID]; ok {
+			snapshot.stock[productID] = product.Stock
+		}
+	}
+	for _, location := range s.locations {
+		held := make(map[int]int, len(productIDs))
+		for _, productID := range productIDs {
+			held[productID] = location.Stock[productID]
+		}
+		snapshot.locations[location.ID] = held
+	}
+	return snapshot
+}
+
+// restoreStock puts back the stock in a snapshot and drops the movements
+// recorded since it was taken. The caller must hold s.mu.
+func (s *Store) restoreStock(snapshot *stockSnapshot) {
+	for productID, stock := range snapshot.stock {
+		if product, ok := s.catalog[productID]; ok {
+			product.Stock = stock
+		}
+	}
+	for locationID, held := range snapshot.locations {
+		if location := s.location(locationID); location != nil {
+			for productID, stock := range held {
+				s.setLocationStock(location, productID, stock)
+			}
+		}
+	}
+	s.ledger = s.ledger[:snapshot.ledger]
+}
+
+// saveInventory persists the stock, the locations and the ledger together.
+// If any of them fails to save, the stock goes back to the snapshot and
+// the files already written are written again, so the catalog, locations
+// and ledger never disagree. The caller must hold s.mu.
+func (s *Store) saveInventory(snapshot *stockSnapshot) error {
+	saves := []func() error{s.saveStock, s.saveLocations, s.saveLedger}
+	for i, save := range saves {
+		err := save()
+		if err == nil {
+			continue
+		}
+		s.restoreStock(snapshot)
+		for _, undo := range saves[:i] {
+			if undoErr := undo(); undoErr != nil {
+				s.logger.Error("error undoing a stock change", "error", undoErr)
+			}
+		}
+		return err
+	}
+	return nil
+}
+
+// openLedger records the stock of products the ledger has never seen as
+// their opening balance, and reports whether it recorded any. The caller
+// must hold s.mu.
+func (s *Store) openLedger() bool {
+	seen := make(map[int]bool)
+	for _, movement := range s.ledger {
+		seen[movement.ProductID] = true
+	}
+	opened := false
+	for _, product := range s.productsLocked() {
+		if !seen[product.ID] && product.Stock != 0 {
+			s.recordMovement(s.catalog[product.ID], product.Stock, MovementOpening, "opening balance", "system", 0)
+			opened = true
+		}
+	}
+	return opened
+}
+
+// Ledger returns up to limit movements, newest first, optionally only for
+// one product or one reason
+func (s *Store) Ledger(productID int, reason string, limit int) []*StockMovement {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	movements := []*StockMovement{}
+	for i := len(s.ledger) - 1; i >= 0 && len(movements) < limit; i-- {
+		movement := s.ledger[i]
+		if (productID == 0 || movement.ProductID == productID) && (reason == "" || movement.Reason == reason) {
+			copied := *movement
+			movements = append(movements, &copied)
+		}
+	}
+	return movements
+}
+
+// AdjustStock changes a product's stock at a location by delta and records
+// why. Restocks and returns add stock, write-offs take it away and
+// adjustments go either way; sales, transfers and opening balances are only
+// recorded by the store itself. A location ID of zero adds to the default
+// location and takes from it first.
+func (s *Store) AdjustStock(ctx context.Context, productID, locationID, delta int, reason, note string, orderID int) (*StockMovement, error) {
+	switch {
+	case delta == 0:
+		return nil, invalidRequest("delta cannot be zero")
+	case reason == MovementRestock || reason == MovementReturn:
+		if delta < 0 {
+			return nil, invalidRequest("a %s must add stock", reason)
+		}
+	case reason == MovementWriteOff:
+		if delta > 0 {
+			return nil, invalidRequest("a write-off must take stock away")
+		}
+	case reason != MovementAdjustment:
+		return nil, invalidRequest("reason must be restock, return, adjustment or write_off")
+	}
+
+	s.mu.Lock()
+	product, ok := s.catalog[productID]
+	if !ok {
+		s.mu.Unlock()
+		return nil, ErrProductNotFound
+	}
+	if orderID != 0 && (orderID < 1 || orderID > len(s.orders)) {
+		s.mu.Unlock()
+		return nil, ErrOrderNotFound
+	}
+	available := product.Stock
+	var location *Location
+	if locationID != 0 {
+		if location = s.location(locationID); location == nil {
+			s.mu.Unlock()
+			return nil, ErrLocationNotFound
+		}
+		available = location.Stock[productID]
+	}
+	if available+delta < 0 {
+		s.mu.Unlock()
+		return nil, &InsufficientStockError{ProductID: productID, Requested: -delta, Available: available}
+	}
+	previous := product.Stock
+	snapshot := s.snapshotStock(productID)
+	product.Stock += delta
+	if location != nil {
+		s.setLocationStock(location, productID, available+delta)
+	}
+	s.syncLocations()
+	movement := s.recordMovement(product, delta, reason, note, actor(ctx), orderID)
+	movement.LocationID = locationID
+	if err := s.saveInventory(snapshot); err != nil {
+		s.mu.Unlock()
+		return nil, err
+	}
+	s.productChanged(product, previous)
+	var filled []*Order
+	var err error
+	if delta > 0 {
+		filled, err = s.fillBackorders(productID)
+	}
+	copied, name, restocked := *movement, product.Name, previous == 0 && product.Stock > 0
+	s.mu.Unlock()
+	s.backordersFilled(ctx, filled)
+	if err != nil {
+		return nil, err
+	}
+
+	s.log(ctx).Info("stock adjusted", "productId", productID, "delta", delta, "reason", reason, "stock", copied.StockAfter)
+	if restocked {
+		s.notifyBackInStock(productID, name)
+	}
+	return &copied, nil
+}
+
+// ReconcileStock rebuilds every product's stock from the ledger and
+// reports where it differs from the stored stock. With apply, drifted
+// products get the ledger's stock, and those whose stock rises fill the
+// orders waiting on them.
+func (s *Store) ReconcileStock(ctx context.Context, apply bool) (*ReconcileReport, error) {
+	s.mu.Lock()
+	report, filled, err := s.reconcileStock(ctx, apply)
+	s.mu.Unlock()
+	s.backordersFilled(ctx, filled)
+	return report, err
+}
+
+// reconcileStock does the work of ReconcileStock and returns the backorders
+// it filled. The caller must hold s.mu.
+func (s *Store) reconcileStock(ctx context.Context, apply bool) (*ReconcileReport, []*Order, error) {
+	rebuilt := make(map[int]int)
+	counts := make(map[int]int)
+	for _, movement := range s.ledger {
+		rebuilt[movement.ProductID] += movement.Delta
+		counts[movement.ProductID]++
+	}
+	report := &ReconcileReport{CheckedAt: time.Now(), Applied: apply, Products: []StockDrift{}}
+	var drifted []*Product
+	for _, product := range s.productsLocked() {
+		drift := StockDrift{
+			ProductID:   product.ID,
+			Name:        product.Name,
+			Stock:       product.Stock,
+			LedgerStock: rebuilt[product.ID],
+			Drift:       product.Stock - rebuilt[product.ID],
+			Movements:   counts[product.ID],
+		}
+		if drift.Drift != 0 {
+			report.Drifted++
+			drifted = append(drifted, s.catalog[product.ID])
+			s.log(ctx).Warn("stock drifted from the ledger", "productId", product.ID,
+				"stock", drift.Stock, "ledgerStock", drift.LedgerStock)
+		}
+		report.Products = append(report.Products, drift)
+	}
+	if !apply || len(drifted) == 0 {
+		return report, nil, nil
+	}
+
+	productIDs := make([]int, len(drifted))
+	previous := make([]int, len(drifted))
+	for i, product := range drifted {
+		productIDs[i], previous[i] = product.ID, product.Stock
+	}
+	snapshot := s.snapshotStock(productIDs...)
+	for _, product := range drifted {
+		product.Stock = rebuilt[product.ID]
+	}
+	s.syncLocations()
+	if err := s.saveInventory(snapshot); err != nil {
+		return nil, nil, err
+	}
+	var filled []*Order
+	for i, product := range drifted {
+		s.productChanged(product, previous[i])
+		if product.Stock > previous[i] {
+			orders, err := s.fillBackorders(product.ID)
+			if err != nil {
+				s.log(ctx).Error("error filling backorders", "productId", product.ID, "error", err)
+			}
+			filled = append(filled, orders...)
+		}
+	}
+	s.log(ctx).Info("stock rebuilt from the ledger", "products", len(drifted))
+	return report, filled, nil
+}
+
+// handleLedger serves GET /api/inventory/ledger?productId=&reason=&limit=
+func (s *Store) handleLedger(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	productID := 0
+	if value := query.Get("productId"); value != "" {
+		id, err := strconv.Atoi(value)
+		if err != nil || id < 1 {
+			s.writeError(w, r, invalidRequest("invalid productId"))
+			return
+		}
+		productID = id
+	}
+	reason := query.Get("reason")
+	reasons := []string{MovementOpening, MovementSale, MovementRestock, MovementReturn, MovementAdjustment, MovementWriteOff, MovementTransfer}
+	if reason != "" && !slices.Contains(reasons, reason) {
+		s.writeError(w, r, invalidRequest("unknown reason %q", reason))
+		return
+	}
+	limit := defaultLedgerLimit
+	if value := query.Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxLedgerLimit {
+			s.writeError(w, r, invalidRequest("invalid limit, expected 1 to %d", maxLedgerLimit))
+			return
+		}
+		limit = n
+	}
+	writeJSON(w, http.StatusOK, s.Ledger(productID, reason, limit))
+}
+
+// handleAdjustStock serves POST /api/inventory/movements
+func (s *Store) handleAdjustStock(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		ProductID  int    `json:"productId"`
+		LocationID int    `json:"locationId"`
+		Delta      int    `json:"delta"`
+		Reason     string `json:"reason"`
+		Note       string `json:"note"`
+		OrderID    int    `json:"orderId"`
+	}
+	if err := decodeJSON(r, &request); err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	movement, err := s.AdjustStock(r.Context(), request.ProductID, request.LocationID, request.Delta, request.Reason, request.Note, request.OrderID)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, movement)
+}
+
+// handleReconcileStock serves GET and POST /api/inventory/reconcile. A GET
+// only reports drift; a POST also sets drifted products to the ledger's
+// stock.
+func (s *Store) handleReconcileStock(w http.ResponseWriter, r *http.Request) {
+	report, err := s.ReconcileStock(r.Context(), r.Method == http.MethodPost)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
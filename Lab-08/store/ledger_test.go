@@ -0,0 +1,161 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"example.com/lab-08/config"
+)
+
+func TestLedgerRecordsMovements(t *testing.T) {
+	store := newTestStore()
+	store.InitializeCatalog()
+	handler := store.Routes("../static")
+	defer store.Close()
+	key := staffKey(t, store, RoleInventoryManager)
+
+	product, _ := store.GetProduct(1)
+	order, err := store.CreateOrder(context.Background(), product, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.CancelOrder(context.Background(), order.ID, 0); err != nil {
+		t.Fatal(err)
+	}
+	if rec := staffRequest(handler, http.MethodPut, "/api/products/1/stock", `{"stock": 90, "note": "cycle count"}`, key); rec.Code != http.StatusOK {
+		t.Fatalf("Expected the stock to be set, got %d: %s", rec.Code, rec.Body.String())
+	}
+	rec := staffRequest(handler, http.MethodPost, "/api/inventory/movements", `{"productId": 1, "delta": -4, "reason": "write_off", "note": "bruised"}`, key)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected the write-off to be recorded, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	movements := store.Ledger(1, "", 10)
+	expected := []struct {
+		reason string
+		delta  int
+		after  int
+	}{
+		{MovementWriteOff, -4, 86},
+		{MovementAdjustment, -10, 90},
+		{MovementReturn, 3, 100},
+		{MovementSale, -3, 97},
+		{MovementOpening, 100, 100},
+	}
+	if len(movements) != len(expected) {
+		t.Fatalf("Expected %d movements, got %d", len(expected), len(movements))
+	}
+	for i, want := range expected {
+		got := movements[i]
+		if got.Reason != want.reason || got.Delta != want.delta || got.StockAfter != want.after {
+			t.Errorf("Movement %d: expected %s %d leaving %d, got %+v", i, want.reason, want.delta, want.after, got)
+		}
+	}
+	if movements[3].Actor != "guest" || movements[3].OrderID != order.ID || movements[0].Actor[:6] != "staff:" || movements[0].Note != "bruised" {
+		t.Errorf("Expected the sale and write-off to say who made them, got %+v and %+v", movements[3], movements[0])
+	}
+	if sales := store.Ledger(0, MovementSale, 10); len(sales) != 1 {
+		t.Errorf("Expected 1 sale, got %d", len(sales))
+	}
+
+	// Movements that make no sense are refused
+	if _, err := store.AdjustStock(context.Background(), 1, 0, -1, MovementRestock, "", 0); err == nil {
+		t.Error("Expected a restock that takes stock away to be refused")
+	}
+	if _, err := store.AdjustStock(context.Background(), 1, 0, -100, MovementWriteOff, "", 0); !errors.Is(err, ErrInsufficientStock) {
+		t.Errorf("Expected writing off more than is in stock to fail, got %v", err)
+	}
+	if _, err := store.AdjustStock(context.Background(), 1, 0, 1, MovementSale, "", 0); err == nil {
+		t.Error("Expected a manual sale to be refused")
+	}
+
+	report, _ := store.ReconcileStock(context.Background(), false)
+	if report.Drifted != 0 || len(report.Products) != 3 || report.Products[0].LedgerStock != 86 {
+		t.Errorf("Expected the ledger to match the stock, got %+v", report)
+	}
+}
+
+func TestReconcileFindsDrift(t *testing.T) {
+	dir := t.TempDir()
+	data, _ := os.ReadFile(testCatalog)
+	cfg := config.Default()
+	cfg.Store.CatalogFile = filepath.Join(dir, "products.json")
+	cfg.Store.DataDir = filepath.Join(dir, "data")
+	os.WriteFile(cfg.Store.CatalogFile, data, 0o644)
+
+	first, err := Open(cfg)
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	product, _ := first.GetProduct(2)
+	first.CreateOrder(context.Background(), product, 2)
+	first.Close()
+
+	// Someone edits the live catalog by hand while the store is down
+	var catalog ProductData
+	data, _ = os.ReadFile(filepath.Join(cfg.Store.DataDir, productsFile))
+	json.Unmarshal(data, &catalog)
+	for i := range catalog.Products {
+		if catalog.Products[i].ID == 2 {
+			catalog.Products[i].Stock = 25
+		}
+	}
+	data, _ = json.Marshal(catalog)
+	os.WriteFile(filepath.Join(cfg.Store.DataDir, productsFile), data, 0o644)
+
+	second, err := Open(cfg)
+	if err != nil {
+		t.Fatalf("Failed to reopen store: %v", err)
+	}
+	defer second.Close()
+	report, _ := second.ReconcileStock(context.Background(), false)
+	if report.Drifted != 1 || report.Products[1].Stock != 25 || report.Products[1].LedgerStock != 8 || report.Products[1].Drift != 17 {
+		t.Fatalf("Expected the laptop to have drifted by 17, got %+v", report)
+	}
+
+	report, _ = second.ReconcileStock(context.Background(), true)
+	if product, _ := second.GetProduct(2); !report.Applied || product.Stock != 8 {
+		t.Errorf("Expected the laptop's stock to be rebuilt from the ledger, got %d", product.Stock)
+	}
+	if report, _ := second.ReconcileStock(context.Background(), false); report.Drifted != 0 {
+		t.Errorf("Expected no drift after rebuilding, got %+v", report)
+	}
+}
+
+func TestStockChangeUndoneWhenLedgerFailsToSave(t *testing.T) {
+	dir := t.TempDir()
+	data, _ := os.ReadFile(testCatalog)
+	cfg := config.Default()
+	cfg.Store.CatalogFile = filepath.Join(dir, "products.json")
+	cfg.Store.DataDir = filepath.Join(dir, "data")
+	os.WriteFile(cfg.Store.CatalogFile, data, 0o644)
+
+	store, err := Open(cfg)
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	defer store.Close()
+	// A directory in the way of the ledger's temporary file fails its save
+	os.MkdirAll(filepath.Join(cfg.Store.DataDir, ledgerFile+".tmp"), 0o755)
+
+	if _, err := store.AdjustStock(context.Background(), 2, 0, 5, MovementRestock, "", 0); err == nil {
+		t.Fatal("Expected the restock to fail when the ledger cannot be saved")
+	}
+	product, _ := store.GetProduct(2)
+	if product.Stock != 10 || len(store.Ledger(2, MovementRestock, 10)) != 0 || store.Locations()[0].Stock[2] != 10 {
+		t.Errorf("Expected the restock to be undone, got stock %d", product.Stock)
+	}
+	var catalog ProductData
+	data, _ = os.ReadFile(filepath.Join(cfg.Store.DataDir, productsFile))
+	json.Unmarshal(data, &catalog)
+	for _, saved := range catalog.Products {
+		if saved.ID == 2 && saved.Stock != 10 {
+			t.Errorf("Expected the saved stock to be put back, got %d", saved.Stock)
+		}
+	}
+}
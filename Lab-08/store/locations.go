@@ -0,0 +1,501 @@
+package store
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// defaultLocationID is the location that takes stock changes which do not
+// name a location
+const defaultLocationID = 1
+
+// MovementTransfer is the ledger reason for stock moved between locations.
+// A transfer is recorded as a pair of movements that add up to nothing.
+const MovementTransfer = "transfer"
+
+// Location is a warehouse or dark store that holds stock. A product's Stock
+// is the sum of its stock at every location.
+type Location struct {
+	ID   int    `json:"id"`
+	Code string `json:"code"`
+	Name string `json:"name"`
+	// Pincode is where the location is, used to find the location nearest
+	// a customer
+	Pincode string      `json:"pincode,omitempty"`
+	Stock   map[int]int `json:"stock"` // units on hand, keyed by product ID
+}
+
+// Allocation is the part of an order one location fulfils
+type Allocation struct {
+	LocationID int `json:"locationId"`
+	Quantity   int `json:"quantity"`
+}
+
+// LocationStock is a product's stock at one location
+type LocationStock struct {
+	LocationID int    `json:"locationId"`
+	Code       string `json:"code"`
+	Name       string `json:"name"`
+	Pincode    string `json:"pincode,omitempty"`
+	Stock      int    `json:"stock"`
+}
+
+// Transfer moves stock of a product from one location to another
+type Transfer struct {
+	ProductID      int    `json:"productId"`
+	FromLocationID int    `json:"fromLocationId"`
+	ToLocationID   int    `json:"toLocationId"`
+	Quantity       int    `json:"quantity"`
+	Note           string `json:"note,omitempty"`
+}
+
+// saveLocations persists the locations and their stock. The caller must
+// hold s.mu.
+func (s *Store) saveLocations() error {
+	return s.writeJSONFile(locationsFile, s.locations)
+}
+
+// location returns a location by its ID, or nil. The caller must hold s.mu.
+func (s *Store) location(id int) *Location {
+	if id < 1 || id > len(s.locations) {
+		return nil
+	}
+	return s.locations[id-1]
+}
+
+// syncLocations makes every product's stock across the locations add up to
+// its Stock, and reports whether anything changed. Stock that appeared
+// without a location goes to the default location; stock that went missing
+// is taken from the default location first, then from the others in ID
+// order. The default location is created when there are none. The caller
+// must hold s.mu.
+func (s *Store) syncLocations() bool {
+	changed := false
+	if len(s.locations) == 0 {
+		s.locations = []*Location{{ID: defaultLocationID, Code: "MAIN", Name: "Main warehouse", Stock: map[int]int{}}}
+		changed = true
+	}
+	held := make(map[int]int)
+	for _, location := range s.locations {
+		if location.Stock == nil {
+			location.Stock = make(map[int]int)
+		}
+		for productID, quantity := range location.Stock {
+			// Deleted products have nothing left anywhere
+			if _, ok := s.catalog[productID]; !ok || quantity == 0 {
+				delete(location.Stock, productID)
+				changed = changed || quantity != 0
+				continue
+			}
+			held[productID] += quantity
+		}
+	}
+	for id, product := range s.catalog {
+		excess := held[id] - product.Stock
+		if excess == 0 {
+			continue
+		}
+		changed = true
+		if excess < 0 {
+			s.locations[0].Stock[id] -= excess
+			continue
+		}
+		for _, location := range s.locations {
+			taken := min(excess, location.Stock[id])
+			s.setLocationStock(location, id, location.Stock[id]-taken)
+			if excess -= taken; excess == 0 {
+				break
+			}
+		}
+	}
+	return changed
+}
+
+// setLocationStock sets a location's stock of a product, leaving out the
+// products it has none of. The caller must hold s.mu.
+func (s *Store) setLocationStock(location *Location, productID, quantity int) {
+	if quantity == 0 {
+		delete(location.Stock, productID)
+		return
+	}
+	location.Stock[productID] = quantity
+}
+
+// pincodeDistance measures how far apart two pincodes are. Indian pincodes
+// narrow down the region, district and post office digit by digit, so the
+// more leading digits they share the nearer they are; among pincodes that
+// share as many, the closer number counts as nearer. A location without a
+// pincode is as far as can be.
+func pincodeDistance(pincode, other string) (shared, apart int) {
+	if other == "" {
+		return -1, math.MaxInt
+	}
+	for shared < len(pincode) && shared < len(other) && pincode[shared] == other[shared] {
+		shared++
+	}
+	a, _ := strconv.Atoi(pincode)
+	b, _ := strconv.Atoi(other)
+	return shared, max(a-b, b-a)
+}
+
+// nearestLocations returns the locations nearest the pincode first, or in
+// ID order without a pincode. The caller must hold s.mu.
+func (s *Store) nearestLocations(pincode string) []*Location {
+	locations := slices.Clone(s.locations)
+	if pincode == "" {
+		return locations
+	}
+	slices.SortStableFunc(locations, func(a, b *Location) int {
+		aShared, aApart := pincodeDistance(pincode, a.Pincode)
+		bShared, bApart := pincodeDistance(pincode, b.Pincode)
+		return cmp.Or(cmp.Compare(bShared, aShared), cmp.Compare(aApart, bApart))
+	})
+	return locations
+}
+
+// allocate picks the locations that fulfil an order for a customer at the
+// pincode: the nearest location that has all of it, or when none does, as
+// much as each location has, nearest first. The caller must hold s.mu and
+// have checked that the product has enough stock in all.
+func (s *Store) allocate(productID, quantity int, pincode string) []Allocation {
+	if quantity <= 0 {
+		return nil
+	}
+	locations := s.nearestLocations(pincode)
+	for _, location := range locations {
+		if location.Stock[productID] >= quantity {
+			return []Allocation{{LocationID: location.ID, Quantity: quantity}}
+		}
+	}
+	var allocations []Allocation
+	for _, location := range locations {
+		if taken := min(quantity, location.Stock[productID]); taken > 0 {
+			allocations = append(allocations, Allocation{LocationID: location.ID, Quantity: taken})
+			if quantity -= taken; quantity == 0 {
+				break
+			}
+		}
+	}
+	return allocations
+}
+
+// copyLocation returns a copy of a location that is safe to use without
+// s.mu. The caller must hold s.mu.
+func copyLocation(location *Location) Location {
+	copied := *location
+	copied.Stock = make(map[int]int, len(location.Stock))
+	for productID, quantity := range location.Stock {
+		copied.Stock[productID] = quantity
+	}
+	return copied
+}
+
+// Locations returns every location with its stock, in ID order
+func (s *Store) Locations() []Location {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	locations := make([]Location, len(s.locations))
+	for i, location := range s.locations {
+		locations[i] = copyLocation(location)
+	}
+	return locations
+}
+
+// checkLocation validates a location's fields and that its code is not used
+// by another location. The caller must hold s.mu.
+func (s *Store) checkLocation(location Location) error {
+	var problems []string
+	if location.Code == "" {
+		problems = append(problems, "code is required")
+	}
+	if location.Name == "" {
+		problems = append(problems, "name is required")
+	}
+	if location.Pincode != "" && !pincodePattern.MatchString(location.Pincode) {
+		problems = append(problems, fmt.Sprintf("pincode %q must be six digits", location.Pincode))
+	}
+	for _, other := range s.locations {
+		if other.ID != location.ID && strings.EqualFold(other.Code, location.Code) {
+			problems = append(problems, fmt.Sprintf("code %q is already used by location %d", location.Code, other.ID))
+		}
+	}
+	if len(problems) > 0 {
+		return invalidRequest("invalid location: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// CreateLocation adds a location with no stock
+func (s *Store) CreateLocation(ctx context.Context, location Location) (*Location, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	location.ID = len(s.locations) + 1
+	location.Stock = make(map[int]int)
+	if err := s.checkLocation(location); err != nil {
+		return nil, err
+	}
+	s.locations = append(s.locations, &location)
+	if err := s.saveLocations(); err != nil {
+		s.locations = s.locations[:len(s.locations)-1]
+		return nil, err
+	}
+	s.log(ctx).Info("location created", "locationId", location.ID, "code", location.Code)
+	copied := copyLocation(&location)
+	return &copied, nil
+}
+
+// UpdateLocation changes a location's code, name and pincode. Its stock is
+// only changed by stock updates and transfers.
+func (s *Store) UpdateLocation(ctx context.Context, id int, update Location) (*Location, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	location := s.location(id)
+	if location == nil {
+		return nil, ErrLocationNotFound
+	}
+	update.ID = id
+	if err := s.checkLocation(update); err != nil {
+		return nil, err
+	}
+	previous := *location
+	location.Code, location.Name, location.Pincode = update.Code, update.Name, update.Pincode
+	if err := s.saveLocations(); err != nil {
+		*location = previous
+		return nil, err
+	}
+	s.log(ctx).Info("location updated", "locationId", id, "code", location.Code)
+	copied := copyLocation(location)
+	return &copied, nil
+}
+
+// SetLocationStock sets a product's stock at one location to a counted
+// quantity, recording the difference in the ledger as an adjustment. A
+// location ID of zero sets the product's total stock instead.
+func (s *Store) SetLocationStock(ctx context.Context, productID, locationID, quantity int, note string) error {
+	s.mu.Lock()
+	product, exists := s.catalog[productID]
+	if !exists {
+		s.mu.Unlock()
+		return ErrProductNotFound
+	}
+	if quantity < 0 {
+		s.mu.Unlock()
+		return ErrInvalidQuantity
+	}
+	var location *Location
+	if locationID != 0 {
+		if location = s.location(locationID); location == nil {
+			s.mu.Unlock()
+			return ErrLocationNotFound
+		}
+	}
+	previous := product.Stock
+	snapshot := s.snapshotStock(productID)
+	if location != nil {
+		product.Stock += quantity - location.Stock[productID]
+		s.setLocationStock(location, productID, quantity)
+	} else {
+		product.Stock = quantity
+		s.syncLocations()
+	}
+	restocked := previous == 0 && product.Stock > 0
+	if movement := s.recordMovement(product, product.Stock-previous, MovementAdjustment, note, actor(ctx), 0); movement != nil {
+		movement.LocationID = locationID
+	}
+	err := s.saveInventory(snapshot)
+	if err == nil {
+		s.productChanged(product, previous)
+	}
+	var filled []*Order
+	if err == nil {
+		filled, err = s.fillBackorders(productID)
+	}
+	restocked = restocked && product.Stock > 0
+	name := product.Name
+	s.mu.Unlock()
+
+	// Customers are notified outside s.mu, which is never held with s.authMu
+	s.backordersFilled(ctx, filled)
+	if err == nil && restocked {
+		s.notifyBackInStock(productID, name)
+	}
+	return err
+}
+
+// TransferStock moves stock of a product between two locations. The
+// product's total stock is unchanged; the ledger records the units leaving
+// one location and arriving at the other.
+func (s *Store) TransferStock(ctx context.Context, transfer Transfer) ([]*StockMovement, error) {
+	if transfer.Quantity <= 0 {
+		return nil, invalidRequest("quantity must be positive")
+	}
+	if transfer.FromLocationID == transfer.ToLocationID {
+		return nil, invalidRequest("fromLocationId and toLocationId must be different locations")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	product, ok := s.catalog[transfer.ProductID]
+	if !ok {
+		return nil, ErrProductNotFound
+	}
+	from, to := s.location(transfer.FromLocationID), s.location(transfer.ToLocationID)
+	if from == nil || to == nil {
+		return nil, ErrLocationNotFound
+	}
+	available := from.Stock[product.ID]
+	if available < transfer.Quantity {
+		return nil, &InsufficientStockError{ProductID: product.ID, Requested: transfer.Quantity, Available: available}
+	}
+	snapshot := s.snapshotStock(product.ID)
+	s.setLocationStock(from, product.ID, available-transfer.Quantity)
+	s.setLocationStock(to, product.ID, to.Stock[product.ID]+transfer.Quantity)
+	by := actor(ctx)
+	out := s.recordMovement(product, -transfer.Quantity, MovementTransfer, transfer.Note, by, 0)
+	out.LocationID = from.ID
+	in := s.recordMovement(product, transfer.Quantity, MovementTransfer, transfer.Note, by, 0)
+	in.LocationID = to.ID
+	if err := s.saveInventory(snapshot); err != nil {
+		return nil, err
+	}
+	s.log(ctx).Info("stock transferred", "productId", product.ID, "from", from.Code, "to", to.Code,
+		"quantity", transfer.Quantity)
+	copiedOut, copiedIn := *out, *in
+	return []*StockMovement{&copiedOut, &copiedIn}, nil
+}
+
+// Availability returns a product's stock at every location, nearest the
+// pincode first
+func (s *Store) Availability(productID int, pincode string) ([]LocationStock, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if _, ok := s.catalog[productID]; !ok {
+		return nil, ErrProductNotFound
+	}
+	var stock []LocationStock
+	for _, location := range s.nearestLocations(pincode) {
+		stock = append(stock, locationStock(location, productID))
+	}
+	return stock, nil
+}
+
+// NearestLocation returns the location nearest the pincode with its stock
+func (s *Store) NearestLocation(pincode string) Location {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return copyLocation(s.nearestLocations(pincode)[0])
+}
+
+// locationStock returns a location's stock of a product
+func locationStock(location *Location, productID int) LocationStock {
+	return LocationStock{
+		LocationID: location.ID,
+		Code:       location.Code,
+		Name:       location.Name,
+		Pincode:    location.Pincode,
+		Stock:      location.Stock[productID],
+	}
+}
+
+// requestPincode returns the pincode a request asks about: the pincode query
+// parameter, or else the signed in customer's default delivery address
+func requestPincode(r *http.Request) (string, error) {
+	if pincode := r.URL.Query().Get("pincode"); pincode != "" {
+		if !pincodePattern.MatchString(pincode) {
+			return "", invalidRequest("pincode %q must be six digits", pincode)
+		}
+		return pincode, nil
+	}
+	if customer := CustomerFromContext(r.Context()); customer != nil {
+		if address, _ := customer.address(0); address != nil {
+			return address.Pincode, nil
+		}
+	}
+	return "", nil
+}
+
+// handleListLocations serves GET /api/inventory/locations
+func (s *Store) handleListLocations(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.Locations())
+}
+
+// handleCreateLocation serves POST /api/inventory/locations
+func (s *Store) handleCreateLocation(w http.ResponseWriter, r *http.Request) {
+	var request Location
+	if err := decodeJSON(r, &request); err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	location, err := s.CreateLocation(r.Context(), request)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, location)
+}
+
+// handleUpdateLocation serves PUT /api/inventory/locations/{id}
+func (s *Store) handleUpdateLocation(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "id", "location")
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	var request Location
+	if err := decodeJSON(r, &request); err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	location, err := s.UpdateLocation(r.Context(), id, request)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, location)
+}
+
+// handleTransferStock serves POST /api/inventory/transfers
+func (s *Store) handleTransferStock(w http.ResponseWriter, r *http.Request) {
+	var request Transfer
+	if err := decodeJSON(r, &request); err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	movements, err := s.TransferStock(r.Context(), request)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, movements)
+}
+
+// handleAvailability serves GET /api/products/{id}/availability?pincode=
+func (s *Store) handleAvailability(w http.ResponseWriter, r *http.Request) {
+	productID, err := pathID(r, "id", "product")
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	pincode, err := requestPincode(r)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	stock, err := s.Availability(productID, pincode)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, stock)
+}
@@ -0,0 +1,163 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"example.com/lab-08/config"
+)
+
+func TestLocationAllocation(t *testing.T) {
+	store := newTestStore()
+	store.InitializeCatalog()
+	handler := store.Routes("../static")
+	defer store.Close()
+	ctx := context.Background()
+
+	// Everything starts in the default location
+	if locations := store.Locations(); len(locations) != 1 || locations[0].Stock[2] != 10 {
+		t.Fatalf("Expected the default location to hold all the stock, got %+v", locations)
+	}
+	bangalore, err := store.CreateLocation(ctx, Location{Code: "BLR", Name: "Indiranagar", Pincode: "560038"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mumbai, _ := store.CreateLocation(ctx, Location{Code: "BOM", Name: "Andheri", Pincode: "400053"})
+	if _, err := store.CreateLocation(ctx, Location{Code: "blr", Name: "Again"}); err == nil {
+		t.Error("Expected a duplicate code to be refused")
+	}
+	for _, transfer := range []Transfer{
+		{ProductID: 1, FromLocationID: 1, ToLocationID: bangalore.ID, Quantity: 30},
+		{ProductID: 2, FromLocationID: 1, ToLocationID: bangalore.ID, Quantity: 4},
+		{ProductID: 2, FromLocationID: 1, ToLocationID: mumbai.ID, Quantity: 3},
+	} {
+		if _, err := store.TransferStock(ctx, transfer); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := store.TransferStock(ctx, Transfer{ProductID: 2, FromLocationID: mumbai.ID, ToLocationID: 1, Quantity: 4}); !errors.Is(err, ErrInsufficientStock) {
+		t.Errorf("Expected moving more than the location holds to fail, got %v", err)
+	}
+	if product, _ := store.GetProduct(2); product.Stock != 10 {
+		t.Errorf("Expected transfers to leave the total alone, got %d", product.Stock)
+	}
+
+	// A Bangalore customer's order comes from the Bangalore store when it
+	// has enough, and is split nearest first when no location does
+	ctx = WithOrderOwner(ctx, OrderOwner{Address: &Address{Pincode: "560001"}})
+	apple, _ := store.GetProduct(1)
+	order, _ := store.CreateOrder(ctx, apple, 20)
+	if len(order.Allocations) != 1 || order.Allocations[0] != (Allocation{bangalore.ID, 20}) {
+		t.Errorf("Expected the apples to come from Bangalore, got %+v", order.Allocations)
+	}
+	laptop, _ := store.GetProduct(2)
+	order, _ = store.CreateOrder(ctx, laptop, 8)
+	expected := []Allocation{{bangalore.ID, 4}, {mumbai.ID, 3}, {1, 1}}
+	if len(order.Allocations) != len(expected) {
+		t.Fatalf("Expected the laptops to be split across every location, got %+v", order.Allocations)
+	}
+	for i := range expected {
+		if order.Allocations[i] != expected[i] {
+			t.Errorf("Allocation %d: expected %+v, got %+v", i, expected[i], order.Allocations[i])
+		}
+	}
+	if sales := store.Ledger(2, MovementSale, 10); len(sales) != 3 || sales[0].LocationID != 1 || sales[2].LocationID != bangalore.ID {
+		t.Errorf("Expected a sale at each location, got %+v", sales)
+	}
+
+	// Cancelling puts the laptops back where they came from
+	if _, err := store.CancelOrder(context.Background(), order.ID, 0); err != nil {
+		t.Fatal(err)
+	}
+	if stock, _ := store.Availability(2, "560001"); stock[0].LocationID != bangalore.ID || stock[0].Stock != 4 || stock[1].Stock != 3 || stock[2].Stock != 3 {
+		t.Errorf("Expected the laptops back at each location, nearest first, got %+v", stock)
+	}
+
+	// Setting the stock at a location changes the total by the difference
+	if err := store.SetLocationStock(context.Background(), 2, mumbai.ID, 5, "count"); err != nil {
+		t.Fatal(err)
+	}
+	if laptop.Stock != 12 {
+		t.Errorf("Expected 12 laptops in all, got %d", laptop.Stock)
+	}
+
+	// The listing shows the stock at the customer's nearest location
+	rec := staffRequest(handler, http.MethodGet, "/api/products?pincode=400001", "", "")
+	var products []RatedProduct
+	json.NewDecoder(rec.Body).Decode(&products)
+	if len(products) != 3 || products[1].Availability == nil || products[1].Availability.LocationID != mumbai.ID || products[1].Availability.Stock != 5 {
+		t.Errorf("Expected the Mumbai stock in the listing, got %+v", products)
+	}
+	if rec := staffRequest(handler, http.MethodGet, "/api/products/1/availability?pincode=12", "", ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected a bad pincode to be refused, got %d", rec.Code)
+	}
+}
+
+func TestLocationsPersist(t *testing.T) {
+	dir := t.TempDir()
+	data, _ := os.ReadFile(testCatalog)
+	cfg := config.Default()
+	cfg.Store.CatalogFile = filepath.Join(dir, "products.json")
+	cfg.Store.DataDir = filepath.Join(dir, "data")
+	os.WriteFile(cfg.Store.CatalogFile, data, 0o644)
+
+	first, err := Open(cfg)
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	location, _ := first.CreateLocation(context.Background(), Location{Code: "DEL", Name: "Saket", Pincode: "110017"})
+	first.TransferStock(context.Background(), Transfer{ProductID: 2, FromLocationID: 1, ToLocationID: location.ID, Quantity: 6})
+	first.Close()
+
+	// Stock added to the live catalog by hand goes to the default location
+	var catalog ProductData
+	data, _ = os.ReadFile(filepath.Join(cfg.Store.DataDir, productsFile))
+	json.Unmarshal(data, &catalog)
+	for i := range catalog.Products {
+		if catalog.Products[i].ID == 2 {
+			catalog.Products[i].Stock = 15
+		}
+	}
+	data, _ = json.Marshal(catalog)
+	os.WriteFile(filepath.Join(cfg.Store.DataDir, productsFile), data, 0o644)
+
+	second, err := Open(cfg)
+	if err != nil {
+		t.Fatalf("Failed to reopen store: %v", err)
+	}
+	defer second.Close()
+	locations := second.Locations()
+	if len(locations) != 2 || locations[0].Stock[2] != 9 || locations[1].Stock[2] != 6 || locations[1].Pincode != "110017" {
+		t.Errorf("Expected the Saket stock to be kept and the new stock in the default location, got %+v", locations)
+	}
+}
+
+func TestLocationStockUndoneWhenSaveFails(t *testing.T) {
+	store := openDataStore(t)
+	ctx := context.Background()
+	location, _ := store.CreateLocation(ctx, Location{Code: "DEL", Name: "Saket", Pincode: "110017"})
+	// A directory in the way of the ledger's temporary file fails its save
+	os.MkdirAll(filepath.Join(store.dataDir, ledgerFile+".tmp"), 0o755)
+
+	if _, err := store.TransferStock(ctx, Transfer{ProductID: 2, FromLocationID: 1, ToLocationID: location.ID, Quantity: 6}); err == nil {
+		t.Fatal("Expected the transfer to fail when the ledger cannot be saved")
+	}
+	if err := store.SetLocationStock(ctx, 2, location.ID, 4, ""); err == nil {
+		t.Fatal("Expected the count to fail when the ledger cannot be saved")
+	}
+	laptop, _ := store.GetProduct(2)
+	if locations := store.Locations(); laptop.Stock != 10 || locations[0].Stock[2] != 10 || locations[1].Stock[2] != 0 {
+		t.Errorf("Expected the stock to stay where it was, got %d in total and %+v", laptop.Stock, locations)
+	}
+	var saved []Location
+	data, _ := os.ReadFile(filepath.Join(store.dataDir, locationsFile))
+	json.Unmarshal(data, &saved)
+	if len(saved) != 2 || saved[0].Stock[2] != 10 || saved[1].Stock[2] != 0 {
+		t.Errorf("Expected the saved locations to be unchanged, got %+v", saved)
+	}
+}
@@ -0,0 +1,115 @@
+package store
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"example.com/lab-08/config"
+)
+
+// RequestIDHeader carries the request ID in requests and responses. A client
+// may send its own ID; otherwise one is generated.
+const RequestIDHeader = "X-Request-ID"
+
+// requestIDKey is the context key for the request ID
+type requestIDKey struct{}
+
+// NewLogger creates a structured logger writing to w in the configured
+// format and level
+func NewLogger(w io.Writer, cfg config.LogConfig) *slog.Logger {
+	level, err := cfg.SlogLevel()
+	if err != nil {
+		level = slog.LevelInfo
+	}
+	opts := &slog.HandlerOptions{Level: level}
+	if cfg.Format == "text" {
+		return slog.New(slog.NewTextHandler(w, opts))
+	}
+	return slog.New(slog.NewJSONHandler(w, opts))
+}
+
+// SetLogger replaces the logger used for request, order and worker logs
+func (s *Store) SetLogger(logger *slog.Logger) {
+	s.logger = logger
+}
+
+// WithRequestID returns a copy of ctx carrying the request ID
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the request ID carried by ctx, or "" if there is none
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// newRequestID returns a random 16 character hex ID
+func newRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// log returns the store logger tagged with the request ID carried by ctx
+func (s *Store) log(ctx context.Context) *slog.Logger {
+	if id := RequestID(ctx); id != "" {
+		return s.logger.With("requestId", id)
+	}
+	return s.logger
+}
+
+// orderLog returns the store logger tagged with the order and the request
+// that created it, so worker output can be matched to the HTTP request
+func (s *Store) orderLog(order *Order) *slog.Logger {
+	logger := s.logger.With("orderId", order.ID)
+	if order.RequestID != "" {
+		logger = logger.With("requestId", order.RequestID)
+	}
+	return logger
+}
+
+// statusRecorder remembers the status code written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// withRequestLogging gives every request an ID, passes it on in the request
+// context and the response header, and logs the request when it completes
+func (s *Store) withRequestLogging(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if id == "" || len(id) > 64 {
+			id = newRequestID()
+		}
+		w.Header().Set(RequestIDHeader, id)
+		r = r.WithContext(WithRequestID(r.Context(), id))
+
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+
+		level := slog.LevelInfo
+		if rec.status >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		s.log(r.Context()).Log(r.Context(), level, "request completed",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", rec.status,
+			"durationMs", float64(time.Since(start).Microseconds())/1000,
+			"remoteAddr", r.RemoteAddr,
+		)
+	})
+}
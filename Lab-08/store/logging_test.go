@@ -0,0 +1,102 @@
+package store
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// syncBuffer is a bytes.Buffer that workers and handlers can log to at once
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+// entries decodes the JSON log lines
+func (b *syncBuffer) entries(t *testing.T) []map[string]any {
+	t.Helper()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var entries []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(b.buf.String()), "\n") {
+		var entry map[string]any
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("Log line is not JSON: %q", line)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func TestRequestIDCorrelatesOrderLogs(t *testing.T) {
+	store := newTestStore()
+	store.InitializeCatalog()
+	logs := &syncBuffer{}
+	store.SetLogger(slog.New(slog.NewJSONHandler(logs, &slog.HandlerOptions{Level: slog.LevelDebug})))
+
+	req := httptest.NewRequest(http.MethodPost, "/api/orders", strings.NewReader(`{"productId": 1, "quantity": 2}`))
+	req.Header.Set(RequestIDHeader, "req-42")
+	rec := httptest.NewRecorder()
+	store.Routes("../static").ServeHTTP(rec, req)
+	store.Close()
+
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if got := rec.Header().Get(RequestIDHeader); got != "req-42" {
+		t.Errorf("Expected response request ID req-42, got %q", got)
+	}
+
+	messages := map[string]bool{}
+	for _, entry := range logsFor(t, logs, "req-42") {
+		messages[entry["msg"].(string)] = true
+	}
+	for _, expected := range []string{"order created", "processing order", "order ready for dispatch", "request completed"} {
+		if !messages[expected] {
+			t.Errorf("Expected %q to be logged with the request ID, got %v", expected, messages)
+		}
+	}
+}
+
+// logsFor returns the log entries tagged with the request ID
+func logsFor(t *testing.T, logs *syncBuffer, id string) []map[string]any {
+	t.Helper()
+	var matched []map[string]any
+	for _, entry := range logs.entries(t) {
+		if entry["requestId"] == id {
+			matched = append(matched, entry)
+		}
+	}
+	return matched
+}
+
+func TestRequestIDGenerated(t *testing.T) {
+	store := newTestStore()
+	defer store.Close()
+	store.InitializeCatalog()
+	logs := &syncBuffer{}
+	store.SetLogger(slog.New(slog.NewJSONHandler(logs, nil)))
+
+	rec := httptest.NewRecorder()
+	store.Routes("../static").ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/products", nil))
+
+	id := rec.Header().Get(RequestIDHeader)
+	if len(id) != 16 {
+		t.Fatalf("Expected a generated 16 character request ID, got %q", id)
+	}
+	entries := logsFor(t, logs, id)
+	if len(entries) != 1 || entries[0]["status"] != float64(http.StatusOK) || entries[0]["path"] != "/api/products" {
+		t.Errorf("Expected one request log line, got %v", entries)
+	}
+}
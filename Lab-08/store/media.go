@@ -0,0 +1,229 @@
+package store
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	// maxImageUpload is the largest image file accepted for a product
+	maxImageUpload = 5 << 20
+	// maxImagePixels is the largest image accepted once decoded. A small
+	// file can declare a huge image, so this is checked before decoding.
+	maxImagePixels = 24_000_000
+	// thumbnailSize is the longest edge of a generated thumbnail in pixels
+	thumbnailSize = 240
+	// mediaURLPrefix is where stored images are served from
+	mediaURLPrefix = "/media/"
+)
+
+// thumbnail scales src down so its longest edge is at most maxSize pixels,
+// averaging the source pixels that fall under each thumbnail pixel
+func thumbnail(src image.Image, maxSize int) image.Image {
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width <= maxSize && height <= maxSize {
+		return src
+	}
+
+	thumbWidth, thumbHeight := maxSize, maxSize
+	if width > height {
+		thumbHeight = max(1, height*maxSize/width)
+	} else {
+		thumbWidth = max(1, width*maxSize/height)
+	}
+
+	dst := image.NewRGBA64(image.Rect(0, 0, thumbWidth, thumbHeight))
+	for y := 0; y < thumbHeight; y++ {
+		y0 := bounds.Min.Y + y*height/thumbHeight
+		y1 := bounds.Min.Y + (y+1)*height/thumbHeight
+		for x := 0; x < thumbWidth; x++ {
+			x0 := bounds.Min.X + x*width/thumbWidth
+			x1 := bounds.Min.X + (x+1)*width/thumbWidth
+
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := src.At(sx, sy).RGBA()
+					r, g, b, a = r+uint64(cr), g+uint64(cg), b+uint64(cb), a+uint64(ca)
+					n++
+				}
+			}
+			dst.SetRGBA64(x, y, color.RGBA64{
+				R: uint16(r / n), G: uint16(g / n), B: uint16(b / n), A: uint16(a / n),
+			})
+		}
+	}
+	return dst
+}
+
+// encodeImage writes img in the given format; JPEG stays JPEG and everything
+// else becomes PNG so transparency is kept
+func encodeImage(w io.Writer, img image.Image, format string) error {
+	if format == "jpeg" {
+		return jpeg.Encode(w, img, &jpeg.Options{Quality: 85})
+	}
+	return png.Encode(w, img)
+}
+
+// imageExtension returns the file extension used to store an image format
+func imageExtension(format string) string {
+	if format == "jpeg" {
+		return ".jpg"
+	}
+	return ".png"
+}
+
+// writeMediaFile stores data in the media directory and returns its URL
+func (s *Store) writeMediaFile(name string, data []byte) (string, error) {
+	if err := os.MkdirAll(s.mediaDir, 0o755); err != nil {
+		return "", fmt.Errorf("error creating media directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(s.mediaDir, name), data, 0o644); err != nil {
+		return "", fmt.Errorf("error saving image: %v", err)
+	}
+	return mediaURLPrefix + name, nil
+}
+
+// SaveProductImage decodes an uploaded image, stores it with a thumbnail and
+// points the product at them. File names include a hash of the content, so a
+// URL always refers to the same bytes and can be cached indefinitely.
+func (s *Store) SaveProductImage(id int, r io.Reader) (*Product, error) {
+	if _, err := s.GetProduct(id); err != nil {
+		return nil, err
+	}
+
+	data, err := io.ReadAll(io.LimitReader(r, maxImageUpload+1))
+	if err != nil {
+		return nil, fmt.Errorf("error reading image: %v", err)
+	}
+	if len(data) > maxImageUpload {
+		return nil, ErrImageTooLarge
+	}
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupportedImage
+	}
+	if config.Width*config.Height > maxImagePixels {
+		return nil, ErrImageDimensions
+	}
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupportedImage
+	}
+
+	// Re-encode rather than storing the upload as-is, so only real images are served
+	var full, thumb bytes.Buffer
+	if err := encodeImage(&full, img, format); err != nil {
+		return nil, fmt.Errorf("error encoding image: %v", err)
+	}
+	if err := encodeImage(&thumb, thumbnail(img, thumbnailSize), format); err != nil {
+		return nil, fmt.Errorf("error encoding thumbnail: %v", err)
+	}
+
+	sum := sha256.Sum256(data)
+	base := fmt.Sprintf("product-%d-%s", id, hex.EncodeToString(sum[:6]))
+	ext := imageExtension(format)
+	imageURL, err := s.writeMediaFile(base+ext, full.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	thumbURL, err := s.writeMediaFile(base+"-thumb"+ext, thumb.Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	product, exists := s.catalog[id]
+	if !exists {
+		return nil, ErrProductNotFound
+	}
+	product.Image = imageURL
+	product.Thumbnail = thumbURL
+	updated := *product
+	return &updated, nil
+}
+
+// handleUploadProductImage serves POST /api/products/{id}/image with the
+// image in the "image" field of a multipart form
+func (s *Store) handleUploadProductImage(w http.ResponseWriter, r *http.Request) {
+	productID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		s.writeError(w, r, invalidRequest("invalid product ID"))
+		return
+	}
+
+	// Leave some room for the multipart headers around the file
+	r.Body = http.MaxBytesReader(w, r.Body, maxImageUpload+1<<20)
+	file, _, err := r.FormFile("image")
+	if err != nil {
+		s.writeError(w, r, badRequestBody(fmt.Errorf("expected an image file in the \"image\" form field: %w", err)))
+		return
+	}
+	defer file.Close()
+
+	product, err := s.SaveProductImage(productID, file)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	if err := s.SaveCatalog(); err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(product)
+}
+
+// mediaHandler serves stored product images. Names are content addressed, so
+// they are marked immutable and cached for a year.
+func (s *Store) mediaHandler() http.Handler {
+	files := http.StripPrefix(mediaURLPrefix, http.FileServer(http.Dir(s.mediaDir)))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Don't expose directory listings
+		if strings.HasSuffix(r.URL.Path, "/") {
+			http.NotFound(w, r)
+			return
+		}
+		files.ServeHTTP(&immutableWriter{ResponseWriter: w}, r)
+	})
+}
+
+// immutableWriter marks a successful response as cacheable for a year. Errors
+// such as a 404 are left uncached, since the file may exist later.
+type immutableWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
+
+func (w *immutableWriter) WriteHeader(status int) {
+	if !w.wroteHeader && status < http.StatusBadRequest {
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	}
+	w.wroteHeader = true
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *immutableWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(p)
+}
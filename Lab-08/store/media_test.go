@@ -0,0 +1,150 @@
+package store
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestThumbnail(t *testing.T) {
+	tests := []struct {
+		name           string
+		width, height  int
+		expectedWidth  int
+		expectedHeight int
+	}{
+		{"landscape", 960, 480, 240, 120},
+		{"portrait", 300, 1200, 60, 240},
+		{"already small", 100, 50, 100, 50},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := image.NewRGBA(image.Rect(0, 0, tt.width, tt.height))
+			bounds := thumbnail(src, thumbnailSize).Bounds()
+			if bounds.Dx() != tt.expectedWidth || bounds.Dy() != tt.expectedHeight {
+				t.Errorf("Expected %dx%d, got %dx%d", tt.expectedWidth, tt.expectedHeight, bounds.Dx(), bounds.Dy())
+			}
+		})
+	}
+}
+
+func TestThumbnailAveragesPixels(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 480, 480))
+	for y := 0; y < 480; y++ {
+		for x := 0; x < 480; x++ {
+			if x%2 == 0 {
+				src.Set(x, y, color.White)
+			} else {
+				src.Set(x, y, color.Black)
+			}
+		}
+	}
+
+	r, _, _, _ := thumbnail(src, thumbnailSize).At(10, 10).RGBA()
+	if r < 0x7000 || r > 0x8fff {
+		t.Errorf("Expected a mid grey from alternating black and white, got red %#x", r)
+	}
+}
+
+// pngUpload builds a multipart request uploading a width x height PNG
+func pngUpload(t *testing.T, path string, width, height int) *http.Request {
+	var img bytes.Buffer
+	png.Encode(&img, image.NewRGBA(image.Rect(0, 0, width, height)))
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("image", "photo.png")
+	if err != nil {
+		t.Fatalf("Failed to build form: %v", err)
+	}
+	part.Write(img.Bytes())
+	form.Close()
+
+	req := httptest.NewRequest(http.MethodPost, path, &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	return req
+}
+
+func TestHandleUploadProductImage(t *testing.T) {
+	dir := t.TempDir()
+	store := newTestStore()
+	store.mediaDir = filepath.Join(dir, "media")
+	store.catalogFile = filepath.Join(dir, "products.json")
+	data, _ := os.ReadFile(testCatalog)
+	os.WriteFile(store.catalogFile, data, 0o644)
+	store.InitializeCatalog()
+
+	key := staffKey(t, store, RoleInventoryManager)
+	req := pngUpload(t, "/api/products/1/image", 800, 600)
+	req.Header.Set(APIKeyHeader, key)
+	rec := httptest.NewRecorder()
+	store.Routes("../static").ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	product, _ := store.GetProduct(1)
+	if product.Image == "" || product.Thumbnail == "" {
+		t.Fatalf("Expected image and thumbnail URLs, got %+v", product)
+	}
+
+	thumbFile, err := os.Open(filepath.Join(store.mediaDir, filepath.Base(product.Thumbnail)))
+	if err != nil {
+		t.Fatalf("Thumbnail was not stored: %v", err)
+	}
+	defer thumbFile.Close()
+	config, _, err := image.DecodeConfig(thumbFile)
+	if err != nil || config.Width != 240 || config.Height != 180 {
+		t.Errorf("Expected a 240x180 thumbnail, got %+v, %v", config, err)
+	}
+
+	// The served image is cached
+	rec = httptest.NewRecorder()
+	store.mediaHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, product.Image, nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("Cache-Control") == "" {
+		t.Errorf("Expected cached image response, got %d with headers %v", rec.Code, rec.Header())
+	}
+	// A missing image may be uploaded later, so its 404 is not cached
+	rec = httptest.NewRecorder()
+	store.mediaHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/media/product-1-missing.png", nil))
+	if rec.Code != http.StatusNotFound || rec.Header().Get("Cache-Control") != "" {
+		t.Errorf("Expected an uncached 404, got %d with headers %v", rec.Code, rec.Header())
+	}
+
+	req = pngUpload(t, "/api/products/99/image", 10, 10)
+	req.Header.Set(APIKeyHeader, key)
+	rec = httptest.NewRecorder()
+	store.Routes("../static").ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for unknown product, got %d", rec.Code)
+	}
+}
+
+func TestImageDimensionsCheckedBeforeDecoding(t *testing.T) {
+	store := newTestStore()
+	store.mediaDir = t.TempDir()
+	store.InitializeCatalog()
+
+	// A tiny PNG whose header declares a 100000x100000 image
+	var img bytes.Buffer
+	png.Encode(&img, image.NewGray(image.Rect(0, 0, 1, 1)))
+	data := img.Bytes()
+	binary.BigEndian.PutUint32(data[16:], 100000)
+	binary.BigEndian.PutUint32(data[20:], 100000)
+	binary.BigEndian.PutUint32(data[29:], crc32.ChecksumIEEE(data[12:29]))
+
+	if _, err := store.SaveProductImage(1, bytes.NewReader(data)); !errors.Is(err, ErrImageDimensions) {
+		t.Errorf("Expected the image to be refused for its size, got %v", err)
+	}
+}
@@ -0,0 +1,301 @@
+package store
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Checkout failure reasons reported by store_checkout_failures_total
+const (
+	failureInvalidRequest    = "invalid_request"
+	failureProductNotFound   = "product_not_found"
+	failureInvalidQuantity   = "invalid_quantity"
+	failureInsufficientStock = "insufficient_stock"
+	failureStorage           = "storage_error"
+	failurePaymentDeclined   = "payment_declined"
+	failurePaymentError      = "payment_error" // the provider failed or timed out
+)
+
+// latencyBuckets are the upper bounds in seconds of the request latency
+// histogram, the same defaults the Prometheus client libraries use
+var latencyBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// histogram counts observations into cumulative buckets
+type histogram struct {
+	counts []uint64 // one per bucket; the +Inf bucket is count
+	count  uint64
+	sum    float64
+}
+
+func (h *histogram) observe(v float64) {
+	if h.counts == nil {
+		h.counts = make([]uint64, len(latencyBuckets))
+	}
+	for i, bound := range latencyBuckets {
+		if v <= bound {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += v
+}
+
+// requestKey identifies a request counter by route, method and status code
+type requestKey struct {
+	route  string
+	method string
+	code   int
+}
+
+// routeKey identifies a latency histogram by route and method
+type routeKey struct {
+	route  string
+	method string
+}
+
+// metrics collects the counters exposed on /metrics. Gauges such as queue
+// depth and stock are read from the store when the metrics are scraped.
+type metrics struct {
+	mu               sync.Mutex
+	requests         map[requestKey]uint64
+	latency          map[routeKey]*histogram
+	checkoutFailures map[string]uint64
+	rateLimited      map[string]uint64
+
+	ordersCreated   atomic.Uint64
+	ordersProcessed atomic.Uint64
+	ordersFailed    atomic.Uint64
+	busyWorkers     atomic.Int32
+}
+
+func newMetrics() *metrics {
+	return &metrics{
+		requests:         make(map[requestKey]uint64),
+		latency:          make(map[routeKey]*histogram),
+		checkoutFailures: make(map[string]uint64),
+		rateLimited:      make(map[string]uint64),
+	}
+}
+
+// observeRequest records a finished HTTP request
+func (m *metrics) observeRequest(route, method string, code int, elapsed time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.requests[requestKey{route, method, code}]++
+	key := routeKey{route, method}
+	h, ok := m.latency[key]
+	if !ok {
+		h = &histogram{}
+		m.latency[key] = h
+	}
+	h.observe(elapsed.Seconds())
+}
+
+// checkoutFailed records an order that could not be placed
+func (m *metrics) checkoutFailed(reason string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.checkoutFailures[reason]++
+}
+
+// requestLimited records a request rejected by the rate limiter
+func (m *metrics) requestLimited(route string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.rateLimited[route]++
+}
+
+// routeLabel returns the route pattern the mux matches for the request,
+// without its method, so paths such as /api/products/7 are counted under
+// /api/products/{id}. Requests that match no route are counted together.
+func routeLabel(mux *http.ServeMux, r *http.Request) string {
+	_, pattern := mux.Handler(r)
+	if pattern == "" {
+		return "unmatched"
+	}
+	if _, path, found := strings.Cut(pattern, " "); found {
+		return path
+	}
+	return pattern
+}
+
+// methodLabel returns the request method, or "other" for anything but the
+// standard methods, so clients cannot add label values of their own
+func methodLabel(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return method
+	}
+	return "other"
+}
+
+// withMetrics counts requests and measures their latency per route
+func (s *Store) withMetrics(mux *http.ServeMux) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(rec, r)
+			s.metrics.observeRequest(routeLabel(mux, r), methodLabel(r.Method), rec.status, time.Since(start))
+		})
+	}
+}
+
+// handleMetrics serves the metrics in the Prometheus text exposition format
+func (s *Store) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	s.WriteMetrics(w)
+}
+
+// WriteMetrics writes every metric in the Prometheus text exposition format
+func (s *Store) WriteMetrics(w io.Writer) {
+	m := s.metrics
+	m.mu.Lock()
+	requests := make(map[requestKey]uint64, len(m.requests))
+	for k, v := range m.requests {
+		requests[k] = v
+	}
+	latency := make(map[routeKey]histogram, len(m.latency))
+	for k, h := range m.latency {
+		latency[k] = histogram{counts: append([]uint64(nil), h.counts...), count: h.count, sum: h.sum}
+	}
+	failures := make(map[string]uint64, len(m.checkoutFailures))
+	for k, v := range m.checkoutFailures {
+		failures[k] = v
+	}
+	limited := make(map[string]uint64, len(m.rateLimited))
+	for k, v := range m.rateLimited {
+		limited[k] = v
+	}
+	m.mu.Unlock()
+
+	writeHeader(w, "store_http_requests_total", "counter", "HTTP requests by route, method and status code.")
+	requestKeys := make([]requestKey, 0, len(requests))
+	for k := range requests {
+		requestKeys = append(requestKeys, k)
+	}
+	sort.Slice(requestKeys, func(i, j int) bool {
+		a, b := requestKeys[i], requestKeys[j]
+		if a.route != b.route {
+			return a.route < b.route
+		}
+		if a.method != b.method {
+			return a.method < b.method
+		}
+		return a.code < b.code
+	})
+	for _, k := range requestKeys {
+		writeSample(w, "store_http_requests_total", requests[k],
+			"route", k.route, "method", k.method, "code", strconv.Itoa(k.code))
+	}
+
+	writeHeader(w, "store_http_request_duration_seconds", "histogram", "HTTP request latency by route and method.")
+	routeKeys := make([]routeKey, 0, len(latency))
+	for k := range latency {
+		routeKeys = append(routeKeys, k)
+	}
+	sort.Slice(routeKeys, func(i, j int) bool {
+		if routeKeys[i].route != routeKeys[j].route {
+			return routeKeys[i].route < routeKeys[j].route
+		}
+		return routeKeys[i].method < routeKeys[j].method
+	})
+	for _, k := range routeKeys {
+		h := latency[k]
+		for i, bound := range latencyBuckets {
+			writeSample(w, "store_http_request_duration_seconds_bucket", h.counts[i],
+				"route", k.route, "method", k.method, "le", strconv.FormatFloat(bound, 'g', -1, 64))
+		}
+		writeSample(w, "store_http_request_duration_seconds_bucket", h.count, "route", k.route, "method", k.method, "le", "+Inf")
+		writeSample(w, "store_http_request_duration_seconds_sum", h.sum, "route", k.route, "method", k.method)
+		writeSample(w, "store_http_request_duration_seconds_count", h.count, "route", k.route, "method", k.method)
+	}
+
+	writeHeader(w, "store_orders_created_total", "counter", "Orders placed.")
+	writeSample(w, "store_orders_created_total", m.ordersCreated.Load())
+	writeHeader(w, "store_orders_processed_total", "counter", "Orders processed by the worker pool.")
+	writeSample(w, "store_orders_processed_total", m.ordersProcessed.Load())
+	writeHeader(w, "store_orders_failed_total", "counter", "Orders the worker pool failed to process.")
+	writeSample(w, "store_orders_failed_total", m.ordersFailed.Load())
+
+	writeHeader(w, "store_checkout_failures_total", "counter", "Orders that could not be placed, by reason.")
+	reasons := make([]string, 0, len(failures))
+	for reason := range failures {
+		reasons = append(reasons, reason)
+	}
+	sort.Strings(reasons)
+	for _, reason := range reasons {
+		writeSample(w, "store_checkout_failures_total", failures[reason], "reason", reason)
+	}
+
+	writeHeader(w, "store_rate_limited_total", "counter", "Requests rejected by the rate limiter, by route.")
+	routes := make([]string, 0, len(limited))
+	for route := range limited {
+		routes = append(routes, route)
+	}
+	sort.Strings(routes)
+	for _, route := range routes {
+		writeSample(w, "store_rate_limited_total", limited[route], "route", route)
+	}
+
+	active := atomic.LoadInt32(&s.activeWorkers)
+	busy := m.busyWorkers.Load()
+	writeHeader(w, "store_order_queue_depth", "gauge", "Orders waiting for a worker.")
+	writeSample(w, "store_order_queue_depth", len(s.orderChan))
+	writeHeader(w, "store_order_queue_capacity", "gauge", "Orders that can wait for a worker.")
+	writeSample(w, "store_order_queue_capacity", cap(s.orderChan))
+	writeHeader(w, "store_workers_busy", "gauge", "Workers processing an order.")
+	writeSample(w, "store_workers_busy", busy)
+	writeHeader(w, "store_workers_idle", "gauge", "Running workers waiting for an order.")
+	writeSample(w, "store_workers_idle", max(active-busy, 0))
+	writeHeader(w, "store_workers_max", "gauge", "Maximum number of workers.")
+	writeSample(w, "store_workers_max", s.workerCount)
+
+	writeHeader(w, "store_product_stock", "gauge", "Units in stock per product.")
+	for _, product := range s.Products() {
+		writeSample(w, "store_product_stock", product.Stock,
+			"product_id", strconv.Itoa(product.ID), "product", product.Name, "category", product.Category)
+	}
+
+	writeHeader(w, "go_goroutines", "gauge", "Number of goroutines that currently exist.")
+	writeSample(w, "go_goroutines", runtime.NumGoroutine())
+}
+
+// writeHeader writes the HELP and TYPE lines for a metric
+func writeHeader(w io.Writer, name, kind, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// writeSample writes one sample line; labels are given as name, value pairs
+func writeSample(w io.Writer, name string, value any, labels ...string) {
+	var b strings.Builder
+	b.WriteString(name)
+	if len(labels) > 0 {
+		b.WriteByte('{')
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			fmt.Fprintf(&b, "%s=\"%s\"", labels[i], labelEscaper.Replace(labels[i+1]))
+		}
+		b.WriteByte('}')
+	}
+	if f, ok := value.(float64); ok {
+		fmt.Fprintf(w, "%s %s\n", b.String(), strconv.FormatFloat(f, 'g', -1, 64))
+		return
+	}
+	fmt.Fprintf(w, "%s %v\n", b.String(), value)
+}
+
+// labelEscaper escapes label values as the exposition format requires
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
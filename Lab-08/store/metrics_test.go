@@ -0,0 +1,128 @@
+package store
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRouteLabel(t *testing.T) {
+	store := newTestStore()
+	defer store.Close()
+	mux, _, _ := store.newMux("../static")
+
+	tests := []struct {
+		method   string
+		path     string
+		expected string
+	}{
+		{http.MethodGet, "/api/products", "/api/products"},
+		{http.MethodGet, "/api/products/12", "/api/products/{id}"},
+		{http.MethodPut, "/api/products/12/stock", "/api/products/{id}/stock"},
+		{http.MethodGet, "/api/orders/7/invoice", "/api/orders/{id}/invoice"},
+		{http.MethodGet, "/static/script.js", "/static/"},
+		{http.MethodGet, "/media/1-abc.jpg", "/media/"},
+		{http.MethodGet, "/", "/{$}"},
+		{http.MethodGet, "/anything/else", "unmatched"},
+		{http.MethodDelete, "/api/products", "unmatched"},
+	}
+	for _, tt := range tests {
+		if got := routeLabel(mux, httptest.NewRequest(tt.method, tt.path, nil)); got != tt.expected {
+			t.Errorf("routeLabel(%s %s) = %q, expected %q", tt.method, tt.path, got, tt.expected)
+		}
+	}
+}
+
+func TestMethodLabel(t *testing.T) {
+	for method, expected := range map[string]string{
+		http.MethodGet:     "GET",
+		http.MethodOptions: "OPTIONS",
+		"get":              "other",
+		"BREW":             "other",
+		"X-12345":          "other",
+	} {
+		if got := methodLabel(method); got != expected {
+			t.Errorf("methodLabel(%q) = %q, expected %q", method, got, expected)
+		}
+	}
+}
+
+func TestHistogramBuckets(t *testing.T) {
+	var h histogram
+	h.observe(0.003)
+	h.observe(0.2)
+	h.observe(20)
+	if h.counts[0] != 1 || h.counts[5] != 2 || h.counts[len(latencyBuckets)-1] != 2 || h.count != 3 {
+		t.Errorf("Unexpected bucket counts %v (count %d)", h.counts, h.count)
+	}
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	store := newTestStore()
+	store.InitializeCatalog()
+	handler := store.Routes("../static")
+
+	requests := []struct {
+		method string
+		path   string
+		body   string
+	}{
+		{http.MethodGet, "/api/products/1", ""},
+		{http.MethodPost, "/api/orders", `{"productId": 1, "quantity": 2}`},
+		{http.MethodPost, "/api/orders", `{"productId": 2, "quantity": 1000}`},
+		{http.MethodPost, "/api/orders", `{"productId": 99, "quantity": 1}`},
+		{http.MethodPost, "/api/checkout", `not json`},
+	}
+	for _, r := range requests {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(r.method, r.path, strings.NewReader(r.body)))
+	}
+
+	// Wait for the worker pool to process the order
+	deadline := time.Now().Add(2 * time.Second)
+	for (store.metrics.ordersProcessed.Load() == 0 || store.metrics.busyWorkers.Load() > 0) && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	store.Close()
+
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Expected Prometheus content type, got %q", ct)
+	}
+	body := rec.Body.String()
+	expected := []string{
+		"# TYPE store_http_requests_total counter",
+		`store_http_requests_total{route="/api/products/{id}",method="GET",code="200"} 1`,
+		`store_http_requests_total{route="/api/orders",method="POST",code="201"} 1`,
+		`store_http_requests_total{route="/api/orders",method="POST",code="404"} 1`,
+		`store_http_requests_total{route="/api/orders",method="POST",code="409"} 1`,
+		"# TYPE store_http_request_duration_seconds histogram",
+		`store_http_request_duration_seconds_bucket{route="/api/orders",method="POST",le="+Inf"} 3`,
+		`store_http_request_duration_seconds_count{route="/api/orders",method="POST"} 3`,
+		"store_orders_created_total 1",
+		"store_orders_processed_total 1",
+		"store_orders_failed_total 0",
+		`store_checkout_failures_total{reason="insufficient_stock"} 1`,
+		`store_checkout_failures_total{reason="invalid_request"} 1`,
+		`store_checkout_failures_total{reason="product_not_found"} 1`,
+		"store_order_queue_depth 0",
+		"store_workers_busy 0",
+		`store_product_stock{product_id="1",product="Apple",category="Grocery"} 98`,
+	}
+	for _, line := range expected {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("Expected metrics to contain %q", line)
+		}
+	}
+}
+
+func TestWriteSampleEscapesLabels(t *testing.T) {
+	var b strings.Builder
+	writeSample(&b, "m", 1, "name", "say \"hi\"\\\n")
+	if expected := `m{name="say \"hi\"\\\n"} 1` + "\n"; b.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, b.String())
+	}
+}
@@ -0,0 +1,165 @@
+package store
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+
+	"example.com/lab-08/config"
+)
+
+// MockSignatureHeader carries the mock provider's webhook signature: the
+// hex HMAC-SHA256 of the body keyed with the webhook secret
+const MockSignatureHeader = "X-Mock-Signature"
+
+// MockProvider is a local payment provider for development and tests. Its
+// mode decides whether authorizations succeed, are declined or time out;
+// a timed out authorization still goes through, as if the answer was lost
+// on the way back, so retrying it with the same idempotency key succeeds.
+type MockProvider struct {
+	mu       sync.Mutex
+	mode     string
+	secret   []byte
+	payments map[string]*mockPayment // keyed by reference
+	keys     map[string]string       // references keyed by idempotency key
+	seq      int
+}
+
+// mockPayment is a payment the mock provider has authorized
+type mockPayment struct {
+	amount   float64
+	captured bool
+	refunded bool
+}
+
+// NewMockProvider returns a mock provider in the given mode, one of
+// config.MockModes, that signs webhooks with secret
+func NewMockProvider(mode, secret string) *MockProvider {
+	return &MockProvider{
+		mode:     mode,
+		secret:   []byte(secret),
+		payments: make(map[string]*mockPayment),
+		keys:     make(map[string]string),
+	}
+}
+
+// Name implements PaymentProvider
+func (m *MockProvider) Name() string {
+	return "mock"
+}
+
+// Mode returns what the provider does with authorizations
+func (m *MockProvider) Mode() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.mode
+}
+
+// SetMode changes what the provider does with authorizations
+func (m *MockProvider) SetMode(mode string) error {
+	if !slices.Contains(config.MockModes, mode) {
+		return fmt.Errorf("mode must be succeed, decline or timeout, got %q", mode)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.mode = mode
+	return nil
+}
+
+// Authorize implements PaymentProvider
+func (m *MockProvider) Authorize(ctx context.Context, request PaymentRequest) (string, error) {
+	m.mu.Lock()
+	if reference, ok := m.keys[request.IdempotencyKey]; ok {
+		m.mu.Unlock()
+		return reference, nil
+	}
+	mode := m.mode
+	if mode == "decline" {
+		m.mu.Unlock()
+		return "", ErrPaymentDeclined
+	}
+	m.seq++
+	reference := fmt.Sprintf("mock_pay_%d", m.seq)
+	m.payments[reference] = &mockPayment{amount: request.Amount}
+	m.keys[request.IdempotencyKey] = reference
+	m.mu.Unlock()
+
+	if mode == "timeout" {
+		<-ctx.Done()
+		return "", ErrPaymentTimeout
+	}
+	return reference, nil
+}
+
+// Capture implements PaymentProvider
+func (m *MockProvider) Capture(ctx context.Context, reference string, amount float64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	payment, ok := m.payments[reference]
+	switch {
+	case !ok:
+		return fmt.Errorf("%w: unknown payment %s", ErrPaymentFailed, reference)
+	case payment.refunded:
+		return fmt.Errorf("%w: payment %s was refunded", ErrPaymentFailed, reference)
+	case amount > payment.amount:
+		return fmt.Errorf("%w: cannot capture more than was authorized", ErrPaymentFailed)
+	}
+	payment.captured = true
+	return nil
+}
+
+// Refund implements PaymentProvider
+func (m *MockProvider) Refund(ctx context.Context, reference string, amount float64) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	payment, ok := m.payments[reference]
+	switch {
+	case !ok:
+		return "", fmt.Errorf("%w: unknown payment %s", ErrPaymentFailed, reference)
+	case payment.refunded:
+		return "", fmt.Errorf("%w: payment %s was already refunded", ErrPaymentFailed, reference)
+	case amount > payment.amount:
+		return "", fmt.Errorf("%w: cannot refund more than was paid", ErrPaymentFailed)
+	}
+	payment.refunded = true
+	m.seq++
+	return fmt.Sprintf("mock_refund_%d", m.seq), nil
+}
+
+// Sign returns the signature the provider sends with a webhook body
+func (m *MockProvider) Sign(body []byte) string {
+	return hex.EncodeToString(m.mac(body))
+}
+
+// mac returns the HMAC-SHA256 of body keyed with the webhook secret
+func (m *MockProvider) mac(body []byte) []byte {
+	mac := hmac.New(sha256.New, m.secret)
+	mac.Write(body)
+	return mac.Sum(nil)
+}
+
+// VerifyWebhook implements PaymentProvider
+func (m *MockProvider) VerifyWebhook(header http.Header, body []byte) (*PaymentEvent, error) {
+	signature, err := hex.DecodeString(header.Get(MockSignatureHeader))
+	if err != nil || !hmac.Equal(signature, m.mac(body)) {
+		return nil, ErrInvalidSignature
+	}
+	var event PaymentEvent
+	if err := json.Unmarshal(body, &event); err != nil {
+		return nil, invalidRequest("invalid webhook body: %v", err)
+	}
+	if event.ID == "" || event.Type == "" {
+		return nil, invalidRequest("webhook event needs an id and a type")
+	}
+	return &event, nil
+}
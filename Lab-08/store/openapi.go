@@ -0,0 +1,474 @@
+package store
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"mime"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// openAPIDocument describes every store endpoint in OpenAPI 3. It is served
+// at /openapi.json and drives the request and response validation in
+// withValidation, so a change to an endpoint starts with a change here.
+//
+//go:embed openapi.json
+var openAPIDocument []byte
+
+// openAPI is the parsed document. It is embedded, so failing to parse it is
+// a bug caught by the first test run.
+var openAPI = mustParseSpec(openAPIDocument)
+
+// checkoutOperations are the operations that place orders, whose rejected
+// requests are counted in store_checkout_failures_total
+var checkoutOperations = map[string]bool{"createOrder": true, "checkout": true}
+
+// apiSpec is the part of an OpenAPI document the validator reads
+type apiSpec struct {
+	Paths      map[string]map[string]*apiOperation `json:"paths"`
+	Components struct {
+		Schemas    map[string]*apiSchema    `json:"schemas"`
+		Parameters map[string]*apiParameter `json:"parameters"`
+		Responses  map[string]*apiResponse  `json:"responses"`
+	} `json:"components"`
+}
+
+// apiOperation is one method on one path
+type apiOperation struct {
+	OperationID  string                  `json:"operationId"`
+	RequiredRole Role                    `json:"x-required-role"` // must match the route table
+	Parameters   []*apiParameter         `json:"parameters"`
+	RequestBody  *apiRequestBody         `json:"requestBody"`
+	Responses    map[string]*apiResponse `json:"responses"`
+}
+
+// apiParameter is a path or query parameter
+type apiParameter struct {
+	Ref      string     `json:"$ref"`
+	Name     string     `json:"name"`
+	In       string     `json:"in"`
+	Required bool       `json:"required"`
+	Schema   *apiSchema `json:"schema"`
+}
+
+type apiRequestBody struct {
+	Required bool                    `json:"required"`
+	Content  map[string]apiMediaType `json:"content"`
+}
+
+type apiResponse struct {
+	Ref     string                  `json:"$ref"`
+	Content map[string]apiMediaType `json:"content"`
+}
+
+type apiMediaType struct {
+	Schema *apiSchema `json:"schema"`
+}
+
+// apiSchema is the subset of JSON Schema the document uses. Properties not
+// listed in an object are allowed unless additionalProperties gives them a
+// schema.
+type apiSchema struct {
+	Ref                  string                `json:"$ref"`
+	Type                 string                `json:"type"`
+	Format               string                `json:"format"`
+	Enum                 []any                 `json:"enum"`
+	Minimum              *float64              `json:"minimum"`
+	Nullable             bool                  `json:"nullable"`
+	Required             []string              `json:"required"`
+	Properties           map[string]*apiSchema `json:"properties"`
+	AdditionalProperties *apiSchema            `json:"additionalProperties"`
+	Items                *apiSchema            `json:"items"`
+}
+
+// typeNames describe schema types in validation messages
+var typeNames = map[string]string{
+	"object":  "an object",
+	"array":   "an array",
+	"string":  "a string",
+	"integer": "an integer",
+	"number":  "a number",
+	"boolean": "true or false",
+}
+
+func mustParseSpec(data []byte) *apiSpec {
+	var spec apiSpec
+	if err := json.Unmarshal(data, &spec); err != nil {
+		panic("store: invalid openapi.json: " + err.Error())
+	}
+	return &spec
+}
+
+// operation returns the operation documented for a method on a route
+// pattern, or nil if the route is not part of the API
+func (spec *apiSpec) operation(method, path string) *apiOperation {
+	if method == http.MethodHead {
+		method = http.MethodGet
+	}
+	return spec.Paths[path][strings.ToLower(method)]
+}
+
+// schema follows a $ref to the schema it names, returning nil if there is none
+func (spec *apiSpec) schema(s *apiSchema) *apiSchema {
+	if s == nil || s.Ref == "" {
+		return s
+	}
+	return spec.Components.Schemas[strings.TrimPrefix(s.Ref, "#/components/schemas/")]
+}
+
+// parameter follows a $ref to the parameter it names
+func (spec *apiSpec) parameter(p *apiParameter) *apiParameter {
+	if p == nil || p.Ref == "" {
+		return p
+	}
+	return spec.Components.Parameters[strings.TrimPrefix(p.Ref, "#/components/parameters/")]
+}
+
+// response follows a $ref to the response it names
+func (spec *apiSpec) response(r *apiResponse) *apiResponse {
+	if r == nil || r.Ref == "" {
+		return r
+	}
+	return spec.Components.Responses[strings.TrimPrefix(r.Ref, "#/components/responses/")]
+}
+
+// validationProblem is one way a request or response differs from the document
+type validationProblem struct {
+	In      string `json:"in"` // path, query, body or response
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+func (p validationProblem) String() string {
+	if p.Field == "" {
+		return p.In + " " + p.Message
+	}
+	return p.Field + " " + p.Message
+}
+
+// validationError reports every problem with a request as one invalid_request error
+func validationError(problems []validationProblem) *APIError {
+	messages := make([]string, len(problems))
+	for i, problem := range problems {
+		messages[i] = problem.String()
+	}
+	apiErr := invalidRequest("invalid request: %s", strings.Join(messages, "; "))
+	apiErr.Details = map[string]any{"problems": problems}
+	return apiErr
+}
+
+// validate checks a decoded JSON value against a schema, adding a problem
+// for each mismatch. field names the value, e.g. "[0].product.id".
+func (spec *apiSpec) validate(s *apiSchema, value any, in, field string, problems *[]validationProblem) {
+	s = spec.schema(s)
+	if s == nil {
+		return
+	}
+	fail := func(format string, args ...any) {
+		*problems = append(*problems, validationProblem{in, field, fmt.Sprintf(format, args...)})
+	}
+	if value == nil {
+		if s.Type != "" && !s.Nullable {
+			fail("must be %s, not null", typeNames[s.Type])
+		}
+		return
+	}
+
+	switch s.Type {
+	case "object":
+		object, ok := value.(map[string]any)
+		if !ok {
+			fail("must be %s", typeNames[s.Type])
+			return
+		}
+		for _, name := range s.Required {
+			if _, ok := object[name]; !ok {
+				*problems = append(*problems, validationProblem{in, joinField(field, name), "is required"})
+			}
+		}
+		names := make([]string, 0, len(object))
+		for name := range object {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			property, ok := s.Properties[name]
+			if !ok {
+				property = s.AdditionalProperties
+			}
+			spec.validate(property, object[name], in, joinField(field, name), problems)
+		}
+	case "array":
+		items, ok := value.([]any)
+		if !ok {
+			fail("must be %s", typeNames[s.Type])
+			return
+		}
+		for i, item := range items {
+			spec.validate(s.Items, item, in, fmt.Sprintf("%s[%d]", field, i), problems)
+		}
+	case "string":
+		str, ok := value.(string)
+		if !ok {
+			fail("must be %s", typeNames[s.Type])
+			return
+		}
+		switch s.Format {
+		case "date":
+			if _, err := time.Parse(DateLayout, str); err != nil {
+				fail("must be a date (YYYY-MM-DD)")
+				return
+			}
+		case "date-time":
+			if _, err := time.Parse(time.RFC3339, str); err != nil {
+				fail("must be a date and time (RFC 3339)")
+				return
+			}
+		}
+	case "integer", "number":
+		n, ok := value.(float64)
+		if !ok || (s.Type == "integer" && n != math.Trunc(n)) {
+			fail("must be %s", typeNames[s.Type])
+			return
+		}
+		if s.Minimum != nil && n < *s.Minimum {
+			fail("must be at least %v", *s.Minimum)
+			return
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			fail("must be %s", typeNames[s.Type])
+			return
+		}
+	}
+
+	if len(s.Enum) > 0 && !slices.Contains(s.Enum, value) {
+		allowed := make([]string, len(s.Enum))
+		for i, v := range s.Enum {
+			allowed[i] = fmt.Sprint(v)
+		}
+		fail("must be one of %s", strings.Join(allowed, ", "))
+	}
+}
+
+// joinField names a property of field
+func joinField(field, name string) string {
+	if field == "" {
+		return name
+	}
+	return field + "." + name
+}
+
+// pathValues matches a request path against a route pattern such as
+// /api/products/{id} and returns the wildcard values
+func pathValues(pattern, path string) map[string]string {
+	values := make(map[string]string)
+	patternSegments := strings.Split(pattern, "/")
+	pathSegments := strings.Split(path, "/")
+	for i, segment := range patternSegments {
+		if i < len(pathSegments) && strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			values[strings.Trim(segment, "{}")] = pathSegments[i]
+		}
+	}
+	return values
+}
+
+// parameterValue converts a path or query string to the JSON type its
+// schema expects, reporting false if it cannot be converted
+func parameterValue(s *apiSchema, raw string) (any, bool) {
+	switch s.Type {
+	case "integer", "number":
+		n, err := strconv.ParseFloat(raw, 64)
+		return n, err == nil
+	case "boolean":
+		b, err := strconv.ParseBool(raw)
+		return b, err == nil
+	}
+	return raw, true
+}
+
+// isJSON reports whether a media type carries JSON
+func isJSON(mediaType string) bool {
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// mediaType picks the documented media type for a request's Content-Type.
+// The handlers do not insist on the header, so a body without a recognised
+// Content-Type is checked against the only media type the operation
+// accepts; when it accepts several, the handler decides.
+func (b *apiRequestBody) mediaType(contentType string) (string, apiMediaType, bool) {
+	name, _, _ := mime.ParseMediaType(contentType)
+	if media, ok := b.Content[name]; ok {
+		return name, media, true
+	}
+	if len(b.Content) == 1 {
+		for name, media := range b.Content {
+			return name, media, true
+		}
+	}
+	return "", apiMediaType{}, false
+}
+
+// checkRequest validates the parameters and JSON body of a request against
+// its operation. The body is read and replaced, so the handler can still
+// read it. An error is returned if the body cannot be read or parsed.
+func (spec *apiSpec) checkRequest(op *apiOperation, path string, r *http.Request) ([]validationProblem, error) {
+	var problems []validationProblem
+	wildcards := pathValues(path, r.URL.Path)
+	query := r.URL.Query()
+	for _, param := range op.Parameters {
+		param = spec.parameter(param)
+		var raw string
+		switch param.In {
+		case "path":
+			raw = wildcards[param.Name]
+		case "query":
+			raw = query.Get(param.Name)
+		default:
+			continue
+		}
+		if raw == "" {
+			if param.Required {
+				problems = append(problems, validationProblem{param.In, param.Name, "is required"})
+			}
+			continue
+		}
+		schema := spec.schema(param.Schema)
+		value, ok := parameterValue(schema, raw)
+		if !ok {
+			problems = append(problems, validationProblem{param.In, param.Name, "must be " + typeNames[schema.Type]})
+			continue
+		}
+		spec.validate(schema, value, param.In, param.Name, &problems)
+	}
+
+	if op.RequestBody == nil {
+		return problems, nil
+	}
+	name, media, ok := op.RequestBody.mediaType(r.Header.Get("Content-Type"))
+	if !ok || !isJSON(name) {
+		return problems, nil
+	}
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, badRequestBody(err)
+	}
+	r.Body = io.NopCloser(bytes.NewReader(data))
+	if len(bytes.TrimSpace(data)) == 0 {
+		if op.RequestBody.Required {
+			problems = append(problems, validationProblem{In: "body", Message: "is required"})
+		}
+		return problems, nil
+	}
+	var body any
+	if err := json.Unmarshal(data, &body); err != nil {
+		return nil, invalidRequest("invalid request body: %v", err)
+	}
+	spec.validate(media.Schema, body, "body", "", &problems)
+	return problems, nil
+}
+
+// checkResponse validates a response's status, content type and JSON body
+// against its operation
+func (spec *apiSpec) checkResponse(op *apiOperation, status int, header http.Header, body []byte) []validationProblem {
+	fail := func(format string, args ...any) []validationProblem {
+		return []validationProblem{{In: "response", Message: fmt.Sprintf(format, args...)}}
+	}
+	response := spec.response(op.Responses[strconv.Itoa(status)])
+	if response == nil {
+		return fail("status %d is not documented", status)
+	}
+	if len(response.Content) == 0 {
+		return nil
+	}
+	name, _, _ := mime.ParseMediaType(header.Get("Content-Type"))
+	media, ok := response.Content[name]
+	if !ok {
+		return fail("content type %q is not documented for status %d", name, status)
+	}
+	if !isJSON(name) {
+		return nil
+	}
+	var value any
+	if err := json.Unmarshal(body, &value); err != nil {
+		return fail("is not valid JSON: %v", err)
+	}
+	var problems []validationProblem
+	spec.validate(media.Schema, value, "response", "", &problems)
+	return problems
+}
+
+// responseCapture passes a response through while keeping a copy of it
+type responseCapture struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (c *responseCapture) WriteHeader(status int) {
+	c.status = status
+	c.ResponseWriter.WriteHeader(status)
+}
+
+func (c *responseCapture) Write(p []byte) (int, error) {
+	c.body.Write(p)
+	return c.ResponseWriter.Write(p)
+}
+
+// withValidation rejects requests whose parameters or JSON body do not
+// match the OpenAPI document before they reach a handler. When response
+// validation is enabled, responses that do not match are logged. Routes the
+// document does not describe, such as the web interface, are passed through.
+func (s *Store) withValidation(mux *http.ServeMux) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			path := routeLabel(mux, r)
+			op := openAPI.operation(r.Method, path)
+			if op == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			problems, err := openAPI.checkRequest(op, path, r)
+			if err == nil && len(problems) > 0 {
+				err = validationError(problems)
+			}
+			if err != nil {
+				if checkoutOperations[op.OperationID] {
+					s.metrics.checkoutFailed(failureInvalidRequest)
+				}
+				s.writeError(w, r, err)
+				return
+			}
+
+			if !s.validateResponses || r.Method == http.MethodHead {
+				next.ServeHTTP(w, r)
+				return
+			}
+			capture := &responseCapture{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(capture, r)
+			if problems := openAPI.checkResponse(op, capture.status, w.Header(), capture.body.Bytes()); len(problems) > 0 {
+				messages := make([]string, len(problems))
+				for i, problem := range problems {
+					messages[i] = problem.String()
+				}
+				s.log(r.Context()).Warn("response does not match the API document",
+					"method", r.Method, "path", r.URL.Path, "status", capture.status, "problems", messages)
+			}
+		})
+	}
+}
+
+// handleOpenAPI serves the OpenAPI document
+func (s *Store) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(openAPIDocument)
+}
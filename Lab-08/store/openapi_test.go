@@ -0,0 +1,313 @@
+package store
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestOpenAPIDocumentsEveryRoute(t *testing.T) {
+	store := newTestStore()
+	defer store.Close()
+
+	documented := make(map[string]bool)
+	for _, rt := range store.routeTable("../static") {
+		// The web interface and uploaded files are not part of the API
+		if strings.HasSuffix(rt.pattern, "/") || rt.pattern == "/{$}" {
+			continue
+		}
+		op := openAPI.operation(rt.method, rt.pattern)
+		if op == nil {
+			t.Errorf("%s %s is not in openapi.json", rt.method, rt.pattern)
+		} else if op.RequiredRole != rt.access {
+			t.Errorf("%s %s needs role %q, openapi.json says %q", rt.method, rt.pattern, rt.access, op.RequiredRole)
+		}
+		documented[strings.ToLower(rt.method)+" "+rt.pattern] = true
+	}
+	for path, operations := range openAPI.Paths {
+		for method := range operations {
+			if !documented[method+" "+path] {
+				t.Errorf("openapi.json describes %s %s, which has no route", method, path)
+			}
+		}
+	}
+}
+
+func TestOpenAPIReferencesResolve(t *testing.T) {
+	refs := regexp.MustCompile(`"\$ref": "#/components/(\w+)/(\w+)"`).FindAllStringSubmatch(string(openAPIDocument), -1)
+	if len(refs) == 0 {
+		t.Fatal("Expected references in openapi.json")
+	}
+	for _, ref := range refs {
+		var found bool
+		switch ref[1] {
+		case "schemas":
+			found = openAPI.Components.Schemas[ref[2]] != nil
+		case "parameters":
+			found = openAPI.Components.Parameters[ref[2]] != nil
+		case "responses":
+			found = openAPI.Components.Responses[ref[2]] != nil
+		}
+		if !found {
+			t.Errorf("Reference %s does not resolve", ref[0])
+		}
+	}
+}
+
+func TestServeOpenAPI(t *testing.T) {
+	store := newTestStore()
+	defer store.Close()
+
+	rec := httptest.NewRecorder()
+	store.Routes("../static").ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("Expected a JSON document, got %d %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	var doc struct {
+		OpenAPI string         `json:"openapi"`
+		Paths   map[string]any `json:"paths"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&doc); err != nil || doc.OpenAPI != "3.0.3" || doc.Paths["/api/orders"] == nil {
+		t.Errorf("Unexpected document: %+v, %v", doc, err)
+	}
+}
+
+func TestRequestValidation(t *testing.T) {
+	store := newTestStore()
+	store.InitializeCatalog()
+	handler := store.Routes("../static")
+	defer store.Close()
+	key := staffKey(t, store, RoleInventoryManager)
+
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		body    string
+		status  int
+		problem string // the first problem reported, if any
+	}{
+		{"valid order", http.MethodPost, "/api/orders", `{"productId": 1, "quantity": 2}`, http.StatusCreated, ""},
+		{"negative quantity", http.MethodPost, "/api/orders", `{"productId": 1, "quantity": -1}`, http.StatusBadRequest, "quantity must be at least 0"},
+		{"missing productId", http.MethodPost, "/api/orders", `{"quantity": 1}`, http.StatusBadRequest, "productId is required"},
+		{"fractional quantity", http.MethodPost, "/api/orders", `{"productId": 1, "quantity": 1.5}`, http.StatusBadRequest, "quantity must be an integer"},
+		{"string productId", http.MethodPost, "/api/orders", `{"productId": "1", "quantity": 1}`, http.StatusBadRequest, "productId must be an integer"},
+		{"empty body", http.MethodPost, "/api/orders", "", http.StatusBadRequest, "body is required"},
+		{"cart item without product id", http.MethodPost, "/api/checkout", `[{"product": {"name": "Apple"}, "quantity": 1}]`, http.StatusBadRequest, "[0].product.id is required"},
+		{"cart is not a list", http.MethodPost, "/api/checkout", `{"product": {"id": 1}, "quantity": 1}`, http.StatusBadRequest, "body must be an array"},
+		{"negative stock", http.MethodPut, "/api/products/1/stock", `{"stock": -5}`, http.StatusBadRequest, "stock must be at least 0"},
+		{"product id not a number", http.MethodGet, "/api/products/apple", "", http.StatusBadRequest, "id must be an integer"},
+		{"product id zero", http.MethodGet, "/api/products/0", "", http.StatusBadRequest, "id must be at least 1"},
+		{"bad report date", http.MethodGet, "/api/reports/sales?from=yesterday", "", http.StatusBadRequest, "from must be a date (YYYY-MM-DD)"},
+		{"bad report top", http.MethodGet, "/api/reports/sales?top=0", "", http.StatusBadRequest, "top must be at least 1"},
+		{"bad export format", http.MethodGet, "/api/catalog/export?format=xml", "", http.StatusBadRequest, "format must be one of json, csv"},
+		{"import without products", http.MethodPost, "/api/catalog/import?format=json", `{}`, http.StatusBadRequest, "products is required"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set(APIKeyHeader, key)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("Expected status %d, got %d: %s", tt.status, rec.Code, rec.Body.String())
+			}
+			if tt.problem == "" {
+				return
+			}
+			apiErr := errorResponse(t, rec)
+			if apiErr.Code != CodeInvalidRequest || apiErr.Message != "invalid request: "+tt.problem {
+				t.Errorf("Expected problem %q, got %+v", tt.problem, apiErr)
+			}
+		})
+	}
+
+	// Rejected requests never reach the store
+	product, _ := store.GetProduct(1)
+	if product.Stock != 98 {
+		t.Errorf("Expected only the valid order to take stock, got %d left", product.Stock)
+	}
+}
+
+func TestResponseValidation(t *testing.T) {
+	store := newTestStore()
+	// Product changes save the catalog, so work on a copy
+	store.catalogFile = filepath.Join(t.TempDir(), "products.json")
+	data, _ := os.ReadFile(testCatalog)
+	os.WriteFile(store.catalogFile, data, 0o644)
+	store.InitializeCatalog()
+	store.validateResponses = true
+	logs := &syncBuffer{}
+	store.SetLogger(slog.New(slog.NewJSONHandler(logs, nil)))
+	handler := store.Routes("../static")
+	defer store.Close()
+	key := staffKey(t, store, RoleAdmin)
+	token := registerCustomer(t, store, "asha@example.com")
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer hook.Close()
+
+	requests := []struct {
+		method string
+		path   string
+		body   string
+	}{
+		{http.MethodGet, "/api/products", ""},
+		{http.MethodGet, "/api/products/1", ""},
+		{http.MethodGet, "/api/products/99", ""},
+		{http.MethodPut, "/api/products/1/stock", `{"stock": 50}`},
+		{http.MethodPost, "/api/orders", `{"productId": 1, "quantity": 2}`},
+		{http.MethodPost, "/api/orders", `{"productId": 2, "quantity": 1000}`},
+		{http.MethodPost, "/api/checkout", `[{"product": {"id": 3}, "quantity": 1}]`},
+		{http.MethodGet, "/api/orders/1/invoice?format=json", ""},
+		{http.MethodGet, "/api/orders/1/invoice", ""},
+		{http.MethodGet, "/api/reports/sales", ""},
+		{http.MethodGet, "/api/reports/sales?format=csv", ""},
+		{http.MethodGet, "/api/catalog/export", ""},
+		{http.MethodPost, "/api/catalog/import?dryRun=true", `{"products": [{"name": "Pear", "category": "Grocery", "price": 30, "stock": 5}, {"name": ""}]}`},
+		{http.MethodPost, "/api/inventory/movements", `{"productId": 2, "delta": 5, "reason": "restock", "note": "PO 7"}`},
+		{http.MethodPost, "/api/inventory/movements", `{"productId": 2, "delta": 5, "reason": "write_off"}`},
+		{http.MethodGet, "/api/inventory/ledger?productId=2", ""},
+		{http.MethodGet, "/api/inventory/reconcile", ""},
+		{http.MethodPut, "/api/products/2/reorder", `{"reorderPoint": 8, "reorderQuantity": 20, "leadTimeDays": 3}`},
+		{http.MethodGet, "/api/inventory/reorder?all=true", ""},
+		{http.MethodGet, "/api/inventory/reorder", ""},
+		{http.MethodPost, "/api/inventory/locations", `{"code": "BLR-1", "name": "Indiranagar", "pincode": "560038"}`},
+		{http.MethodPost, "/api/inventory/locations", `{"code": "blr-1", "name": ""}`},
+		{http.MethodPut, "/api/inventory/locations/1", `{"code": "MAIN", "name": "Main warehouse", "pincode": "110001"}`},
+		{http.MethodPut, "/api/inventory/locations/9", `{"code": "NONE", "name": "Nowhere"}`},
+		{http.MethodPost, "/api/inventory/transfers", `{"productId": 1, "fromLocationId": 1, "toLocationId": 2, "quantity": 10}`},
+		{http.MethodPost, "/api/inventory/transfers", `{"productId": 1, "fromLocationId": 2, "toLocationId": 1, "quantity": 1000}`},
+		{http.MethodPut, "/api/products/2/stock", `{"stock": 3, "locationId": 2}`},
+		{http.MethodGet, "/api/inventory/locations", ""},
+		{http.MethodGet, "/api/products/1/availability?pincode=560001", ""},
+		{http.MethodGet, "/api/products/1/availability?pincode=abc", ""},
+		{http.MethodGet, "/api/products?pincode=560001", ""},
+		{http.MethodPut, "/api/products/2/backorder", `{"limit": 20, "expectedAt": "2026-12-01T00:00:00Z"}`},
+		{http.MethodPut, "/api/products/2/backorder", `{"limit": -1}`},
+		{http.MethodPost, "/api/orders", `{"productId": 2, "quantity": 15}`},
+		{http.MethodGet, "/api/inventory/backorders?productId=2", ""},
+		{http.MethodGet, "/api/products/2", ""},
+		{http.MethodPut, "/api/products/2/stock", `{"stock": 30}`},
+		{http.MethodGet, "/api/inventory/backorders", ""},
+		{http.MethodPost, "/api/inventory/suppliers", `{"name": "Fresh Farms", "email": "orders@freshfarms.example", "leadTimeDays": 4}`},
+		{http.MethodPost, "/api/inventory/suppliers", `{"name": "fresh farms"}`},
+		{http.MethodGet, "/api/inventory/suppliers", ""},
+		{http.MethodPost, "/api/inventory/purchase-orders", `{"supplierId": 1, "lines": [{"productId": 1, "quantity": 40, "unitCost": 12.5}, {"productId": 3, "quantity": 10}]}`},
+		{http.MethodPost, "/api/inventory/purchase-orders", `{"supplierId": 9, "lines": [{"productId": 1, "quantity": 1}]}`},
+		{http.MethodPost, "/api/inventory/purchase-orders/1/receipts", `{"lines": [{"productId": 1, "quantity": 25}], "note": "truck 1"}`},
+		{http.MethodPost, "/api/inventory/purchase-orders/1/receipts", `{"lines": [{"productId": 1, "quantity": 100}]}`},
+		{http.MethodGet, "/api/inventory/purchase-orders/1", ""},
+		{http.MethodGet, "/api/inventory/purchase-orders?status=partially_received", ""},
+		{http.MethodGet, "/api/inventory/purchase-orders?status=lost", ""},
+		{http.MethodGet, "/api/reports/purchasing", ""},
+		{http.MethodPost, "/api/inventory/purchase-orders/1/cancel", ""},
+		{http.MethodPost, "/api/inventory/purchase-orders/1/cancel", ""},
+		{http.MethodGet, "/api/inventory/purchase-orders/9", ""},
+		{http.MethodPost, "/api/inventory/reconcile", ""},
+		{http.MethodGet, "/api/admin/workers", ""},
+		{http.MethodPost, "/api/admin/webhooks", `{"url": "` + hook.URL + `", "events": ["order.created", "product.updated"]}`},
+		{http.MethodPost, "/api/admin/webhooks", `{"url": "ftp://example.com", "events": ["stock.low"]}`},
+		{http.MethodGet, "/api/admin/webhooks", ""},
+		{http.MethodPost, "/api/products", `{"name": "Pear", "category": "Grocery", "price": 30, "stock": 5}`},
+		{http.MethodPost, "/api/products", `{"name": "", "category": "Toys", "price": 0, "stock": 1}`},
+		{http.MethodPut, "/api/products/4", `{"name": "Ripe Pear", "category": "Grocery", "price": 35, "stock": 5}`},
+		{http.MethodDelete, "/api/products/4", ""},
+		{http.MethodGet, "/api/auth/me", ""},
+		{http.MethodPost, "/api/auth/login", `{"username": "nobody", "password": "wrong"}`},
+		{http.MethodPost, "/api/auth/logout", ""},
+		{http.MethodGet, "/api/admin/users", ""},
+		{http.MethodPost, "/api/admin/users", `{"username": "viewer", "role": "viewer"}`},
+		{http.MethodPost, "/api/admin/users/1/keys", `{"name": "ci"}`},
+		{http.MethodDelete, "/api/admin/users/1/keys/missing", ""},
+		{http.MethodPost, "/api/customers/register", `{"email": "ravi@example.com", "password": "correct horse"}`},
+		{http.MethodPost, "/api/customers/login", `{"email": "asha@example.com", "password": "wrong"}`},
+		{http.MethodPut, "/api/me", `{"name": "Asha"}`},
+		{http.MethodPost, "/api/me/addresses", `{"name": "Asha", "line1": "12 MG Road", "city": "Bengaluru", "pincode": "560001"}`},
+		{http.MethodPut, "/api/me/addresses/1", `{"name": "Asha", "line1": "14 MG Road", "city": "Bengaluru", "pincode": "560001"}`},
+		{http.MethodGet, "/api/me/addresses", ""},
+		{http.MethodPost, "/api/orders", `{"productId": 1, "quantity": 1}`},
+		{http.MethodGet, "/api/me", ""},
+		{http.MethodGet, "/api/me/orders", ""},
+		{http.MethodPost, "/api/me/orders/claim", `{"claimCode": "NONE-SUCH"}`},
+		{http.MethodDelete, "/api/me/addresses/1", ""},
+		{http.MethodPost, "/api/products/1/reviews", `{"rating": 4, "title": "Crisp", "body": "Fresh every time"}`},
+		{http.MethodPost, "/api/products/2/reviews", `{"rating": 6}`},
+		{http.MethodGet, "/api/me/reviews", ""},
+		{http.MethodGet, "/api/admin/reviews?status=pending", ""},
+		{http.MethodPut, "/api/admin/reviews/1/status", `{"status": "approved"}`},
+		{http.MethodGet, "/api/products/1/reviews", ""},
+		{http.MethodGet, "/api/products?sort=rating", ""},
+		{http.MethodGet, "/api/products/1/recommendations?limit=3", ""},
+		{http.MethodPost, "/api/cart/recommendations", `[{"product": {"id": 1}, "quantity": 1}]`},
+		{http.MethodPost, "/api/cart/recommendations?limit=50", `[]`},
+		{http.MethodPost, "/api/orders/1/payment", ""},
+		{http.MethodPost, "/api/payments/webhook", `{"id": "evt_1", "type": "payment.captured", "orderId": 1}`},
+		{http.MethodPut, "/api/admin/payments/mock", `{"mode": "decline"}`},
+		{http.MethodPost, "/api/orders", `{"productId": 3, "quantity": 1}`},
+		{http.MethodPut, "/api/admin/payments/mock", `{"mode": "succeed"}`},
+		{http.MethodPost, "/api/me/orders/1/cancel", ""},
+		{http.MethodPost, "/api/admin/orders/1/cancel", ""},
+		{http.MethodPost, "/api/me/wishlist", `{"productId": 2}`},
+		{http.MethodGet, "/api/me/wishlist", ""},
+		{http.MethodPost, "/api/me/wishlist/2/cart", ""},
+		{http.MethodDelete, "/api/me/wishlist/2", ""},
+		{http.MethodPost, "/api/me/carts", `{"name": "Later", "items": [{"product": {"id": 1}, "quantity": 2}]}`},
+		{http.MethodGet, "/api/me/carts", ""},
+		{http.MethodPost, "/api/me/carts/1/restore", ""},
+		{http.MethodDelete, "/api/me/carts/1", ""},
+		{http.MethodGet, "/api/me/notifications", ""},
+		{http.MethodPost, "/api/me/notifications/read", ""},
+		{http.MethodGet, "/api/admin/webhooks/1/deliveries", ""},
+		{http.MethodPost, "/api/admin/webhooks/deliveries/1/redeliver", ""},
+		{http.MethodPost, "/api/admin/webhooks/deliveries/999/redeliver", ""},
+		{http.MethodDelete, "/api/admin/webhooks/1", ""},
+		{http.MethodPost, "/api/customers/logout", ""},
+		{http.MethodGet, "/healthz", ""},
+		{http.MethodGet, "/readyz", ""},
+		{http.MethodGet, "/metrics", ""},
+		{http.MethodGet, "/openapi.json", ""},
+	}
+	for _, req := range requests {
+		r := httptest.NewRequest(req.method, req.path, strings.NewReader(req.body))
+		r.Header.Set(APIKeyHeader, key)
+		r.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, r)
+		if rec.Code >= http.StatusInternalServerError {
+			t.Errorf("%s %s failed with %d: %s", req.method, req.path, rec.Code, rec.Body.String())
+		}
+	}
+
+	for _, entry := range logs.entries(t) {
+		if entry["level"] == "WARN" && entry["msg"] == "response does not match the API document" {
+			t.Errorf("%s %s: %v", entry["method"], entry["path"], entry["problems"])
+		}
+	}
+}
+
+func TestCheckResponse(t *testing.T) {
+	op := openAPI.operation(http.MethodGet, "/api/products/{id}")
+	header := http.Header{"Content-Type": {"application/json"}}
+	rating := `"rating": {"average": 4.5, "count": 2, "distribution": {"1": 0, "2": 0, "3": 0, "4": 1, "5": 1}}`
+
+	if problems := openAPI.checkResponse(op, http.StatusOK, header, []byte(`{"id": 1, "name": "Apple", "category": "Grocery", "price": 40, "stock": 3, `+rating+`}`)); len(problems) != 0 {
+		t.Errorf("Expected a valid product, got %v", problems)
+	}
+	problems := openAPI.checkResponse(op, http.StatusOK, header, []byte(`{"id": "1", "name": "Apple", "category": "Grocery", "price": 40, `+rating+`}`))
+	if len(problems) != 2 || problems[0].String() != "stock is required" || problems[1].String() != "id must be an integer" {
+		t.Errorf("Unexpected problems: %v", problems)
+	}
+	if problems := openAPI.checkResponse(op, http.StatusTeapot, header, nil); len(problems) != 1 {
+		t.Errorf("Expected an undocumented status to be reported, got %v", problems)
+	}
+}
@@ -0,0 +1,721 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"time"
+)
+
+// Payment states
+const (
+	PaymentPending    = "pending"    // no answer from the provider yet
+	PaymentDeclined   = "declined"   // may be tried again
+	PaymentAuthorized = "authorized" // held, captured once the order is processed
+	PaymentCaptured   = "captured"
+	PaymentRefunded   = "refunded"
+)
+
+// Payment webhook event types
+const (
+	EventPaymentAuthorized = "payment.authorized"
+	EventPaymentFailed     = "payment.failed"
+	EventPaymentCaptured   = "payment.captured"
+	EventPaymentRefunded   = "payment.refunded"
+)
+
+// PaymentProvider is a payment gateway. Calls are made with a deadline,
+// and a provider that does not answer in time returns ErrPaymentTimeout.
+type PaymentProvider interface {
+	Name() string
+	// Authorize holds the amount and returns the provider's reference for
+	// the payment. Retrying with the same idempotency key returns the
+	// payment made the first time rather than making another.
+	Authorize(ctx context.Context, request PaymentRequest) (string, error)
+	Capture(ctx context.Context, reference string, amount float64) error
+	// Refund gives back an authorized or captured payment and returns the
+	// provider's reference for the refund
+	Refund(ctx context.Context, reference string, amount float64) (string, error)
+	// VerifyWebhook checks that a webhook was sent by the provider and
+	// reads the event it carries
+	VerifyWebhook(header http.Header, body []byte) (*PaymentEvent, error)
+}
+
+// PaymentRequest asks a provider to authorize the payment for an order
+type PaymentRequest struct {
+	OrderID        int
+	Amount         float64
+	Currency       string
+	IdempotencyKey string
+}
+
+// PaymentEvent is a change to a payment, sent by the provider's webhook
+type PaymentEvent struct {
+	ID        string `json:"id"` // unique per event, so redelivered events are only applied once
+	Type      string `json:"type"`
+	OrderID   int    `json:"orderId"`
+	Reference string `json:"reference,omitempty"`
+}
+
+// Payment is the payment for an order
+type Payment struct {
+	Provider  string    `json:"provider"`
+	Reference string    `json:"reference,omitempty"`
+	Status    string    `json:"status"`
+	Amount    float64   `json:"amount"`
+	RefundID  string    `json:"refundId,omitempty"`
+	UpdatedAt time.Time `json:"updatedAt"`
+	// Events are the IDs of the webhook events applied to the payment
+	Events []string `json:"events,omitempty"`
+}
+
+// PaymentError is a payment for an order that did not go through. The order
+// stays pending, so the payment can be tried again.
+type PaymentError struct {
+	OrderID int
+	// ClaimCode is set for the request that placed an anonymous order, which
+	// needs it to try the payment again
+	ClaimCode string
+	Err       error
+}
+
+func (e *PaymentError) Error() string {
+	return fmt.Sprintf("payment for order %d failed: %v", e.OrderID, e.Err)
+}
+
+func (e *PaymentError) Unwrap() error {
+	return e.Err
+}
+
+// SetPaymentProvider replaces the payment provider, which is the mock
+// provider set up from the configuration until then
+func (s *Store) SetPaymentProvider(provider PaymentProvider) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.payments = provider
+}
+
+// paymentProvider returns the payment provider and a context for calling it
+func (s *Store) paymentProvider(ctx context.Context) (PaymentProvider, context.Context, context.CancelFunc) {
+	s.mu.RLock()
+	provider := s.payments
+	s.mu.RUnlock()
+
+	ctx, cancel := context.WithTimeout(ctx, s.paymentTimeout)
+	return provider, ctx, cancel
+}
+
+// newPayment starts the payment record of an order. The caller must hold s.mu.
+func (s *Store) newPayment(order *Order) *Payment {
+	if order.Payment == nil {
+		order.Payment = &Payment{Provider: s.payments.Name(), Status: PaymentPending, Amount: s.CalculateTotal(order)}
+	}
+	return order.Payment
+}
+
+// paymentRequest asks for the payment of an order. Every attempt for the
+// order uses the same idempotency key, so the provider authorizes it at most
+// once. The caller must hold s.mu.
+func (s *Store) paymentRequest(order *Order) PaymentRequest {
+	return PaymentRequest{
+		OrderID:        order.ID,
+		Amount:         s.CalculateTotal(order),
+		Currency:       "INR",
+		IdempotencyKey: fmt.Sprintf("order-%d", order.ID),
+	}
+}
+
+// PayOrder authorizes the payment for a pending order, issues its invoice
+// and queues the order for processing. A backordered order's payment is
+// authorized and invoiced too, but the order waits for its stock before it
+// is queued. Orders that are already paid are left alone. A declined or
+// timed out payment returns a *PaymentError and leaves the order pending.
+func (s *Store) PayOrder(ctx context.Context, order *Order) error {
+	paid, err := s.authorizeOrder(ctx, order)
+	if paid {
+		s.ProcessOrder(order)
+	}
+	return err
+}
+
+// authorizeOrder does the work of PayOrder but leaves queueing the order to
+// the caller, reporting whether the order is now paid and ready for it
+func (s *Store) authorizeOrder(ctx context.Context, order *Order) (bool, error) {
+	s.mu.Lock()
+	switch order.Status {
+	case OrderCancelled:
+		s.mu.Unlock()
+		return false, ErrOrderCancelled
+	case OrderPending:
+	case OrderBackordered:
+		if order.Payment != nil && order.Payment.Status == PaymentAuthorized {
+			s.mu.Unlock()
+			return false, nil
+		}
+	default:
+		s.mu.Unlock()
+		return false, nil
+	}
+	// Zero quantity orders sell nothing, so there is nothing to pay
+	if order.Quantity == 0 {
+		order.Status = OrderPaid
+		err := s.saveOrders()
+		if err == nil {
+			s.orderStatusChanged(order, OrderPending)
+		}
+		s.mu.Unlock()
+		return err == nil, err
+	}
+	request := s.paymentRequest(order)
+	s.mu.Unlock()
+
+	provider, callCtx, cancel := s.paymentProvider(ctx)
+	defer cancel()
+	reference, err := provider.Authorize(callCtx, request)
+
+	s.mu.Lock()
+	payment := s.newPayment(order)
+	payment.UpdatedAt = time.Now()
+	switch {
+	case payment.Status == PaymentRefunded:
+		// A cancellation in the meantime found and refunded the payment
+	case err == nil:
+		payment.Reference, payment.Status = reference, PaymentAuthorized
+	case errors.Is(err, ErrPaymentDeclined):
+		payment.Status = PaymentDeclined
+	default:
+		payment.Status = PaymentPending
+	}
+	// An order cancelled while the provider was asked, for example because
+	// it went unpaid too long, gives back what was authorized
+	cancelled := order.Status == OrderCancelled
+	var paid bool
+	var saveErr error
+	if err == nil {
+		paid, saveErr = s.savePaidOrder(order)
+	} else {
+		saveErr = s.saveOrders()
+	}
+	s.mu.Unlock()
+
+	logger := s.orderLog(order)
+	if err != nil {
+		logger.Warn("payment failed", "provider", provider.Name(), "error", err)
+		if errors.Is(err, ErrPaymentDeclined) {
+			s.metrics.checkoutFailed(failurePaymentDeclined)
+		} else {
+			s.metrics.checkoutFailed(failurePaymentError)
+		}
+		return false, &PaymentError{OrderID: order.ID, Err: err}
+	}
+	if cancelled {
+		if err := s.refundPayment(ctx, order); err != nil {
+			logger.Error("error refunding the payment of a cancelled order", "error", err)
+		}
+		return false, ErrOrderCancelled
+	}
+	if saveErr != nil {
+		return false, saveErr
+	}
+	logger.Info("payment authorized", "provider", provider.Name(), "reference", reference)
+	return paid, nil
+}
+
+// savePaidOrder saves an order whose payment has been authorized, then
+// issues its invoice and marks it paid, reporting whether it is now ready to
+// be queued. The order is saved first so that a failed save never uses up an
+// invoice number. Without its invoice the order stays pending, and paying
+// again finds the same authorization. A cancelled order is only saved, and a
+// backorder is invoiced but keeps waiting for its stock. The caller must
+// hold s.mu.
+func (s *Store) savePaidOrder(order *Order) (bool, error) {
+	if err := s.saveOrders(); err != nil || order.Status == OrderCancelled {
+		return false, err
+	}
+	if err := s.invoicePaidOrder(order); err != nil {
+		return false, err
+	}
+	if order.Status != OrderPending {
+		return false, nil
+	}
+	order.Status = OrderPaid
+	if err := s.saveOrders(); err != nil {
+		order.Status = OrderPending
+		return false, err
+	}
+	s.orderStatusChanged(order, OrderPending)
+	return true, nil
+}
+
+// capturePayment collects an authorized payment before its order is
+// dispatched. Orders without an authorized payment have nothing to collect.
+func (s *Store) capturePayment(order *Order) error {
+	s.mu.RLock()
+	payment := order.Payment
+	var reference string
+	var amount float64
+	if payment != nil && payment.Status == PaymentAuthorized {
+		reference, amount = payment.Reference, payment.Amount
+	}
+	s.mu.RUnlock()
+	if reference == "" {
+		return nil
+	}
+
+	provider, ctx, cancel := s.paymentProvider(context.Background())
+	defer cancel()
+	if err := provider.Capture(ctx, reference, amount); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if payment.Status == PaymentAuthorized {
+		payment.Status, payment.UpdatedAt = PaymentCaptured, time.Now()
+	}
+	return nil
+}
+
+// refundPayment gives back the payment for an order if the provider holds
+// or has collected it. A payment whose authorization timed out may have gone
+// through all the same, so the provider is asked for it again with the same
+// idempotency key, which finds it without holding the amount twice.
+func (s *Store) refundPayment(ctx context.Context, order *Order) error {
+	s.mu.RLock()
+	payment := order.Payment
+	refundable := payment != nil && (payment.Status == PaymentAuthorized || payment.Status == PaymentCaptured)
+	unconfirmed := payment != nil && payment.Status == PaymentPending
+	var reference string
+	var amount float64
+	var request PaymentRequest
+	if refundable {
+		reference, amount = payment.Reference, payment.Amount
+	}
+	if unconfirmed {
+		request = s.paymentRequest(order)
+		amount = request.Amount
+	}
+	s.mu.RUnlock()
+	if !refundable && !unconfirmed {
+		return nil
+	}
+
+	provider, callCtx, cancel := s.paymentProvider(ctx)
+	defer cancel()
+	if unconfirmed {
+		var err error
+		reference, err = provider.Authorize(callCtx, request)
+		if errors.Is(err, ErrPaymentDeclined) {
+			// Nothing is held
+			s.mu.Lock()
+			if payment.Status == PaymentPending {
+				payment.Status, payment.UpdatedAt = PaymentDeclined, time.Now()
+			}
+			err = s.saveOrders()
+			s.mu.Unlock()
+			return err
+		}
+		if err != nil {
+			return &PaymentError{OrderID: order.ID, Err: err}
+		}
+	}
+	refundID, err := provider.Refund(callCtx, reference, amount)
+	if err != nil {
+		return &PaymentError{OrderID: order.ID, Err: err}
+	}
+	s.mu.Lock()
+	payment.Reference = reference
+	payment.Status, payment.RefundID, payment.UpdatedAt = PaymentRefunded, refundID, time.Now()
+	err = s.saveOrders()
+	s.mu.Unlock()
+	s.orderLog(order).Info("payment refunded", "provider", provider.Name(), "refundId", refundID, "amount", amount)
+	return err
+}
+
+// CancelOrder cancels an order, puts its stock back and refunds its
+// payment. A customer may only cancel their own orders; customerID is zero
+// for staff. Orders already dispatched cannot be cancelled.
+//
+// The order is marked cancelled before the refund, so the worker leaves it
+// alone and a second cancellation is refused, but its stock only goes back
+// once the refund has gone through. If the refund fails, or the stock cannot
+// be saved before anything was refunded, the order is put back as it was.
+func (s *Store) CancelOrder(ctx context.Context, id, customerID int) (*Order, error) {
+	return s.cancelOrderIf(ctx, id, customerID, nil)
+}
+
+// errNotExpired is returned by cancelOrderIf for an order that no longer
+// matches, such as an expiring order that was paid for in the meantime
+var errNotExpired = errors.New("order was paid for")
+
+// cancelOrderIf is CancelOrder for an order that still matches, checked
+// under the same lock that cancels it. A nil match cancels any order.
+func (s *Store) cancelOrderIf(ctx context.Context, id, customerID int, match func(*Order) bool) (*Order, error) {
+	s.mu.Lock()
+	var order *Order
+	if id >= 1 && id <= len(s.orders) {
+		order = s.orders[id-1]
+	}
+	var err error
+	switch {
+	case order == nil, customerID != 0 && order.CustomerID != customerID:
+		err = ErrOrderNotFound
+	case order.Status == OrderCancelled:
+		err = ErrOrderCancelled
+	case order.Status == OrderProcessed:
+		err = ErrOrderDispatched
+	case match != nil && !match(order):
+		err = errNotExpired
+	}
+	if err != nil {
+		s.mu.Unlock()
+		return nil, err
+	}
+	previous := order.Status
+	order.Status = OrderCancelled
+	s.mu.Unlock()
+
+	// A refund the provider refused leaves the order as it was; one that
+	// went through but was not saved is saved with the cancellation below
+	var paymentErr *PaymentError
+	if err := s.refundPayment(ctx, order); errors.As(err, &paymentErr) {
+		s.mu.Lock()
+		requeue := s.uncancelOrder(order, previous)
+		s.mu.Unlock()
+		if requeue {
+			s.ProcessOrder(order)
+		}
+		return nil, err
+	} else if err != nil {
+		s.orderLog(order).Error("error saving the refund", "error", err)
+	}
+
+	s.mu.Lock()
+	snapshot := s.snapshotStock(order.Product.ID)
+	// Products removed from the catalog since have no stock to put back.
+	// The stock goes back to the locations the order was allocated from;
+	// orders placed before there were locations return it to the default.
+	// A backordered order never had any stock.
+	restocked := false
+	if product, ok := s.catalog[order.Product.ID]; ok && order.Quantity > 0 && previous != OrderBackordered {
+		restocked = product.Stock == 0
+		allocations := order.Allocations
+		if len(allocations) == 0 {
+			allocations = []Allocation{{LocationID: defaultLocationID, Quantity: order.Quantity}}
+		}
+		for _, allocation := range allocations {
+			location := s.location(allocation.LocationID)
+			s.setLocationStock(location, product.ID, location.Stock[product.ID]+allocation.Quantity)
+			product.Stock += allocation.Quantity
+			movement := s.recordMovement(product, allocation.Quantity, MovementReturn, "order cancelled", actor(ctx), order.ID)
+			movement.LocationID = allocation.LocationID
+		}
+	}
+	err = s.saveOrders()
+	if err != nil {
+		s.restoreStock(snapshot)
+	} else {
+		err = s.saveInventory(snapshot)
+	}
+	if err != nil {
+		// The stock is as it was. A refunded order stays cancelled, since its
+		// payment is gone; any other is put back.
+		requeue := false
+		if order.Payment != nil && order.Payment.Status == PaymentRefunded {
+			s.orderLog(order).Error("stock of a refunded order was not put back", "error", err)
+		} else {
+			requeue = s.uncancelOrder(order, previous)
+		}
+		s.mu.Unlock()
+		if requeue {
+			s.ProcessOrder(order)
+		}
+		return nil, err
+	}
+	s.orderStatusChanged(order, previous)
+	// The stock put back, or the place this order gave up in the queue,
+	// may let other backorders be filled
+	filled, err := s.fillBackorders(order.Product.ID)
+	restocked = restocked && order.Product.Stock > 0
+	name := order.Product.Name
+	s.mu.Unlock()
+
+	logger := s.orderLog(order)
+	logger.Info("order cancelled", "customerId", customerID)
+	if err != nil {
+		logger.Error("error filling backorders", "productId", order.Product.ID, "error", err)
+	}
+	s.backordersFilled(ctx, filled)
+	if restocked {
+		s.notifyBackInStock(order.Product.ID, name)
+	}
+	return order, nil
+}
+
+// uncancelOrder puts back the status of an order whose cancellation failed
+// and reports whether it has to be queued again, since the worker skips an
+// order while it looks cancelled. The caller must hold s.mu.
+func (s *Store) uncancelOrder(order *Order, previous string) bool {
+	order.Status = previous
+	if err := s.saveOrders(); err != nil {
+		s.orderLog(order).Error("error restoring the order after a failed cancellation", "error", err)
+	}
+	return previous == OrderPaid
+}
+
+// expireEvery cancels unpaid orders past the pending timeout every interval
+// until the store is closed
+func (s *Store) expireEvery(interval time.Duration) {
+	defer close(s.expiryDone)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.expireUnpaidOrders(context.Background(), time.Now())
+		case <-s.stopExpiry:
+			return
+		}
+	}
+}
+
+// expireUnpaidOrders cancels the pending orders whose payment has not been
+// authorized within the pending timeout of them becoming payable, so that a
+// declined or abandoned order gives its stock back, and returns them
+func (s *Store) expireUnpaidOrders(ctx context.Context, now time.Time) []*Order {
+	expired := func(order *Order) bool {
+		// Orders saved before PendingSince was kept became payable when placed
+		since := order.CreatedAt
+		if order.PendingSince != nil {
+			since = *order.PendingSince
+		}
+		return order.Status == OrderPending && now.Sub(since) >= s.pendingTimeout &&
+			(order.Payment == nil || order.Payment.Status != PaymentAuthorized)
+	}
+	s.mu.RLock()
+	var ids []int
+	for _, order := range s.orders {
+		if expired(order) {
+			ids = append(ids, order.ID)
+		}
+	}
+	s.mu.RUnlock()
+
+	var cancelled []*Order
+	for _, id := range ids {
+		order, err := s.cancelOrderIf(ctx, id, 0, expired)
+		switch {
+		case errors.Is(err, errNotExpired), errors.Is(err, ErrOrderCancelled):
+		case err != nil:
+			s.logger.Error("error expiring unpaid order", "orderId", id, "error", err)
+		default:
+			s.orderLog(order).Info("unpaid order expired", "timeout", s.pendingTimeout)
+			cancelled = append(cancelled, order)
+		}
+	}
+	return cancelled
+}
+
+// HandlePaymentEvent applies a webhook event to the payment it is about.
+// Events already applied are ignored, and duplicate reports whether the
+// event was one of them. An event for another payment than the one the
+// order holds is refused. A payment authorized after its order was
+// cancelled is refunded.
+func (s *Store) HandlePaymentEvent(ctx context.Context, event *PaymentEvent) (duplicate bool, err error) {
+	s.mu.Lock()
+	if event.OrderID < 1 || event.OrderID > len(s.orders) {
+		s.mu.Unlock()
+		return false, ErrOrderNotFound
+	}
+	order := s.orders[event.OrderID-1]
+	existing := order.Payment != nil
+	payment := s.newPayment(order)
+	if slices.Contains(payment.Events, event.ID) {
+		s.mu.Unlock()
+		return true, nil
+	}
+	if payment.Reference != "" && event.Reference != payment.Reference {
+		s.mu.Unlock()
+		return false, invalidRequest("event is for payment %q, not the order's payment %q", event.Reference, payment.Reference)
+	}
+	before := *payment
+
+	authorized, refund := false, false
+	switch event.Type {
+	case EventPaymentAuthorized:
+		// An authorized payment on a pending order is one whose invoice
+		// could not be issued the first time
+		if payment.Status == PaymentPending || payment.Status == PaymentDeclined ||
+			payment.Status == PaymentAuthorized && order.Status == OrderPending {
+			payment.Reference, payment.Status = event.Reference, PaymentAuthorized
+			authorized = true
+			refund = order.Status == OrderCancelled
+		}
+	case EventPaymentFailed:
+		if payment.Status == PaymentPending {
+			payment.Status = PaymentDeclined
+		}
+	case EventPaymentCaptured:
+		if payment.Status == PaymentAuthorized {
+			payment.Status = PaymentCaptured
+		}
+	case EventPaymentRefunded:
+		payment.Status = PaymentRefunded
+	default:
+		s.mu.Unlock()
+		return false, invalidRequest("unknown payment event type %q", event.Type)
+	}
+	payment.Events = append(payment.Events, event.ID)
+	payment.UpdatedAt = time.Now()
+	queue := false
+	if authorized {
+		queue, err = s.savePaidOrder(order)
+	} else {
+		err = s.saveOrders()
+	}
+	if err != nil {
+		// Forget the event, so that the provider's redelivery applies it
+		*payment = before
+		if !existing {
+			order.Payment = nil
+		}
+	}
+	s.mu.Unlock()
+	if err != nil {
+		return false, err
+	}
+
+	s.orderLog(order).Info("payment event applied", "event", event.ID, "type", event.Type)
+	if queue {
+		s.ProcessOrder(order)
+	}
+	if refund {
+		return false, s.refundPayment(ctx, order)
+	}
+	return false, nil
+}
+
+// placingError hands an anonymous order's claim code to the request that
+// placed it when its payment fails, so the shopper can try again
+func (s *Store) placingError(order *Order, err error) error {
+	var paymentErr *PaymentError
+	if errors.As(err, &paymentErr) {
+		s.mu.RLock()
+		paymentErr.ClaimCode = order.ClaimCode
+		s.mu.RUnlock()
+	}
+	return err
+}
+
+// OrderPayment is the payment route's view of an order: where it stands and
+// its payment, without the buyer's details
+type OrderPayment struct {
+	OrderID int      `json:"orderId"`
+	Status  string   `json:"status"`
+	Payment *Payment `json:"payment,omitempty"`
+}
+
+// handlePayOrder serves POST /api/orders/{id}/payment, which tries the
+// payment for a pending order again. Like the invoice, only staff, the
+// customer who placed the order or the holder of its claim code may.
+func (s *Store) handlePayOrder(w http.ResponseWriter, r *http.Request) {
+	orderID, err := pathID(r, "id", "order")
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	order, err := s.GetOrder(orderID)
+	if err == nil && !s.canAccessOrder(r, order) {
+		err = ErrOrderNotFound
+	}
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	if err := s.PayOrder(r.Context(), order); err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	writeJSON(w, http.StatusOK, OrderPayment{OrderID: order.ID, Status: order.Status, Payment: order.Payment})
+}
+
+// handleCancelMyOrder serves POST /api/me/orders/{id}/cancel
+func (s *Store) handleCancelMyOrder(w http.ResponseWriter, r *http.Request) {
+	s.cancelOrder(w, r, CustomerFromContext(r.Context()).ID)
+}
+
+// handleCancelOrder serves POST /api/admin/orders/{id}/cancel
+func (s *Store) handleCancelOrder(w http.ResponseWriter, r *http.Request) {
+	s.cancelOrder(w, r, 0)
+}
+
+// cancelOrder cancels the order in the path for a customer, or for staff
+// when customerID is zero
+func (s *Store) cancelOrder(w http.ResponseWriter, r *http.Request, customerID int) {
+	orderID, err := pathID(r, "id", "order")
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	order, err := s.CancelOrder(r.Context(), orderID, customerID)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	writeJSON(w, http.StatusOK, order)
+}
+
+// handlePaymentWebhook serves POST /api/payments/webhook. The provider
+// signs every webhook, and may send the same event more than once.
+func (s *Store) handlePaymentWebhook(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		s.writeError(w, r, badRequestBody(err))
+		return
+	}
+	s.mu.RLock()
+	provider := s.payments
+	s.mu.RUnlock()
+	event, err := provider.VerifyWebhook(r.Header, body)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	duplicate, err := s.HandlePaymentEvent(r.Context(), event)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"received": true, "duplicate": duplicate})
+}
+
+// handleSetMockPaymentMode serves PUT /api/admin/payments/mock, which sets
+// what the mock provider does with authorizations
+func (s *Store) handleSetMockPaymentMode(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Mode string `json:"mode"`
+	}
+	if err := decodeJSON(r, &request); err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	s.mu.RLock()
+	mock, ok := s.payments.(*MockProvider)
+	s.mu.RUnlock()
+	if !ok {
+		s.writeError(w, r, invalidRequest("the payment provider is not the mock provider"))
+		return
+	}
+	if err := mock.SetMode(request.Mode); err != nil {
+		s.writeError(w, r, invalidRequest("%v", err))
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"mode": mock.Mode()})
+}
@@ -0,0 +1,397 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"example.com/lab-08/config"
+)
+
+// sendWebhook posts a payment event signed by the mock provider
+func sendWebhook(handler http.Handler, mock *MockProvider, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/api/payments/webhook", strings.NewReader(body))
+	req.Header.Set(MockSignatureHeader, mock.Sign([]byte(body)))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestOrderPayment(t *testing.T) {
+	store := newTestStore()
+	store.InitializeCatalog()
+	handler := store.Routes("../static")
+	mock := store.payments.(*MockProvider)
+
+	// A declined payment leaves the order pending with its stock held
+	mock.SetMode("decline")
+	rec := customerRequest(handler, http.MethodPost, "/api/orders", `{"productId": 1, "quantity": 2}`, "")
+	var body struct {
+		Error APIError `json:"error"`
+	}
+	json.NewDecoder(rec.Body).Decode(&body)
+	if rec.Code != http.StatusPaymentRequired || body.Error.Code != CodePaymentDeclined || body.Error.Details["orderId"] != 1.0 {
+		t.Fatalf("Expected the payment to be declined, got %d %+v", rec.Code, body.Error)
+	}
+	order, _ := store.GetOrder(1)
+	if order.Status != OrderPending || order.Payment.Status != PaymentDeclined || order.Product.Stock != 98 {
+		t.Errorf("Expected a pending order holding its stock, got %s %+v", order.Status, order.Payment)
+	}
+
+	// Only the shopper holding the claim code may try again, and once the
+	// payment goes through the order is queued
+	mock.SetMode("succeed")
+	if rec := customerRequest(handler, http.MethodPost, "/api/orders/1/payment", "", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected a payment without the claim code to be refused, got %d", rec.Code)
+	}
+	claimCode, _ := body.Error.Details["claimCode"].(string)
+	rec = customerRequest(handler, http.MethodPost, "/api/orders/1/payment?claimCode="+claimCode, "", "")
+	var paid map[string]any
+	json.NewDecoder(rec.Body).Decode(&paid)
+	if rec.Code != http.StatusOK || claimCode == "" || paid["orderId"] != 1.0 || paid["payment"] == nil {
+		t.Fatalf("Expected the payment to go through, got %d: %v", rec.Code, paid)
+	}
+	if _, ok := paid["product"]; ok {
+		t.Errorf("Expected only the payment in the response, got %v", paid)
+	}
+	store.Close()
+	if order.Status != OrderProcessed || order.Payment.Status != PaymentCaptured || order.Payment.Reference == "" || order.Payment.Amount != 80 {
+		t.Errorf("Expected a processed order with its payment captured, got %s %+v", order.Status, order.Payment)
+	}
+}
+
+func TestPaymentTimeoutAndWebhook(t *testing.T) {
+	store := newTestStore()
+	store.InitializeCatalog()
+	store.paymentTimeout = 20 * time.Millisecond
+	handler := store.Routes("../static")
+	defer store.Close()
+	mock := store.payments.(*MockProvider)
+
+	mock.SetMode("timeout")
+	product, _ := store.GetProduct(3)
+	order, _ := store.CreateOrder(context.Background(), product, 1)
+	err := store.PayOrder(context.Background(), order)
+	var paymentErr *PaymentError
+	if !errors.Is(err, ErrPaymentTimeout) || !errors.As(err, &paymentErr) || order.Status != OrderPending {
+		t.Fatalf("Expected the payment to time out, got %v with the order %s", err, order.Status)
+	}
+
+	// The provider reports the authorization later, once, however often it is sent
+	if rec := sendWebhook(handler, mock, `{"id": "evt_1", "type": "payment.authorized", "orderId": 1}`+" "); rec.Code != http.StatusOK {
+		t.Fatalf("Expected the event to be applied, got %d: %s", rec.Code, rec.Body.String())
+	}
+	rec := sendWebhook(handler, mock, `{"id": "evt_1", "type": "payment.authorized", "orderId": 1}`)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"duplicate":true`) {
+		t.Errorf("Expected the repeated event to be acknowledged as a duplicate, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if status := orderStatus(store, order); status != OrderPaid && status != OrderProcessed {
+		t.Errorf("Expected the order to be paid, got %s", status)
+	}
+	if len(order.Payment.Events) != 1 {
+		t.Errorf("Expected the event to be recorded once, got %v", order.Payment.Events)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/payments/webhook", strings.NewReader(`{"id": "evt_2", "type": "payment.refunded", "orderId": 1}`))
+	req.Header.Set(MockSignatureHeader, mock.Sign([]byte("something else")))
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected a bad signature to be refused, got %d", rec.Code)
+	}
+
+	// Without a configured secret the store makes up its own, so a
+	// well known one signs nothing
+	guessed := NewMockProvider("succeed", "mock-webhook-secret")
+	if rec := sendWebhook(handler, guessed, `{"id": "evt_3", "type": "payment.authorized", "orderId": 1}`); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected a webhook signed with a guessed secret to be refused, got %d", rec.Code)
+	}
+}
+
+func TestCancelVoidsTimedOutPayment(t *testing.T) {
+	store := newTestStore()
+	store.InitializeCatalog()
+	store.paymentTimeout = 20 * time.Millisecond
+	defer store.Close()
+	mock := store.payments.(*MockProvider)
+	ctx := context.Background()
+
+	// The provider authorized the payment but the answer never came back
+	mock.SetMode("timeout")
+	product, _ := store.GetProduct(3)
+	order, _ := store.CreateOrder(ctx, product, 1)
+	if err := store.PayOrder(ctx, order); !errors.Is(err, ErrPaymentTimeout) {
+		t.Fatalf("Expected the payment to time out, got %v", err)
+	}
+	if _, err := store.CancelOrder(ctx, order.ID, 0); err != nil {
+		t.Fatal(err)
+	}
+	held := mock.payments[order.Payment.Reference]
+	if order.Payment.Status != PaymentRefunded || held == nil || !held.refunded {
+		t.Errorf("Expected the authorization to be refunded, got %+v", order.Payment)
+	}
+	if len(mock.payments) != 1 {
+		t.Errorf("Expected the payment to be authorized once, got %d", len(mock.payments))
+	}
+
+	// A provider that declined has nothing to give back
+	mock.SetMode("decline")
+	declined, _ := store.CreateOrder(ctx, product, 1)
+	store.mu.Lock()
+	store.newPayment(declined)
+	store.mu.Unlock()
+	if _, err := store.CancelOrder(ctx, declined.ID, 0); err != nil {
+		t.Fatal(err)
+	}
+	if declined.Payment.Status != PaymentDeclined || declined.Payment.RefundID != "" {
+		t.Errorf("Expected nothing to be refunded, got %+v", declined.Payment)
+	}
+}
+
+// openDataStore opens a store that saves to a temporary data directory,
+// with its own copy of the test catalog
+func openDataStore(t *testing.T) *Store {
+	dir := t.TempDir()
+	data, _ := os.ReadFile(testCatalog)
+	cfg := config.Default()
+	cfg.Store.CatalogFile = filepath.Join(dir, "products.json")
+	cfg.Store.DataDir = filepath.Join(dir, "data")
+	os.WriteFile(cfg.Store.CatalogFile, data, 0o644)
+
+	store, err := Open(cfg)
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	t.Cleanup(store.Close)
+	return store
+}
+
+func TestPaymentEventSavedBeforeInvoice(t *testing.T) {
+	store := openDataStore(t)
+	store.paymentTimeout = 20 * time.Millisecond
+	mock := store.payments.(*MockProvider)
+	ctx := context.Background()
+
+	mock.SetMode("timeout")
+	product, _ := store.GetProduct(3)
+	order, _ := store.CreateOrder(ctx, product, 1)
+	if err := store.PayOrder(ctx, order); !errors.Is(err, ErrPaymentTimeout) {
+		t.Fatalf("Expected the payment to time out, got %v", err)
+	}
+
+	// An event that cannot be saved issues no invoice and is not recorded,
+	// so the provider's redelivery is applied
+	blocker := filepath.Join(store.dataDir, ordersFile+".tmp")
+	os.MkdirAll(blocker, 0o755)
+	event := &PaymentEvent{ID: "evt_1", Type: EventPaymentAuthorized, OrderID: order.ID, Reference: "mock_pay_1"}
+	if _, err := store.HandlePaymentEvent(ctx, event); err == nil {
+		t.Fatal("Expected the event to fail when the orders cannot be saved")
+	}
+	if _, err := store.GetInvoice(order.ID); !errors.Is(err, ErrInvoiceNotFound) || len(store.invoiceSeq) != 0 {
+		t.Errorf("Expected no invoice number to be used, got %v", store.invoiceSeq)
+	}
+	if order.Status != OrderPending || order.Payment.Status != PaymentPending || len(order.Payment.Events) != 0 {
+		t.Errorf("Expected the payment to be left as it was, got %s %+v", order.Status, order.Payment)
+	}
+
+	os.Remove(blocker)
+	if duplicate, err := store.HandlePaymentEvent(ctx, event); err != nil || duplicate {
+		t.Fatalf("Expected the redelivered event to be applied, got %v", err)
+	}
+	if invoice, err := store.GetInvoice(order.ID); err != nil || invoice.Sequence != 1 {
+		t.Errorf("Expected the first invoice number, got %+v %v", invoice, err)
+	}
+
+	// Events for another payment are refused
+	other := &PaymentEvent{ID: "evt_2", Type: EventPaymentRefunded, OrderID: order.ID, Reference: "mock_pay_9"}
+	if _, err := store.HandlePaymentEvent(ctx, other); err == nil {
+		t.Error("Expected an event for another payment to be refused")
+	}
+	store.mu.RLock()
+	status := order.Payment.Status
+	store.mu.RUnlock()
+	if status == PaymentRefunded {
+		t.Error("Expected the payment not to be refunded by another payment's event")
+	}
+}
+
+func TestCancelOrderUndoneWhenSaveFails(t *testing.T) {
+	store := openDataStore(t)
+	ctx := context.Background()
+	product, _ := store.GetProduct(2)
+	unpaid, _ := store.CreateOrder(ctx, product, 2)
+	paid, _ := store.CreateOrder(ctx, product, 3)
+	if ok, err := store.authorizeOrder(ctx, paid); !ok || err != nil {
+		t.Fatalf("Expected the payment to go through, got %v", err)
+	}
+	os.MkdirAll(filepath.Join(store.dataDir, ledgerFile+".tmp"), 0o755)
+
+	// Without a refund the order is put back as it was
+	if _, err := store.CancelOrder(ctx, unpaid.ID, 0); err == nil {
+		t.Fatal("Expected the cancellation to fail when the ledger cannot be saved")
+	}
+	if orderStatus(store, unpaid) != OrderPending || product.Stock != 5 || len(store.Ledger(2, MovementReturn, 10)) != 0 {
+		t.Errorf("Expected the cancellation to be undone, got %s with stock %d", orderStatus(store, unpaid), product.Stock)
+	}
+
+	// A refunded order stays cancelled, with its stock not put back
+	if _, err := store.CancelOrder(ctx, paid.ID, 0); err == nil {
+		t.Fatal("Expected the cancellation to fail when the ledger cannot be saved")
+	}
+	if orderStatus(store, paid) != OrderCancelled || paid.Payment.Status != PaymentRefunded || product.Stock != 5 {
+		t.Errorf("Expected a refunded order with its stock unchanged, got %s with stock %d", orderStatus(store, paid), product.Stock)
+	}
+	if len(store.Ledger(2, MovementReturn, 10)) != 0 {
+		t.Error("Expected no return to be recorded")
+	}
+}
+
+// orderStatus reads an order's status while the workers may be changing it
+func orderStatus(store *Store, order *Order) string {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	return order.Status
+}
+
+func TestCancelOrderRefunds(t *testing.T) {
+	store := newTestStore()
+	store.InitializeCatalog()
+	handler := store.Routes("../static")
+	defer store.Close()
+	token := registerCustomer(t, store, "asha@example.com")
+	other := registerCustomer(t, store, "ravi@example.com")
+
+	rec := customerRequest(handler, http.MethodPost, "/api/orders", `{"productId": 2, "quantity": 10}`, token)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected the order to be placed, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := customerRequest(handler, http.MethodPost, "/api/me/orders/1/cancel", "", other); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected another customer's order to be a 404, got %d", rec.Code)
+	}
+
+	rec = customerRequest(handler, http.MethodPost, "/api/me/orders/1/cancel", "", token)
+	var order Order
+	json.NewDecoder(rec.Body).Decode(&order)
+	if rec.Code != http.StatusOK || order.Status != OrderCancelled || order.Payment.Status != PaymentRefunded || order.Payment.RefundID == "" {
+		t.Fatalf("Expected the order to be cancelled and refunded, got %d %+v", rec.Code, order.Payment)
+	}
+	if product, _ := store.GetProduct(2); product.Stock != 10 {
+		t.Errorf("Expected the stock back, got %d", product.Stock)
+	}
+	if rec := customerRequest(handler, http.MethodPost, "/api/me/orders/1/cancel", "", token); rec.Code != http.StatusConflict {
+		t.Errorf("Expected a second cancellation to be refused, got %d", rec.Code)
+	}
+	if rec := customerRequest(handler, http.MethodPost, "/api/orders/1/payment", "", token); rec.Code != http.StatusConflict {
+		t.Errorf("Expected a cancelled order not to be paid for, got %d", rec.Code)
+	}
+}
+
+func TestCancelledOrderIsNotProcessed(t *testing.T) {
+	store := newTestStore()
+	store.InitializeCatalog()
+	ctx := context.Background()
+	product, _ := store.GetProduct(1)
+
+	// An order cancelled while it waits in the queue is left alone by the worker
+	queued, _ := store.CreateOrder(ctx, product, 5)
+	store.mu.Lock()
+	queued.Status = OrderPaid
+	store.mu.Unlock()
+	if _, err := store.CancelOrder(ctx, queued.ID, 0); err != nil {
+		t.Fatal(err)
+	}
+	store.ProcessOrder(queued)
+
+	// A dispatched order cannot be cancelled
+	dispatched, _ := store.CreateOrder(ctx, product, 2)
+	store.PayOrder(ctx, dispatched)
+	store.Close()
+	if queued.Status != OrderCancelled || product.Stock != 98 {
+		t.Errorf("Expected the cancelled order to stay cancelled with its stock back, got %s and %d", queued.Status, product.Stock)
+	}
+	if _, err := store.CancelOrder(ctx, dispatched.ID, 0); !errors.Is(err, ErrOrderDispatched) {
+		t.Errorf("Expected a dispatched order not to be cancelled, got %v", err)
+	}
+	if dispatched.Status != OrderProcessed || dispatched.Payment.Status != PaymentCaptured {
+		t.Errorf("Expected the dispatched order to keep its payment, got %s %+v", dispatched.Status, dispatched.Payment)
+	}
+}
+
+func TestUnpaidOrdersExpire(t *testing.T) {
+	store := newTestStore()
+	store.InitializeCatalog()
+	defer store.Close()
+	ctx := context.Background()
+	mock := store.payments.(*MockProvider)
+	product, _ := store.GetProduct(1)
+
+	mock.SetMode("decline")
+	declined, _ := store.CreateOrder(ctx, product, 5)
+	store.PayOrder(ctx, declined)
+	mock.SetMode("succeed")
+	paid, _ := store.CreateOrder(ctx, product, 2)
+	store.PayOrder(ctx, paid)
+
+	// Within the timeout the declined order keeps its stock for a retry
+	if expired := store.expireUnpaidOrders(ctx, time.Now()); len(expired) != 0 {
+		t.Errorf("Expected nothing to expire yet, got %d orders", len(expired))
+	}
+	expired := store.expireUnpaidOrders(ctx, time.Now().Add(store.pendingTimeout))
+	if len(expired) != 1 || expired[0] != declined || orderStatus(store, declined) != OrderCancelled {
+		t.Fatalf("Expected the declined order to expire, got %+v", expired)
+	}
+	if product.Stock != 98 {
+		t.Errorf("Expected the declined order's stock back, got %d", product.Stock)
+	}
+	if err := store.PayOrder(ctx, declined); !errors.Is(err, ErrOrderCancelled) {
+		t.Errorf("Expected an expired order not to be paid for, got %v", err)
+	}
+
+	// A backorder filled long after it was placed gets the whole timeout
+	// to be paid for from when its stock arrived
+	store.SetBackorderPolicy(2, BackorderPolicy{Limit: 15})
+	laptop, _ := store.GetProduct(2)
+	backorder, _ := store.CreateOrder(ctx, laptop, 12)
+	store.mu.Lock()
+	backorder.CreatedAt = backorder.CreatedAt.Add(-48 * time.Hour)
+	store.mu.Unlock()
+	if _, err := store.AdjustStock(ctx, 2, 0, 2, MovementRestock, "", 0); err != nil {
+		t.Fatal(err)
+	}
+	if status := orderStatus(store, backorder); status != OrderPending {
+		t.Fatalf("Expected the backorder to be filled, got %s", status)
+	}
+	if expired := store.expireUnpaidOrders(ctx, time.Now().Add(time.Minute)); len(expired) != 0 {
+		t.Errorf("Expected the filled backorder not to expire yet, got %d orders", len(expired))
+	}
+	if expired := store.expireUnpaidOrders(ctx, time.Now().Add(store.pendingTimeout)); len(expired) != 1 || expired[0] != backorder {
+		t.Errorf("Expected the filled backorder to expire after the timeout, got %+v", expired)
+	}
+}
+
+func TestFailedCheckoutIsUndone(t *testing.T) {
+	store := newTestStore()
+	store.InitializeCatalog()
+	handler := store.Routes("../static")
+	defer store.Close()
+
+	// The laptops run out, so the apples bought before them are given back
+	rec := customerRequest(handler, http.MethodPost, "/api/checkout", `[{"product": {"id": 1}, "quantity": 3}, {"product": {"id": 2}, "quantity": 11}]`, "")
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("Expected the checkout to fail, got %d: %s", rec.Code, rec.Body.String())
+	}
+	apples, err := store.GetOrder(1)
+	if err != nil || orderStatus(store, apples) != OrderCancelled || apples.Payment.Status != PaymentRefunded {
+		t.Fatalf("Expected the apples to be cancelled and refunded, got %+v, %v", apples, err)
+	}
+	if product, _ := store.GetProduct(1); product.Stock != 100 {
+		t.Errorf("Expected the apples back in stock, got %d", product.Stock)
+	}
+}
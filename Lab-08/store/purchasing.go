@@ -0,0 +1,595 @@
+package store
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"maps"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Purchase order states. An order stays open until goods arrive against
+// it, and is received once every line has arrived in full.
+const (
+	PurchaseOrderOpen              = "open"
+	PurchaseOrderPartiallyReceived = "partially_received"
+	PurchaseOrderReceived          = "received"
+	PurchaseOrderCancelled         = "cancelled"
+)
+
+// Supplier is who purchase orders are placed with
+type Supplier struct {
+	ID           int       `json:"id"`
+	Name         string    `json:"name"`
+	Email        string    `json:"email,omitempty"`
+	Phone        string    `json:"phone,omitempty"`
+	LeadTimeDays int       `json:"leadTimeDays,omitempty"` // defaults purchase orders' expected date
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+// PurchaseOrder is stock ordered from a supplier, delivered to one location
+type PurchaseOrder struct {
+	ID         int                 `json:"id"`
+	SupplierID int                 `json:"supplierId"`
+	LocationID int                 `json:"locationId"`
+	Status     string              `json:"status"`
+	Lines      []PurchaseOrderLine `json:"lines"`
+	ExpectedAt time.Time           `json:"expectedAt"`
+	Note       string              `json:"note,omitempty"`
+	CreatedBy  string              `json:"createdBy"`
+	CreatedAt  time.Time           `json:"createdAt"`
+	Receipts   []GoodsReceipt      `json:"receipts"`
+	ClosedAt   *time.Time          `json:"closedAt,omitempty"` // when it was received in full or cancelled
+}
+
+// PurchaseOrderLine is one product on a purchase order
+type PurchaseOrderLine struct {
+	ProductID int     `json:"productId"`
+	Quantity  int     `json:"quantity"`
+	Received  int     `json:"received"`
+	UnitCost  float64 `json:"unitCost,omitempty"`
+}
+
+// GoodsReceipt is a delivery against a purchase order
+type GoodsReceipt struct {
+	ID         int           `json:"id"` // numbered within the purchase order
+	Lines      []ReceiptLine `json:"lines"`
+	Note       string        `json:"note,omitempty"`
+	ReceivedBy string        `json:"receivedBy"`
+	ReceivedAt time.Time     `json:"receivedAt"`
+}
+
+// ReceiptLine is how much of a product arrived
+type ReceiptLine struct {
+	ProductID int `json:"productId"`
+	Quantity  int `json:"quantity"`
+}
+
+// OpenPurchaseOrder is a purchase order still waiting for goods
+type OpenPurchaseOrder struct {
+	ID          int                 `json:"id"`
+	SupplierID  int                 `json:"supplierId"`
+	Supplier    string              `json:"supplier"`
+	Status      string              `json:"status"`
+	ExpectedAt  time.Time           `json:"expectedAt"`
+	Overdue     bool                `json:"overdue"`
+	Outstanding int                 `json:"outstanding"` // units still to arrive
+	Lines       []PurchaseOrderLine `json:"lines"`
+}
+
+// SupplierFillRate is how much of what was ordered from a supplier arrived.
+// Only purchase orders that are closed or past their expected date count,
+// so orders still on their way do not lower it.
+type SupplierFillRate struct {
+	SupplierID     int      `json:"supplierId"`
+	Name           string   `json:"name"`
+	PurchaseOrders int      `json:"purchaseOrders"`
+	Open           int      `json:"open"`
+	UnitsOrdered   int      `json:"unitsOrdered"`
+	UnitsReceived  int      `json:"unitsReceived"`
+	FillRate       *float64 `json:"fillRate,omitempty"` // percent; missing when nothing is due yet
+}
+
+// PurchasingReport lists open purchase orders, soonest expected first, and
+// every supplier's fill rate
+type PurchasingReport struct {
+	GeneratedAt time.Time           `json:"generatedAt"`
+	Open        []OpenPurchaseOrder `json:"openPurchaseOrders"`
+	Suppliers   []SupplierFillRate  `json:"suppliers"`
+}
+
+// saveSuppliers persists the suppliers. The caller must hold s.mu.
+func (s *Store) saveSuppliers() error {
+	return s.writeJSONFile(suppliersFile, s.suppliers)
+}
+
+// savePurchaseOrders persists the purchase orders. The caller must hold s.mu.
+func (s *Store) savePurchaseOrders() error {
+	return s.writeJSONFile(purchaseOrdersFile, s.purchaseOrders)
+}
+
+// supplier returns a supplier by its ID, or nil. The caller must hold s.mu.
+func (s *Store) supplier(id int) *Supplier {
+	if id < 1 || id > len(s.suppliers) {
+		return nil
+	}
+	return s.suppliers[id-1]
+}
+
+// Suppliers returns every supplier in ID order
+func (s *Store) Suppliers() []Supplier {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	suppliers := make([]Supplier, len(s.suppliers))
+	for i, supplier := range s.suppliers {
+		suppliers[i] = *supplier
+	}
+	return suppliers
+}
+
+// CreateSupplier adds a supplier. Names must be unique, ignoring case.
+func (s *Store) CreateSupplier(ctx context.Context, supplier Supplier) (*Supplier, error) {
+	supplier.Name = strings.TrimSpace(supplier.Name)
+	var problems []string
+	if supplier.Name == "" {
+		problems = append(problems, "name is required")
+	}
+	if supplier.LeadTimeDays < 0 {
+		problems = append(problems, "leadTimeDays cannot be negative")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, other := range s.suppliers {
+		if supplier.Name != "" && strings.EqualFold(other.Name, supplier.Name) {
+			problems = append(problems, fmt.Sprintf("name %q is already used by supplier %d", supplier.Name, other.ID))
+		}
+	}
+	if len(problems) > 0 {
+		return nil, invalidRequest("invalid supplier: %s", strings.Join(problems, "; "))
+	}
+	supplier.ID = len(s.suppliers) + 1
+	supplier.CreatedAt = time.Now()
+	s.suppliers = append(s.suppliers, &supplier)
+	if err := s.saveSuppliers(); err != nil {
+		s.suppliers = s.suppliers[:len(s.suppliers)-1]
+		return nil, err
+	}
+	s.log(ctx).Info("supplier created", "supplierId", supplier.ID, "name", supplier.Name)
+	copied := supplier
+	return &copied, nil
+}
+
+// copyPurchaseOrder returns a copy of a purchase order that is safe to use
+// without s.mu. The caller must hold s.mu.
+func copyPurchaseOrder(po *PurchaseOrder) *PurchaseOrder {
+	copied := *po
+	copied.Lines = slices.Clone(po.Lines)
+	copied.Receipts = slices.Clone(po.Receipts)
+	return &copied
+}
+
+// PurchaseOrders returns the purchase orders in ID order, optionally only
+// those in one state or from one supplier
+func (s *Store) PurchaseOrders(status string, supplierID int) []*PurchaseOrder {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	orders := []*PurchaseOrder{}
+	for _, po := range s.purchaseOrders {
+		if (status == "" || po.Status == status) && (supplierID == 0 || po.SupplierID == supplierID) {
+			orders = append(orders, copyPurchaseOrder(po))
+		}
+	}
+	return orders
+}
+
+// PurchaseOrder returns a purchase order by its ID
+func (s *Store) PurchaseOrder(id int) (*PurchaseOrder, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if id < 1 || id > len(s.purchaseOrders) {
+		return nil, ErrPurchaseOrderNotFound
+	}
+	return copyPurchaseOrder(s.purchaseOrders[id-1]), nil
+}
+
+// CreatePurchaseOrder places a purchase order with a supplier. Goods go to
+// the default location unless it names another, and without an expected
+// date they are expected after the supplier's lead time, or the store's.
+func (s *Store) CreatePurchaseOrder(ctx context.Context, po PurchaseOrder) (*PurchaseOrder, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	supplier := s.supplier(po.SupplierID)
+	if supplier == nil {
+		return nil, ErrSupplierNotFound
+	}
+	if po.LocationID == 0 {
+		po.LocationID = defaultLocationID
+	}
+	if s.location(po.LocationID) == nil {
+		return nil, ErrLocationNotFound
+	}
+	var problems []string
+	if len(po.Lines) == 0 {
+		problems = append(problems, "at least one line is required")
+	}
+	seen := make(map[int]bool)
+	for i, line := range po.Lines {
+		switch {
+		case s.catalog[line.ProductID] == nil:
+			problems = append(problems, fmt.Sprintf("line %d: product %d not found", i+1, line.ProductID))
+		case seen[line.ProductID]:
+			problems = append(problems, fmt.Sprintf("line %d: product %d is already on the order", i+1, line.ProductID))
+		case line.Quantity <= 0:
+			problems = append(problems, fmt.Sprintf("line %d: quantity must be positive", i+1))
+		case line.UnitCost < 0:
+			problems = append(problems, fmt.Sprintf("line %d: unitCost cannot be negative", i+1))
+		}
+		seen[line.ProductID] = true
+		po.Lines[i].Received = 0
+	}
+	if len(problems) > 0 {
+		return nil, invalidRequest("invalid purchase order: %s", strings.Join(problems, "; "))
+	}
+
+	now := time.Now()
+	if po.ExpectedAt.IsZero() {
+		leadTime := cmp.Or(supplier.LeadTimeDays, s.leadTimeDays)
+		po.ExpectedAt = now.AddDate(0, 0, leadTime)
+	}
+	po.ID = len(s.purchaseOrders) + 1
+	po.Status = PurchaseOrderOpen
+	po.CreatedBy = actor(ctx)
+	po.CreatedAt = now
+	po.Receipts = []GoodsReceipt{}
+	po.ClosedAt = nil
+	s.purchaseOrders = append(s.purchaseOrders, &po)
+	if err := s.savePurchaseOrders(); err != nil {
+		s.purchaseOrders = s.purchaseOrders[:len(s.purchaseOrders)-1]
+		return nil, err
+	}
+	s.log(ctx).Info("purchase order created", "purchaseOrderId", po.ID, "supplierId", po.SupplierID,
+		"lines", len(po.Lines), "expectedAt", po.ExpectedAt)
+	return copyPurchaseOrder(&po), nil
+}
+
+// ReceiveGoods records a delivery against a purchase order. The goods are
+// added to the order's location as restocks in the inventory ledger, and
+// fill any backorders waiting on them. A product may not arrive in greater
+// quantity than is still outstanding on its line. The order is received
+// once every line has arrived in full.
+func (s *Store) ReceiveGoods(ctx context.Context, id int, lines []ReceiptLine, note string) (*PurchaseOrder, error) {
+	s.mu.Lock()
+	if id < 1 || id > len(s.purchaseOrders) {
+		s.mu.Unlock()
+		return nil, ErrPurchaseOrderNotFound
+	}
+	po := s.purchaseOrders[id-1]
+	if po.Status == PurchaseOrderReceived || po.Status == PurchaseOrderCancelled {
+		s.mu.Unlock()
+		return nil, ErrPurchaseOrderClosed
+	}
+	var problems []string
+	if len(lines) == 0 {
+		problems = append(problems, "at least one line is required")
+	}
+	arriving := make(map[int]int)
+	for i, line := range lines {
+		index := slices.IndexFunc(po.Lines, func(l PurchaseOrderLine) bool { return l.ProductID == line.ProductID })
+		switch {
+		case index < 0:
+			problems = append(problems, fmt.Sprintf("line %d: product %d is not on the order", i+1, line.ProductID))
+		case line.Quantity <= 0:
+			problems = append(problems, fmt.Sprintf("line %d: quantity must be positive", i+1))
+		case s.catalog[line.ProductID] == nil:
+			problems = append(problems, fmt.Sprintf("line %d: product %d is no longer in the catalog", i+1, line.ProductID))
+		default:
+			arriving[line.ProductID] += line.Quantity
+			if outstanding := po.Lines[index].Quantity - po.Lines[index].Received; arriving[line.ProductID] > outstanding {
+				problems = append(problems, fmt.Sprintf("line %d: only %d of product %d are outstanding", i+1, outstanding, line.ProductID))
+			}
+		}
+	}
+	if len(problems) > 0 {
+		s.mu.Unlock()
+		return nil, invalidRequest("invalid goods receipt: %s", strings.Join(problems, "; "))
+	}
+
+	// Take the goods into stock at the order's location, in line order. If
+	// anything fails to save, the purchase order and the stock are put back
+	// so the delivery can be recorded again.
+	now, by := time.Now(), actor(ctx)
+	location := s.location(po.LocationID)
+	before := copyPurchaseOrder(po)
+	snapshot := s.snapshotStock(slices.Collect(maps.Keys(arriving))...)
+	previousStock := make(map[int]int)
+	for i := range po.Lines {
+		line := &po.Lines[i]
+		quantity := arriving[line.ProductID]
+		if quantity == 0 {
+			continue
+		}
+		product := s.catalog[line.ProductID]
+		previousStock[product.ID] = product.Stock
+		line.Received += quantity
+		product.Stock += quantity
+		s.setLocationStock(location, product.ID, location.Stock[product.ID]+quantity)
+		movement := s.recordMovement(product, quantity, MovementRestock, note, by, 0)
+		movement.LocationID, movement.PurchaseOrderID = location.ID, po.ID
+	}
+	po.Receipts = append(po.Receipts, GoodsReceipt{
+		ID:         len(po.Receipts) + 1,
+		Lines:      slices.Clone(lines),
+		Note:       note,
+		ReceivedBy: by,
+		ReceivedAt: now,
+	})
+	po.Status = PurchaseOrderReceived
+	for _, line := range po.Lines {
+		if line.Received < line.Quantity {
+			po.Status = PurchaseOrderPartiallyReceived
+		}
+	}
+	if po.Status == PurchaseOrderReceived {
+		po.ClosedAt = &now
+	}
+	if err := s.savePurchaseOrders(); err != nil {
+		*po = *before
+		s.restoreStock(snapshot)
+		s.mu.Unlock()
+		return nil, err
+	}
+	if err := s.saveInventory(snapshot); err != nil {
+		*po = *before
+		if saveErr := s.savePurchaseOrders(); saveErr != nil {
+			s.log(ctx).Error("error undoing goods receipt", "purchaseOrderId", id, "error", saveErr)
+		}
+		s.mu.Unlock()
+		return nil, err
+	}
+
+	// The new stock goes to waiting backorders first; customers with a
+	// product on their wishlist hear about what is left
+	var filled []*Order
+	var err error
+	restocked := make(map[int]string)
+	for _, line := range po.Lines {
+		previous, ok := previousStock[line.ProductID]
+		if !ok {
+			continue
+		}
+		product := s.catalog[line.ProductID]
+		s.productChanged(product, previous)
+		if err == nil {
+			var orders []*Order
+			orders, err = s.fillBackorders(product.ID)
+			filled = append(filled, orders...)
+		}
+		if previous == 0 && product.Stock > 0 {
+			restocked[product.ID] = product.Name
+		}
+	}
+	received := copyPurchaseOrder(po)
+	s.mu.Unlock()
+
+	s.log(ctx).Info("goods received", "purchaseOrderId", id, "units", sumReceipt(lines), "status", received.Status)
+	s.backordersFilled(ctx, filled)
+	for productID, name := range restocked {
+		s.notifyBackInStock(productID, name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return received, nil
+}
+
+// sumReceipt adds up the units in a goods receipt
+func sumReceipt(lines []ReceiptLine) int {
+	units := 0
+	for _, line := range lines {
+		units += line.Quantity
+	}
+	return units
+}
+
+// CancelPurchaseOrder closes a purchase order that is still waiting for
+// goods. What already arrived stays in stock; what is outstanding counts
+// against the supplier's fill rate.
+func (s *Store) CancelPurchaseOrder(ctx context.Context, id int) (*PurchaseOrder, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if id < 1 || id > len(s.purchaseOrders) {
+		return nil, ErrPurchaseOrderNotFound
+	}
+	po := s.purchaseOrders[id-1]
+	if po.Status == PurchaseOrderReceived || po.Status == PurchaseOrderCancelled {
+		return nil, ErrPurchaseOrderClosed
+	}
+	previous := po.Status
+	now := time.Now()
+	po.Status, po.ClosedAt = PurchaseOrderCancelled, &now
+	if err := s.savePurchaseOrders(); err != nil {
+		po.Status, po.ClosedAt = previous, nil
+		return nil, err
+	}
+	s.log(ctx).Info("purchase order cancelled", "purchaseOrderId", id)
+	return copyPurchaseOrder(po), nil
+}
+
+// PurchasingReport lists the purchase orders still waiting for goods,
+// soonest expected first, and each supplier's fill rate: the share of the
+// units ordered that arrived, over purchase orders that are closed or past
+// their expected date
+func (s *Store) PurchasingReport(now time.Time) *PurchasingReport {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	report := &PurchasingReport{GeneratedAt: now, Open: []OpenPurchaseOrder{}, Suppliers: []SupplierFillRate{}}
+	rates := make([]SupplierFillRate, len(s.suppliers))
+	for i, supplier := range s.suppliers {
+		rates[i] = SupplierFillRate{SupplierID: supplier.ID, Name: supplier.Name}
+	}
+	for _, po := range s.purchaseOrders {
+		rate := &rates[po.SupplierID-1]
+		rate.PurchaseOrders++
+		open := po.Status == PurchaseOrderOpen || po.Status == PurchaseOrderPartiallyReceived
+		if open {
+			rate.Open++
+			line := OpenPurchaseOrder{
+				ID:         po.ID,
+				SupplierID: po.SupplierID,
+				Supplier:   rate.Name,
+				Status:     po.Status,
+				ExpectedAt: po.ExpectedAt,
+				Overdue:    now.After(po.ExpectedAt),
+				Lines:      slices.Clone(po.Lines),
+			}
+			for _, l := range po.Lines {
+				line.Outstanding += l.Quantity - l.Received
+			}
+			report.Open = append(report.Open, line)
+		}
+		if open && !now.After(po.ExpectedAt) {
+			continue
+		}
+		for _, l := range po.Lines {
+			rate.UnitsOrdered += l.Quantity
+			rate.UnitsReceived += l.Received
+		}
+	}
+	for _, rate := range rates {
+		if rate.UnitsOrdered > 0 {
+			fillRate := math.Round(float64(rate.UnitsReceived)/float64(rate.UnitsOrdered)*1000) / 10
+			rate.FillRate = &fillRate
+		}
+		report.Suppliers = append(report.Suppliers, rate)
+	}
+	slices.SortStableFunc(report.Open, func(a, b OpenPurchaseOrder) int {
+		return a.ExpectedAt.Compare(b.ExpectedAt)
+	})
+	return report
+}
+
+// handleListSuppliers serves GET /api/inventory/suppliers
+func (s *Store) handleListSuppliers(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.Suppliers())
+}
+
+// handleCreateSupplier serves POST /api/inventory/suppliers
+func (s *Store) handleCreateSupplier(w http.ResponseWriter, r *http.Request) {
+	var request Supplier
+	if err := decodeJSON(r, &request); err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	supplier, err := s.CreateSupplier(r.Context(), request)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, supplier)
+}
+
+// handleListPurchaseOrders serves GET /api/inventory/purchase-orders?status=&supplierId=
+func (s *Store) handleListPurchaseOrders(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	status := query.Get("status")
+	statuses := []string{PurchaseOrderOpen, PurchaseOrderPartiallyReceived, PurchaseOrderReceived, PurchaseOrderCancelled}
+	if status != "" && !slices.Contains(statuses, status) {
+		s.writeError(w, r, invalidRequest("unknown status %q, expected one of %s", status, strings.Join(statuses, ", ")))
+		return
+	}
+	supplierID := 0
+	if value := query.Get("supplierId"); value != "" {
+		id, err := strconv.Atoi(value)
+		if err != nil || id < 1 {
+			s.writeError(w, r, invalidRequest("invalid supplierId"))
+			return
+		}
+		supplierID = id
+	}
+	writeJSON(w, http.StatusOK, s.PurchaseOrders(status, supplierID))
+}
+
+// handleCreatePurchaseOrder serves POST /api/inventory/purchase-orders
+func (s *Store) handleCreatePurchaseOrder(w http.ResponseWriter, r *http.Request) {
+	var request PurchaseOrder
+	if err := decodeJSON(r, &request); err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	po, err := s.CreatePurchaseOrder(r.Context(), request)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, po)
+}
+
+// handleGetPurchaseOrder serves GET /api/inventory/purchase-orders/{id}
+func (s *Store) handleGetPurchaseOrder(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "id", "purchase order")
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	po, err := s.PurchaseOrder(id)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, po)
+}
+
+// handleReceiveGoods serves POST /api/inventory/purchase-orders/{id}/receipts
+func (s *Store) handleReceiveGoods(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "id", "purchase order")
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	var request struct {
+		Lines []ReceiptLine `json:"lines"`
+		Note  string        `json:"note"`
+	}
+	if err := decodeJSON(r, &request); err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	po, err := s.ReceiveGoods(r.Context(), id, request.Lines, request.Note)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, po)
+}
+
+// handleCancelPurchaseOrder serves POST /api/inventory/purchase-orders/{id}/cancel
+func (s *Store) handleCancelPurchaseOrder(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "id", "purchase order")
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	po, err := s.CancelPurchaseOrder(r.Context(), id)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, po)
+}
+
+// handlePurchasingReport serves GET /api/reports/purchasing
+func (s *Store) handlePurchasingReport(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.PurchasingReport(time.Now()))
+}
@@ -0,0 +1,190 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"example.com/lab-08/config"
+)
+
+func TestPurchaseOrders(t *testing.T) {
+	store := newTestStore()
+	store.InitializeCatalog()
+	defer store.Close()
+	ctx := context.Background()
+
+	supplier, err := store.CreateSupplier(ctx, Supplier{Name: "Fresh Farms", LeadTimeDays: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.CreateSupplier(ctx, Supplier{Name: "FRESH FARMS"}); err == nil {
+		t.Error("Expected a duplicate supplier name to be refused")
+	}
+	if _, err := store.CreatePurchaseOrder(ctx, PurchaseOrder{SupplierID: 9, Lines: []PurchaseOrderLine{{ProductID: 1, Quantity: 1}}}); !errors.Is(err, ErrSupplierNotFound) {
+		t.Errorf("Expected an unknown supplier to be refused, got %v", err)
+	}
+	po, err := store.CreatePurchaseOrder(ctx, PurchaseOrder{
+		SupplierID: supplier.ID,
+		Lines:      []PurchaseOrderLine{{ProductID: 1, Quantity: 40}, {ProductID: 2, Quantity: 6, UnitCost: 52000}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if po.Status != PurchaseOrderOpen || po.LocationID != defaultLocationID || po.ExpectedAt.Sub(po.CreatedAt) != 4*24*time.Hour {
+		t.Errorf("Expected an open order due after the supplier's lead time, got %+v", po)
+	}
+
+	// Only what is outstanding can arrive
+	if _, err := store.ReceiveGoods(ctx, po.ID, []ReceiptLine{{ProductID: 1, Quantity: 41}}, ""); err == nil {
+		t.Error("Expected receiving more than was ordered to be refused")
+	}
+	if _, err := store.ReceiveGoods(ctx, po.ID, []ReceiptLine{{ProductID: 3, Quantity: 1}}, ""); err == nil {
+		t.Error("Expected a product not on the order to be refused")
+	}
+
+	// Laptops waiting on backorder are filled by the delivery
+	if _, err := store.SetBackorderPolicy(2, BackorderPolicy{Limit: 15}); err != nil {
+		t.Fatal(err)
+	}
+	laptop, _ := store.GetProduct(2)
+	backorder, _ := store.CreateOrder(ctx, laptop, 12)
+
+	po, err = store.ReceiveGoods(ctx, po.ID, []ReceiptLine{{ProductID: 1, Quantity: 25}, {ProductID: 2, Quantity: 6}}, "first truck")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if po.Status != PurchaseOrderPartiallyReceived || po.Lines[0].Received != 25 || len(po.Receipts) != 1 {
+		t.Errorf("Expected the order to be partially received, got %+v", po)
+	}
+	apple, _ := store.GetProduct(1)
+	if apple.Stock != 125 || laptop.Stock != 4 {
+		t.Errorf("Expected 125 apples and 4 laptops left after the backorder, got %d and %d", apple.Stock, laptop.Stock)
+	}
+	if len(store.Backorders(2)) != 0 || backorder.Allocations == nil {
+		t.Error("Expected the backorder to be filled from the delivery")
+	}
+	restocks := store.Ledger(1, MovementRestock, 1)
+	if len(restocks) != 1 || restocks[0].Delta != 25 || restocks[0].PurchaseOrderID != po.ID || restocks[0].LocationID != defaultLocationID {
+		t.Errorf("Expected the delivery in the ledger, got %+v", restocks)
+	}
+
+	po, err = store.ReceiveGoods(ctx, po.ID, []ReceiptLine{{ProductID: 1, Quantity: 15}}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if po.Status != PurchaseOrderReceived || po.ClosedAt == nil || apple.Stock != 140 {
+		t.Errorf("Expected the order to be received in full, got %s with %d apples", po.Status, apple.Stock)
+	}
+	if _, err := store.ReceiveGoods(ctx, po.ID, []ReceiptLine{{ProductID: 1, Quantity: 1}}, ""); !errors.Is(err, ErrPurchaseOrderClosed) {
+		t.Errorf("Expected a received order to take no more goods, got %v", err)
+	}
+	if drift, _ := store.ReconcileStock(ctx, false); drift.Drifted != 0 {
+		t.Errorf("Expected receipts to keep stock and the ledger in step, got %+v", drift)
+	}
+
+	// A late order that only half arrived pulls the fill rate down; one
+	// still on its way does not count yet
+	late, _ := store.CreatePurchaseOrder(ctx, PurchaseOrder{
+		SupplierID: supplier.ID,
+		Lines:      []PurchaseOrderLine{{ProductID: 3, Quantity: 20}},
+		ExpectedAt: time.Now().AddDate(0, 0, -2),
+	})
+	store.ReceiveGoods(ctx, late.ID, []ReceiptLine{{ProductID: 3, Quantity: 10}}, "")
+	store.CreatePurchaseOrder(ctx, PurchaseOrder{SupplierID: supplier.ID, Lines: []PurchaseOrderLine{{ProductID: 3, Quantity: 50}}})
+
+	report := store.PurchasingReport(time.Now())
+	if len(report.Open) != 2 || report.Open[0].ID != late.ID || !report.Open[0].Overdue || report.Open[0].Outstanding != 10 || report.Open[1].Overdue {
+		t.Errorf("Expected the late order first and overdue, got %+v", report.Open)
+	}
+	rate := report.Suppliers[0]
+	if rate.PurchaseOrders != 3 || rate.Open != 2 || rate.UnitsOrdered != 66 || rate.UnitsReceived != 56 || rate.FillRate == nil || *rate.FillRate != 84.8 {
+		t.Errorf("Expected a fill rate of 56 of 66 units, got %+v", rate)
+	}
+
+	if _, err := store.CancelPurchaseOrder(ctx, late.ID); err != nil {
+		t.Fatal(err)
+	}
+	if orders := store.PurchaseOrders(PurchaseOrderOpen, 0); len(orders) != 1 {
+		t.Errorf("Expected one open order after cancelling, got %d", len(orders))
+	}
+}
+
+func TestPurchaseOrdersPersist(t *testing.T) {
+	dir := t.TempDir()
+	data, _ := os.ReadFile(testCatalog)
+	cfg := config.Default()
+	cfg.Store.CatalogFile = filepath.Join(dir, "products.json")
+	cfg.Store.DataDir = filepath.Join(dir, "data")
+	os.WriteFile(cfg.Store.CatalogFile, data, 0o644)
+
+	first, err := Open(cfg)
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	ctx := context.Background()
+	supplier, _ := first.CreateSupplier(ctx, Supplier{Name: "Tech Distributors"})
+	po, _ := first.CreatePurchaseOrder(ctx, PurchaseOrder{SupplierID: supplier.ID, Lines: []PurchaseOrderLine{{ProductID: 2, Quantity: 5}}})
+	if _, err := first.ReceiveGoods(ctx, po.ID, []ReceiptLine{{ProductID: 2, Quantity: 2}}, ""); err != nil {
+		t.Fatal(err)
+	}
+	first.Close()
+
+	second, err := Open(cfg)
+	if err != nil {
+		t.Fatalf("Failed to reopen store: %v", err)
+	}
+	defer second.Close()
+	loaded, err := second.PurchaseOrder(po.ID)
+	if err != nil || loaded.Status != PurchaseOrderPartiallyReceived || loaded.Lines[0].Received != 2 || len(loaded.Receipts) != 1 {
+		t.Errorf("Expected the partial receipt to be kept, got %+v, %v", loaded, err)
+	}
+	if laptop, _ := second.GetProduct(2); laptop.Stock != 12 {
+		t.Errorf("Expected 12 laptops after reopening, got %d", laptop.Stock)
+	}
+	if suppliers := second.Suppliers(); len(suppliers) != 1 || suppliers[0].Name != "Tech Distributors" {
+		t.Errorf("Expected the supplier to be kept, got %+v", suppliers)
+	}
+}
+
+func TestGoodsReceiptUndoneWhenSaveFails(t *testing.T) {
+	dir := t.TempDir()
+	data, _ := os.ReadFile(testCatalog)
+	cfg := config.Default()
+	cfg.Store.CatalogFile = filepath.Join(dir, "products.json")
+	cfg.Store.DataDir = filepath.Join(dir, "data")
+	os.WriteFile(cfg.Store.CatalogFile, data, 0o644)
+
+	store, err := Open(cfg)
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	defer store.Close()
+	ctx := context.Background()
+	supplier, _ := store.CreateSupplier(ctx, Supplier{Name: "Tech Distributors"})
+	po, _ := store.CreatePurchaseOrder(ctx, PurchaseOrder{SupplierID: supplier.ID, Lines: []PurchaseOrderLine{{ProductID: 2, Quantity: 5}}})
+
+	// A directory in the way of the ledger's temporary file fails its save
+	blocker := filepath.Join(cfg.Store.DataDir, ledgerFile+".tmp")
+	os.MkdirAll(blocker, 0o755)
+	if _, err := store.ReceiveGoods(ctx, po.ID, []ReceiptLine{{ProductID: 2, Quantity: 5}}, ""); err == nil {
+		t.Fatal("Expected the receipt to fail when the ledger cannot be saved")
+	}
+	laptop, _ := store.GetProduct(2)
+	loaded, _ := store.PurchaseOrder(po.ID)
+	if laptop.Stock != 10 || loaded.Status != PurchaseOrderOpen || loaded.Lines[0].Received != 0 || len(loaded.Receipts) != 0 {
+		t.Errorf("Expected the receipt to be undone, got stock %d and %+v", laptop.Stock, loaded)
+	}
+
+	// Once the ledger can be saved the same delivery goes through
+	os.Remove(blocker)
+	if po, err := store.ReceiveGoods(ctx, po.ID, []ReceiptLine{{ProductID: 2, Quantity: 5}}, ""); err != nil || po.Status != PurchaseOrderReceived {
+		t.Fatalf("Expected the retried receipt to go through, got %+v, %v", po, err)
+	}
+	if laptop.Stock != 15 {
+		t.Errorf("Expected 15 laptops, got %d", laptop.Stock)
+	}
+}
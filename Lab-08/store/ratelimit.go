@@ -0,0 +1,259 @@
+package store
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"example.com/lab-08/config"
+)
+
+// APIKeyHeader carries the API key a client identifies itself with
+const APIKeyHeader = "X-API-Key"
+
+// tokenBucket holds the requests a client may still make on a route. It
+// refills continuously at the route's rate, up to its burst.
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// rateRule is the limit on one route
+type rateRule struct {
+	rate  float64 // tokens added per second
+	burst float64
+	limit string // as configured, e.g. "30/m"
+}
+
+// bucketKey identifies one client's bucket on one route
+type bucketKey struct {
+	route  string // method and pattern, e.g. "POST /api/orders"
+	client string // "user:<id>", "customer:<id>" or "ip:<address>"
+}
+
+// rateLimiter keeps a token bucket per client and route. A signed in staff
+// user or customer is one client wherever they call from, whether with an
+// API key or a session; anonymous requests are charged to the client IP.
+type rateLimiter struct {
+	rules      map[string]rateRule
+	allowIPs   []netip.Prefix
+	allowKeys  map[string]bool
+	trustProxy bool
+	proxies    []netip.Prefix // further trusted proxies behind the first
+	now        func() time.Time
+
+	mu      sync.Mutex
+	buckets map[bucketKey]*tokenBucket
+	stop    chan struct{}
+}
+
+// newRateLimiter creates a limiter from the configuration and starts
+// forgetting idle clients in the background. It returns nil when rate
+// limiting is disabled.
+func newRateLimiter(cfg config.RateLimitConfig) *rateLimiter {
+	if !cfg.Enabled {
+		return nil
+	}
+	l := &rateLimiter{
+		rules:      make(map[string]rateRule),
+		allowKeys:  make(map[string]bool),
+		trustProxy: cfg.TrustProxy,
+		now:        time.Now,
+		buckets:    make(map[bucketKey]*tokenBucket),
+		stop:       make(chan struct{}),
+	}
+	// The rules and proxies were checked when the configuration was validated
+	rules, _ := cfg.Rules()
+	l.proxies, _ = cfg.Proxies()
+	for _, rule := range rules {
+		l.rules[rule.Method+" "+rule.Pattern] = rateRule{
+			rate:  float64(rule.Requests) / rule.Per.Seconds(),
+			burst: float64(rule.Burst),
+			limit: rule.Rate,
+		}
+	}
+	for _, entry := range splitList(cfg.Allowlist) {
+		if prefix, err := netip.ParsePrefix(entry); err == nil {
+			l.allowIPs = append(l.allowIPs, prefix.Masked())
+		} else if addr, err := netip.ParseAddr(entry); err == nil {
+			l.allowIPs = append(l.allowIPs, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+		} else {
+			l.allowKeys[entry] = true
+		}
+	}
+	go l.cleanupEvery(time.Duration(cfg.CleanupInterval))
+	return l
+}
+
+// close stops the background cleanup
+func (l *rateLimiter) close() {
+	close(l.stop)
+}
+
+// cleanupEvery forgets idle clients every interval until the limiter is closed
+func (l *rateLimiter) cleanupEvery(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			l.cleanup()
+		case <-l.stop:
+			return
+		}
+	}
+}
+
+// cleanup forgets buckets that have refilled, since a new bucket would
+// start full anyway, and returns how many are left
+func (l *rateLimiter) cleanup() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	for key, bucket := range l.buckets {
+		rule := l.rules[key.route]
+		if bucket.tokens+now.Sub(bucket.last).Seconds()*rule.rate >= rule.burst {
+			delete(l.buckets, key)
+		}
+	}
+	return len(l.buckets)
+}
+
+// clientIP returns the address the request came from. Behind a trusted proxy
+// it is the right-most X-Forwarded-For entry that is not another trusted
+// proxy: every entry left of it was sent by the client, which can make them up.
+func (l *rateLimiter) clientIP(r *http.Request) string {
+	host := r.RemoteAddr
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if l.trustProxy {
+		var hops []string
+		for _, value := range r.Header.Values("X-Forwarded-For") {
+			hops = append(hops, strings.Split(value, ",")...)
+		}
+		for i := len(hops) - 1; i >= 0; i-- {
+			addr, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+			if err != nil {
+				break
+			}
+			host = addr.Unmap().String()
+			if !l.trustedProxy(addr.Unmap()) {
+				break
+			}
+		}
+	}
+	if addr, err := netip.ParseAddr(host); err == nil {
+		return addr.Unmap().String()
+	}
+	return host
+}
+
+// trustedProxy reports whether addr is one of the further trusted proxies
+func (l *rateLimiter) trustedProxy(addr netip.Addr) bool {
+	for _, prefix := range l.proxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowlisted reports whether the client IP or API key is never limited
+func (l *rateLimiter) allowlisted(ip, key string) bool {
+	if key != "" && l.allowKeys[key] {
+		return true
+	}
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	for _, prefix := range l.allowIPs {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// client returns the bucket a request is charged to and its API key, if it
+// was authenticated with one. It needs the request to have passed withAuth,
+// so a key or session that does not authenticate counts as anonymous.
+func (l *rateLimiter) client(r *http.Request) (string, string) {
+	if user := UserFromContext(r.Context()); user != nil {
+		return "user:" + strconv.Itoa(user.ID), r.Header.Get(APIKeyHeader)
+	}
+	if customer := CustomerFromContext(r.Context()); customer != nil {
+		return "customer:" + strconv.Itoa(customer.ID), ""
+	}
+	return "ip:" + l.clientIP(r), ""
+}
+
+// take charges a request on route to the client's bucket. If it is empty
+// nothing is charged, and take returns the route's rule and how long until
+// the request would be allowed.
+func (l *rateLimiter) take(route string, r *http.Request) (rateRule, time.Duration, bool) {
+	rule, ok := l.rules[route]
+	if !ok {
+		return rule, 0, true
+	}
+	client, key := l.client(r)
+	if l.allowlisted(l.clientIP(r), key) {
+		return rule, 0, true
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	k := bucketKey{route, client}
+	bucket, ok := l.buckets[k]
+	if !ok {
+		bucket = &tokenBucket{tokens: rule.burst, last: now}
+		l.buckets[k] = bucket
+	}
+	bucket.tokens = math.Min(rule.burst, bucket.tokens+now.Sub(bucket.last).Seconds()*rule.rate)
+	bucket.last = now
+	if bucket.tokens < 1 {
+		return rule, time.Duration((1 - bucket.tokens) / rule.rate * float64(time.Second)), false
+	}
+	bucket.tokens--
+	return rule, 0, true
+}
+
+// withRateLimit rejects requests from clients that have used up their
+// requests on a rate limited route, with a 429 and a Retry-After header. It
+// runs after withAuth so signed in clients are limited by who they are.
+func (s *Store) withRateLimit(mux *http.ServeMux) Middleware {
+	return func(next http.Handler) http.Handler {
+		if s.rateLimiter == nil {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			route := routeLabel(mux, r)
+			rule, wait, ok := s.rateLimiter.take(r.Method+" "+route, r)
+			if ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			retryAfter := int(math.Ceil(wait.Seconds()))
+			s.metrics.requestLimited(route)
+			client, _ := s.rateLimiter.client(r)
+			s.log(r.Context()).Warn("request rate limited", "method", r.Method, "path", r.URL.Path,
+				"client", client, "clientIp", s.rateLimiter.clientIP(r), "retryAfter", retryAfter)
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+			s.writeError(w, r, &APIError{
+				Status:  http.StatusTooManyRequests,
+				Code:    CodeRateLimited,
+				Message: fmt.Sprintf("too many requests, try again in %d seconds", retryAfter),
+				Details: map[string]any{"limit": rule.limit, "retryAfter": retryAfter},
+			})
+		})
+	}
+}
@@ -0,0 +1,206 @@
+package store
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"example.com/lab-08/config"
+)
+
+// newLimitedStore creates a test store that rate limits orders to two per minute
+func newLimitedStore(t *testing.T, allowlist string) *Store {
+	t.Helper()
+	store := newTestStore()
+	store.InitializeCatalog()
+	store.rateLimiter.close()
+	store.rateLimiter = newRateLimiter(config.RateLimitConfig{
+		Enabled:         true,
+		Routes:          "POST /api/orders 2/m",
+		Allowlist:       allowlist,
+		CleanupInterval: config.Duration(time.Minute),
+	})
+	t.Cleanup(store.Close)
+	return store
+}
+
+// placeOrder posts a one unit order from the given address with an API key
+// or a customer's session token
+func placeOrder(handler http.Handler, remoteAddr, apiKey string) *httptest.ResponseRecorder {
+	return placeOrderAs(handler, remoteAddr, apiKey, "")
+}
+
+func placeOrderAs(handler http.Handler, remoteAddr, apiKey, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/api/orders", strings.NewReader(`{"productId": 1, "quantity": 1}`))
+	req.RemoteAddr = remoteAddr
+	if apiKey != "" {
+		req.Header.Set(APIKeyHeader, apiKey)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestRateLimit(t *testing.T) {
+	store := newLimitedStore(t, "")
+	handler := store.Routes("../static")
+
+	for i := 0; i < 2; i++ {
+		if rec := placeOrder(handler, "203.0.113.5:4000", ""); rec.Code != http.StatusCreated {
+			t.Fatalf("Order %d: expected 201, got %d: %s", i+1, rec.Code, rec.Body.String())
+		}
+	}
+	rec := placeOrder(handler, "203.0.113.5:4001", "")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected 429 once the burst is used, got %d", rec.Code)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "30" {
+		t.Errorf("Expected Retry-After 30, got %q", got)
+	}
+	if apiErr := errorResponse(t, rec); apiErr.Code != CodeRateLimited || apiErr.Details["limit"] != "2/m" {
+		t.Errorf("Unexpected error body: %+v", apiErr)
+	}
+
+	// Other clients and other routes are not affected
+	if rec := placeOrder(handler, "203.0.113.6:4000", ""); rec.Code != http.StatusCreated {
+		t.Errorf("Expected another IP to be allowed, got %d", rec.Code)
+	}
+	get := httptest.NewRequest(http.MethodGet, "/api/products", nil)
+	get.RemoteAddr = "203.0.113.5:4000"
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, get)
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected unlimited route to be allowed, got %d", rec.Code)
+	}
+
+	// A made up API key does not sign in, so it is still charged to the IP
+	if rec := placeOrder(handler, "203.0.113.5:4000", "fresh-key"); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected an unknown key to stay limited by IP, got %d", rec.Code)
+	}
+
+	// Staff and customers are limited wherever they call from, and get
+	// their own buckets whatever IP they share
+	key := staffKey(t, store, RoleViewer)
+	token := registerCustomer(t, store, "limited@example.com")
+	for i, addr := range []string{"203.0.113.5:4000", "198.51.100.1:4000"} {
+		if rec := placeOrder(handler, addr, key); rec.Code != http.StatusCreated {
+			t.Errorf("Staff order %d: expected 201, got %d", i+1, rec.Code)
+		}
+		if rec := placeOrderAs(handler, addr, "", token); rec.Code != http.StatusCreated {
+			t.Errorf("Customer order %d: expected 201, got %d", i+1, rec.Code)
+		}
+	}
+	if rec := placeOrder(handler, "198.51.100.3:4000", key); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected a key used from several IPs to be limited, got %d", rec.Code)
+	}
+	if rec := placeOrderAs(handler, "198.51.100.3:4000", "", token); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected a customer using several IPs to be limited, got %d", rec.Code)
+	}
+
+	var metrics strings.Builder
+	store.WriteMetrics(&metrics)
+	if !strings.Contains(metrics.String(), `store_rate_limited_total{route="/api/orders"} 4`) {
+		t.Errorf("Expected rate limited requests to be counted, got:\n%s", metrics.String())
+	}
+}
+
+func TestRateLimitAllowlist(t *testing.T) {
+	store := newLimitedStore(t, "10.0.0.0/8")
+	key := staffKey(t, store, RoleViewer)
+	store.rateLimiter.allowKeys[key] = true
+	handler := store.Routes("../static")
+
+	for i := 0; i < 5; i++ {
+		if rec := placeOrder(handler, "10.1.2.3:4000", ""); rec.Code != http.StatusCreated {
+			t.Fatalf("Expected allowlisted IP to be unlimited, got %d", rec.Code)
+		}
+		if rec := placeOrder(handler, "203.0.113.9:4000", key); rec.Code != http.StatusCreated {
+			t.Fatalf("Expected allowlisted key to be unlimited, got %d", rec.Code)
+		}
+	}
+
+	// An allowlisted key only counts once it signs in
+	store.rateLimiter.allowKeys["ops-tool-key"] = true
+	placeOrder(handler, "203.0.113.10:4000", "ops-tool-key")
+	placeOrder(handler, "203.0.113.10:4000", "ops-tool-key")
+	if rec := placeOrder(handler, "203.0.113.10:4000", "ops-tool-key"); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected an allowlisted key that does not sign in to be limited, got %d", rec.Code)
+	}
+}
+
+func TestTokenBucketRefillAndCleanup(t *testing.T) {
+	limiter := newRateLimiter(config.RateLimitConfig{
+		Enabled:         true,
+		Routes:          "POST /api/orders 2/m 1",
+		TrustProxy:      true,
+		TrustedProxies:  "10.0.0.0/8",
+		CleanupInterval: config.Duration(time.Hour),
+	})
+	defer limiter.close()
+	now := time.Now()
+	limiter.now = func() time.Time { return now }
+
+	req := httptest.NewRequest(http.MethodPost, "/api/orders", nil)
+	req.Header.Set("X-Forwarded-For", "192.0.2.44, 10.0.0.1")
+	if _, _, ok := limiter.take("POST /api/orders", req); !ok {
+		t.Fatal("Expected the first request to be allowed")
+	}
+	if _, wait, ok := limiter.take("POST /api/orders", req); ok || wait != 30*time.Second {
+		t.Fatalf("Expected to wait 30s, got %v (allowed %v)", wait, ok)
+	}
+	if _, ok := limiter.buckets[bucketKey{"POST /api/orders", "ip:192.0.2.44"}]; !ok {
+		t.Errorf("Expected the forwarded client IP to be limited, got %v", limiter.buckets)
+	}
+
+	now = now.Add(10 * time.Second)
+	if left := limiter.cleanup(); left != 1 {
+		t.Errorf("Expected the empty bucket to be kept, %d left", left)
+	}
+	now = now.Add(20 * time.Second)
+	if left := limiter.cleanup(); left != 0 {
+		t.Errorf("Expected the refilled bucket to be forgotten, %d left", left)
+	}
+	if _, _, ok := limiter.take("POST /api/orders", req); !ok {
+		t.Error("Expected the request to be allowed after refilling")
+	}
+}
+
+func TestClientIPIgnoresSpoofedEntries(t *testing.T) {
+	limiter := newRateLimiter(config.RateLimitConfig{
+		Enabled:         true,
+		TrustProxy:      true,
+		TrustedProxies:  "10.0.0.0/8, 192.0.2.9",
+		CleanupInterval: config.Duration(time.Hour),
+	})
+	defer limiter.close()
+
+	tests := []struct {
+		name      string
+		forwarded []string
+		expected  string
+	}{
+		{"no header", nil, "192.0.2.1"},
+		{"one proxy", []string{"198.51.100.7"}, "198.51.100.7"},
+		{"made up entries", []string{"127.0.0.1, 203.0.113.5, 198.51.100.7"}, "198.51.100.7"},
+		{"further proxies", []string{"127.0.0.1, 198.51.100.7, 192.0.2.9, 10.1.2.3"}, "198.51.100.7"},
+		{"split headers", []string{"127.0.0.1", "198.51.100.7, 10.1.2.3"}, "198.51.100.7"},
+		{"only proxies", []string{"10.1.2.3"}, "10.1.2.3"},
+		{"garbled", []string{"198.51.100.7, nonsense"}, "192.0.2.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/products", nil)
+			for _, value := range tt.forwarded {
+				req.Header.Add("X-Forwarded-For", value)
+			}
+			if ip := limiter.clientIP(req); ip != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, ip)
+			}
+		})
+	}
+}
@@ -0,0 +1,290 @@
+package store
+
+import (
+	"cmp"
+	"context"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+)
+
+// Limits on how many recommendations a request gets
+const (
+	defaultRecommendations = 5
+	maxRecommendations     = 20
+)
+
+// minBoughtTogether is how many checkouts must have had two products for
+// one to be recommended with the other; pairs seen fewer times are noise
+const minBoughtTogether = 2
+
+// Why a product was recommended
+const (
+	ReasonBoughtTogether = "bought_together"
+	ReasonPopular        = "popular"
+)
+
+// Recommendation is a product suggested alongside a product or a cart
+type Recommendation struct {
+	Product *Product `json:"product"`
+	Reason  string   `json:"reason"`
+	// BoughtTogether is the number of checkouts that had both products.
+	// Confidence is the share of checkouts with the product recommended
+	// from that also had this one, and Lift how much likelier this one was
+	// in those checkouts than in checkouts overall.
+	BoughtTogether int     `json:"boughtTogether,omitempty"`
+	Confidence     float64 `json:"confidence,omitempty"`
+	Lift           float64 `json:"lift,omitempty"`
+	// Because is the cart product a cart recommendation comes from
+	Because int `json:"because,omitempty"`
+}
+
+// recommender counts which products are bought in the same checkout. It is
+// built from the stored orders and kept up to date as orders are placed;
+// s.mu guards it.
+type recommender struct {
+	baskets   map[int][]int       // the products in each checkout
+	purchases map[int]int         // checkouts each product was in
+	pairs     map[int]map[int]int // checkouts each pair of products was in, both ways round
+}
+
+// newRecommender returns a recommender with no orders
+func newRecommender() *recommender {
+	return &recommender{
+		baskets:   make(map[int][]int),
+		purchases: make(map[int]int),
+		pairs:     make(map[int]map[int]int),
+	}
+}
+
+// add counts an order. Orders placed before checkouts were numbered are a
+// checkout of their own.
+func (rec *recommender) add(order *Order) {
+	if order.Quantity <= 0 || order.Status == OrderCancelled {
+		return
+	}
+	basket := order.CheckoutID
+	if basket == 0 {
+		basket = -order.ID
+	}
+	productID := order.Product.ID
+	if slices.Contains(rec.baskets[basket], productID) {
+		return
+	}
+	rec.purchases[productID]++
+	for _, other := range rec.baskets[basket] {
+		rec.pair(productID, other)
+		rec.pair(other, productID)
+	}
+	rec.baskets[basket] = append(rec.baskets[basket], productID)
+}
+
+// pair counts a checkout with both a and b
+func (rec *recommender) pair(a, b int) {
+	if rec.pairs[a] == nil {
+		rec.pairs[a] = make(map[int]int)
+	}
+	rec.pairs[a][b]++
+}
+
+// rule returns the recommendation of to for a checkout with from, or false
+// when they were not bought together often enough
+func (rec *recommender) rule(from, to int) (Recommendation, bool) {
+	together := rec.pairs[from][to]
+	if together < minBoughtTogether {
+		return Recommendation{}, false
+	}
+	confidence := float64(together) / float64(rec.purchases[from])
+	share := float64(rec.purchases[to]) / float64(len(rec.baskets))
+	return Recommendation{
+		Reason:         ReasonBoughtTogether,
+		BoughtTogether: together,
+		Confidence:     math.Round(confidence*1000) / 1000,
+		Lift:           math.Round(confidence/share*100) / 100,
+	}, true
+}
+
+// rebuildRecommender counts every stored order again. The caller must hold
+// s.mu.
+func (s *Store) rebuildRecommender() {
+	s.recommender = newRecommender()
+	s.checkoutSeq = 0
+	for _, order := range s.orders {
+		s.recommender.add(order)
+		s.checkoutSeq = max(s.checkoutSeq, order.CheckoutID)
+	}
+}
+
+// checkoutKey is the context key for the checkout a request's orders belong to
+type checkoutKey struct{}
+
+// beginCheckout returns a copy of ctx whose orders all belong to a new
+// checkout, so they are counted as bought together
+func (s *Store) beginCheckout(ctx context.Context) context.Context {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.checkoutSeq++
+	return context.WithValue(ctx, checkoutKey{}, s.checkoutSeq)
+}
+
+// checkoutID returns the checkout an order placed with ctx belongs to. An
+// order placed outside a checkout is a checkout of its own. The caller must
+// hold s.mu.
+func (s *Store) checkoutID(ctx context.Context) int {
+	if id, ok := ctx.Value(checkoutKey{}).(int); ok {
+		return id
+	}
+	s.checkoutSeq++
+	return s.checkoutSeq
+}
+
+// Recommendations returns up to limit products often bought with a
+// product, best first, topped up with the most popular products
+func (s *Store) Recommendations(productID, limit int) ([]Recommendation, error) {
+	return s.CartRecommendations([]int{productID}, limit)
+}
+
+// CartRecommendations returns up to limit products often bought with the
+// products in a cart. Each product is recommended by the cart product that
+// makes the strongest case for it, and the list is topped up with the most
+// popular products the cart does not have.
+func (s *Store) CartRecommendations(productIDs []int, limit int) ([]Recommendation, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, id := range productIDs {
+		if _, ok := s.catalog[id]; !ok {
+			return nil, ErrProductNotFound
+		}
+	}
+	// Only products that are still sold and in stock are worth suggesting
+	available := func(id int) bool {
+		product, ok := s.catalog[id]
+		return ok && product.Stock > 0 && !slices.Contains(productIDs, id)
+	}
+
+	best := make(map[int]Recommendation)
+	for _, from := range productIDs {
+		for to := range s.recommender.pairs[from] {
+			rule, ok := s.recommender.rule(from, to)
+			if !ok || !available(to) {
+				continue
+			}
+			if len(productIDs) > 1 {
+				rule.Because = from
+			}
+			if current, seen := best[to]; !seen || compareRules(rule, current) < 0 {
+				best[to] = rule
+			}
+		}
+	}
+	recommendations := make([]Recommendation, 0, len(best))
+	for id, rule := range best {
+		product := *s.catalog[id]
+		rule.Product = &product
+		recommendations = append(recommendations, rule)
+	}
+	slices.SortFunc(recommendations, func(a, b Recommendation) int {
+		return cmp.Or(compareRules(a, b), cmp.Compare(a.Product.ID, b.Product.ID))
+	})
+	if len(recommendations) >= limit {
+		return recommendations[:limit], nil
+	}
+
+	// Fill up with the products in the most checkouts
+	for _, product := range s.popularLocked() {
+		if len(recommendations) == limit {
+			break
+		}
+		if _, ok := best[product.ID]; ok || !available(product.ID) {
+			continue
+		}
+		recommendations = append(recommendations, Recommendation{Product: &product, Reason: ReasonPopular})
+	}
+	return recommendations, nil
+}
+
+// compareRules orders recommendations strongest first
+func compareRules(a, b Recommendation) int {
+	return cmp.Or(
+		cmp.Compare(b.Confidence, a.Confidence),
+		cmp.Compare(b.Lift, a.Lift),
+		cmp.Compare(b.BoughtTogether, a.BoughtTogether),
+	)
+}
+
+// popularLocked returns the catalog, products in the most checkouts first
+// and ties in ID order. The caller must hold s.mu.
+func (s *Store) popularLocked() []Product {
+	products := s.productsLocked()
+	slices.SortStableFunc(products, func(a, b Product) int {
+		return cmp.Compare(s.recommender.purchases[b.ID], s.recommender.purchases[a.ID])
+	})
+	return products
+}
+
+// recommendationLimit reads the limit query parameter
+func recommendationLimit(r *http.Request) (int, error) {
+	value := r.URL.Query().Get("limit")
+	if value == "" {
+		return defaultRecommendations, nil
+	}
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit < 1 || limit > maxRecommendations {
+		return 0, invalidRequest("invalid limit, expected 1 to %d", maxRecommendations)
+	}
+	return limit, nil
+}
+
+// handleProductRecommendations serves GET /api/products/{id}/recommendations?limit=
+func (s *Store) handleProductRecommendations(w http.ResponseWriter, r *http.Request) {
+	productID, err := pathID(r, "id", "product")
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	limit, err := recommendationLimit(r)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	recommendations, err := s.Recommendations(productID, limit)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, recommendations)
+}
+
+// handleCartRecommendations serves POST /api/cart/recommendations?limit=,
+// which takes the same cart items as a checkout
+func (s *Store) handleCartRecommendations(w http.ResponseWriter, r *http.Request) {
+	var items []CartItem
+	if err := decodeJSON(r, &items); err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	limit, err := recommendationLimit(r)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	productIDs := make([]int, 0, len(items))
+	for _, item := range items {
+		if item.Product == nil {
+			s.writeError(w, r, invalidRequest("cart item is missing its product"))
+			return
+		}
+		if !slices.Contains(productIDs, item.Product.ID) {
+			productIDs = append(productIDs, item.Product.ID)
+		}
+	}
+	recommendations, err := s.CartRecommendations(productIDs, limit)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, recommendations)
+}
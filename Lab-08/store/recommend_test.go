@@ -0,0 +1,122 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"example.com/lab-08/config"
+)
+
+// checkout places one order for each product in a single checkout
+func checkout(t *testing.T, store *Store, productIDs ...int) {
+	t.Helper()
+	ctx := store.beginCheckout(context.Background())
+	for _, id := range productIDs {
+		product, _ := store.GetProduct(id)
+		if _, err := store.CreateOrder(ctx, product, 1); err != nil {
+			t.Fatalf("Failed to order product %d: %v", id, err)
+		}
+	}
+}
+
+func TestRecommendations(t *testing.T) {
+	store := newTestStore()
+	store.InitializeCatalog()
+	handler := store.Routes("../static")
+	defer store.Close()
+
+	// Apples are bought with T-Shirts twice, and with the Laptop once
+	checkout(t, store, 1, 3)
+	checkout(t, store, 1, 3, 2)
+	checkout(t, store, 1)
+	checkout(t, store, 2)
+
+	var recommendations []Recommendation
+	rec := customerRequest(handler, http.MethodGet, "/api/products/1/recommendations?limit=2", "", "")
+	json.NewDecoder(rec.Body).Decode(&recommendations)
+	if rec.Code != http.StatusOK || len(recommendations) != 2 {
+		t.Fatalf("Expected two recommendations, got %d %+v", rec.Code, recommendations)
+	}
+	first := recommendations[0]
+	if first.Product.ID != 3 || first.Reason != ReasonBoughtTogether || first.BoughtTogether != 2 || first.Confidence != 0.667 || first.Lift != 1.33 {
+		t.Errorf("Expected the T-Shirt bought together, got %+v", first)
+	}
+	// The Laptop was bought with apples only once, so it is only popular
+	if second := recommendations[1]; second.Product.ID != 2 || second.Reason != ReasonPopular {
+		t.Errorf("Expected the Laptop as a popular product, got %+v", second)
+	}
+
+	// Orders placed later count straight away
+	checkout(t, store, 1, 2)
+	recommendations = nil
+	json.NewDecoder(customerRequest(handler, http.MethodGet, "/api/products/2/recommendations", "", "").Body).Decode(&recommendations)
+	if len(recommendations) != 2 || recommendations[0].Product.ID != 1 || recommendations[0].Reason != ReasonBoughtTogether {
+		t.Errorf("Expected apples first for the Laptop, got %+v", recommendations)
+	}
+
+	// A cart gets recommendations from any of its products, never its own
+	rec = customerRequest(handler, http.MethodPost, "/api/cart/recommendations", `[{"product": {"id": 3}, "quantity": 1}, {"product": {"id": 2}, "quantity": 1}]`, "")
+	recommendations = nil
+	json.NewDecoder(rec.Body).Decode(&recommendations)
+	if rec.Code != http.StatusOK || len(recommendations) != 1 || recommendations[0].Product.ID != 1 || recommendations[0].Because != 3 {
+		t.Errorf("Expected apples because of the T-Shirt, got %d %+v", rec.Code, recommendations)
+	}
+
+	if rec := customerRequest(handler, http.MethodGet, "/api/products/99/recommendations", "", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected an unknown product to be a 404, got %d", rec.Code)
+	}
+	if rec := customerRequest(handler, http.MethodGet, "/api/products/1/recommendations?limit=0", "", ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected a bad limit to be refused, got %d", rec.Code)
+	}
+}
+
+func TestRecommendationsFallBackToPopular(t *testing.T) {
+	store := newTestStore()
+	store.InitializeCatalog()
+	defer store.Close()
+	checkout(t, store, 3)
+	checkout(t, store, 3)
+	checkout(t, store, 2)
+	store.UpdateStock(2, 0)
+
+	// Without history the best sellers in stock are suggested
+	recommendations, err := store.Recommendations(1, 5)
+	if err != nil || len(recommendations) != 1 || recommendations[0].Product.ID != 3 || recommendations[0].Reason != ReasonPopular {
+		t.Errorf("Expected only the T-Shirt, got %+v, %v", recommendations, err)
+	}
+}
+
+func TestRecommendationsRebuiltOnLoad(t *testing.T) {
+	dir := t.TempDir()
+	data, _ := os.ReadFile(testCatalog)
+	cfg := config.Default()
+	cfg.Store.CatalogFile = filepath.Join(dir, "products.json")
+	cfg.Store.DataDir = filepath.Join(dir, "data")
+	os.WriteFile(cfg.Store.CatalogFile, data, 0o644)
+
+	first, err := Open(cfg)
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	checkout(t, first, 1, 3)
+	checkout(t, first, 1, 3)
+	first.Close()
+
+	second, err := Open(cfg)
+	if err != nil {
+		t.Fatalf("Failed to reopen store: %v", err)
+	}
+	defer second.Close()
+	recommendations, _ := second.Recommendations(3, 1)
+	if len(recommendations) != 1 || recommendations[0].Product.ID != 1 || recommendations[0].BoughtTogether != 2 {
+		t.Errorf("Expected the stored orders to be counted, got %+v", recommendations)
+	}
+	checkout(t, second, 2)
+	if orders := second.Orders(); orders[len(orders)-1].CheckoutID != 3 {
+		t.Errorf("Expected checkout IDs to carry on, got %d", orders[len(orders)-1].CheckoutID)
+	}
+}
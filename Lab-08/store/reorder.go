@@ -0,0 +1,239 @@
+package store
+
+import (
+	"cmp"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// ReorderPolicy is when and how much of a product to reorder. Zero fields
+// fall back to the store's defaults.
+type ReorderPolicy struct {
+	ProductID       int `json:"productId"`
+	ReorderPoint    int `json:"reorderPoint"`    // alert and reorder once available stock falls to this
+	ReorderQuantity int `json:"reorderQuantity"` // the least worth ordering at once
+	LeadTimeDays    int `json:"leadTimeDays"`    // days the supplier takes to deliver
+}
+
+// ReorderLine is one product in the reorder report
+type ReorderLine struct {
+	ProductID int    `json:"productId"`
+	Name      string `json:"name"`
+	SKU       string `json:"sku,omitempty"`
+	Stock     int    `json:"stock"`
+	// ReorderPoint is the higher of the product's reorder point and the
+	// sales expected over its lead time
+	ReorderPoint    int     `json:"reorderPoint"`
+	ReorderQuantity int     `json:"reorderQuantity"`
+	LeadTimeDays    int     `json:"leadTimeDays"`
+	UnitsSold       int     `json:"unitsSold"`     // over the velocity window
+	DailyVelocity   float64 `json:"dailyVelocity"` // units sold per day
+	// DaysOfCover is how long the stock lasts at the current velocity; it is
+	// missing when nothing sold
+	DaysOfCover       *float64 `json:"daysOfCover,omitempty"`
+	NeedsReorder      bool     `json:"needsReorder"`
+	SuggestedQuantity int      `json:"suggestedQuantity"`
+}
+
+// ReorderReport suggests what to buy
+type ReorderReport struct {
+	GeneratedAt  time.Time     `json:"generatedAt"`
+	VelocityDays int           `json:"velocityDays"`
+	CoverDays    int           `json:"coverDays"`
+	Products     []ReorderLine `json:"products"` // most urgent first
+}
+
+// saveReorderPolicies persists the reorder policies. The caller must hold
+// s.mu.
+func (s *Store) saveReorderPolicies() error {
+	policies := make([]*ReorderPolicy, 0, len(s.reorder))
+	for _, policy := range s.reorder {
+		policies = append(policies, policy)
+	}
+	slices.SortFunc(policies, func(a, b *ReorderPolicy) int { return cmp.Compare(a.ProductID, b.ProductID) })
+	return s.writeJSONFile(reorderFile, policies)
+}
+
+// reorderPoint returns the stock level at which a product needs reordering.
+// The caller must hold s.mu.
+func (s *Store) reorderPoint(productID int) int {
+	if policy, ok := s.reorder[productID]; ok && policy.ReorderPoint > 0 {
+		return policy.ReorderPoint
+	}
+	return s.webhooks.lowStock
+}
+
+// SetReorderPolicy sets when and how much of a product to reorder. A policy
+// of all zeros removes it.
+func (s *Store) SetReorderPolicy(productID int, policy ReorderPolicy) (*ReorderPolicy, error) {
+	if policy.ReorderPoint < 0 || policy.ReorderQuantity < 0 || policy.LeadTimeDays < 0 {
+		return nil, invalidRequest("reorderPoint, reorderQuantity and leadTimeDays cannot be negative")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.catalog[productID]; !ok {
+		return nil, ErrProductNotFound
+	}
+	previous, had := s.reorder[productID]
+	policy.ProductID = productID
+	if policy == (ReorderPolicy{ProductID: productID}) {
+		delete(s.reorder, productID)
+	} else {
+		s.reorder[productID] = &policy
+	}
+	if err := s.saveReorderPolicies(); err != nil {
+		if had {
+			s.reorder[productID] = previous
+		} else {
+			delete(s.reorder, productID)
+		}
+		return nil, err
+	}
+	s.logger.Info("reorder policy set", "productId", productID, "reorderPoint", policy.ReorderPoint,
+		"reorderQuantity", policy.ReorderQuantity, "leadTimeDays", policy.LeadTimeDays)
+	return &policy, nil
+}
+
+// stockChanged alerts when a product's stock has just fallen to its reorder
+// point: it is logged and sent as stock.low. The caller must hold s.mu.
+func (s *Store) stockChanged(product *Product, previousStock int) {
+	threshold := s.reorderPoint(product.ID)
+	if previousStock <= threshold || product.Stock > threshold {
+		return
+	}
+	s.logger.Warn("stock reached its reorder point", "productId", product.ID, "name", product.Name,
+		"stock", product.Stock, "reorderPoint", threshold)
+	data := map[string]any{
+		"productId": product.ID,
+		"name":      product.Name,
+		"sku":       product.SKU,
+		"stock":     product.Stock,
+		"threshold": threshold,
+	}
+	if policy, ok := s.reorder[product.ID]; ok && policy.ReorderQuantity > 0 {
+		data["reorderQuantity"] = policy.ReorderQuantity
+	}
+	s.emit(EventStockLow, data)
+}
+
+// ReorderReport works out which products need reordering and how much to
+// buy. Sales velocity is the units sold by orders that were not cancelled
+// over the last velocity window, per day. A product needs reordering once
+// its stock is at its reorder point or below the sales expected over its
+// lead time; the suggestion tops it up to last the lead time and the cover
+// days after it, and is at least the product's reorder quantity. Unless all
+// is set, only products that need reordering are listed.
+func (s *Store) ReorderReport(now time.Time, all bool) *ReorderReport {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	since := now.AddDate(0, 0, -s.velocityDays)
+	sold := make(map[int]int)
+	for _, order := range s.orders {
+		if order.Status != OrderCancelled && !order.CreatedAt.Before(since) && !order.CreatedAt.After(now) {
+			sold[order.Product.ID] += order.Quantity
+		}
+	}
+
+	report := &ReorderReport{GeneratedAt: now, VelocityDays: s.velocityDays, CoverDays: s.coverDays, Products: []ReorderLine{}}
+	for _, product := range s.productsLocked() {
+		line := ReorderLine{
+			ProductID:     product.ID,
+			Name:          product.Name,
+			SKU:           product.SKU,
+			Stock:         product.Stock,
+			LeadTimeDays:  s.leadTimeDays,
+			UnitsSold:     sold[product.ID],
+			DailyVelocity: math.Round(float64(sold[product.ID])/float64(s.velocityDays)*100) / 100,
+		}
+		if policy, ok := s.reorder[product.ID]; ok {
+			line.ReorderQuantity = policy.ReorderQuantity
+			if policy.LeadTimeDays > 0 {
+				line.LeadTimeDays = policy.LeadTimeDays
+			}
+		}
+		velocity := float64(sold[product.ID]) / float64(s.velocityDays)
+		leadDemand := int(math.Ceil(velocity * float64(line.LeadTimeDays)))
+		line.ReorderPoint = max(s.reorderPoint(product.ID), leadDemand)
+		if velocity > 0 {
+			cover := math.Round(float64(product.Stock)/velocity*10) / 10
+			line.DaysOfCover = &cover
+		}
+		line.NeedsReorder = product.Stock <= line.ReorderPoint
+		if line.NeedsReorder {
+			target := int(math.Ceil(velocity * float64(line.LeadTimeDays+s.coverDays)))
+			// With no sales to go by, get back above the reorder point
+			target = max(target, line.ReorderPoint+1)
+			line.SuggestedQuantity = max(line.ReorderQuantity, target-product.Stock)
+		}
+		if line.NeedsReorder || all {
+			report.Products = append(report.Products, line)
+		}
+	}
+	slices.SortStableFunc(report.Products, func(a, b ReorderLine) int {
+		return cmp.Or(compareNeeds(a, b), compareCover(a, b))
+	})
+	return report
+}
+
+// compareNeeds puts products that need reordering first
+func compareNeeds(a, b ReorderLine) int {
+	switch {
+	case a.NeedsReorder == b.NeedsReorder:
+		return 0
+	case a.NeedsReorder:
+		return -1
+	}
+	return 1
+}
+
+// compareCover puts products that run out soonest first; products that are
+// not selling come last
+func compareCover(a, b ReorderLine) int {
+	switch {
+	case a.DaysOfCover == nil && b.DaysOfCover == nil:
+		return 0
+	case a.DaysOfCover == nil:
+		return 1
+	case b.DaysOfCover == nil:
+		return -1
+	}
+	return cmp.Compare(*a.DaysOfCover, *b.DaysOfCover)
+}
+
+// handleReorderReport serves GET /api/inventory/reorder?all=true
+func (s *Store) handleReorderReport(w http.ResponseWriter, r *http.Request) {
+	all := false
+	if value := r.URL.Query().Get("all"); value != "" {
+		var err error
+		if all, err = strconv.ParseBool(value); err != nil {
+			s.writeError(w, r, invalidRequest("invalid all, expected true or false"))
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, s.ReorderReport(time.Now(), all))
+}
+
+// handleSetReorderPolicy serves PUT /api/products/{id}/reorder
+func (s *Store) handleSetReorderPolicy(w http.ResponseWriter, r *http.Request) {
+	productID, err := pathID(r, "id", "product")
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	var policy ReorderPolicy
+	if err := decodeJSON(r, &policy); err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	saved, err := s.SetReorderPolicy(productID, policy)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, saved)
+}
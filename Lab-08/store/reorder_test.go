@@ -0,0 +1,76 @@
+package store
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+func TestReorderReport(t *testing.T) {
+	store := newTestStore()
+	store.InitializeCatalog()
+	defer store.Close()
+	logs := &syncBuffer{}
+	store.SetLogger(slog.New(slog.NewJSONHandler(logs, nil)))
+
+	if _, err := store.SetReorderPolicy(2, ReorderPolicy{ReorderPoint: 4, ReorderQuantity: 10, LeadTimeDays: 10}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.SetReorderPolicy(2, ReorderPolicy{ReorderPoint: -1}); err == nil {
+		t.Error("Expected a negative reorder point to be refused")
+	}
+	apple, _ := store.GetProduct(1)
+	laptop, _ := store.GetProduct(2)
+	for _, sale := range []struct {
+		product  *Product
+		quantity int
+	}{{laptop, 6}, {apple, 90}, {apple, 5}} {
+		if _, err := store.CreateOrder(context.Background(), sale.product, sale.quantity); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The laptop fell to its own reorder point of 4, the apples to the
+	// default of 5
+	alerts := map[float64]int{}
+	for _, entry := range logs.entries(t) {
+		if entry["msg"] == "stock reached its reorder point" {
+			alerts[entry["productId"].(float64)]++
+		}
+	}
+	if alerts[1] != 1 || alerts[2] != 1 {
+		t.Errorf("Expected one alert for each product, got %v", alerts)
+	}
+
+	now := time.Now()
+	report := store.ReorderReport(now, false)
+	if len(report.Products) != 2 {
+		t.Fatalf("Expected the apples and the laptop to need reordering, got %+v", report.Products)
+	}
+	// 95 apples in 30 days leaves 1.6 days of cover and is most urgent. They
+	// need 23 in stock to last the 7 day lead time, and 67 for the lead time
+	// and the 14 days of cover after it.
+	apples := report.Products[0]
+	if apples.ProductID != 1 || apples.UnitsSold != 95 || apples.DailyVelocity != 3.17 || *apples.DaysOfCover != 1.6 ||
+		apples.ReorderPoint != 23 || apples.SuggestedQuantity != 62 {
+		t.Errorf("Unexpected apple suggestion: %+v", apples)
+	}
+	// The laptop's 24 days of sales come to 5, less than its reorder quantity
+	laptops := report.Products[1]
+	if laptops.ProductID != 2 || laptops.ReorderPoint != 4 || laptops.LeadTimeDays != 10 || *laptops.DaysOfCover != 20 ||
+		laptops.SuggestedQuantity != 10 {
+		t.Errorf("Unexpected laptop suggestion: %+v", laptops)
+	}
+
+	report = store.ReorderReport(now, true)
+	if shirts := report.Products[2]; len(report.Products) != 3 || shirts.NeedsReorder || shirts.DaysOfCover != nil || shirts.SuggestedQuantity != 0 {
+		t.Errorf("Expected the unsold T-shirts last with nothing to buy, got %+v", report.Products)
+	}
+
+	// Sales older than the velocity window no longer count
+	report = store.ReorderReport(now.AddDate(0, 0, 31), false)
+	if apples := report.Products[0]; apples.UnitsSold != 0 || apples.ReorderPoint != 5 || apples.SuggestedQuantity != 1 {
+		t.Errorf("Expected old sales to be ignored, got %+v", apples)
+	}
+}
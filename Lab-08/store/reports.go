@@ -0,0 +1,257 @@
+package store
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// DateLayout is the format used for report dates in query strings and output
+const DateLayout = "2006-01-02"
+
+// defaultTopProducts is how many products the sales report ranks unless asked otherwise
+const defaultTopProducts = 5
+
+// SalesBucket aggregates sales for one day, week or category
+type SalesBucket struct {
+	Key     string  `json:"key"`
+	Orders  int     `json:"orders"`
+	Units   int     `json:"units"`
+	Revenue float64 `json:"revenue"`
+}
+
+// ProductSales aggregates sales for a single product
+type ProductSales struct {
+	ProductID int     `json:"productId"`
+	Name      string  `json:"name"`
+	Category  string  `json:"category"`
+	Units     int     `json:"units"`
+	Revenue   float64 `json:"revenue"`
+}
+
+// SalesReport summarises the orders placed within a date range
+type SalesReport struct {
+	From              string         `json:"from"`
+	To                string         `json:"to"`
+	Orders            int            `json:"orders"`
+	CancelledOrders   int            `json:"cancelledOrders"`
+	CancellationRate  float64        `json:"cancellationRate"`
+	Units             int            `json:"units"`
+	Revenue           float64        `json:"revenue"`
+	AverageOrderValue float64        `json:"averageOrderValue"`
+	ByDay             []SalesBucket  `json:"byDay"`
+	ByWeek            []SalesBucket  `json:"byWeek"`
+	ByCategory        []SalesBucket  `json:"byCategory"`
+	TopProducts       []ProductSales `json:"topProducts"`
+}
+
+// isoWeek returns the ISO 8601 week containing t, e.g. "2026-W07"
+func isoWeek(t time.Time) string {
+	year, week := t.ISOWeek()
+	return fmt.Sprintf("%d-W%02d", year, week)
+}
+
+// startOfDay returns midnight at the start of t's day in t's location
+func startOfDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// addToBucket adds an order's figures to the bucket stored under key
+func addToBucket(buckets map[string]*SalesBucket, key string, units int, revenue float64) {
+	bucket, ok := buckets[key]
+	if !ok {
+		bucket = &SalesBucket{Key: key}
+		buckets[key] = bucket
+	}
+	bucket.Orders++
+	bucket.Units += units
+	bucket.Revenue = roundMoney(bucket.Revenue + revenue)
+}
+
+// sortedBuckets returns the buckets ordered by key
+func sortedBuckets(buckets map[string]*SalesBucket) []SalesBucket {
+	result := make([]SalesBucket, 0, len(buckets))
+	for _, bucket := range buckets {
+		result = append(result, *bucket)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Key < result[j].Key })
+	return result
+}
+
+// SalesReport computes sales figures for orders placed between from and to
+// (both inclusive, compared by calendar day). Cancelled orders count towards
+// the cancellation rate but not towards revenue or units.
+func (s *Store) SalesReport(from, to time.Time, top int) (*SalesReport, error) {
+	if to.Before(from) {
+		return nil, ErrInvalidDateRange
+	}
+	if top <= 0 {
+		top = defaultTopProducts
+	}
+	from, to = startOfDay(from), startOfDay(to)
+	end := to.AddDate(0, 0, 1)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	report := &SalesReport{From: from.Format(DateLayout), To: to.Format(DateLayout)}
+	days := make(map[string]*SalesBucket)
+	weeks := make(map[string]*SalesBucket)
+	categories := make(map[string]*SalesBucket)
+	products := make(map[int]*ProductSales)
+
+	for _, order := range s.orders {
+		placed := order.CreatedAt.In(from.Location())
+		if placed.Before(from) || !placed.Before(end) {
+			continue
+		}
+		report.Orders++
+		if order.Status == OrderCancelled {
+			report.CancelledOrders++
+			continue
+		}
+
+		revenue := s.CalculateTotal(order)
+		report.Units += order.Quantity
+		report.Revenue = roundMoney(report.Revenue + revenue)
+		addToBucket(days, placed.Format(DateLayout), order.Quantity, revenue)
+		addToBucket(weeks, isoWeek(placed), order.Quantity, revenue)
+		addToBucket(categories, order.Product.Category, order.Quantity, revenue)
+
+		sales, ok := products[order.Product.ID]
+		if !ok {
+			sales = &ProductSales{
+				ProductID: order.Product.ID,
+				Name:      order.Product.Name,
+				Category:  order.Product.Category,
+			}
+			products[order.Product.ID] = sales
+		}
+		sales.Units += order.Quantity
+		sales.Revenue = roundMoney(sales.Revenue + revenue)
+	}
+
+	if report.Orders > 0 {
+		report.CancellationRate = float64(report.CancelledOrders) / float64(report.Orders)
+	}
+	if completed := report.Orders - report.CancelledOrders; completed > 0 {
+		report.AverageOrderValue = roundMoney(report.Revenue / float64(completed))
+	}
+	report.ByDay = sortedBuckets(days)
+	report.ByWeek = sortedBuckets(weeks)
+	report.ByCategory = sortedBuckets(categories)
+
+	report.TopProducts = make([]ProductSales, 0, len(products))
+	for _, sales := range products {
+		report.TopProducts = append(report.TopProducts, *sales)
+	}
+	sort.Slice(report.TopProducts, func(i, j int) bool {
+		a, b := report.TopProducts[i], report.TopProducts[j]
+		if a.Revenue != b.Revenue {
+			return a.Revenue > b.Revenue
+		}
+		return a.ProductID < b.ProductID
+	})
+	if len(report.TopProducts) > top {
+		report.TopProducts = report.TopProducts[:top]
+	}
+	return report, nil
+}
+
+// WriteCSV writes the report as CSV with one row per summary figure, bucket and top product
+func (r *SalesReport) WriteCSV(w *csv.Writer) error {
+	money := func(amount float64) string { return strconv.FormatFloat(amount, 'f', 2, 64) }
+
+	rows := [][]string{
+		{"section", "key", "orders", "units", "revenue"},
+		{"summary", "total", strconv.Itoa(r.Orders - r.CancelledOrders), strconv.Itoa(r.Units), money(r.Revenue)},
+		{"summary", "cancelled", strconv.Itoa(r.CancelledOrders), "", ""},
+		{"summary", "cancellation_rate", "", "", strconv.FormatFloat(r.CancellationRate, 'f', 4, 64)},
+		{"summary", "average_order_value", "", "", money(r.AverageOrderValue)},
+	}
+	sections := []struct {
+		name    string
+		buckets []SalesBucket
+	}{
+		{"day", r.ByDay},
+		{"week", r.ByWeek},
+		{"category", r.ByCategory},
+	}
+	for _, section := range sections {
+		for _, b := range section.buckets {
+			rows = append(rows, []string{section.name, b.Key, strconv.Itoa(b.Orders), strconv.Itoa(b.Units), money(b.Revenue)})
+		}
+	}
+	for _, p := range r.TopProducts {
+		rows = append(rows, []string{"top_product", p.Name, "", strconv.Itoa(p.Units), money(p.Revenue)})
+	}
+
+	if err := w.WriteAll(rows); err != nil {
+		return fmt.Errorf("error writing report CSV: %v", err)
+	}
+	return nil
+}
+
+// parseReportRange reads the from and to query parameters, defaulting to the last 30 days
+func parseReportRange(r *http.Request) (time.Time, time.Time, error) {
+	today := startOfDay(time.Now())
+	from, to := today.AddDate(0, 0, -29), today
+
+	var err error
+	if value := r.URL.Query().Get("from"); value != "" {
+		if from, err = time.ParseInLocation(DateLayout, value, time.Local); err != nil {
+			return from, to, errors.New("invalid from date, expected YYYY-MM-DD")
+		}
+	}
+	if value := r.URL.Query().Get("to"); value != "" {
+		if to, err = time.ParseInLocation(DateLayout, value, time.Local); err != nil {
+			return from, to, errors.New("invalid to date, expected YYYY-MM-DD")
+		}
+	}
+	return from, to, nil
+}
+
+// handleSalesReport serves GET /api/reports/sales?from=&to=&top=&format=json|csv
+func (s *Store) handleSalesReport(w http.ResponseWriter, r *http.Request) {
+	from, to, err := parseReportRange(r)
+	if err != nil {
+		s.writeError(w, r, invalidRequest("%v", err))
+		return
+	}
+
+	top := 0
+	if value := r.URL.Query().Get("top"); value != "" {
+		if top, err = strconv.Atoi(value); err != nil || top < 1 {
+			s.writeError(w, r, invalidRequest("invalid top value, expected a positive number"))
+			return
+		}
+	}
+
+	report, err := s.SalesReport(from, to, top)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+
+	switch r.URL.Query().Get("format") {
+	case "", "json":
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(report)
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition",
+			fmt.Sprintf("attachment; filename=\"sales-%s-to-%s.csv\"", report.From, report.To))
+		cw := csv.NewWriter(w)
+		if err := report.WriteCSV(cw); err != nil {
+			// The response has started, so the error can only be logged
+			s.log(r.Context()).Error("error writing sales report", "error", err)
+		}
+	default:
+		s.writeError(w, r, invalidRequest("unsupported report format, expected json or csv"))
+	}
+}
@@ -0,0 +1,89 @@
+package store
+
+import (
+	"context"
+	"encoding/csv"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSalesReport(t *testing.T) {
+	store := newTestStore()
+	store.InitializeCatalog()
+	apple, _ := store.GetProduct(1)
+	laptop, _ := store.GetProduct(2)
+
+	store.CreateOrder(context.Background(), apple, 3)
+	store.CreateOrder(context.Background(), laptop, 1)
+	cancelled, _ := store.CreateOrder(context.Background(), apple, 1)
+	cancelled.Status = "Cancelled"
+
+	today := time.Now()
+	report, err := store.SalesReport(today.AddDate(0, 0, -1), today, 1)
+	if err != nil {
+		t.Fatalf("Failed to build report: %v", err)
+	}
+
+	if report.Orders != 3 || report.CancelledOrders != 1 {
+		t.Errorf("Expected 3 orders with 1 cancelled, got %d and %d", report.Orders, report.CancelledOrders)
+	}
+	if report.Revenue != 82120 || report.Units != 4 {
+		t.Errorf("Expected revenue 82120 for 4 units, got %.2f for %d", report.Revenue, report.Units)
+	}
+	if report.AverageOrderValue != 41060 {
+		t.Errorf("Expected average order value 41060, got %.2f", report.AverageOrderValue)
+	}
+	if len(report.TopProducts) != 1 || report.TopProducts[0].Name != "Laptop" {
+		t.Errorf("Expected Laptop as the only top product, got %+v", report.TopProducts)
+	}
+	if len(report.ByCategory) != 2 || len(report.ByDay) != 1 {
+		t.Errorf("Expected 2 categories over 1 day, got %+v and %+v", report.ByCategory, report.ByDay)
+	}
+}
+
+func TestSalesReportExcludesOrdersOutsideRange(t *testing.T) {
+	store := newTestStore()
+	store.InitializeCatalog()
+	apple, _ := store.GetProduct(1)
+	store.CreateOrder(context.Background(), apple, 2)
+
+	lastMonth := time.Now().AddDate(0, -1, 0)
+	report, _ := store.SalesReport(lastMonth, lastMonth, 0)
+	if report.Orders != 0 || report.Revenue != 0 {
+		t.Errorf("Expected empty report, got %+v", report)
+	}
+
+	if _, err := store.SalesReport(time.Now(), lastMonth, 0); err == nil {
+		t.Errorf("Expected error for reversed date range, got nil")
+	}
+}
+
+func TestHandleSalesReportCSV(t *testing.T) {
+	store := newTestStore()
+	store.InitializeCatalog()
+	apple, _ := store.GetProduct(1)
+	store.CreateOrder(context.Background(), apple, 2)
+
+	rec := httptest.NewRecorder()
+	store.handleSalesReport(rec, httptest.NewRequest(http.MethodGet, "/api/reports/sales?format=csv", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rec.Code)
+	}
+
+	rows, err := csv.NewReader(strings.NewReader(rec.Body.String())).ReadAll()
+	if err != nil {
+		t.Fatalf("Invalid CSV: %v", err)
+	}
+	if rows[1][0] != "summary" || rows[1][4] != "80.00" {
+		t.Errorf("Expected summary row with revenue 80.00, got %v", rows[1])
+	}
+
+	rec = httptest.NewRecorder()
+	store.handleSalesReport(rec, httptest.NewRequest(http.MethodGet, "/api/reports/sales?from=yesterday", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for invalid date, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,395 @@
+package store
+
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Review moderation states. A review is only shown, and only counts
+// towards a product's rating, once it is approved.
+const (
+	ReviewPending  = "pending"
+	ReviewApproved = "approved"
+	ReviewRejected = "rejected"
+)
+
+// Limits on the text of a review, in characters
+const (
+	maxReviewTitle = 120
+	maxReviewBody  = 2000
+)
+
+// productSorts are the orders GET /api/products can list products in
+var productSorts = []string{"id", "name", "price", "-price", "rating", "reviews"}
+
+// Review is a customer's star rating and review of a product
+type Review struct {
+	ID         int    `json:"id"`
+	ProductID  int    `json:"productId"`
+	CustomerID int    `json:"customerId,omitempty"`
+	Author     string `json:"author"`
+	Rating     int    `json:"rating"` // 1 to 5 stars
+	Title      string `json:"title,omitempty"`
+	Body       string `json:"body,omitempty"`
+	Status     string `json:"status"`
+	// VerifiedPurchase is worked out when the review is served: the author
+	// still has an order for the product that was not cancelled
+	VerifiedPurchase bool       `json:"verifiedPurchase"`
+	CreatedAt        time.Time  `json:"createdAt"`
+	ModeratedBy      string     `json:"moderatedBy,omitempty"`
+	ModeratedAt      *time.Time `json:"moderatedAt,omitempty"`
+	ModerationNote   string     `json:"moderationNote,omitempty"` // why it was rejected, shown to the author
+}
+
+// RatingSummary is the average and spread of a product's approved ratings
+type RatingSummary struct {
+	Average      float64        `json:"average"` // zero when there are no ratings
+	Count        int            `json:"count"`
+	Distribution map[string]int `json:"distribution"` // number of ratings for each of "1" to "5" stars
+}
+
+// RatedProduct is a product as served by the product endpoints, with its
+// rating
+type RatedProduct struct {
+	Product
+	Rating RatingSummary `json:"rating"`
+	// Availability is the product's stock at the location nearest the
+	// customer, when their pincode is known
+	Availability *LocationStock `json:"availability,omitempty"`
+	// Backorder is set when the product can be ordered beyond its stock
+	Backorder *BackorderAvailability `json:"backorder,omitempty"`
+}
+
+// newRatingSummary returns a summary with no ratings
+func newRatingSummary() RatingSummary {
+	return RatingSummary{Distribution: map[string]int{"1": 0, "2": 0, "3": 0, "4": 0, "5": 0}}
+}
+
+// ratingSummaries sums up the approved ratings of every product. The caller
+// must hold s.mu.
+func (s *Store) ratingSummaries() map[int]RatingSummary {
+	totals := make(map[int]int)
+	summaries := make(map[int]RatingSummary)
+	for _, review := range s.reviews {
+		if review.Status != ReviewApproved {
+			continue
+		}
+		summary, ok := summaries[review.ProductID]
+		if !ok {
+			summary = newRatingSummary()
+		}
+		summary.Count++
+		summary.Distribution[strconv.Itoa(review.Rating)]++
+		totals[review.ProductID] += review.Rating
+		summaries[review.ProductID] = summary
+	}
+	for id, summary := range summaries {
+		summary.Average = math.Round(float64(totals[id])/float64(summary.Count)*100) / 100
+		summaries[id] = summary
+	}
+	return summaries
+}
+
+// RatedProducts returns the catalog with each product's rating, in one of
+// the productSorts orders: by ID (the default), name, price low to high or
+// high to low, best rated first or most reviewed first
+func (s *Store) RatedProducts(sortBy string) ([]RatedProduct, error) {
+	if sortBy == "" {
+		sortBy = "id"
+	}
+	if !slices.Contains(productSorts, sortBy) {
+		return nil, invalidRequest("unknown sort %q, expected one of %s", sortBy, strings.Join(productSorts, ", "))
+	}
+
+	s.mu.RLock()
+	summaries := s.ratingSummaries()
+	products := s.productsLocked()
+	backorders := s.backorderAvailability()
+	s.mu.RUnlock()
+
+	rated := make([]RatedProduct, len(products))
+	for i, product := range products {
+		rated[i] = RatedProduct{Product: product, Rating: summaries[product.ID], Backorder: backorders[product.ID]}
+		if rated[i].Rating.Distribution == nil {
+			rated[i].Rating = newRatingSummary()
+		}
+	}
+	// products is in ID order, so a stable sort leaves ties in ID order
+	slices.SortStableFunc(rated, func(a, b RatedProduct) int {
+		switch sortBy {
+		case "name":
+			return cmp.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name))
+		case "price":
+			return cmp.Compare(a.Price, b.Price)
+		case "-price":
+			return cmp.Compare(b.Price, a.Price)
+		case "rating":
+			return cmp.Or(cmp.Compare(b.Rating.Average, a.Rating.Average), cmp.Compare(b.Rating.Count, a.Rating.Count))
+		case "reviews":
+			return cmp.Compare(b.Rating.Count, a.Rating.Count)
+		}
+		return 0
+	})
+	return rated, nil
+}
+
+// RatedProduct returns a product with its rating
+func (s *Store) RatedProduct(id int) (*RatedProduct, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	product, ok := s.catalog[id]
+	if !ok {
+		return nil, ErrProductNotFound
+	}
+	summary, ok := s.ratingSummaries()[id]
+	if !ok {
+		summary = newRatingSummary()
+	}
+	return &RatedProduct{Product: *product, Rating: summary, Backorder: s.backorderAvailability()[id]}, nil
+}
+
+// hasOrdered reports whether a customer has an order for a product that
+// was not cancelled. The caller must hold s.mu.
+func (s *Store) hasOrdered(customerID, productID int) bool {
+	return slices.ContainsFunc(s.orders, func(order *Order) bool {
+		return order.CustomerID == customerID && order.Product.ID == productID &&
+			order.Quantity > 0 && order.Status != OrderCancelled
+	})
+}
+
+// servedReview returns a copy of a review with its verified purchase badge
+// worked out. The caller must hold s.mu.
+func (s *Store) servedReview(review *Review) Review {
+	served := *review
+	served.VerifiedPurchase = s.hasOrdered(review.CustomerID, review.ProductID)
+	return served
+}
+
+// PostReview saves a customer's review of a product they have ordered. A
+// customer has one review per product, so posting again replaces it, and
+// the second result is false. New and changed reviews wait for moderation.
+func (s *Store) PostReview(customer *Customer, productID, rating int, title, body string) (*Review, bool, error) {
+	title, body = strings.TrimSpace(title), strings.TrimSpace(body)
+	switch {
+	case rating < 1 || rating > 5:
+		return nil, false, fmt.Errorf("%w: rating must be from 1 to 5 stars", ErrInvalidReview)
+	case utf8.RuneCountInString(title) > maxReviewTitle:
+		return nil, false, fmt.Errorf("%w: title is longer than %d characters", ErrInvalidReview, maxReviewTitle)
+	case utf8.RuneCountInString(body) > maxReviewBody:
+		return nil, false, fmt.Errorf("%w: review is longer than %d characters", ErrInvalidReview, maxReviewBody)
+	}
+	author := customer.Name
+	if author == "" {
+		author = "Customer"
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.catalog[productID]; !ok {
+		return nil, false, ErrProductNotFound
+	}
+	if !s.hasOrdered(customer.ID, productID) {
+		return nil, false, ErrPurchaseRequired
+	}
+
+	review := &Review{
+		ProductID:  productID,
+		CustomerID: customer.ID,
+		Author:     author,
+		Rating:     rating,
+		Title:      title,
+		Body:       body,
+		Status:     ReviewPending,
+		CreatedAt:  time.Now(),
+	}
+	created := true
+	index := slices.IndexFunc(s.reviews, func(r *Review) bool {
+		return r.CustomerID == customer.ID && r.ProductID == productID
+	})
+	var previous *Review
+	if index >= 0 {
+		previous, created = s.reviews[index], false
+		review.ID = previous.ID
+		s.reviews[index] = review
+	} else {
+		review.ID = len(s.reviews) + 1
+		s.reviews = append(s.reviews, review)
+	}
+	if err := s.saveReviews(); err != nil {
+		if created {
+			s.reviews = s.reviews[:len(s.reviews)-1]
+		} else {
+			s.reviews[index] = previous
+		}
+		return nil, false, err
+	}
+	s.logger.Info("review posted", "reviewId", review.ID, "productId", productID, "customerId", customer.ID, "rating", rating)
+	served := s.servedReview(review)
+	return &served, created, nil
+}
+
+// ProductReviews returns the approved reviews of a product, newest first,
+// without who moderated them
+func (s *Store) ProductReviews(productID int) ([]Review, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if _, ok := s.catalog[productID]; !ok {
+		return nil, ErrProductNotFound
+	}
+	reviews := []Review{}
+	for i := len(s.reviews) - 1; i >= 0; i-- {
+		if s.reviews[i].ProductID != productID || s.reviews[i].Status != ReviewApproved {
+			continue
+		}
+		review := s.servedReview(s.reviews[i])
+		review.CustomerID, review.ModeratedBy, review.ModeratedAt, review.ModerationNote = 0, "", nil, ""
+		reviews = append(reviews, review)
+	}
+	return reviews, nil
+}
+
+// Reviews returns the reviews in a moderation state, or all reviews when
+// status is empty, oldest first so the moderation queue is worked in order.
+// A customer ID other than zero only returns that customer's reviews.
+func (s *Store) Reviews(status string, customerID int) ([]Review, error) {
+	if status != "" && !validReviewStatus(status) {
+		return nil, ErrInvalidReviewStatus
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	reviews := []Review{}
+	for _, review := range s.reviews {
+		if (status == "" || review.Status == status) && (customerID == 0 || review.CustomerID == customerID) {
+			reviews = append(reviews, s.servedReview(review))
+		}
+	}
+	return reviews, nil
+}
+
+// validReviewStatus reports whether status is a moderation state
+func validReviewStatus(status string) bool {
+	return status == ReviewPending || status == ReviewApproved || status == ReviewRejected
+}
+
+// ModerateReview moves a review to a moderation state, recording who did it
+// and an optional note for the author. Approved reviews can be taken down
+// again by rejecting them.
+func (s *Store) ModerateReview(id int, status, note, moderator string) (*Review, error) {
+	if !validReviewStatus(status) {
+		return nil, ErrInvalidReviewStatus
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if id < 1 || id > len(s.reviews) {
+		return nil, ErrReviewNotFound
+	}
+	review := s.reviews[id-1]
+	previous := *review
+	now := time.Now()
+	review.Status, review.ModerationNote = status, strings.TrimSpace(note)
+	review.ModeratedBy, review.ModeratedAt = moderator, &now
+	if err := s.saveReviews(); err != nil {
+		*review = previous
+		return nil, err
+	}
+	s.logger.Info("review moderated", "reviewId", id, "status", status, "moderator", moderator)
+	served := s.servedReview(review)
+	return &served, nil
+}
+
+// handleListProductReviews serves GET /api/products/{id}/reviews
+func (s *Store) handleListProductReviews(w http.ResponseWriter, r *http.Request) {
+	productID, err := pathID(r, "id", "product")
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	reviews, err := s.ProductReviews(productID)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, reviews)
+}
+
+// handlePostReview serves POST /api/products/{id}/reviews
+func (s *Store) handlePostReview(w http.ResponseWriter, r *http.Request) {
+	productID, err := pathID(r, "id", "product")
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	var request struct {
+		Rating int    `json:"rating"`
+		Title  string `json:"title"`
+		Body   string `json:"body"`
+	}
+	if err := decodeJSON(r, &request); err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	review, created, err := s.PostReview(CustomerFromContext(r.Context()), productID, request.Rating, request.Title, request.Body)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	writeJSON(w, status, review)
+}
+
+// handleMyReviews serves GET /api/me/reviews
+func (s *Store) handleMyReviews(w http.ResponseWriter, r *http.Request) {
+	reviews, err := s.Reviews("", CustomerFromContext(r.Context()).ID)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, reviews)
+}
+
+// handleListReviews serves GET /api/admin/reviews?status=
+func (s *Store) handleListReviews(w http.ResponseWriter, r *http.Request) {
+	reviews, err := s.Reviews(r.URL.Query().Get("status"), 0)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, reviews)
+}
+
+// handleModerateReview serves PUT /api/admin/reviews/{id}/status
+func (s *Store) handleModerateReview(w http.ResponseWriter, r *http.Request) {
+	reviewID, err := pathID(r, "id", "review")
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	var request struct {
+		Status string `json:"status"`
+		Note   string `json:"note"`
+	}
+	if err := decodeJSON(r, &request); err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	moderator := ""
+	if user := UserFromContext(r.Context()); user != nil {
+		moderator = user.Username
+	}
+	review, err := s.ModerateReview(reviewID, request.Status, request.Note, moderator)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, review)
+}
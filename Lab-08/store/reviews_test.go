@@ -0,0 +1,130 @@
+package store
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testing"
+)
+
+func TestReviewsAndRatings(t *testing.T) {
+	store := newTestStore()
+	store.InitializeCatalog()
+	handler := store.Routes("../static")
+	defer store.Close()
+	moderator := staffKey(t, store, RoleInventoryManager)
+	viewer := staffKey(t, store, RoleViewer)
+
+	// Customers can only review what they ordered
+	tokens := make([]string, 3)
+	for i := range tokens {
+		tokens[i] = registerCustomer(t, store, "buyer"+strconv.Itoa(i)+"@example.com")
+		customerRequest(handler, http.MethodPost, "/api/orders", `{"productId": 3, "quantity": 1}`, tokens[i])
+	}
+	if rec := customerRequest(handler, http.MethodPost, "/api/products/2/reviews", `{"rating": 5}`, tokens[0]); rec.Code != http.StatusForbidden {
+		t.Errorf("Expected a review without an order to be refused, got %d", rec.Code)
+	}
+	if rec := customerRequest(handler, http.MethodPost, "/api/products/3/reviews", `{"rating": 6}`, tokens[0]); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected six stars to be refused, got %d", rec.Code)
+	}
+	for i, rating := range []string{"2", "5", "4"} {
+		rec := customerRequest(handler, http.MethodPost, "/api/products/3/reviews", `{"rating": `+rating+`, "body": "Fits well"}`, tokens[i])
+		var review Review
+		json.NewDecoder(rec.Body).Decode(&review)
+		if rec.Code != http.StatusCreated || review.Status != ReviewPending || !review.VerifiedPurchase {
+			t.Fatalf("Expected a pending verified review, got %d %+v", rec.Code, review)
+		}
+	}
+	// Posting again replaces the customer's review
+	if rec := customerRequest(handler, http.MethodPost, "/api/products/3/reviews", `{"rating": 1, "title": "Shrank"}`, tokens[0]); rec.Code != http.StatusOK {
+		t.Errorf("Expected the review to be replaced, got %d", rec.Code)
+	}
+
+	// Pending reviews are neither shown nor counted
+	var reviews []Review
+	json.NewDecoder(customerRequest(handler, http.MethodGet, "/api/products/3/reviews", "", "").Body).Decode(&reviews)
+	if len(reviews) != 0 {
+		t.Errorf("Expected no approved reviews yet, got %+v", reviews)
+	}
+	json.NewDecoder(staffRequest(handler, http.MethodGet, "/api/admin/reviews?status=pending", "", viewer).Body).Decode(&reviews)
+	if len(reviews) != 3 || reviews[0].Rating != 1 {
+		t.Fatalf("Expected three reviews to moderate, got %+v", reviews)
+	}
+	if rec := staffRequest(handler, http.MethodPut, "/api/admin/reviews/1/status", `{"status": "approved"}`, viewer); rec.Code != http.StatusForbidden {
+		t.Errorf("Expected a viewer not to moderate, got %d", rec.Code)
+	}
+	for _, change := range []struct{ id, status string }{{"1", "approved"}, {"2", "approved"}, {"3", "rejected"}} {
+		rec := staffRequest(handler, http.MethodPut, "/api/admin/reviews/"+change.id+"/status", `{"status": "`+change.status+`", "note": "checked"}`, moderator)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected review %s to be %s, got %d: %s", change.id, change.status, rec.Code, rec.Body.String())
+		}
+	}
+
+	reviews = nil
+	json.NewDecoder(customerRequest(handler, http.MethodGet, "/api/products/3/reviews", "", "").Body).Decode(&reviews)
+	if len(reviews) != 2 || reviews[0].ID != 2 || reviews[0].CustomerID != 0 || reviews[0].ModeratedBy != "" {
+		t.Errorf("Expected the approved reviews newest first without moderation details, got %+v", reviews)
+	}
+	reviews = nil
+	json.NewDecoder(customerRequest(handler, http.MethodGet, "/api/me/reviews", "", tokens[2]).Body).Decode(&reviews)
+	if len(reviews) != 1 || reviews[0].Status != ReviewRejected || reviews[0].ModerationNote != "checked" {
+		t.Errorf("Expected the author to see why their review was rejected, got %+v", reviews)
+	}
+
+	var product RatedProduct
+	json.NewDecoder(customerRequest(handler, http.MethodGet, "/api/products/3", "", "").Body).Decode(&product)
+	want := map[string]int{"1": 1, "2": 0, "3": 0, "4": 0, "5": 1}
+	if product.Rating.Count != 2 || product.Rating.Average != 3 || len(product.Rating.Distribution) != 5 {
+		t.Fatalf("Expected two ratings averaging 3, got %+v", product.Rating)
+	}
+	for stars, count := range want {
+		if product.Rating.Distribution[stars] != count {
+			t.Errorf("Expected %d ratings of %s stars, got %d", count, stars, product.Rating.Distribution[stars])
+		}
+	}
+}
+
+func TestProductSorts(t *testing.T) {
+	store := newTestStore()
+	store.InitializeCatalog()
+	handler := store.Routes("../static")
+	defer store.Close()
+	store.reviews = []*Review{
+		{ID: 1, ProductID: 1, Rating: 4, Status: ReviewApproved},
+		{ID: 2, ProductID: 1, Rating: 4, Status: ReviewApproved},
+		{ID: 3, ProductID: 2, Rating: 5, Status: ReviewApproved},
+		{ID: 4, ProductID: 3, Rating: 5, Status: ReviewPending},
+	}
+
+	tests := []struct {
+		sort string
+		want []int
+	}{
+		{"", []int{1, 2, 3}},
+		{"rating", []int{2, 1, 3}},
+		{"reviews", []int{1, 2, 3}},
+		{"-price", []int{2, 3, 1}},
+		{"name", []int{1, 2, 3}},
+	}
+	for _, tt := range tests {
+		var products []RatedProduct
+		rec := customerRequest(handler, http.MethodGet, "/api/products?sort="+tt.sort, "", "")
+		json.NewDecoder(rec.Body).Decode(&products)
+		var got []int
+		for _, product := range products {
+			got = append(got, product.ID)
+		}
+		if rec.Code != http.StatusOK || len(got) != len(tt.want) {
+			t.Fatalf("sort=%s: got %d %v", tt.sort, rec.Code, got)
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("sort=%s: expected %v, got %v", tt.sort, tt.want, got)
+				break
+			}
+		}
+	}
+	if rec := customerRequest(handler, http.MethodGet, "/api/products?sort=stars", "", ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected an unknown sort to be refused, got %d", rec.Code)
+	}
+}
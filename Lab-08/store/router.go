@@ -0,0 +1,294 @@
+package store
+
+import (
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"runtime/debug"
+	"slices"
+	"strings"
+)
+
+// Middleware wraps a handler with behaviour shared by many routes
+type Middleware func(http.Handler) http.Handler
+
+// Chain wraps h in the middleware. The first middleware listed is the
+// outermost, so it sees the request first and the response last.
+func Chain(h http.Handler, middleware ...Middleware) http.Handler {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		h = middleware[i](h)
+	}
+	return h
+}
+
+// route is one entry in the route table
+type route struct {
+	method  string
+	pattern string
+	access  Role // the least role that may call it, or public
+	handler http.Handler
+}
+
+// routeTable lists every endpoint the store serves. Patterns use the
+// net/http syntax, so {id} is read with r.PathValue("id"), and a request
+// that matches a path but not its method gets a 405 with an Allow header.
+// Routes that need a role are only served to staff signed in with one that
+// allows them, and customer routes to a signed in customer. API routes must
+// also be described in openapi.json.
+func (s *Store) routeTable(staticDir string) []route {
+	return []route{
+		{http.MethodGet, "/api/products", public, http.HandlerFunc(s.handleGetProducts)},
+		{http.MethodPost, "/api/products", RoleInventoryManager, http.HandlerFunc(s.handleCreateProduct)},
+		{http.MethodGet, "/api/products/{id}", public, http.HandlerFunc(s.handleGetProduct)},
+		{http.MethodPut, "/api/products/{id}", RoleInventoryManager, http.HandlerFunc(s.handleUpdateProduct)},
+		{http.MethodDelete, "/api/products/{id}", RoleInventoryManager, http.HandlerFunc(s.handleDeleteProduct)},
+		{http.MethodPut, "/api/products/{id}/stock", RoleInventoryManager, http.HandlerFunc(s.handleUpdateStock)},
+		{http.MethodPut, "/api/products/{id}/reorder", RoleInventoryManager, http.HandlerFunc(s.handleSetReorderPolicy)},
+		{http.MethodPut, "/api/products/{id}/backorder", RoleInventoryManager, http.HandlerFunc(s.handleSetBackorderPolicy)},
+		{http.MethodPost, "/api/products/{id}/image", RoleInventoryManager, http.HandlerFunc(s.handleUploadProductImage)},
+		{http.MethodGet, "/api/products/{id}/reviews", public, http.HandlerFunc(s.handleListProductReviews)},
+		{http.MethodPost, "/api/products/{id}/reviews", RoleCustomer, http.HandlerFunc(s.handlePostReview)},
+		{http.MethodGet, "/api/products/{id}/recommendations", public, http.HandlerFunc(s.handleProductRecommendations)},
+		{http.MethodGet, "/api/products/{id}/availability", public, http.HandlerFunc(s.handleAvailability)},
+		{http.MethodPost, "/api/orders", public, http.HandlerFunc(s.handleCreateOrder)},
+		{http.MethodGet, "/api/orders/{id}/invoice", public, http.HandlerFunc(s.handleGetInvoice)},
+		{http.MethodPost, "/api/orders/{id}/payment", public, http.HandlerFunc(s.handlePayOrder)},
+		{http.MethodPost, "/api/payments/webhook", public, http.HandlerFunc(s.handlePaymentWebhook)},
+		{http.MethodPost, "/api/checkout", public, http.HandlerFunc(s.handleCheckout)},
+		{http.MethodPost, "/api/cart/recommendations", public, http.HandlerFunc(s.handleCartRecommendations)},
+		{http.MethodGet, "/api/reports/sales", RoleViewer, http.HandlerFunc(s.handleSalesReport)},
+		{http.MethodPost, "/api/catalog/import", RoleInventoryManager, http.HandlerFunc(s.handleImportCatalog)},
+		{http.MethodGet, "/api/catalog/export", RoleViewer, http.HandlerFunc(s.handleExportCatalog)},
+		{http.MethodGet, "/api/inventory/ledger", RoleViewer, http.HandlerFunc(s.handleLedger)},
+		{http.MethodPost, "/api/inventory/movements", RoleInventoryManager, http.HandlerFunc(s.handleAdjustStock)},
+		{http.MethodGet, "/api/inventory/reconcile", RoleViewer, http.HandlerFunc(s.handleReconcileStock)},
+		{http.MethodPost, "/api/inventory/reconcile", RoleAdmin, http.HandlerFunc(s.handleReconcileStock)},
+		{http.MethodGet, "/api/inventory/reorder", RoleViewer, http.HandlerFunc(s.handleReorderReport)},
+		{http.MethodGet, "/api/inventory/locations", RoleViewer, http.HandlerFunc(s.handleListLocations)},
+		{http.MethodPost, "/api/inventory/locations", RoleAdmin, http.HandlerFunc(s.handleCreateLocation)},
+		{http.MethodPut, "/api/inventory/locations/{id}", RoleAdmin, http.HandlerFunc(s.handleUpdateLocation)},
+		{http.MethodPost, "/api/inventory/transfers", RoleInventoryManager, http.HandlerFunc(s.handleTransferStock)},
+		{http.MethodGet, "/api/inventory/backorders", RoleViewer, http.HandlerFunc(s.handleListBackorders)},
+		{http.MethodGet, "/api/inventory/suppliers", RoleViewer, http.HandlerFunc(s.handleListSuppliers)},
+		{http.MethodPost, "/api/inventory/suppliers", RoleInventoryManager, http.HandlerFunc(s.handleCreateSupplier)},
+		{http.MethodGet, "/api/inventory/purchase-orders", RoleViewer, http.HandlerFunc(s.handleListPurchaseOrders)},
+		{http.MethodPost, "/api/inventory/purchase-orders", RoleInventoryManager, http.HandlerFunc(s.handleCreatePurchaseOrder)},
+		{http.MethodGet, "/api/inventory/purchase-orders/{id}", RoleViewer, http.HandlerFunc(s.handleGetPurchaseOrder)},
+		{http.MethodPost, "/api/inventory/purchase-orders/{id}/receipts", RoleInventoryManager, http.HandlerFunc(s.handleReceiveGoods)},
+		{http.MethodPost, "/api/inventory/purchase-orders/{id}/cancel", RoleInventoryManager, http.HandlerFunc(s.handleCancelPurchaseOrder)},
+		{http.MethodGet, "/api/reports/purchasing", RoleViewer, http.HandlerFunc(s.handlePurchasingReport)},
+		{http.MethodPost, "/api/auth/login", public, http.HandlerFunc(s.handleLogin)},
+		{http.MethodPost, "/api/auth/logout", public, http.HandlerFunc(s.handleLogout)},
+		{http.MethodGet, "/api/auth/me", RoleViewer, http.HandlerFunc(s.handleMe)},
+		{http.MethodPost, "/api/customers/register", public, http.HandlerFunc(s.handleRegisterCustomer)},
+		{http.MethodPost, "/api/customers/login", public, http.HandlerFunc(s.handleCustomerLogin)},
+		{http.MethodPost, "/api/customers/logout", public, http.HandlerFunc(s.handleCustomerLogout)},
+		{http.MethodGet, "/api/me", RoleCustomer, http.HandlerFunc(s.handleGetProfile)},
+		{http.MethodPut, "/api/me", RoleCustomer, http.HandlerFunc(s.handleUpdateProfile)},
+		{http.MethodGet, "/api/me/addresses", RoleCustomer, http.HandlerFunc(s.handleListAddresses)},
+		{http.MethodPost, "/api/me/addresses", RoleCustomer, http.HandlerFunc(s.handleSaveAddress)},
+		{http.MethodPut, "/api/me/addresses/{id}", RoleCustomer, http.HandlerFunc(s.handleSaveAddress)},
+		{http.MethodDelete, "/api/me/addresses/{id}", RoleCustomer, http.HandlerFunc(s.handleDeleteAddress)},
+		{http.MethodGet, "/api/me/orders", RoleCustomer, http.HandlerFunc(s.handleMyOrders)},
+		{http.MethodPost, "/api/me/orders/claim", RoleCustomer, http.HandlerFunc(s.handleClaimOrders)},
+		{http.MethodPost, "/api/me/orders/{id}/cancel", RoleCustomer, http.HandlerFunc(s.handleCancelMyOrder)},
+		{http.MethodGet, "/api/me/wishlist", RoleCustomer, http.HandlerFunc(s.handleGetWishlist)},
+		{http.MethodPost, "/api/me/wishlist", RoleCustomer, http.HandlerFunc(s.handleAddToWishlist)},
+		{http.MethodDelete, "/api/me/wishlist/{productId}", RoleCustomer, http.HandlerFunc(s.handleRemoveFromWishlist)},
+		{http.MethodPost, "/api/me/wishlist/{productId}/cart", RoleCustomer, http.HandlerFunc(s.handleMoveToCart)},
+		{http.MethodGet, "/api/me/carts", RoleCustomer, http.HandlerFunc(s.handleListSavedCarts)},
+		{http.MethodPost, "/api/me/carts", RoleCustomer, http.HandlerFunc(s.handleSaveCart)},
+		{http.MethodDelete, "/api/me/carts/{id}", RoleCustomer, http.HandlerFunc(s.handleDeleteSavedCart)},
+		{http.MethodPost, "/api/me/carts/{id}/restore", RoleCustomer, http.HandlerFunc(s.handleRestoreCart)},
+		{http.MethodGet, "/api/me/reviews", RoleCustomer, http.HandlerFunc(s.handleMyReviews)},
+		{http.MethodGet, "/api/me/notifications", RoleCustomer, http.HandlerFunc(s.handleListNotifications)},
+		{http.MethodPost, "/api/me/notifications/read", RoleCustomer, http.HandlerFunc(s.handleMarkNotificationsRead)},
+		{http.MethodGet, "/api/admin/workers", RoleViewer, http.HandlerFunc(s.handleWorkerPool)},
+		{http.MethodGet, "/api/admin/reviews", RoleViewer, http.HandlerFunc(s.handleListReviews)},
+		{http.MethodPut, "/api/admin/reviews/{id}/status", RoleInventoryManager, http.HandlerFunc(s.handleModerateReview)},
+		{http.MethodPost, "/api/admin/orders/{id}/cancel", RoleInventoryManager, http.HandlerFunc(s.handleCancelOrder)},
+		{http.MethodPut, "/api/admin/payments/mock", RoleAdmin, http.HandlerFunc(s.handleSetMockPaymentMode)},
+		{http.MethodGet, "/api/admin/webhooks", RoleAdmin, http.HandlerFunc(s.handleListWebhooks)},
+		{http.MethodPost, "/api/admin/webhooks", RoleAdmin, http.HandlerFunc(s.handleCreateWebhook)},
+		{http.MethodDelete, "/api/admin/webhooks/{id}", RoleAdmin, http.HandlerFunc(s.handleDeleteWebhook)},
+		{http.MethodGet, "/api/admin/webhooks/{id}/deliveries", RoleAdmin, http.HandlerFunc(s.handleListDeliveries)},
+		{http.MethodPost, "/api/admin/webhooks/deliveries/{id}/redeliver", RoleAdmin, http.HandlerFunc(s.handleRedeliver)},
+		{http.MethodGet, "/api/admin/users", RoleAdmin, http.HandlerFunc(s.handleListUsers)},
+		{http.MethodPost, "/api/admin/users", RoleAdmin, http.HandlerFunc(s.handleCreateUser)},
+		{http.MethodPost, "/api/admin/users/{id}/keys", RoleAdmin, http.HandlerFunc(s.handleCreateAPIKey)},
+		{http.MethodDelete, "/api/admin/users/{id}/keys/{keyId}", RoleAdmin, http.HandlerFunc(s.handleRevokeAPIKey)},
+		{http.MethodGet, "/healthz", public, http.HandlerFunc(s.handleHealthz)},
+		{http.MethodGet, "/readyz", public, http.HandlerFunc(s.handleReadyz)},
+		{http.MethodGet, "/metrics", public, http.HandlerFunc(s.handleMetrics)},
+		{http.MethodGet, "/openapi.json", public, http.HandlerFunc(s.handleOpenAPI)},
+		{http.MethodGet, mediaURLPrefix, public, s.mediaHandler()},
+		{http.MethodGet, "/static/", public, http.StripPrefix("/static/", http.FileServer(http.Dir(staticDir)))},
+		{http.MethodGet, "/{$}", public, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.ServeFile(w, r, filepath.Join(staticDir, "index.html"))
+		})},
+	}
+}
+
+// Routes returns the HTTP handler for the store API, the uploaded media and
+// the web interface served from staticDir, wrapped in the middleware every
+// request goes through
+func (s *Store) Routes(staticDir string) http.Handler {
+	mux, methods, access := s.newMux(staticDir)
+	return Chain(mux,
+		s.withRequestLogging,
+		s.withMetrics(mux),
+		s.withRecovery,
+		s.withCORS(mux, methods),
+		s.withRouteErrors(mux, methods),
+		s.withAuth(mux, access),
+		s.withRateLimit(mux),
+		s.withBodyLimit,
+		s.withValidation(mux),
+	)
+}
+
+// newMux registers the route table on a ServeMux and returns it with the
+// methods used by any route and the role each route needs, keyed by the
+// pattern the mux reports for it
+func (s *Store) newMux(staticDir string) (*http.ServeMux, []string, map[string]Role) {
+	mux := http.NewServeMux()
+	var methods []string
+	access := make(map[string]Role)
+	for _, rt := range s.routeTable(staticDir) {
+		pattern := rt.method + " " + rt.pattern
+		mux.Handle(pattern, rt.handler)
+		access[pattern] = rt.access
+		if !slices.Contains(methods, rt.method) {
+			methods = append(methods, rt.method)
+		}
+	}
+	return mux, methods, access
+}
+
+// withRecovery turns a panic in a handler into a 500 response and an error
+// log line instead of a dropped connection
+func (s *Store) withRecovery(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			err := recover()
+			if err == nil {
+				return
+			}
+			if err == http.ErrAbortHandler {
+				panic(err)
+			}
+			s.log(r.Context()).Error("handler panicked",
+				"method", r.Method, "path", r.URL.Path,
+				"panic", fmt.Sprint(err), "stack", string(debug.Stack()))
+			s.writeError(w, r, &APIError{Status: http.StatusInternalServerError, Code: CodeInternal, Message: "internal server error"})
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// withCORS lets browsers on the allowed origins call the API and answers
+// OPTIONS requests, including CORS preflights, with the methods the path
+// accepts. An origin of "*" allows every origin.
+func (s *Store) withCORS(mux *http.ServeMux, methods []string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if origin := r.Header.Get("Origin"); origin != "" {
+				switch {
+				case slices.Contains(s.corsOrigins, "*"):
+					w.Header().Set("Access-Control-Allow-Origin", "*")
+				case slices.Contains(s.corsOrigins, origin):
+					w.Header().Set("Access-Control-Allow-Origin", origin)
+					w.Header().Add("Vary", "Origin")
+				}
+				w.Header().Set("Access-Control-Expose-Headers", RequestIDHeader+", Retry-After")
+			}
+
+			if r.Method != http.MethodOptions {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			allowed := allowedMethods(mux, r, methods)
+			if len(allowed) == 0 {
+				s.writeError(w, r, &APIError{Status: http.StatusNotFound, Code: CodeNotFound, Message: "no route for " + r.URL.Path})
+				return
+			}
+			allow := strings.Join(allowed, ", ")
+			w.Header().Set("Allow", allow)
+			if w.Header().Get("Access-Control-Allow-Origin") != "" {
+				w.Header().Set("Access-Control-Allow-Methods", allow)
+				w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, "+RequestIDHeader+", "+APIKeyHeader)
+				w.Header().Set("Access-Control-Max-Age", "600")
+			}
+			w.WriteHeader(http.StatusNoContent)
+		})
+	}
+}
+
+// withRouteErrors answers requests that match no route with a JSON 404, or
+// a 405 listing the allowed methods when the path exists
+func (s *Store) withRouteErrors(mux *http.ServeMux, methods []string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, pattern := mux.Handler(r); pattern != "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			allowed := allowedMethods(mux, r, methods)
+			if len(allowed) == 0 {
+				s.writeError(w, r, &APIError{Status: http.StatusNotFound, Code: CodeNotFound, Message: "no route for " + r.URL.Path})
+				return
+			}
+			w.Header().Set("Allow", strings.Join(allowed, ", "))
+			s.writeError(w, r, &APIError{
+				Status:  http.StatusMethodNotAllowed,
+				Code:    CodeMethodNotAllowed,
+				Message: r.Method + " is not allowed on " + r.URL.Path,
+				Details: map[string]any{"allowed": allowed},
+			})
+		})
+	}
+}
+
+// allowedMethods returns the methods the mux has a route for at the request
+// path, including HEAD for GET routes and OPTIONS, which is always answered
+func allowedMethods(mux *http.ServeMux, r *http.Request, methods []string) []string {
+	var allowed []string
+	for _, method := range methods {
+		probe := r.Clone(r.Context())
+		probe.Method = method
+		if _, pattern := mux.Handler(probe); pattern != "" {
+			allowed = append(allowed, method)
+			if method == http.MethodGet {
+				allowed = append(allowed, http.MethodHead)
+			}
+		}
+	}
+	if len(allowed) > 0 {
+		allowed = append(allowed, http.MethodOptions)
+	}
+	return allowed
+}
+
+// withBodyLimit rejects request bodies larger than the configured limit
+func (s *Store) withBodyLimit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ContentLength > s.maxBodyBytes {
+			s.writeError(w, r, &http.MaxBytesError{Limit: s.maxBodyBytes})
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, s.maxBodyBytes)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// splitList splits a comma separated setting, dropping empty entries
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,136 @@
+package store
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestChainOrder(t *testing.T) {
+	var calls []string
+	tag := func(name string) Middleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls = append(calls, name)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+	handler := Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, "handler")
+	}), tag("first"), tag("second"))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if got := strings.Join(calls, ","); got != "first,second,handler" {
+		t.Errorf("Expected middleware in order, got %s", got)
+	}
+}
+
+func TestRouting(t *testing.T) {
+	store := newTestStore()
+	defer store.Close()
+	store.InitializeCatalog()
+	handler := store.Routes("../static")
+	key := staffKey(t, store, RoleInventoryManager)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		status int
+		allow  string
+	}{
+		{"update stock", http.MethodPut, "/api/products/1/stock", `{"stock": 7}`, http.StatusOK, ""},
+		{"bad product id", http.MethodGet, "/api/products/apple", "", http.StatusBadRequest, ""},
+		{"unknown product", http.MethodGet, "/api/products/99", "", http.StatusNotFound, ""},
+		{"wrong method", http.MethodDelete, "/api/products", "", http.StatusMethodNotAllowed, "GET, HEAD, POST, OPTIONS"},
+		{"wrong method on stock", http.MethodGet, "/api/products/1/stock", "", http.StatusMethodNotAllowed, "PUT, OPTIONS"},
+		{"unknown path", http.MethodGet, "/api/nothing", "", http.StatusNotFound, ""},
+		{"index", http.MethodGet, "/", "", http.StatusOK, ""},
+		{"options", http.MethodOptions, "/api/orders", "", http.StatusNoContent, "POST, OPTIONS"},
+		{"options unknown path", http.MethodOptions, "/api/nothing", "", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			req.Header.Set(APIKeyHeader, key)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.status {
+				t.Fatalf("Expected status %d, got %d: %s", tt.status, rec.Code, rec.Body.String())
+			}
+			if tt.allow != "" && rec.Header().Get("Allow") != tt.allow {
+				t.Errorf("Expected Allow %q, got %q", tt.allow, rec.Header().Get("Allow"))
+			}
+		})
+	}
+
+	if product, _ := store.GetProduct(1); product.Stock != 7 {
+		t.Errorf("Expected stock 7 after update, got %d", product.Stock)
+	}
+}
+
+func TestCORS(t *testing.T) {
+	store := newTestStore()
+	defer store.Close()
+	store.InitializeCatalog()
+	store.corsOrigins = []string{"https://shop.example"}
+	handler := store.Routes("../static")
+
+	preflight := httptest.NewRequest(http.MethodOptions, "/api/products/1/stock", nil)
+	preflight.Header.Set("Origin", "https://shop.example")
+	preflight.Header.Set("Access-Control-Request-Method", http.MethodPut)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, preflight)
+
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("Expected 204, got %d", rec.Code)
+	}
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "https://shop.example" {
+		t.Errorf("Expected allowed origin, got %q", got)
+	}
+	if got := rec.Header().Get("Access-Control-Allow-Methods"); got != "PUT, OPTIONS" {
+		t.Errorf("Expected PUT, OPTIONS, got %q", got)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/products", nil)
+	req.Header.Set("Origin", "https://elsewhere.example")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Errorf("Expected no CORS header for an unknown origin, got %q", got)
+	}
+}
+
+func TestRecovery(t *testing.T) {
+	store := newTestStore()
+	defer store.Close()
+	store.SetLogger(slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	handler := store.withRecovery(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("Expected 500 after a panic, got %d", rec.Code)
+	}
+}
+
+func TestBodyLimit(t *testing.T) {
+	store := newTestStore()
+	defer store.Close()
+	store.InitializeCatalog()
+	store.maxBodyBytes = 16
+	handler := store.Routes("../static")
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/orders", strings.NewReader(`{"productId": 1, "quantity": 1}`)))
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected 413, got %d", rec.Code)
+	}
+}
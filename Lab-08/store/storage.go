@@ -0,0 +1,354 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+const (
+	ordersFile         = "orders.json"
+	invoicesFile       = "invoices.json"
+	usersFile          = "users.json"
+	customersFile      = "customers.json"
+	reviewsFile        = "reviews.json"
+	webhooksFile       = "webhooks.json"
+	deliveriesFile     = "deliveries.json"
+	ledgerFile         = "ledger.json"
+	reorderFile        = "reorder.json"
+	locationsFile      = "locations.json"
+	backordersFile     = "backorders.json"
+	suppliersFile      = "suppliers.json"
+	purchaseOrdersFile = "purchase_orders.json"
+	// productsFile is the live catalog, with its stock. The catalog file
+	// the store is configured with only seeds it.
+	productsFile = "products.json"
+	// lockFile holds the ID of the process using the data directory
+	lockFile = "store.lock"
+)
+
+// lockDataDir takes the data directory for this process, so two storectl
+// commands never rewrite the same files at once. A lock left behind by a
+// process that is no longer running is taken over.
+func (s *Store) lockDataDir() error {
+	if s.dataDir == "" {
+		return nil
+	}
+	if err := os.MkdirAll(s.dataDir, 0o755); err != nil {
+		return fmt.Errorf("error creating data directory: %v", err)
+	}
+	path := filepath.Join(s.dataDir, lockFile)
+	for {
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if err == nil {
+			_, err = fmt.Fprintf(file, "%d\n", os.Getpid())
+			if closeErr := file.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				os.Remove(path)
+				return fmt.Errorf("error locking data directory: %v", err)
+			}
+			s.lockPath = path
+			return nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return fmt.Errorf("error locking data directory: %v", err)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("error locking data directory: %v", err)
+		}
+		// A lock without a process ID is still being written
+		pid, _ := strconv.Atoi(strings.TrimSpace(string(data)))
+		if err == nil && (pid <= 0 || processRunning(pid)) {
+			return fmt.Errorf("data directory %s is in use by process %d; stop it first, or remove %s if it is not running",
+				s.dataDir, pid, path)
+		}
+		os.Remove(path)
+	}
+}
+
+// unlockDataDir gives up the data directory taken by lockDataDir
+func (s *Store) unlockDataDir() {
+	if s.lockPath != "" {
+		os.Remove(s.lockPath)
+		s.lockPath = ""
+	}
+}
+
+// processRunning reports whether a process with the given ID is running
+func processRunning(pid int) bool {
+	if pid == os.Getpid() {
+		return true
+	}
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	err = process.Signal(syscall.Signal(0))
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
+// writeJSONFile writes v to name inside the data directory. The data is
+// written to a temporary file first and renamed so a crash never leaves a
+// half-written file behind.
+func (s *Store) writeJSONFile(name string, v any) error {
+	if s.dataDir == "" {
+		return nil
+	}
+	if err := os.MkdirAll(s.dataDir, 0o755); err != nil {
+		return fmt.Errorf("error creating data directory: %v", err)
+	}
+
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding %s: %v", name, err)
+	}
+
+	path := filepath.Join(s.dataDir, name)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("error writing %s: %v", name, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("error writing %s: %v", name, err)
+	}
+	return nil
+}
+
+// readJSONFile reads name from the data directory into v. A missing file is
+// not an error, it just means nothing has been stored yet.
+func (s *Store) readJSONFile(name string, v any) error {
+	data, err := os.ReadFile(filepath.Join(s.dataDir, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error reading %s: %v", name, err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("error parsing %s: %v", name, err)
+	}
+	return nil
+}
+
+// saveOrders persists all orders. The caller must hold s.mu.
+func (s *Store) saveOrders() error {
+	return s.writeJSONFile(ordersFile, placedOrders(s.orders))
+}
+
+// saveStock writes stock changes to the live catalog when the store is
+// persistent, so every command sharing the data directory sees the same
+// stock. The caller must hold s.mu.
+func (s *Store) saveStock() error {
+	if s.dataDir == "" {
+		return nil
+	}
+	return s.saveCatalog()
+}
+
+// saveInvoices persists all issued invoices in order. The caller must hold s.mu.
+func (s *Store) saveInvoices() error {
+	invoices := make([]*Invoice, 0, len(s.invoices))
+	for _, invoice := range s.invoices {
+		invoices = append(invoices, invoice)
+	}
+	sort.Slice(invoices, func(i, j int) bool {
+		return invoices[i].OrderID < invoices[j].OrderID
+	})
+	return s.writeJSONFile(invoicesFile, invoices)
+}
+
+// saveUsers persists staff accounts with their password and API key hashes.
+// The caller must hold s.authMu.
+func (s *Store) saveUsers() error {
+	users := make([]*User, 0, len(s.users))
+	for _, user := range s.users {
+		users = append(users, user)
+	}
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].ID < users[j].ID
+	})
+	return s.writeJSONFile(usersFile, users)
+}
+
+// saveReviews persists product reviews. The caller must hold s.mu.
+func (s *Store) saveReviews() error {
+	return s.writeJSONFile(reviewsFile, s.reviews)
+}
+
+// saveCustomers persists customer accounts and their addresses. The caller
+// must hold s.authMu.
+func (s *Store) saveCustomers() error {
+	customers := make([]*Customer, 0, len(s.customers))
+	for _, customer := range s.customers {
+		customers = append(customers, customer)
+	}
+	sort.Slice(customers, func(i, j int) bool {
+		return customers[i].ID < customers[j].ID
+	})
+	return s.writeJSONFile(customersFile, customers)
+}
+
+// LoadState restores orders, invoices, reviews, the inventory ledger,
+// reorder and backorder policies, locations, users, customers and webhooks
+// from the data directory. It must be called after InitializeCatalog so orders can be
+// linked to catalog products. Products the ledger has never seen get their
+// stock as an opening balance, and stock the locations do not account for
+// goes to the default location.
+func (s *Store) LoadState() error {
+	if s.dataDir == "" {
+		return nil
+	}
+
+	var placed []placedOrder
+	if err := s.readJSONFile(ordersFile, &placed); err != nil {
+		return err
+	}
+	orders := make([]*Order, len(placed))
+	for i, order := range placed {
+		order.Order.ClaimCode = order.ClaimCode
+		orders[i] = order.Order
+	}
+	var invoices []*Invoice
+	if err := s.readJSONFile(invoicesFile, &invoices); err != nil {
+		return err
+	}
+	var reviews []*Review
+	if err := s.readJSONFile(reviewsFile, &reviews); err != nil {
+		return err
+	}
+	var users []*User
+	if err := s.readJSONFile(usersFile, &users); err != nil {
+		return err
+	}
+	var customers []*Customer
+	if err := s.readJSONFile(customersFile, &customers); err != nil {
+		return err
+	}
+	var ledger []*StockMovement
+	if err := s.readJSONFile(ledgerFile, &ledger); err != nil {
+		return err
+	}
+	var policies []*ReorderPolicy
+	if err := s.readJSONFile(reorderFile, &policies); err != nil {
+		return err
+	}
+	var backorders []*BackorderPolicy
+	if err := s.readJSONFile(backordersFile, &backorders); err != nil {
+		return err
+	}
+	var locations []*Location
+	if err := s.readJSONFile(locationsFile, &locations); err != nil {
+		return err
+	}
+	var suppliers []*Supplier
+	if err := s.readJSONFile(suppliersFile, &suppliers); err != nil {
+		return err
+	}
+	var purchaseOrders []*PurchaseOrder
+	if err := s.readJSONFile(purchaseOrdersFile, &purchaseOrders); err != nil {
+		return err
+	}
+	var subscriptions []*Subscription
+	if err := s.readJSONFile(webhooksFile, &subscriptions); err != nil {
+		return err
+	}
+	var deliveries []*Delivery
+	if err := s.readJSONFile(deliveriesFile, &deliveries); err != nil {
+		return err
+	}
+	s.loadWebhooks(subscriptions, deliveries)
+
+	s.authMu.Lock()
+	for _, user := range users {
+		s.users[user.ID] = user
+	}
+	for _, customer := range customers {
+		s.customers[customer.ID] = customer
+	}
+	s.authMu.Unlock()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, order := range orders {
+		if order.ID != i+1 {
+			return fmt.Errorf("error loading orders: expected order %d, found %d", i+1, order.ID)
+		}
+		// Share the catalog product so the order sees live stock and details
+		if product, ok := s.catalog[order.Product.ID]; ok {
+			order.Product = product
+		}
+	}
+	s.orders = orders
+	s.rebuildRecommender()
+	for i, review := range reviews {
+		if review.ID != i+1 {
+			return fmt.Errorf("error loading reviews: expected review %d, found %d", i+1, review.ID)
+		}
+	}
+	s.reviews = reviews
+	for i, movement := range ledger {
+		if movement.ID != i+1 {
+			return fmt.Errorf("error loading ledger: expected movement %d, found %d", i+1, movement.ID)
+		}
+	}
+	s.ledger = ledger
+	for _, policy := range policies {
+		s.reorder[policy.ProductID] = policy
+	}
+	for _, policy := range backorders {
+		s.backorders[policy.ProductID] = policy
+	}
+	if s.openLedger() {
+		if err := s.saveLedger(); err != nil {
+			return err
+		}
+	}
+	for i, location := range locations {
+		if location.ID != i+1 {
+			return fmt.Errorf("error loading locations: expected location %d, found %d", i+1, location.ID)
+		}
+	}
+	if len(locations) > 0 {
+		s.locations = locations
+	}
+	if s.syncLocations() {
+		if err := s.saveLocations(); err != nil {
+			return err
+		}
+	}
+	for i, supplier := range suppliers {
+		if supplier.ID != i+1 {
+			return fmt.Errorf("error loading suppliers: expected supplier %d, found %d", i+1, supplier.ID)
+		}
+	}
+	s.suppliers = suppliers
+	for i, po := range purchaseOrders {
+		if po.ID != i+1 {
+			return fmt.Errorf("error loading purchase orders: expected purchase order %d, found %d", i+1, po.ID)
+		}
+		if po.SupplierID < 1 || po.SupplierID > len(suppliers) {
+			return fmt.Errorf("error loading purchase orders: purchase order %d has unknown supplier %d", po.ID, po.SupplierID)
+		}
+	}
+	s.purchaseOrders = purchaseOrders
+
+	s.invoices = make(map[int]*Invoice)
+	s.invoiceSeq = make(map[string]int)
+	for _, invoice := range invoices {
+		s.invoices[invoice.OrderID] = invoice
+		if invoice.Sequence > s.invoiceSeq[invoice.FinancialYear] {
+			s.invoiceSeq[invoice.FinancialYear] = invoice.Sequence
+		}
+	}
+	return nil
+}
@@ -0,0 +1,654 @@
+// Package store holds the product catalog, order handling and HTTP API shared
+// by every storectl subcommand.
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"example.com/lab-08/config"
+)
+
+// ProductManager interface defines product-related operations
+type ProductManager interface {
+	InitializeCatalog() error
+	GetProduct(id int) (*Product, error)
+	DisplayProducts()
+	UpdateStock(id int, quantity int) error
+}
+
+// OrderProcessor interface defines order-related operations
+type OrderProcessor interface {
+	CreateOrder(ctx context.Context, product *Product, quantity int) (*Order, error)
+	ProcessOrder(order *Order)
+	CalculateTotal(order *Order) float64
+}
+
+// DisplayManager interface defines display-related operations
+type DisplayManager interface {
+	DisplayOrderDetails(order *Order)
+	DisplayAllOrders(orders []*Order)
+}
+
+// Product struct to define the structure of a product
+type Product struct {
+	ID        int     `json:"id"`
+	Name      string  `json:"name"`
+	Category  string  `json:"category"`
+	SKU       string  `json:"sku,omitempty"`
+	Price     float64 `json:"price"`
+	Stock     int     `json:"stock"` // the total across every location
+	Image     string  `json:"image,omitempty"`
+	Thumbnail string  `json:"thumbnail,omitempty"`
+}
+
+// Order struct to store order details
+type Order struct {
+	ID        int       `json:"id"`
+	Product   *Product  `json:"product"`
+	Quantity  int       `json:"quantity"`
+	UnitPrice float64   `json:"unitPrice"`
+	Status    string    `json:"status"`
+	CreatedAt time.Time `json:"createdAt"`
+	// RequestID is the ID of the request that placed the order, used to
+	// correlate the order's log lines
+	RequestID string `json:"requestId,omitempty"`
+	// CustomerID is the account the order belongs to, zero for an anonymous
+	// order, which carries a ClaimCode that links it to an account later.
+	// The claim code is only returned to the request that placed the order.
+	CustomerID      int      `json:"customerId,omitempty"`
+	DeliveryAddress *Address `json:"deliveryAddress,omitempty"` // a copy, so later edits leave it alone
+	ClaimCode       string   `json:"-"`
+	// CheckoutID is shared by the orders placed in one checkout, which
+	// recommendations count as bought together
+	CheckoutID int      `json:"checkoutId,omitempty"`
+	Payment    *Payment `json:"payment,omitempty"`
+	// Allocations are the locations the order is fulfilled from, more than
+	// one when no single location had all of it
+	Allocations []Allocation `json:"allocations,omitempty"`
+	// ExpectedAt is when stock was expected for an order taken on backorder
+	ExpectedAt *time.Time `json:"expectedAt,omitempty"`
+	// PendingSince is when the order became payable: when it was placed, or
+	// for a backorder when its stock arrived. Unpaid orders expire from then.
+	PendingSince *time.Time `json:"pendingSince,omitempty"`
+}
+
+// Order states. An order stays pending until its payment is authorized,
+// when it is queued for processing. A backordered order waits for stock
+// first, and may be paid for while it waits.
+const (
+	OrderBackordered = "Backordered"
+	OrderPending     = "Pending"
+	OrderPaid        = "Paid"
+	OrderProcessed   = "Processed"
+	OrderCancelled   = "Cancelled"
+)
+
+// ProductCatalog represents the store's product inventory
+type ProductCatalog map[int]*Product
+
+// ProductData represents the structure of the JSON file
+type ProductData struct {
+	Products []Product `json:"products"`
+}
+
+// Store struct implements all interfaces with concurrency support
+type Store struct {
+	catalog     ProductCatalog
+	catalogFile string
+	lockPath    string // the data directory's lock file while Open holds it
+	mu          sync.RWMutex
+	orders      []*Order
+	invoices    map[int]*Invoice         // keyed by order ID
+	reviews     []*Review                // in ID order, starting at 1
+	ledger      []*StockMovement         // every stock change, in ID order starting at 1
+	reorder     map[int]*ReorderPolicy   // keyed by product ID
+	backorders  map[int]*BackorderPolicy // keyed by product ID
+	locations   []*Location              // in ID order, starting at the default location
+	suppliers   []*Supplier              // in ID order, starting at 1
+	// purchaseOrders are in ID order, starting at 1
+	purchaseOrders []*PurchaseOrder
+	recommender    *recommender
+	checkoutSeq    int // the last checkout ID given out
+	// invoiceSeq holds the last invoice number issued per financial year
+	invoiceSeq map[string]int
+	// dataDir is where orders, invoices and stock changes are persisted;
+	// empty keeps them in memory only
+	dataDir string
+	// mediaDir is where uploaded product images and thumbnails are stored
+	mediaDir string
+	seller   Party
+	logger   *slog.Logger
+	metrics  *metrics
+	// payments authorizes, captures and refunds order payments; s.mu
+	// guards replacing it
+	payments       PaymentProvider
+	paymentTimeout time.Duration
+	// pendingTimeout is how long an unpaid order holds its stock before the
+	// expiry sweep cancels it; closing stopExpiry ends the sweep
+	pendingTimeout time.Duration
+	stopExpiry     chan struct{}
+	expiryDone     chan struct{}
+	// webhooks sends store events to subscribed URLs
+	webhooks *webhooks
+	// Defaults for the reorder report
+	velocityDays int
+	leadTimeDays int
+	coverDays    int
+
+	// Worker pool state; poolMu guards sending on orderChan against Close
+	orderChan     chan *Order
+	workerCount   int
+	idleTimeout   time.Duration
+	activeWorkers int32
+	nextWorkerID  int32
+	poolMu        sync.RWMutex
+	closed        bool
+	workers       sync.WaitGroup
+	// workerStates describes each running worker for the admin endpoint
+	workerStates  map[int]*workerState
+	workerStateMu sync.Mutex
+	// readyQueueDepth is the queue depth at which the store stops being ready
+	readyQueueDepth int
+	// HTTP settings applied by the middleware in Routes
+	corsOrigins       []string
+	maxBodyBytes      int64
+	validateResponses bool
+	rateLimiter       *rateLimiter // nil when rate limiting is disabled
+
+	// Staff and customer accounts and their login sessions; authMu guards
+	// users, customers and sessions
+	authEnabled     bool
+	sessionLifetime time.Duration
+	authMu          sync.Mutex
+	users           map[int]*User
+	customers       map[int]*Customer
+	sessions        map[string]*session // keyed by session token
+}
+
+// NewStore creates a new in-memory store instance with the default settings
+func NewStore() *Store {
+	cfg := config.Default()
+	cfg.Store.DataDir = ""
+	return newStore(cfg)
+}
+
+// newStore creates a store from the configuration and starts its worker pool
+func newStore(cfg *config.Config) *Store {
+	// A secret nobody else knows means no payment webhook is accepted
+	// until one is configured
+	webhookSecret := cfg.Payments.WebhookSecret
+	if webhookSecret == "" {
+		webhookSecret = randomHex(32)
+	}
+	store := &Store{
+		catalog:     make(ProductCatalog),
+		catalogFile: cfg.Store.CatalogFile,
+		dataDir:     cfg.Store.DataDir,
+		mediaDir:    cfg.Store.MediaDir,
+		invoices:    make(map[int]*Invoice),
+		invoiceSeq:  make(map[string]int),
+		recommender: newRecommender(),
+		reorder:     make(map[int]*ReorderPolicy),
+		backorders:  make(map[int]*BackorderPolicy),
+		seller: Party{
+			Name:    cfg.Seller.Name,
+			Address: cfg.Seller.Address,
+			GSTIN:   cfg.Seller.GSTIN,
+		},
+		orderChan:         make(chan *Order, cfg.Workers.QueueSize),
+		workerCount:       cfg.Workers.Count,
+		idleTimeout:       time.Duration(cfg.Workers.IdleTimeout),
+		workerStates:      make(map[int]*workerState),
+		readyQueueDepth:   cfg.Workers.QueueSize * cfg.Workers.ReadyQueuePercent / 100,
+		logger:            NewLogger(os.Stderr, cfg.Log),
+		metrics:           newMetrics(),
+		corsOrigins:       splitList(cfg.Server.CORSOrigins),
+		maxBodyBytes:      int64(cfg.Server.MaxBodyBytes),
+		validateResponses: cfg.Server.ValidateResponses,
+		rateLimiter:       newRateLimiter(cfg.RateLimit),
+		authEnabled:       cfg.Auth.Enabled,
+		sessionLifetime:   time.Duration(cfg.Auth.SessionLifetime),
+		users:             make(map[int]*User),
+		customers:         make(map[int]*Customer),
+		sessions:          make(map[string]*session),
+		payments:          NewMockProvider(cfg.Payments.MockMode, webhookSecret),
+		paymentTimeout:    time.Duration(cfg.Payments.Timeout),
+		pendingTimeout:    time.Duration(cfg.Payments.PendingTimeout),
+		stopExpiry:        make(chan struct{}),
+		expiryDone:        make(chan struct{}),
+		webhooks:          newWebhooks(cfg.Webhooks),
+		velocityDays:      cfg.Inventory.VelocityDays,
+		leadTimeDays:      cfg.Inventory.LeadTimeDays,
+		coverDays:         cfg.Inventory.CoverDays,
+	}
+	// Start the worker pool
+	store.startWorkerPool()
+	go store.expireEvery(min(store.pendingTimeout, time.Minute))
+	return store
+}
+
+// Open creates a store from the configuration, loading the catalog and any
+// previously stored orders and invoices. Every storectl subcommand opens the
+// store this way so they all share the same catalog and order storage.
+func Open(cfg *config.Config) (*Store, error) {
+	store := newStore(cfg)
+	if err := store.lockDataDir(); err != nil {
+		store.Close()
+		return nil, err
+	}
+	if err := store.InitializeCatalog(); err != nil {
+		store.Close()
+		return nil, err
+	}
+	if err := store.LoadState(); err != nil {
+		store.Close()
+		return nil, err
+	}
+	// The first open copies the seed catalog into the data directory
+	if store.dataDir != "" {
+		if _, err := os.Stat(filepath.Join(store.dataDir, productsFile)); errors.Is(err, os.ErrNotExist) {
+			if err := store.SaveCatalog(); err != nil {
+				store.Close()
+				return nil, err
+			}
+		}
+	}
+	return store, nil
+}
+
+// copyOrder returns a copy of an order, with its product and payment, that
+// is safe to use without s.mu. The caller must hold s.mu.
+func copyOrder(order *Order) *Order {
+	copied := *order
+	product := *order.Product
+	copied.Product = &product
+	if order.Payment != nil {
+		payment := *order.Payment
+		payment.Events = slices.Clone(order.Payment.Events)
+		copied.Payment = &payment
+	}
+	copied.Allocations = slices.Clone(order.Allocations)
+	return &copied
+}
+
+// InitializeCatalog implements ProductManager interface. With a data
+// directory the catalog file only seeds the store: once saved, the catalog
+// and its stock are read from the data directory, so the catalog file is
+// never rewritten.
+func (s *Store) InitializeCatalog() error {
+	path := s.catalogFile
+	if s.dataDir != "" {
+		live := filepath.Join(s.dataDir, productsFile)
+		if _, err := os.Stat(live); err == nil {
+			path = live
+		}
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("error reading products file: %v", err)
+	}
+
+	var productData ProductData
+	if err := json.Unmarshal(data, &productData); err != nil {
+		return fmt.Errorf("error parsing products data: %v", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.catalog = make(ProductCatalog)
+	for _, product := range productData.Products {
+		// Create a new product pointer for each product
+		newProduct := product // Copy the product
+		s.catalog[product.ID] = &newProduct
+	}
+	s.openLedger()
+	s.syncLocations()
+
+	return nil
+}
+
+// GetProduct implements ProductManager interface (Call by Reference)
+func (s *Store) GetProduct(id int) (*Product, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	product, exists := s.catalog[id]
+	if !exists {
+		return nil, ErrProductNotFound
+	}
+	return product, nil
+}
+
+// UpdateStock implements ProductManager interface (Call by Reference). When
+// a product that was out of stock gets stock again, customers with it on
+// their wishlist are notified.
+func (s *Store) UpdateStock(id int, quantity int) error {
+	return s.SetStock(context.Background(), id, quantity, "")
+}
+
+// SetStock sets a product's total stock to a counted quantity, recording
+// the difference in the ledger as an adjustment. The locations take up the
+// difference, the default location first.
+func (s *Store) SetStock(ctx context.Context, id int, quantity int, note string) error {
+	return s.SetLocationStock(ctx, id, 0, quantity, note)
+}
+
+// CreateProduct adds a product to the catalog with the next free ID and
+// saves the catalog. It returns a copy that is safe to use without s.mu.
+func (s *Store) CreateProduct(ctx context.Context, p Product) (*Product, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p.ID = 0
+	if err := s.checkProduct(p); err != nil {
+		return nil, err
+	}
+	for id := range s.catalog {
+		p.ID = max(p.ID, id)
+	}
+	p.ID++
+	snapshot := s.snapshotStock(p.ID)
+	product := &p
+	s.catalog[p.ID] = product
+	if err := s.saveCatalog(); err != nil {
+		delete(s.catalog, p.ID)
+		return nil, err
+	}
+	s.recordMovement(product, product.Stock, MovementOpening, "product created", actor(ctx), 0)
+	s.syncLocations()
+	if err := s.saveInventory(snapshot); err != nil {
+		// The product was never created
+		delete(s.catalog, p.ID)
+		if undoErr := s.saveCatalog(); undoErr != nil {
+			s.logger.Error("error undoing a product creation", "error", undoErr)
+		}
+		return nil, err
+	}
+	s.logger.Info("product created", "productId", p.ID, "name", p.Name)
+	copied := *product
+	return &copied, nil
+}
+
+// UpdateProduct replaces a product's details and saves the catalog. The
+// product is changed in place so orders keep pointing at it, and its image
+// is kept unless a new one is given. Raising its stock fills the orders
+// waiting on it. It returns a copy that is safe to use without s.mu.
+func (s *Store) UpdateProduct(ctx context.Context, id int, p Product) (*Product, error) {
+	s.mu.Lock()
+	updated, filled, err := s.updateProduct(ctx, id, p)
+	s.mu.Unlock()
+	s.backordersFilled(ctx, filled)
+	return updated, err
+}
+
+// updateProduct does the work of UpdateProduct and returns the backorders
+// it filled. The caller must hold s.mu.
+func (s *Store) updateProduct(ctx context.Context, id int, p Product) (*Product, []*Order, error) {
+	product, ok := s.catalog[id]
+	if !ok {
+		return nil, nil, ErrProductNotFound
+	}
+	p.ID = id
+	if err := s.checkProduct(p); err != nil {
+		return nil, nil, err
+	}
+	if p.Image == "" {
+		p.Image, p.Thumbnail = product.Image, product.Thumbnail
+	}
+	previous := *product
+	*product = p
+	if err := s.saveCatalog(); err != nil {
+		*product = previous
+		return nil, nil, err
+	}
+	s.recordMovement(product, product.Stock-previous.Stock, MovementAdjustment, "product updated", actor(ctx), 0)
+	if s.syncLocations() {
+		if err := s.saveLocations(); err != nil {
+			return nil, nil, err
+		}
+	}
+	if err := s.saveLedger(); err != nil {
+		return nil, nil, err
+	}
+	s.productChanged(product, previous.Stock)
+	var filled []*Order
+	if product.Stock > previous.Stock {
+		var err error
+		if filled, err = s.fillBackorders(id); err != nil {
+			return nil, nil, err
+		}
+	}
+	s.logger.Info("product updated", "productId", id)
+	copied := *product
+	return &copied, filled, nil
+}
+
+// DeleteProduct removes a product from the catalog and saves it. Past
+// orders keep their copy of the product. Its remaining stock is written off
+// the ledger, so a product that later gets its ID starts from nothing.
+func (s *Store) DeleteProduct(ctx context.Context, id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	product, ok := s.catalog[id]
+	if !ok {
+		return ErrProductNotFound
+	}
+	snapshot := s.snapshotStock(id)
+	delete(s.catalog, id)
+	if err := s.saveCatalog(); err != nil {
+		s.catalog[id] = product
+		return err
+	}
+	if movement := s.recordMovement(product, -product.Stock, MovementWriteOff, "product deleted", actor(ctx), 0); movement != nil {
+		movement.StockAfter = 0
+	}
+	s.syncLocations()
+	if err := s.saveInventory(snapshot); err != nil {
+		// The product was never deleted
+		s.catalog[id] = product
+		if undoErr := s.saveCatalog(); undoErr != nil {
+			s.logger.Error("error undoing a product deletion", "error", undoErr)
+		}
+		return err
+	}
+	if _, ok := s.reorder[id]; ok {
+		delete(s.reorder, id)
+		if err := s.saveReorderPolicies(); err != nil {
+			return err
+		}
+	}
+	if _, ok := s.backorders[id]; ok {
+		delete(s.backorders, id)
+		if err := s.saveBackorderPolicies(); err != nil {
+			return err
+		}
+	}
+	s.logger.Info("product deleted", "productId", id)
+	return nil
+}
+
+// checkProduct validates a product's fields and that its SKU is not used
+// by another product. The caller must hold s.mu.
+func (s *Store) checkProduct(p Product) error {
+	problems := validateProduct(p)
+	if p.SKU != "" {
+		for id, other := range s.catalog {
+			if id != p.ID && other.SKU == p.SKU {
+				problems = append(problems, fmt.Sprintf("sku %q is already used by product %d", p.SKU, id))
+			}
+		}
+	}
+	if len(problems) > 0 {
+		return &InvalidProductError{Problems: problems}
+	}
+	return nil
+}
+
+// DisplayProducts implements ProductManager interface (Call by Value)
+func (s *Store) DisplayProducts() {
+	fmt.Println("Available Products:")
+	for _, product := range s.Products() {
+		fmt.Printf("ID: %d, Name: %s, Category: %s, Price: ₹%.2f, Stock: %d\n",
+			product.ID, product.Name, product.Category, product.Price, product.Stock)
+	}
+}
+
+// ValidateQuantity checks if the quantity is valid (Call by Value)
+func ValidateQuantity(quantity int) error {
+	if quantity < 0 {
+		return ErrInvalidQuantity
+	}
+	return nil
+}
+
+// CreateOrder implements OrderProcessor interface (Call by Reference). The
+// request ID carried by ctx is recorded on the order so the worker that
+// processes it logs under the same ID, and the order belongs to the owner
+// set with WithOrderOwner. Stock already promised to backorders cannot be
+// sold; an order for more than is left is taken on backorder when the
+// product's backorder limit allows.
+func (s *Store) CreateOrder(ctx context.Context, product *Product, quantity int) (*Order, error) {
+	logger := s.log(ctx)
+	if err := ValidateQuantity(quantity); err != nil {
+		logger.Warn("order rejected", "reason", err.Error(), "quantity", quantity)
+		s.metrics.checkoutFailed(failureInvalidQuantity)
+		return nil, err
+	}
+	if product == nil {
+		return nil, errors.New("product cannot be nil")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Check stock before creating order
+	backordered := s.backordered(product.ID)
+	available := product.Stock - backordered
+	backorder := quantity > 0 && available < quantity
+	policy := s.backorders[product.ID]
+	if backorder && (policy == nil || backordered+quantity > policy.Limit) {
+		logger.Warn("order rejected", "reason", "insufficient stock",
+			"productId", product.ID, "quantity", quantity, "available", max(available, 0))
+		s.metrics.checkoutFailed(failureInsufficientStock)
+		return nil, &InsufficientStockError{ProductID: product.ID, Requested: quantity, Available: max(available, 0)}
+	}
+	// Create the order first
+	owner := orderOwner(ctx)
+	order := &Order{
+		ID:              len(s.orders) + 1,
+		Product:         product,
+		Quantity:        quantity,
+		UnitPrice:       product.Price,
+		Status:          OrderPending,
+		CreatedAt:       time.Now(),
+		RequestID:       RequestID(ctx),
+		CustomerID:      owner.CustomerID,
+		DeliveryAddress: owner.Address,
+		ClaimCode:       owner.ClaimCode,
+		CheckoutID:      s.checkoutID(ctx),
+	}
+	// Then take the ordered quantity from the locations nearest the
+	// delivery address; a backorder waits for stock to arrive
+	previousStock := product.Stock
+	snapshot := s.snapshotStock(product.ID)
+	if backorder {
+		order.Status, order.ExpectedAt = OrderBackordered, policy.ExpectedAt
+	} else {
+		order.PendingSince = &order.CreatedAt
+		s.takeStock(order, "", orderBuyer(order))
+	}
+	// If anything fails to save the order never happened: its stock goes
+	// back and the order is dropped again
+	s.orders = append(s.orders, order)
+	if err := s.saveOrders(); err != nil {
+		s.orders = s.orders[:len(s.orders)-1]
+		s.restoreStock(snapshot)
+		s.metrics.checkoutFailed(failureStorage)
+		return nil, err
+	}
+	if err := s.saveInventory(snapshot); err != nil {
+		s.orders = s.orders[:len(s.orders)-1]
+		if saveErr := s.saveOrders(); saveErr != nil {
+			logger.Error("error dropping the unsaved order", "orderId", order.ID, "error", saveErr)
+		}
+		s.metrics.checkoutFailed(failureStorage)
+		return nil, err
+	}
+	s.recommender.add(order)
+	s.emit(EventOrderCreated, order)
+	s.stockChanged(product, previousStock)
+	s.metrics.ordersCreated.Add(1)
+	s.orderLog(order).Info("order created", "productId", product.ID, "quantity", quantity,
+		"total", s.CalculateTotal(order), "locations", len(order.Allocations), "status", order.Status)
+	return order, nil
+}
+
+// GetOrder returns a stored order by its ID
+func (s *Store) GetOrder(id int) (*Order, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if id < 1 || id > len(s.orders) {
+		return nil, ErrOrderNotFound
+	}
+	return s.orders[id-1], nil
+}
+
+// Orders returns every stored order, oldest first
+func (s *Store) Orders() []*Order {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return append([]*Order(nil), s.orders...)
+}
+
+// CalculateTotal implements OrderProcessor interface (Call by Reference)
+func (s *Store) CalculateTotal(order *Order) float64 {
+	return float64(order.Quantity) * order.price()
+}
+
+// price returns the unit price captured when the order was placed,
+// falling back to the current product price for hand-built orders
+func (o *Order) price() float64 {
+	if o.UnitPrice == 0 {
+		return o.Product.Price
+	}
+	return o.UnitPrice
+}
+
+// DisplayOrderDetails implements DisplayManager interface (Call by Reference)
+func (s *Store) DisplayOrderDetails(order *Order) {
+	totalPrice := s.CalculateTotal(order)
+
+	fmt.Printf("\nFinal Product Details:\n")
+	fmt.Printf("ID: %d\n", order.Product.ID)
+	fmt.Printf("Name: %s\n", order.Product.Name)
+	fmt.Printf("Category: %s\n", order.Product.Category)
+	fmt.Printf("Price: ₹%.2f\n", order.price())
+	fmt.Printf("Quantity: %d\n", order.Quantity)
+	fmt.Printf("Total Price: ₹%.2f\n", totalPrice)
+}
+
+// DisplayAllOrders implements DisplayManager interface (Call by Reference)
+func (s *Store) DisplayAllOrders(orders []*Order) {
+	fmt.Println("\nAll Orders:")
+	var grandTotal float64
+	for i, order := range orders {
+		orderTotal := s.CalculateTotal(order)
+		grandTotal += orderTotal
+		fmt.Printf("Order %d: %s x%d - ₹%.2f\n",
+			i+1, order.Product.Name, order.Quantity, orderTotal)
+	}
+	fmt.Printf("\nGrand Total: ₹%.2f\n", grandTotal)
+}
@@ -0,0 +1,379 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"example.com/lab-08/config"
+)
+
+// testCatalog is the product fixture every test store loads
+const testCatalog = "testdata/products.json"
+
+// newTestStore returns an in-memory store that loads the test catalog
+func newTestStore() *Store {
+	store := NewStore()
+	store.catalogFile = testCatalog
+	return store
+}
+
+func TestInitializeCatalog(t *testing.T) {
+	store := newTestStore()
+	err := store.InitializeCatalog()
+	if err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+	if len(store.catalog) == 0 {
+		t.Errorf("Expected catalog to be initialized, got empty catalog")
+	}
+}
+
+func TestGetProduct(t *testing.T) {
+	store := newTestStore()
+	store.InitializeCatalog()
+	product, err := store.GetProduct(1)
+	if err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+	if product == nil {
+		t.Errorf("Expected product, got nil")
+	}
+}
+
+func TestUpdateStock(t *testing.T) {
+	store := newTestStore()
+	store.InitializeCatalog()
+	err := store.UpdateStock(1, 5)
+	if err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+	product, _ := store.GetProduct(1)
+	if product.Stock != 5 {
+		t.Errorf("Expected stock to be 5, got %d", product.Stock)
+	}
+}
+
+func TestCreateOrder(t *testing.T) {
+	store := newTestStore()
+	store.InitializeCatalog()
+	product, _ := store.GetProduct(1)
+	order, err := store.CreateOrder(context.Background(), product, 2)
+	if err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+	if order.Quantity != 2 {
+		t.Errorf("Expected quantity to be 2, got %d", order.Quantity)
+	}
+}
+
+func TestCalculateTotal(t *testing.T) {
+	store := newTestStore()
+	store.InitializeCatalog()
+	product, _ := store.GetProduct(1)
+	order, _ := store.CreateOrder(context.Background(), product, 2)
+	total := store.CalculateTotal(order)
+	expectedTotal := product.Price * 2
+	if total != expectedTotal {
+		t.Errorf("Expected total to be %v, got %v", expectedTotal, total)
+	}
+}
+
+func TestGetProductInvalidID(t *testing.T) {
+	store := newTestStore()
+	store.InitializeCatalog()
+
+	tests := []struct {
+		name string
+		id   int
+	}{
+		{"non-existent id", 999},
+		{"negative id", -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			product, err := store.GetProduct(tt.id)
+			if err == nil {
+				t.Errorf("Expected error for %s, got nil", tt.name)
+			}
+			if product != nil {
+				t.Errorf("Expected no product for %s, got %v", tt.name, product)
+			}
+		})
+	}
+}
+
+func TestUpdateStockNegative(t *testing.T) {
+	store := newTestStore()
+	store.InitializeCatalog()
+	err := store.UpdateStock(1, -5)
+	if err == nil {
+		t.Errorf("Expected error for negative stock update, got nil")
+	}
+}
+
+func TestCreateOrderExceedsStock(t *testing.T) {
+	store := newTestStore()
+	store.InitializeCatalog()
+	store.UpdateStock(1, 5) // Set known stock
+
+	product, _ := store.GetProduct(1)
+	_, err := store.CreateOrder(context.Background(), product, 6)
+	if err == nil {
+		t.Errorf("Expected error for quantity exceeding stock, got nil")
+	}
+}
+
+func TestProductsJSONLoading(t *testing.T) {
+	store := newTestStore()
+	err := store.InitializeCatalog()
+	if err != nil {
+		t.Fatalf("Failed to load products: %v", err)
+	}
+
+	if len(store.catalog) == 0 {
+		t.Fatal("Catalog failed to load from JSON")
+	}
+
+	// Verify at least one product has non-zero fields
+	product, _ := store.GetProduct(1)
+	if product.Name == "" || product.Price <= 0 {
+		t.Errorf("Invalid product data loaded from JSON: %+v", product)
+	}
+}
+
+func TestCalculateTotalTableDriven(t *testing.T) {
+	tests := []struct {
+		name     string
+		quantity int
+		expected float64
+	}{
+		{"single item", 1, 40.00},
+		{"multiple items", 3, 120.00},
+		{"zero quantity", 0, 0.00},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Create a new store instance for each test case
+			store := newTestStore()
+			if err := store.InitializeCatalog(); err != nil {
+				t.Fatalf("Failed to initialize catalog: %v", err)
+			}
+
+			product, err := store.GetProduct(1)
+			if err != nil {
+				t.Fatalf("Failed to get product: %v", err)
+			}
+
+			order, err := store.CreateOrder(context.Background(), product, tt.quantity)
+			if err != nil {
+				t.Fatalf("Failed to create order: %v", err)
+			}
+			total := store.CalculateTotal(order)
+			if total != tt.expected {
+				t.Errorf("Expected %.2f, got %.2f", tt.expected, total)
+			}
+		})
+	}
+}
+func TestOpenSharesStorage(t *testing.T) {
+	dir := t.TempDir()
+	data, _ := os.ReadFile(testCatalog)
+	cfg := config.Default()
+	cfg.Store.CatalogFile = filepath.Join(dir, "products.json")
+	cfg.Store.DataDir = filepath.Join(dir, "data")
+	os.WriteFile(cfg.Store.CatalogFile, data, 0o644)
+
+	first, err := Open(cfg)
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	product, _ := first.GetProduct(2)
+	order, _ := first.CreateOrder(context.Background(), product, 4)
+	first.PayOrder(context.Background(), order)
+	first.Close()
+
+	// A second store on the same files sees the order, its status and the stock change
+	second, err := Open(cfg)
+	if err != nil {
+		t.Fatalf("Failed to reopen store: %v", err)
+	}
+	defer second.Close()
+
+	reloaded, err := second.GetOrder(order.ID)
+	if err != nil {
+		t.Fatalf("Expected stored order, got %v", err)
+	}
+	if reloaded.Status != "Processed" {
+		t.Errorf("Expected order to be processed, got %s", reloaded.Status)
+	}
+	if laptop, _ := second.GetProduct(2); laptop.Stock != 6 {
+		t.Errorf("Expected stock 6 after reopening, got %d", laptop.Stock)
+	}
+}
+
+func TestOpenLocksDataDir(t *testing.T) {
+	dir := t.TempDir()
+	data, _ := os.ReadFile(testCatalog)
+	cfg := config.Default()
+	cfg.Store.CatalogFile = filepath.Join(dir, "products.json")
+	cfg.Store.DataDir = filepath.Join(dir, "data")
+	os.WriteFile(cfg.Store.CatalogFile, data, 0o644)
+
+	first, err := Open(cfg)
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	if _, err := Open(cfg); err == nil {
+		t.Fatal("Expected a second store on the same data directory to be refused")
+	}
+
+	// Orders change the live catalog in the data directory, not the seed file
+	product, _ := first.GetProduct(2)
+	if _, err := first.CreateOrder(context.Background(), product, 4); err != nil {
+		t.Fatal(err)
+	}
+	if seed, _ := os.ReadFile(cfg.Store.CatalogFile); string(seed) != string(data) {
+		t.Error("Expected the seed catalog to be left unchanged")
+	}
+	first.Close()
+
+	second, err := Open(cfg)
+	if err != nil {
+		t.Fatalf("Expected the data directory to be free after closing, got %v", err)
+	}
+	defer second.Close()
+	if laptop, _ := second.GetProduct(2); laptop.Stock != 6 {
+		t.Errorf("Expected stock 6 from the live catalog, got %d", laptop.Stock)
+	}
+}
+
+func TestCreateOrderUndoneWhenSaveFails(t *testing.T) {
+	dir := t.TempDir()
+	data, _ := os.ReadFile(testCatalog)
+	cfg := config.Default()
+	cfg.Store.CatalogFile = filepath.Join(dir, "products.json")
+	cfg.Store.DataDir = filepath.Join(dir, "data")
+	os.WriteFile(cfg.Store.CatalogFile, data, 0o644)
+
+	store, err := Open(cfg)
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	defer store.Close()
+	// A directory in the way of the ledger's temporary file fails its save
+	os.MkdirAll(filepath.Join(cfg.Store.DataDir, ledgerFile+".tmp"), 0o755)
+
+	product, _ := store.GetProduct(2)
+	if _, err := store.CreateOrder(context.Background(), product, 4); err == nil {
+		t.Fatal("Expected the order to fail when the ledger cannot be saved")
+	}
+	if product.Stock != 10 || len(store.Orders()) != 0 || len(store.Ledger(2, MovementSale, 10)) != 0 {
+		t.Errorf("Expected the order to be undone, got stock %d and %d orders", product.Stock, len(store.Orders()))
+	}
+}
+
+func TestProcessOrderAfterClose(t *testing.T) {
+	store := newTestStore()
+	store.InitializeCatalog()
+	product, _ := store.GetProduct(1)
+	order, _ := store.CreateOrder(context.Background(), product, 1)
+
+	store.Close()
+	store.ProcessOrder(order) // must not panic
+	if order.Status != OrderPending {
+		t.Errorf("Expected order queued after Close to stay Pending, got %s", order.Status)
+	}
+}
+
+func TestIdleWorkersStop(t *testing.T) {
+	cfg := config.Default()
+	cfg.Store.DataDir = ""
+	cfg.Store.CatalogFile = testCatalog
+	cfg.Workers.IdleTimeout = config.Duration(20 * time.Millisecond)
+	store := newStore(cfg)
+	defer store.Close()
+
+	// All but the last worker stop once they have been idle for the timeout
+	deadline := time.Now().Add(2 * time.Second)
+	for atomic.LoadInt32(&store.activeWorkers) > 1 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if active := atomic.LoadInt32(&store.activeWorkers); active != 1 {
+		t.Fatalf("Expected 1 active worker after idling, got %d", active)
+	}
+
+	// Queued orders are still processed by the remaining worker
+	store.InitializeCatalog()
+	product, _ := store.GetProduct(1)
+	order, _ := store.CreateOrder(context.Background(), product, 1)
+	store.PayOrder(context.Background(), order)
+	store.Close()
+	if order.Status != "Processed" {
+		t.Errorf("Expected order to be processed, got %s", order.Status)
+	}
+}
+
+func TestProductChangesReturnCopies(t *testing.T) {
+	store := newTestStore()
+	store.catalogFile = filepath.Join(t.TempDir(), "products.json")
+	data, _ := os.ReadFile(testCatalog)
+	os.WriteFile(store.catalogFile, data, 0o644)
+	store.InitializeCatalog()
+	defer store.Close()
+	ctx := context.Background()
+
+	created, err := store.CreateProduct(ctx, Product{Name: "Pear", Category: "Grocery", Price: 30, Stock: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	created.Stock = 99
+	updated, err := store.UpdateProduct(ctx, 1, Product{Name: "Apple", Category: "Grocery", Price: 42, Stock: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	updated.Price = 1
+
+	// The returned products can be encoded without s.mu, so changing them
+	// must not reach the catalog
+	if pear, _ := store.GetProduct(created.ID); pear.Stock != 5 {
+		t.Errorf("Expected the created product to be a copy, got stock %d", pear.Stock)
+	}
+	if apple, _ := store.GetProduct(1); apple.Price != 42 {
+		t.Errorf("Expected the updated product to be a copy, got price %v", apple.Price)
+	}
+}
+
+func TestProductChangesUndoneWhenSaveFails(t *testing.T) {
+	store := openDataStore(t)
+	ctx := context.Background()
+	os.MkdirAll(filepath.Join(store.dataDir, ledgerFile+".tmp"), 0o755)
+
+	product := Product{Name: "Rice", Category: "Grocery", Price: 300, Stock: 20}
+	if _, err := store.CreateProduct(ctx, product); err == nil {
+		t.Fatal("Expected the product not to be created when the ledger cannot be saved")
+	}
+	if _, err := store.GetProduct(4); !errors.Is(err, ErrProductNotFound) || store.Locations()[0].Stock[4] != 0 {
+		t.Errorf("Expected the product not to exist, got %v", err)
+	}
+
+	if err := store.DeleteProduct(ctx, 2); err == nil {
+		t.Fatal("Expected the product not to be deleted when the ledger cannot be saved")
+	}
+	if laptop, err := store.GetProduct(2); err != nil || laptop.Stock != 10 || store.Locations()[0].Stock[2] != 10 {
+		t.Errorf("Expected the product to keep its stock, got %v", err)
+	}
+	var catalog ProductData
+	data, _ := os.ReadFile(filepath.Join(store.dataDir, productsFile))
+	json.Unmarshal(data, &catalog)
+	if len(catalog.Products) != 3 {
+		t.Errorf("Expected the saved catalog to be unchanged, got %d products", len(catalog.Products))
+	}
+}
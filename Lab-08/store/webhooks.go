@@ -0,0 +1,561 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"example.com/lab-08/config"
+)
+
+// Store events sent to webhook subscriptions
+const (
+	EventOrderCreated       = "order.created"
+	EventOrderStatusChanged = "order.status_changed"
+	EventStockLow           = "stock.low"
+	EventProductUpdated     = "product.updated"
+)
+
+// WebhookEvents are the events a subscription can ask for
+var WebhookEvents = []string{EventOrderCreated, EventOrderStatusChanged, EventStockLow, EventProductUpdated}
+
+// Delivery states
+const (
+	DeliveryPending   = "pending" // waiting for its next attempt
+	DeliverySucceeded = "succeeded"
+	DeliveryFailed    = "failed" // every attempt failed
+)
+
+// Headers sent with every webhook delivery. The signature is
+// "sha256=" and the hex HMAC-SHA256, keyed with the subscription's secret,
+// of the timestamp, a dot and the body.
+const (
+	WebhookEventHeader     = "X-Store-Event"
+	WebhookDeliveryHeader  = "X-Store-Delivery"
+	WebhookTimestampHeader = "X-Store-Timestamp"
+	WebhookSignatureHeader = "X-Store-Signature"
+)
+
+// maxDeliveries is how many deliveries the delivery log keeps
+const maxDeliveries = 500
+
+// Subscription sends the events it asks for to a URL
+type Subscription struct {
+	ID          int       `json:"id"`
+	URL         string    `json:"url"`
+	Events      []string  `json:"events"`
+	Description string    `json:"description,omitempty"`
+	Secret      string    `json:"secret,omitempty"` // only shown when the subscription is created
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+// public returns a copy of the subscription without its secret
+func (sub *Subscription) public() *Subscription {
+	copied := *sub
+	copied.Secret = ""
+	return &copied
+}
+
+// WebhookEvent is the body of a webhook delivery
+type WebhookEvent struct {
+	ID        string    `json:"id"`
+	Type      string    `json:"type"`
+	CreatedAt time.Time `json:"createdAt"`
+	Data      any       `json:"data"`
+}
+
+// Delivery is one event sent to one subscription, with every attempt made
+// to send it
+type Delivery struct {
+	ID             int               `json:"id"`
+	SubscriptionID int               `json:"subscriptionId"`
+	EventID        string            `json:"eventId"`
+	EventType      string            `json:"eventType"`
+	Payload        json.RawMessage   `json:"payload"` // the body as sent
+	Status         string            `json:"status"`
+	Attempts       []DeliveryAttempt `json:"attempts"`
+	NextAttemptAt  *time.Time        `json:"nextAttemptAt,omitempty"`
+	CreatedAt      time.Time         `json:"createdAt"`
+}
+
+// DeliveryAttempt is one try at sending a delivery
+type DeliveryAttempt struct {
+	At         time.Time `json:"at"`
+	StatusCode int       `json:"statusCode,omitempty"` // zero when no response came back
+	Error      string    `json:"error,omitempty"`
+	DurationMs float64   `json:"durationMs"`
+	Manual     bool      `json:"manual,omitempty"` // asked for with the redeliver endpoint
+}
+
+// webhooks holds the subscriptions and the delivery log. mu guards every
+// field and is never held while sending; s.mu may be held when taking it.
+type webhooks struct {
+	mu            sync.Mutex
+	subscriptions []*Subscription
+	deliveries    []*Delivery // oldest first
+	lastID        int         // the last subscription ID given out
+	lastDelivery  int
+	timers        map[int]*time.Timer // scheduled attempts, keyed by delivery ID
+	closed        bool
+
+	maxAttempts int
+	backoff     time.Duration
+	lowStock    int
+	client      *http.Client
+	// inflight counts scheduled and running attempts; ctx is cancelled on
+	// Close so attempts in progress give up
+	inflight sync.WaitGroup
+	ctx      context.Context
+	cancel   context.CancelFunc
+}
+
+// newWebhooks creates the webhook state from the configuration
+func newWebhooks(cfg config.WebhooksConfig) *webhooks {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &webhooks{
+		timers:      make(map[int]*time.Timer),
+		maxAttempts: cfg.MaxAttempts,
+		backoff:     time.Duration(cfg.RetryBackoff),
+		lowStock:    cfg.LowStockThreshold,
+		client:      &http.Client{Timeout: time.Duration(cfg.Timeout)},
+		ctx:         ctx,
+		cancel:      cancel,
+	}
+}
+
+// subscription returns a subscription by ID. The caller must hold wh.mu.
+func (wh *webhooks) subscription(id int) *Subscription {
+	for _, sub := range wh.subscriptions {
+		if sub.ID == id {
+			return sub
+		}
+	}
+	return nil
+}
+
+// delivery returns a delivery by ID. The caller must hold wh.mu.
+func (wh *webhooks) delivery(id int) *Delivery {
+	for _, delivery := range wh.deliveries {
+		if delivery.ID == id {
+			return delivery
+		}
+	}
+	return nil
+}
+
+// saveWebhooks persists the subscriptions. The caller must hold s.webhooks.mu.
+func (s *Store) saveWebhooks() error {
+	return s.writeJSONFile(webhooksFile, s.webhooks.subscriptions)
+}
+
+// saveDeliveries persists the delivery log. The caller must hold
+// s.webhooks.mu.
+func (s *Store) saveDeliveries() error {
+	return s.writeJSONFile(deliveriesFile, s.webhooks.deliveries)
+}
+
+// loadWebhooks restores the subscriptions and delivery log and schedules the
+// deliveries that were still pending
+func (s *Store) loadWebhooks(subscriptions []*Subscription, deliveries []*Delivery) {
+	wh := s.webhooks
+	wh.mu.Lock()
+	defer wh.mu.Unlock()
+
+	wh.subscriptions, wh.deliveries = subscriptions, deliveries
+	for _, sub := range subscriptions {
+		wh.lastID = max(wh.lastID, sub.ID)
+	}
+	for _, delivery := range deliveries {
+		wh.lastDelivery = max(wh.lastDelivery, delivery.ID)
+		if delivery.Status == DeliveryPending {
+			wait := time.Duration(0)
+			if delivery.NextAttemptAt != nil {
+				wait = time.Until(*delivery.NextAttemptAt)
+			}
+			s.scheduleDelivery(delivery, max(wait, 0), false)
+		}
+	}
+}
+
+// Subscriptions returns every webhook subscription without its secret
+func (s *Store) Subscriptions() []*Subscription {
+	s.webhooks.mu.Lock()
+	defer s.webhooks.mu.Unlock()
+
+	subscriptions := make([]*Subscription, len(s.webhooks.subscriptions))
+	for i, sub := range s.webhooks.subscriptions {
+		subscriptions[i] = sub.public()
+	}
+	return subscriptions
+}
+
+// Subscribe adds a webhook subscription with a new signing secret. The
+// returned copy is the only one that carries the secret.
+func (s *Store) Subscribe(target, description string, events []string) (*Subscription, error) {
+	parsed, err := url.Parse(target)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return nil, ErrInvalidWebhookURL
+	}
+	if len(events) == 0 {
+		return nil, ErrInvalidWebhookEvent
+	}
+	for _, event := range events {
+		if !slices.Contains(WebhookEvents, event) {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidWebhookEvent, event)
+		}
+	}
+
+	wh := s.webhooks
+	wh.mu.Lock()
+	defer wh.mu.Unlock()
+
+	wh.lastID++
+	sub := &Subscription{
+		ID:          wh.lastID,
+		URL:         target,
+		Events:      slices.Compact(slices.Sorted(slices.Values(events))),
+		Description: strings.TrimSpace(description),
+		Secret:      "whsec_" + randomHex(24),
+		CreatedAt:   time.Now(),
+	}
+	wh.subscriptions = append(wh.subscriptions, sub)
+	if err := s.saveWebhooks(); err != nil {
+		wh.subscriptions = wh.subscriptions[:len(wh.subscriptions)-1]
+		return nil, err
+	}
+	s.logger.Info("webhook subscribed", "subscriptionId", sub.ID, "url", sub.URL, "events", sub.Events)
+	copied := *sub
+	return &copied, nil
+}
+
+// Unsubscribe removes a webhook subscription. Its pending deliveries fail
+// at their next attempt.
+func (s *Store) Unsubscribe(id int) error {
+	wh := s.webhooks
+	wh.mu.Lock()
+	defer wh.mu.Unlock()
+
+	i := slices.IndexFunc(wh.subscriptions, func(sub *Subscription) bool { return sub.ID == id })
+	if i < 0 {
+		return ErrSubscriptionNotFound
+	}
+	wh.subscriptions = slices.Delete(wh.subscriptions, i, i+1)
+	s.logger.Info("webhook unsubscribed", "subscriptionId", id)
+	return s.saveWebhooks()
+}
+
+// Deliveries returns the delivery log of a subscription, newest first
+func (s *Store) Deliveries(subscriptionID int) ([]*Delivery, error) {
+	wh := s.webhooks
+	wh.mu.Lock()
+	defer wh.mu.Unlock()
+
+	if wh.subscription(subscriptionID) == nil {
+		return nil, ErrSubscriptionNotFound
+	}
+	deliveries := []*Delivery{}
+	for i := len(wh.deliveries) - 1; i >= 0; i-- {
+		if delivery := wh.deliveries[i]; delivery.SubscriptionID == subscriptionID {
+			copied := *delivery
+			copied.Attempts = slices.Clone(delivery.Attempts)
+			deliveries = append(deliveries, &copied)
+		}
+	}
+	return deliveries, nil
+}
+
+// Redeliver sends a delivery again straight away, whatever became of it.
+// The attempt is added to its log, and is not retried if it fails.
+func (s *Store) Redeliver(id int) (*Delivery, error) {
+	wh := s.webhooks
+	wh.mu.Lock()
+	defer wh.mu.Unlock()
+
+	delivery := wh.delivery(id)
+	if delivery == nil || wh.subscription(delivery.SubscriptionID) == nil {
+		return nil, ErrDeliveryNotFound
+	}
+	if timer, ok := wh.timers[id]; ok && timer.Stop() {
+		delete(wh.timers, id)
+		wh.inflight.Done()
+	}
+	delivery.Status, delivery.NextAttemptAt = DeliveryPending, nil
+	s.scheduleDelivery(delivery, 0, true)
+	copied := *delivery
+	copied.Attempts = slices.Clone(delivery.Attempts)
+	return &copied, nil
+}
+
+// emit sends an event to every subscription that asked for it. The data
+// is encoded straight away, so callers may hold s.mu to get a consistent
+// view of it.
+func (s *Store) emit(eventType string, data any) {
+	wh := s.webhooks
+	wh.mu.Lock()
+	defer wh.mu.Unlock()
+
+	var subscribers []*Subscription
+	for _, sub := range wh.subscriptions {
+		if slices.Contains(sub.Events, eventType) {
+			subscribers = append(subscribers, sub)
+		}
+	}
+	if len(subscribers) == 0 || wh.closed {
+		return
+	}
+	event := WebhookEvent{ID: "evt_" + randomHex(12), Type: eventType, CreatedAt: time.Now(), Data: data}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		s.logger.Error("error encoding webhook event", "event", eventType, "error", err)
+		return
+	}
+	for _, sub := range subscribers {
+		wh.lastDelivery++
+		delivery := &Delivery{
+			ID:             wh.lastDelivery,
+			SubscriptionID: sub.ID,
+			EventID:        event.ID,
+			EventType:      eventType,
+			Payload:        payload,
+			Status:         DeliveryPending,
+			Attempts:       []DeliveryAttempt{},
+			CreatedAt:      event.CreatedAt,
+		}
+		wh.deliveries = append(wh.deliveries, delivery)
+		s.scheduleDelivery(delivery, 0, false)
+	}
+	// Forget the oldest deliveries, unless they are still being sent
+	for len(wh.deliveries) > maxDeliveries && wh.deliveries[0].Status != DeliveryPending {
+		wh.deliveries = wh.deliveries[1:]
+	}
+	if err := s.saveDeliveries(); err != nil {
+		s.logger.Error("error saving webhook deliveries", "error", err)
+	}
+}
+
+// scheduleDelivery makes the next attempt at a delivery after wait. The
+// caller must hold s.webhooks.mu.
+func (s *Store) scheduleDelivery(delivery *Delivery, wait time.Duration, manual bool) {
+	wh := s.webhooks
+	if wh.closed {
+		return
+	}
+	id := delivery.ID
+	wh.inflight.Add(1)
+	wh.timers[id] = time.AfterFunc(wait, func() {
+		defer wh.inflight.Done()
+		s.attemptDelivery(id, manual)
+	})
+}
+
+// attemptDelivery sends a delivery once and records the attempt. A failed
+// automatic attempt is retried with exponential backoff until the
+// delivery runs out of attempts.
+func (s *Store) attemptDelivery(id int, manual bool) {
+	wh := s.webhooks
+	wh.mu.Lock()
+	delete(wh.timers, id)
+	delivery := wh.delivery(id)
+	if delivery == nil || wh.closed {
+		wh.mu.Unlock()
+		return
+	}
+	sub := wh.subscription(delivery.SubscriptionID)
+	if sub == nil {
+		delivery.Status, delivery.NextAttemptAt = DeliveryFailed, nil
+		delivery.Attempts = append(delivery.Attempts, DeliveryAttempt{At: time.Now(), Error: "subscription was removed", Manual: manual})
+		s.saveDeliveries()
+		wh.mu.Unlock()
+		return
+	}
+	target, secret, payload, eventType := sub.URL, sub.Secret, delivery.Payload, delivery.EventType
+	wh.mu.Unlock()
+
+	attempt := DeliveryAttempt{At: time.Now(), Manual: manual}
+	statusCode, err := s.sendWebhook(target, secret, id, eventType, payload)
+	attempt.DurationMs = float64(time.Since(attempt.At).Microseconds()) / 1000
+	attempt.StatusCode = statusCode
+	if err != nil {
+		attempt.Error = err.Error()
+	}
+
+	wh.mu.Lock()
+	defer wh.mu.Unlock()
+	// An attempt cut short by Close is not counted, so it is made again
+	// when the store next starts
+	if wh.closed {
+		return
+	}
+	delivery.Attempts = append(delivery.Attempts, attempt)
+	delivery.NextAttemptAt = nil
+	logger := s.logger.With("deliveryId", id, "subscriptionId", delivery.SubscriptionID, "event", eventType,
+		"attempt", len(delivery.Attempts), "statusCode", statusCode)
+	switch {
+	case err == nil:
+		delivery.Status = DeliverySucceeded
+		logger.Info("webhook delivered")
+	case manual || len(delivery.Attempts) >= wh.maxAttempts:
+		delivery.Status = DeliveryFailed
+		logger.Warn("webhook delivery failed", "error", err)
+	default:
+		// Back off 1, 2, 4... times the configured wait for each retry
+		wait := wh.backoff << (len(delivery.Attempts) - 1)
+		next := time.Now().Add(wait)
+		delivery.NextAttemptAt = &next
+		s.scheduleDelivery(delivery, wait, false)
+		logger.Warn("webhook delivery failed, will retry", "error", err, "retryIn", wait.String())
+	}
+	if err := s.saveDeliveries(); err != nil {
+		s.logger.Error("error saving webhook deliveries", "error", err)
+	}
+}
+
+// sendWebhook posts a signed payload and returns the response status. Any
+// status other than 2xx is an error.
+func (s *Store) sendWebhook(target, secret string, deliveryID int, eventType string, payload []byte) (int, error) {
+	wh := s.webhooks
+	req, err := http.NewRequestWithContext(wh.ctx, http.MethodPost, target, bytes.NewReader(payload))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "storectl-webhooks")
+	req.Header.Set(WebhookEventHeader, eventType)
+	req.Header.Set(WebhookDeliveryHeader, strconv.Itoa(deliveryID))
+	req.Header.Set(WebhookTimestampHeader, timestamp)
+	req.Header.Set(WebhookSignatureHeader, SignWebhook(secret, timestamp, payload))
+
+	resp, err := wh.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("receiver answered %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// SignWebhook returns the X-Store-Signature value for a webhook body sent
+// at timestamp, in Unix seconds. Receivers compute the same value to check
+// the body came from the store.
+func SignWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// closeWebhooks stops scheduling deliveries, gives up attempts in progress
+// and waits for them. Pending deliveries are sent when the store next
+// starts.
+func (s *Store) closeWebhooks() {
+	wh := s.webhooks
+	wh.mu.Lock()
+	if !wh.closed {
+		wh.closed = true
+		wh.cancel()
+		for id, timer := range wh.timers {
+			if timer.Stop() {
+				wh.inflight.Done()
+			}
+			delete(wh.timers, id)
+		}
+	}
+	wh.mu.Unlock()
+	wh.inflight.Wait()
+}
+
+// orderStatusChanged sends order.status_changed. The caller must hold s.mu.
+func (s *Store) orderStatusChanged(order *Order, previous string) {
+	s.emit(EventOrderStatusChanged, map[string]any{"order": order, "previousStatus": previous})
+}
+
+// productChanged sends product.updated, and alerts when the product's
+// stock has just fallen to its reorder point. The caller must hold s.mu.
+func (s *Store) productChanged(product *Product, previousStock int) {
+	s.emit(EventProductUpdated, product)
+	s.stockChanged(product, previousStock)
+}
+
+// handleListWebhooks serves GET /api/admin/webhooks
+func (s *Store) handleListWebhooks(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.Subscriptions())
+}
+
+// handleCreateWebhook serves POST /api/admin/webhooks
+func (s *Store) handleCreateWebhook(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		URL         string   `json:"url"`
+		Events      []string `json:"events"`
+		Description string   `json:"description"`
+	}
+	if err := decodeJSON(r, &request); err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	sub, err := s.Subscribe(request.URL, request.Description, request.Events)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, sub)
+}
+
+// handleDeleteWebhook serves DELETE /api/admin/webhooks/{id}
+func (s *Store) handleDeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "id", "webhook")
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	if err := s.Unsubscribe(id); err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleListDeliveries serves GET /api/admin/webhooks/{id}/deliveries
+func (s *Store) handleListDeliveries(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "id", "webhook")
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	deliveries, err := s.Deliveries(id)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, deliveries)
+}
+
+// handleRedeliver serves POST /api/admin/webhooks/deliveries/{id}/redeliver
+func (s *Store) handleRedeliver(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "id", "delivery")
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	delivery, err := s.Redeliver(id)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, delivery)
+}
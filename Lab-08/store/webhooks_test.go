@@ -0,0 +1,195 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// webhookReceiver records the webhooks it is sent. It fails the first
+// attempt at every delivery when failFirst is set, and every attempt when
+// failAll is.
+type webhookReceiver struct {
+	mu        sync.Mutex
+	failFirst bool
+	failAll   bool
+	seen      map[string]int // attempts per delivery ID
+	bodies    [][]byte
+	headers   []http.Header
+}
+
+func (rcv *webhookReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	rcv.mu.Lock()
+	defer rcv.mu.Unlock()
+
+	delivery := r.Header.Get(WebhookDeliveryHeader)
+	rcv.seen[delivery]++
+	rcv.bodies = append(rcv.bodies, body)
+	rcv.headers = append(rcv.headers, r.Header.Clone())
+	if rcv.failAll || (rcv.failFirst && rcv.seen[delivery] == 1) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// waitForDeliveries polls a subscription's deliveries until done accepts them
+func waitForDeliveries(t *testing.T, store *Store, subscriptionID int, done func([]*Delivery) bool) []*Delivery {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		deliveries, err := store.Deliveries(subscriptionID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if done(deliveries) {
+			return deliveries
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for deliveries, got %+v", deliveries)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// settled reports whether every delivery has stopped being attempted
+func settled(count int) func([]*Delivery) bool {
+	return func(deliveries []*Delivery) bool {
+		if len(deliveries) != count {
+			return false
+		}
+		for _, delivery := range deliveries {
+			if delivery.Status == DeliveryPending {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+func TestWebhookDelivery(t *testing.T) {
+	store := newTestStore()
+	store.InitializeCatalog()
+	store.webhooks.backoff = time.Millisecond
+	handler := store.Routes("../static")
+	defer store.Close()
+	key := staffKey(t, store, RoleAdmin)
+	receiver := &webhookReceiver{failFirst: true, seen: make(map[string]int)}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	rec := staffRequest(handler, http.MethodPost, "/api/admin/webhooks",
+		`{"url": "`+server.URL+`", "events": ["order.created", "stock.low"]}`, key)
+	var sub Subscription
+	json.NewDecoder(rec.Body).Decode(&sub)
+	if rec.Code != http.StatusCreated || sub.Secret == "" {
+		t.Fatalf("Expected a subscription with a secret, got %d %+v", rec.Code, sub)
+	}
+	if subs := store.Subscriptions(); len(subs) != 1 || subs[0].Secret != "" {
+		t.Errorf("Expected the listed subscription to hide its secret, got %+v", subs)
+	}
+
+	// Selling 6 of the 10 laptops leaves 4, under the threshold of 5
+	product, _ := store.GetProduct(2)
+	if _, err := store.CreateOrder(context.Background(), product, 6); err != nil {
+		t.Fatal(err)
+	}
+	deliveries := waitForDeliveries(t, store, sub.ID, settled(2))
+	for _, delivery := range deliveries {
+		if delivery.Status != DeliverySucceeded || len(delivery.Attempts) != 2 ||
+			delivery.Attempts[0].StatusCode != http.StatusServiceUnavailable || delivery.Attempts[1].StatusCode != http.StatusNoContent {
+			t.Errorf("Expected %s to succeed on its second attempt, got %+v", delivery.EventType, delivery)
+		}
+	}
+	if deliveries[0].EventType != EventStockLow || deliveries[1].EventType != EventOrderCreated {
+		t.Errorf("Expected stock.low after order.created, got %s and %s", deliveries[1].EventType, deliveries[0].EventType)
+	}
+
+	// Every request is signed with the subscription's secret
+	receiver.mu.Lock()
+	for i, body := range receiver.bodies {
+		header := receiver.headers[i]
+		if header.Get(WebhookSignatureHeader) != SignWebhook(sub.Secret, header.Get(WebhookTimestampHeader), body) {
+			t.Errorf("Expected a valid signature on %s", body)
+		}
+	}
+	receiver.mu.Unlock()
+	var event struct {
+		Type string `json:"type"`
+		Data struct {
+			ProductID int `json:"productId"`
+			Stock     int `json:"stock"`
+		} `json:"data"`
+	}
+	json.Unmarshal(deliveries[0].Payload, &event)
+	if event.Type != EventStockLow || event.Data.ProductID != 2 || event.Data.Stock != 4 {
+		t.Errorf("Unexpected stock.low event: %s", deliveries[0].Payload)
+	}
+
+	// A redelivery is one more attempt, marked as manual
+	rec = staffRequest(handler, http.MethodPost, "/api/admin/webhooks/deliveries/1/redeliver", "", key)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("Expected the redelivery to be accepted, got %d: %s", rec.Code, rec.Body.String())
+	}
+	deliveries = waitForDeliveries(t, store, sub.ID, func(deliveries []*Delivery) bool {
+		return len(deliveries[1].Attempts) == 3 && deliveries[1].Status != DeliveryPending
+	})
+	if attempt := deliveries[1].Attempts[2]; !attempt.Manual || attempt.StatusCode != http.StatusNoContent {
+		t.Errorf("Expected a manual attempt, got %+v", attempt)
+	}
+	if rec := staffRequest(handler, http.MethodPost, "/api/admin/webhooks/deliveries/9/redeliver", "", key); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected a missing delivery to be a 404, got %d", rec.Code)
+	}
+}
+
+func TestWebhookRetriesGiveUp(t *testing.T) {
+	store := newTestStore()
+	store.InitializeCatalog()
+	store.webhooks.backoff = time.Millisecond
+	store.webhooks.maxAttempts = 3
+	defer store.Close()
+	server := httptest.NewServer(&webhookReceiver{failAll: true, seen: make(map[string]int)})
+	defer server.Close()
+
+	sub, err := store.Subscribe(server.URL, "", []string{EventOrderStatusChanged})
+	if err != nil {
+		t.Fatal(err)
+	}
+	product, _ := store.GetProduct(1)
+	order, _ := store.CreateOrder(context.Background(), product, 1)
+	if _, err := store.CancelOrder(context.Background(), order.ID, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	deliveries := waitForDeliveries(t, store, sub.ID, settled(1))
+	delivery := deliveries[0]
+	if delivery.Status != DeliveryFailed || len(delivery.Attempts) != 3 || delivery.NextAttemptAt != nil {
+		t.Errorf("Expected the delivery to fail after 3 attempts, got %+v", delivery)
+	}
+	var event struct {
+		Data struct {
+			Order          Order  `json:"order"`
+			PreviousStatus string `json:"previousStatus"`
+		} `json:"data"`
+	}
+	json.Unmarshal(delivery.Payload, &event)
+	if event.Data.Order.Status != OrderCancelled || event.Data.PreviousStatus != OrderPending {
+		t.Errorf("Unexpected order.status_changed event: %s", delivery.Payload)
+	}
+
+	if _, err := store.Subscribe("not a url", "", []string{EventStockLow}); err != ErrInvalidWebhookURL {
+		t.Errorf("Expected an invalid URL to be rejected, got %v", err)
+	}
+	if err := store.Unsubscribe(sub.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Deliveries(sub.ID); err != ErrSubscriptionNotFound {
+		t.Errorf("Expected the subscription to be gone, got %v", err)
+	}
+}
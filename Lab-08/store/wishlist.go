@@ -0,0 +1,492 @@
+package store
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxNotifications is how many notifications a customer keeps; older ones
+// are dropped
+const maxNotifications = 50
+
+// Notification kinds
+const (
+	NotificationBackInStock = "back_in_stock"
+)
+
+// WishlistItem is a product a customer wants to buy later
+type WishlistItem struct {
+	ProductID int       `json:"productId"`
+	AddedAt   time.Time `json:"addedAt"`
+	Product   *Product  `json:"product,omitempty"` // filled in when listed
+}
+
+// SavedCart is a named cart a customer put aside to restore later
+type SavedCart struct {
+	ID      int             `json:"id"`
+	Name    string          `json:"name"`
+	Items   []SavedCartItem `json:"items"`
+	SavedAt time.Time       `json:"savedAt"`
+}
+
+// SavedCartItem is a product and quantity in a saved cart
+type SavedCartItem struct {
+	ProductID int `json:"productId"`
+	Quantity  int `json:"quantity"`
+}
+
+// UnavailableItem is a saved cart item that cannot go back in the cart
+type UnavailableItem struct {
+	ProductID int    `json:"productId"`
+	Quantity  int    `json:"quantity"`
+	Available int    `json:"available"`
+	Reason    string `json:"reason"` // "removed" or "insufficient_stock"
+}
+
+// RestoredCart is a saved cart turned back into cart items with live
+// product details
+type RestoredCart struct {
+	Name        string            `json:"name"`
+	Items       []CartItem        `json:"items"`
+	Unavailable []UnavailableItem `json:"unavailable"`
+}
+
+// Notification is a message for a customer, such as a wishlisted product
+// being back in stock
+type Notification struct {
+	ID        int       `json:"id"`
+	Kind      string    `json:"kind"`
+	Message   string    `json:"message"`
+	ProductID int       `json:"productId,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	Read      bool      `json:"read"`
+}
+
+// readCustomer runs fn on a customer's stored record. fn must not keep it.
+func (s *Store) readCustomer(customerID int, fn func(*Customer)) error {
+	s.authMu.Lock()
+	defer s.authMu.Unlock()
+	customer, ok := s.customers[customerID]
+	if !ok {
+		return ErrCustomerNotFound
+	}
+	fn(customer)
+	return nil
+}
+
+// updateCustomer runs fn on a customer's stored record and saves the
+// customers if fn succeeds. fn must not keep the record.
+func (s *Store) updateCustomer(customerID int, fn func(*Customer) error) error {
+	s.authMu.Lock()
+	defer s.authMu.Unlock()
+	customer, ok := s.customers[customerID]
+	if !ok {
+		return ErrCustomerNotFound
+	}
+	if err := fn(customer); err != nil {
+		return err
+	}
+	return s.saveCustomers()
+}
+
+// Wishlist returns a customer's wishlist, most recently added first, with
+// the live details of each product. Products since removed from the catalog
+// are left out.
+func (s *Store) Wishlist(customerID int) ([]WishlistItem, error) {
+	var items []WishlistItem
+	err := s.readCustomer(customerID, func(c *Customer) {
+		items = slices.Clone(c.Wishlist)
+	})
+	if err != nil {
+		return nil, err
+	}
+	listed := make([]WishlistItem, 0, len(items))
+	for i := len(items) - 1; i >= 0; i-- {
+		product, err := s.GetProduct(items[i].ProductID)
+		if err != nil {
+			continue
+		}
+		items[i].Product = product
+		listed = append(listed, items[i])
+	}
+	return listed, nil
+}
+
+// AddToWishlist adds a product to a customer's wishlist. Adding a product
+// that is already there leaves it as it was.
+func (s *Store) AddToWishlist(customerID, productID int) (*WishlistItem, error) {
+	product, err := s.GetProduct(productID)
+	if err != nil {
+		return nil, err
+	}
+	item := WishlistItem{ProductID: productID, AddedAt: time.Now()}
+	err = s.updateCustomer(customerID, func(c *Customer) error {
+		if i := slices.IndexFunc(c.Wishlist, func(w WishlistItem) bool { return w.ProductID == productID }); i >= 0 {
+			item = c.Wishlist[i]
+			return nil
+		}
+		c.Wishlist = append(c.Wishlist, item)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	item.Product = product
+	return &item, nil
+}
+
+// RemoveFromWishlist takes a product off a customer's wishlist
+func (s *Store) RemoveFromWishlist(customerID, productID int) error {
+	return s.updateCustomer(customerID, func(c *Customer) error {
+		i := slices.IndexFunc(c.Wishlist, func(w WishlistItem) bool { return w.ProductID == productID })
+		if i < 0 {
+			return ErrNotInWishlist
+		}
+		c.Wishlist = slices.Delete(c.Wishlist, i, i+1)
+		return nil
+	})
+}
+
+// MoveToCart takes a product off a customer's wishlist and returns it as a
+// cart item, as long as there is stock for the quantity. The cart itself
+// lives in the shopper's browser until checkout.
+func (s *Store) MoveToCart(customerID, productID, quantity int) (*CartItem, error) {
+	if quantity < 1 {
+		return nil, ErrInvalidQuantity
+	}
+	product, err := s.GetProduct(productID)
+	if err != nil {
+		return nil, err
+	}
+	if available := s.stockOf(product); available < quantity {
+		return nil, &InsufficientStockError{ProductID: productID, Requested: quantity, Available: available}
+	}
+	if err := s.RemoveFromWishlist(customerID, productID); err != nil {
+		return nil, err
+	}
+	return &CartItem{Product: product, Quantity: quantity}, nil
+}
+
+// stockOf reads a product's stock under the store lock
+func (s *Store) stockOf(product *Product) int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return product.Stock
+}
+
+// SavedCarts returns a customer's saved carts, most recently saved first
+func (s *Store) SavedCarts(customerID int) ([]SavedCart, error) {
+	var carts []SavedCart
+	err := s.readCustomer(customerID, func(c *Customer) {
+		carts = slices.Clone(c.SavedCarts)
+	})
+	slices.Reverse(carts)
+	return carts, err
+}
+
+// SaveCart saves a cart under a name. Saving under a name that is already
+// used replaces that cart, and the second result is false.
+func (s *Store) SaveCart(customerID int, name string, items []SavedCartItem) (*SavedCart, bool, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, false, fmt.Errorf("%w: a name is required", ErrInvalidSavedCart)
+	}
+	if len(items) == 0 {
+		return nil, false, fmt.Errorf("%w: it has no items", ErrInvalidSavedCart)
+	}
+	for _, item := range items {
+		if item.Quantity < 1 {
+			return nil, false, fmt.Errorf("%w: quantity of product %d must be at least 1", ErrInvalidSavedCart, item.ProductID)
+		}
+		if _, err := s.GetProduct(item.ProductID); err != nil {
+			return nil, false, err
+		}
+	}
+
+	cart := SavedCart{Name: name, Items: items, SavedAt: time.Now()}
+	created := true
+	err := s.updateCustomer(customerID, func(c *Customer) error {
+		for i, existing := range c.SavedCarts {
+			if strings.EqualFold(existing.Name, name) {
+				cart.ID, created = existing.ID, false
+				// Move it to the end, as the most recently saved
+				c.SavedCarts = slices.Delete(c.SavedCarts, i, i+1)
+				break
+			}
+		}
+		if created {
+			for _, existing := range c.SavedCarts {
+				cart.ID = max(cart.ID, existing.ID)
+			}
+			cart.ID++
+		}
+		c.SavedCarts = append(c.SavedCarts, cart)
+		return nil
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return &cart, created, nil
+}
+
+// DeleteSavedCart removes a customer's saved cart
+func (s *Store) DeleteSavedCart(customerID, cartID int) error {
+	return s.updateCustomer(customerID, func(c *Customer) error {
+		i := slices.IndexFunc(c.SavedCarts, func(cart SavedCart) bool { return cart.ID == cartID })
+		if i < 0 {
+			return ErrSavedCartNotFound
+		}
+		c.SavedCarts = slices.Delete(c.SavedCarts, i, i+1)
+		return nil
+	})
+}
+
+// RestoreCart turns a saved cart back into cart items with live product
+// details. Items whose product was removed, or that no longer have enough
+// stock, are listed as unavailable instead. The saved cart is kept.
+func (s *Store) RestoreCart(customerID, cartID int) (*RestoredCart, error) {
+	var cart SavedCart
+	found := false
+	err := s.readCustomer(customerID, func(c *Customer) {
+		i := slices.IndexFunc(c.SavedCarts, func(cart SavedCart) bool { return cart.ID == cartID })
+		if found = i >= 0; found {
+			cart = c.SavedCarts[i]
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, ErrSavedCartNotFound
+	}
+
+	restored := &RestoredCart{Name: cart.Name, Items: []CartItem{}, Unavailable: []UnavailableItem{}}
+	for _, item := range cart.Items {
+		product, err := s.GetProduct(item.ProductID)
+		if err != nil {
+			restored.Unavailable = append(restored.Unavailable, UnavailableItem{ProductID: item.ProductID, Quantity: item.Quantity, Reason: "removed"})
+			continue
+		}
+		if available := s.stockOf(product); available < item.Quantity {
+			restored.Unavailable = append(restored.Unavailable, UnavailableItem{
+				ProductID: item.ProductID, Quantity: item.Quantity, Available: available, Reason: "insufficient_stock"})
+			continue
+		}
+		restored.Items = append(restored.Items, CartItem{Product: product, Quantity: item.Quantity})
+	}
+	return restored, nil
+}
+
+// notify adds a notification for a customer, dropping the oldest beyond
+// maxNotifications. The caller must hold s.authMu and save the customers.
+func (s *Store) notify(customer *Customer, n Notification) {
+	for _, existing := range customer.Notifications {
+		n.ID = max(n.ID, existing.ID)
+	}
+	n.ID++
+	n.CreatedAt = time.Now()
+	customer.Notifications = append(customer.Notifications, n)
+	if extra := len(customer.Notifications) - maxNotifications; extra > 0 {
+		customer.Notifications = slices.Delete(customer.Notifications, 0, extra)
+	}
+	s.logger.Info("customer notified", "customerId", customer.ID, "kind", n.Kind, "productId", n.ProductID)
+}
+
+// notifyBackInStock tells every customer with the product on their
+// wishlist that it can be bought again
+func (s *Store) notifyBackInStock(productID int, name string) {
+	s.authMu.Lock()
+	defer s.authMu.Unlock()
+	notified := 0
+	for _, customer := range s.customers {
+		if !slices.ContainsFunc(customer.Wishlist, func(w WishlistItem) bool { return w.ProductID == productID }) {
+			continue
+		}
+		s.notify(customer, Notification{
+			Kind:      NotificationBackInStock,
+			Message:   name + " from your wishlist is back in stock",
+			ProductID: productID,
+		})
+		notified++
+	}
+	if notified == 0 {
+		return
+	}
+	if err := s.saveCustomers(); err != nil {
+		s.logger.Error("error saving notifications", "productId", productID, "error", err)
+	}
+}
+
+// Notifications returns a customer's notifications, newest first
+func (s *Store) Notifications(customerID int) ([]Notification, error) {
+	var notifications []Notification
+	err := s.readCustomer(customerID, func(c *Customer) {
+		notifications = slices.Clone(c.Notifications)
+	})
+	slices.Reverse(notifications)
+	return notifications, err
+}
+
+// MarkNotificationsRead marks all of a customer's notifications as read
+func (s *Store) MarkNotificationsRead(customerID int) error {
+	return s.updateCustomer(customerID, func(c *Customer) error {
+		for i := range c.Notifications {
+			c.Notifications[i].Read = true
+		}
+		return nil
+	})
+}
+
+// handleGetWishlist serves GET /api/me/wishlist
+func (s *Store) handleGetWishlist(w http.ResponseWriter, r *http.Request) {
+	items, err := s.Wishlist(CustomerFromContext(r.Context()).ID)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, items)
+}
+
+// handleAddToWishlist serves POST /api/me/wishlist
+func (s *Store) handleAddToWishlist(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		ProductID int `json:"productId"`
+	}
+	if err := decodeJSON(r, &request); err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	item, err := s.AddToWishlist(CustomerFromContext(r.Context()).ID, request.ProductID)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, item)
+}
+
+// handleRemoveFromWishlist serves DELETE /api/me/wishlist/{productId}
+func (s *Store) handleRemoveFromWishlist(w http.ResponseWriter, r *http.Request) {
+	productID, err := pathID(r, "productId", "product")
+	if err == nil {
+		err = s.RemoveFromWishlist(CustomerFromContext(r.Context()).ID, productID)
+	}
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleMoveToCart serves POST /api/me/wishlist/{productId}/cart?quantity=
+func (s *Store) handleMoveToCart(w http.ResponseWriter, r *http.Request) {
+	productID, err := pathID(r, "productId", "product")
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	quantity := 1
+	if value := r.URL.Query().Get("quantity"); value != "" {
+		if quantity, err = strconv.Atoi(value); err != nil {
+			s.writeError(w, r, invalidRequest("invalid quantity %q", value))
+			return
+		}
+	}
+	item, err := s.MoveToCart(CustomerFromContext(r.Context()).ID, productID, quantity)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, item)
+}
+
+// handleListSavedCarts serves GET /api/me/carts
+func (s *Store) handleListSavedCarts(w http.ResponseWriter, r *http.Request) {
+	carts, err := s.SavedCarts(CustomerFromContext(r.Context()).ID)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, append([]SavedCart{}, carts...))
+}
+
+// handleSaveCart serves POST /api/me/carts. The items are sent like a
+// checkout, so the web interface can save its cart as it is.
+func (s *Store) handleSaveCart(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Name  string     `json:"name"`
+		Items []CartItem `json:"items"`
+	}
+	if err := decodeJSON(r, &request); err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	items := make([]SavedCartItem, 0, len(request.Items))
+	for _, item := range request.Items {
+		if item.Product == nil {
+			s.writeError(w, r, invalidRequest("cart item is missing its product"))
+			return
+		}
+		items = append(items, SavedCartItem{ProductID: item.Product.ID, Quantity: item.Quantity})
+	}
+	cart, created, err := s.SaveCart(CustomerFromContext(r.Context()).ID, request.Name, items)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	writeJSON(w, status, cart)
+}
+
+// handleDeleteSavedCart serves DELETE /api/me/carts/{id}
+func (s *Store) handleDeleteSavedCart(w http.ResponseWriter, r *http.Request) {
+	cartID, err := pathID(r, "id", "cart")
+	if err == nil {
+		err = s.DeleteSavedCart(CustomerFromContext(r.Context()).ID, cartID)
+	}
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleRestoreCart serves POST /api/me/carts/{id}/restore
+func (s *Store) handleRestoreCart(w http.ResponseWriter, r *http.Request) {
+	cartID, err := pathID(r, "id", "cart")
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	restored, err := s.RestoreCart(CustomerFromContext(r.Context()).ID, cartID)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, restored)
+}
+
+// handleListNotifications serves GET /api/me/notifications
+func (s *Store) handleListNotifications(w http.ResponseWriter, r *http.Request) {
+	notifications, err := s.Notifications(CustomerFromContext(r.Context()).ID)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, append([]Notification{}, notifications...))
+}
+
+// handleMarkNotificationsRead serves POST /api/me/notifications/read
+func (s *Store) handleMarkNotificationsRead(w http.ResponseWriter, r *http.Request) {
+	if err := s.MarkNotificationsRead(CustomerFromContext(r.Context()).ID); err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
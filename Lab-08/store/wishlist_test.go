@@ -0,0 +1,111 @@
+package store
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestWishlist(t *testing.T) {
+	store := newTestStore()
+	store.InitializeCatalog()
+	handler := store.Routes("../static")
+	defer store.Close()
+	token := registerCustomer(t, store, "asha@example.com")
+	other := registerCustomer(t, store, "ravi@example.com")
+
+	for _, id := range []string{"2", "3", "2"} {
+		if rec := customerRequest(handler, http.MethodPost, "/api/me/wishlist", `{"productId": `+id+`}`, token); rec.Code != http.StatusCreated {
+			t.Fatalf("Expected product %s to be added, got %d: %s", id, rec.Code, rec.Body.String())
+		}
+	}
+	if rec := customerRequest(handler, http.MethodPost, "/api/me/wishlist", `{"productId": 99}`, token); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected an unknown product to be refused, got %d", rec.Code)
+	}
+	var items []WishlistItem
+	json.NewDecoder(customerRequest(handler, http.MethodGet, "/api/me/wishlist", "", token).Body).Decode(&items)
+	if len(items) != 2 || items[0].ProductID != 3 || items[1].Product == nil || items[1].Product.Name != "Laptop" {
+		t.Fatalf("Expected the T-Shirt then the Laptop, got %+v", items)
+	}
+
+	// Moving to the cart needs stock, and takes the product off the wishlist
+	if rec := customerRequest(handler, http.MethodPost, "/api/me/wishlist/3/cart?quantity=51", "", token); rec.Code != http.StatusConflict {
+		t.Errorf("Expected more than the stock to be refused, got %d", rec.Code)
+	}
+	rec := customerRequest(handler, http.MethodPost, "/api/me/wishlist/3/cart?quantity=2", "", token)
+	var item CartItem
+	json.NewDecoder(rec.Body).Decode(&item)
+	if rec.Code != http.StatusOK || item.Product.ID != 3 || item.Quantity != 2 {
+		t.Fatalf("Expected a cart item, got %d %+v", rec.Code, item)
+	}
+	if rec := customerRequest(handler, http.MethodDelete, "/api/me/wishlist/3", "", token); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected the moved product to be off the wishlist, got %d", rec.Code)
+	}
+
+	// Only customers wishing for a product are told it is back in stock
+	store.UpdateStock(2, 0)
+	store.UpdateStock(2, 5)
+	store.UpdateStock(2, 8)
+	var notifications []Notification
+	json.NewDecoder(customerRequest(handler, http.MethodGet, "/api/me/notifications", "", token).Body).Decode(&notifications)
+	if len(notifications) != 1 || notifications[0].Kind != NotificationBackInStock || notifications[0].ProductID != 2 || notifications[0].Read {
+		t.Fatalf("Expected one unread back in stock notification, got %+v", notifications)
+	}
+	json.NewDecoder(customerRequest(handler, http.MethodGet, "/api/me/notifications", "", other).Body).Decode(&notifications)
+	if len(notifications) != 0 {
+		t.Errorf("Expected no notifications for another customer, got %+v", notifications)
+	}
+	customerRequest(handler, http.MethodPost, "/api/me/notifications/read", "", token)
+	json.NewDecoder(customerRequest(handler, http.MethodGet, "/api/me/notifications", "", token).Body).Decode(&notifications)
+	if len(notifications) != 1 || !notifications[0].Read {
+		t.Errorf("Expected the notification to be read, got %+v", notifications)
+	}
+}
+
+func TestSavedCarts(t *testing.T) {
+	store := newTestStore()
+	store.InitializeCatalog()
+	handler := store.Routes("../static")
+	defer store.Close()
+	token := registerCustomer(t, store, "asha@example.com")
+
+	rec := customerRequest(handler, http.MethodPost, "/api/me/carts", `{"name": "Diwali", "items": [{"product": {"id": 1}, "quantity": 3}, {"product": {"id": 2}, "quantity": 1}]}`, token)
+	var cart SavedCart
+	json.NewDecoder(rec.Body).Decode(&cart)
+	if rec.Code != http.StatusCreated || cart.ID != 1 || len(cart.Items) != 2 {
+		t.Fatalf("Expected the cart to be saved, got %d %+v", rec.Code, cart)
+	}
+	for _, body := range []string{`{"name": "", "items": [{"product": {"id": 1}, "quantity": 1}]}`, `{"name": "Empty", "items": []}`} {
+		if rec := customerRequest(handler, http.MethodPost, "/api/me/carts", body, token); rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected %s to be refused, got %d", body, rec.Code)
+		}
+	}
+	customerRequest(handler, http.MethodPost, "/api/me/carts", `{"name": "Office", "items": [{"product": {"id": 3}, "quantity": 1}]}`, token)
+
+	// Saving under the same name replaces the cart
+	rec = customerRequest(handler, http.MethodPost, "/api/me/carts", `{"name": "diwali", "items": [{"product": {"id": 1}, "quantity": 3}, {"product": {"id": 2}, "quantity": 20}]}`, token)
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected the cart to be replaced, got %d", rec.Code)
+	}
+	var carts []SavedCart
+	json.NewDecoder(customerRequest(handler, http.MethodGet, "/api/me/carts", "", token).Body).Decode(&carts)
+	if len(carts) != 2 || carts[0].ID != 1 || carts[0].Items[1].Quantity != 20 {
+		t.Fatalf("Expected the replaced cart first, got %+v", carts)
+	}
+
+	// Restoring leaves out what can no longer be bought
+	rec = customerRequest(handler, http.MethodPost, "/api/me/carts/1/restore", "", token)
+	var restored RestoredCart
+	json.NewDecoder(rec.Body).Decode(&restored)
+	if rec.Code != http.StatusOK || len(restored.Items) != 1 || restored.Items[0].Quantity != 3 ||
+		len(restored.Unavailable) != 1 || restored.Unavailable[0].Reason != "insufficient_stock" || restored.Unavailable[0].Available != 10 {
+		t.Errorf("Expected the apples back and the laptops unavailable, got %d %+v", rec.Code, restored)
+	}
+
+	if rec := customerRequest(handler, http.MethodDelete, "/api/me/carts/1", "", token); rec.Code != http.StatusNoContent {
+		t.Fatalf("Expected the cart to be removed, got %d", rec.Code)
+	}
+	if rec := customerRequest(handler, http.MethodPost, "/api/me/carts/1/restore", "", token); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected a removed cart to be a 404, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,189 @@
+package store
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// startWorkerPool initializes a pool of workers to process orders concurrently
+func (s *Store) startWorkerPool() {
+	for i := 0; i < s.workerCount; i++ {
+		s.startWorker()
+	}
+}
+
+// startWorker adds a worker to the pool unless it is already full
+func (s *Store) startWorker() {
+	for {
+		active := atomic.LoadInt32(&s.activeWorkers)
+		if int(active) >= s.workerCount {
+			return
+		}
+		if atomic.CompareAndSwapInt32(&s.activeWorkers, active, active+1) {
+			break
+		}
+	}
+	workerID := int(atomic.AddInt32(&s.nextWorkerID, 1))
+	s.trackWorker(workerID)
+	s.workers.Add(1)
+	go s.runWorker(workerID)
+}
+
+// runWorker processes queued orders until the queue is closed. A worker that
+// sits idle for the idle timeout stops, but the last worker always stays.
+func (s *Store) runWorker(workerID int) {
+	defer s.workers.Done()
+	defer s.untrackWorker(workerID)
+
+	// A nil channel never fires, so without an idle timeout workers never stop
+	var idle <-chan time.Time
+	var idleTimeout *time.Timer
+	if s.idleTimeout > 0 {
+		idleTimeout = time.NewTimer(s.idleTimeout)
+		defer idleTimeout.Stop()
+		idle = idleTimeout.C
+	}
+
+	for {
+		select {
+		case order, ok := <-s.orderChan:
+			if !ok {
+				atomic.AddInt32(&s.activeWorkers, -1)
+				return
+			}
+			s.setWorkerOrder(workerID, order)
+			s.processOrderAsync(order, workerID)
+			s.setWorkerOrder(workerID, nil)
+			if idleTimeout != nil {
+				idleTimeout.Reset(s.idleTimeout)
+			}
+		case <-idle:
+			if s.retireWorker() {
+				s.logger.Debug("worker stopping", "worker", workerID, "idleFor", s.idleTimeout.String())
+				return
+			}
+			idleTimeout.Reset(s.idleTimeout)
+		}
+	}
+}
+
+// retireWorker takes an idle worker out of the pool unless it is the last one
+func (s *Store) retireWorker() bool {
+	for {
+		active := atomic.LoadInt32(&s.activeWorkers)
+		if active <= 1 {
+			return false
+		}
+		if atomic.CompareAndSwapInt32(&s.activeWorkers, active, active-1) {
+			return true
+		}
+	}
+}
+
+// ProcessOrder implements OrderProcessor interface by queueing the order for
+// the worker pool, starting another worker if orders are backing up. Orders
+// queued after Close are ignored.
+func (s *Store) ProcessOrder(order *Order) {
+	s.poolMu.RLock()
+	defer s.poolMu.RUnlock()
+
+	if s.closed {
+		return
+	}
+	s.orderChan <- order
+	if len(s.orderChan) > 0 {
+		s.startWorker()
+	}
+}
+
+// Close stops accepting orders and waits for the workers to finish the queue
+func (s *Store) Close() {
+	s.poolMu.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.orderChan)
+		close(s.stopExpiry)
+		if s.rateLimiter != nil {
+			s.rateLimiter.close()
+		}
+	}
+	s.poolMu.Unlock()
+
+	s.workers.Wait()
+	<-s.expiryDone
+	// The workers may have sent events until they stopped
+	s.closeWebhooks()
+	s.unlockDataDir()
+}
+
+// processOrderAsync handles order processing asynchronously. Every log line
+// carries the order ID and the ID of the request that placed the order.
+func (s *Store) processOrderAsync(order *Order, workerID int) {
+	s.metrics.busyWorkers.Add(1)
+	defer s.metrics.busyWorkers.Add(-1)
+
+	logger := s.orderLog(order).With("worker", workerID)
+
+	// Skip orders cancelled while they waited in the queue. The product is
+	// read under the lock since it can be edited while the order is packed.
+	s.mu.RLock()
+	status := order.Status
+	name, category := order.Product.Name, order.Product.Category
+	s.mu.RUnlock()
+	if status != OrderPaid {
+		logger.Info("order skipped", "status", status)
+		return
+	}
+	logger.Info("processing order", "product", name, "category", category)
+
+	if order.Quantity > 0 {
+		logger.Debug("product is in stock and ready for quick delivery")
+	} else {
+		logger.Warn("product is out of stock, restocking soon")
+	}
+
+	for i := 0; i < order.Quantity; i++ {
+		logger.Debug("packing item", "item", i+1)
+	}
+
+	switch category {
+	case "Grocery":
+		logger.Debug("grocery item is perishable and needs fast delivery")
+	case "Electronics":
+		logger.Debug("electronic item needs safe packaging")
+	case "Fashion":
+		logger.Debug("fashion item needs speed and presentation")
+	default:
+		logger.Warn("unknown category, classify properly for quick commerce")
+	}
+
+	// Collect the payment before the order goes out
+	if err := s.capturePayment(order); err != nil {
+		logger.Error("error capturing payment", "error", err)
+		s.metrics.ordersFailed.Add(1)
+		return
+	}
+
+	s.mu.Lock()
+	// The order may have been cancelled, and its payment refunded, while the
+	// payment was captured
+	if status := order.Status; status != OrderPaid {
+		s.mu.Unlock()
+		logger.Info("order skipped", "status", status)
+		return
+	}
+	order.Status = OrderProcessed
+	err := s.saveOrders()
+	if err == nil {
+		s.orderStatusChanged(order, OrderPaid)
+	}
+	s.mu.Unlock()
+	if err != nil {
+		logger.Error("error saving order", "error", err)
+		s.metrics.ordersFailed.Add(1)
+		return
+	}
+	s.metrics.ordersProcessed.Add(1)
+
+	logger.Info("order ready for dispatch")
+}
@@ -38,6 +38,7 @@ type Product struct {
     Category string  `json:"category"`
     Price    float64 `json:"price"`
     Stock    int     `json:"stock"`
+    Image    string  `json:"image"`
 }
 
 // Order struct to store order details